@@ -10,7 +10,7 @@ fi
 
 version=$1
 
-for submod in awss3v1 awss3v2 examples
+for submod in awss3v1 awss3v2 examples s3iototel s3iotprom s3iotfsnotify cmd/s3iot
 do
   sed -i "s|\(\s*github.com/at-wat/s3iot\) v.*|\1 ${version}|" ${submod}/go.mod
   sed -i '/^github.com\/at-wat\/s3iot/d' ${submod}/go.sum
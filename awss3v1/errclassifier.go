@@ -15,25 +15,48 @@
 package awss3v1
 
 import (
+	"errors"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
+
+	"github.com/at-wat/s3iot"
 )
 
 // ErrorClassifier classifies aws-sdk-go (v1) errors.
+//
+// If the error response has Retry-After header, the error is classified as
+// throttle and the requested wait is used instead of ThrottleWait.
+// The wait is capped by MaxThrottleWait.
+//
+// Error responses with 5xx status except 501 Not Implemented are retryable
+// as the default retryer of aws-sdk-go does.
 type ErrorClassifier struct {
-	ThrottleWait time.Duration
+	ThrottleWait    time.Duration
+	MaxThrottleWait time.Duration
 }
 
 // DefaultThrottleWait is a default wait duration on throttle.
 var DefaultThrottleWait = 5 * time.Second
 
+// DefaultMaxThrottleWait is a default upper limit of the wait duration
+// requested by Retry-After header.
+var DefaultMaxThrottleWait = time.Minute
+
 // IsRetryable implements ErrorClassifier.
-func (ErrorClassifier) IsRetryable(err error) bool {
+func (c ErrorClassifier) IsRetryable(err error) bool {
 	if request.IsErrorRetryable(err) || request.IsErrorThrottle(err) {
 		return true
 	}
+	if _, ok := c.IsThrottle(err); ok {
+		return true
+	}
+	if status, ok := c.HTTPStatus(err); ok && status >= 500 && status != http.StatusNotImplemented {
+		return true
+	}
 	// Workaround https://github.com/aws/aws-sdk-go/issues/3971
 	if strings.Contains(err.Error(), "read: connection reset") {
 		return true
@@ -43,12 +66,84 @@ func (ErrorClassifier) IsRetryable(err error) bool {
 
 // IsThrottle implements ErrorClassifier.
 func (c ErrorClassifier) IsThrottle(err error) (time.Duration, bool) {
-	if !request.IsErrorThrottle(err) {
+	return c.IsThrottleAt(err, time.Now())
+}
+
+// IsThrottleAt implements s3iot.ThrottleAtClassifier.
+func (c ErrorClassifier) IsThrottleAt(err error, now time.Time) (time.Duration, bool) {
+	var re *retryAfterError
+	if errors.As(err, &re) {
+		if wait, ok := s3iot.ParseRetryAfter(re.retryAfter, now); ok {
+			limit := c.MaxThrottleWait
+			if limit == 0 {
+				limit = DefaultMaxThrottleWait
+			}
+			if wait > limit {
+				wait = limit
+			}
+			return wait, true
+		}
+	}
+	if !request.IsErrorThrottle(err) && !isThrottleResponse(err) {
 		return 0, false
 	}
 	wait := c.ThrottleWait
 	if wait == 0 {
 		wait = DefaultThrottleWait
 	}
-	return wait, request.IsErrorThrottle(err)
+	return wait, true
+}
+
+// HTTPStatus implements s3iot.HTTPStatusClassifier.
+func (ErrorClassifier) HTTPStatus(err error) (int, bool) {
+	var rf awserr.RequestFailure
+	if errors.As(err, &rf) && rf.StatusCode() != 0 {
+		return rf.StatusCode(), true
+	}
+	return 0, false
+}
+
+// isThrottleResponse checks S3 specific throttle responses
+// which are not covered by request.IsErrorThrottle.
+func isThrottleResponse(err error) bool {
+	var ae awserr.Error
+	if errors.As(err, &ae) && ae.Code() == "SlowDown" {
+		return true
+	}
+	var rf awserr.RequestFailure
+	return errors.As(err, &rf) && rf.StatusCode() == http.StatusTooManyRequests
+}
+
+// retryAfterError holds Retry-After header of the error response.
+type retryAfterError struct {
+	awserr.RequestFailure
+	retryAfter string
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.RequestFailure
+}
+
+// storeRequest returns request.Option to store the request
+// to access the response after the API call.
+func storeRequest(req **request.Request) request.Option {
+	return func(r *request.Request) {
+		*req = r
+	}
+}
+
+// withRetryAfter wraps the error to hold Retry-After header of the response.
+func withRetryAfter(err error, req *request.Request) error {
+	if req == nil || req.HTTPResponse == nil {
+		return err
+	}
+	retryAfter := req.HTTPResponse.Header.Get("Retry-After")
+	if retryAfter == "" {
+		return err
+	}
+	rf, ok := err.(awserr.RequestFailure)
+	if !ok {
+		return err
+	}
+	return &retryAfterError{RequestFailure: rf, retryAfter: retryAfter}
 }
@@ -17,6 +17,7 @@ package awss3v1
 import (
 	"errors"
 	"net"
+	"net/http"
 	"testing"
 	"time"
 
@@ -62,6 +63,7 @@ func TestErrorClassifier(t *testing.T) {
 		retryable bool
 		throttle  bool
 		wait      time.Duration
+		status    int
 	}{
 		"Unknown": {
 			err:       errors.New("an error"),
@@ -80,6 +82,49 @@ func TestErrorClassifier(t *testing.T) {
 			throttle:  true,
 			wait:      DefaultThrottleWait,
 		},
+		"AWSInternalError": {
+			err:       awserr.NewRequestFailure(awserr.New("InternalError", "dummy", nil), 500, "id"),
+			retryable: true,
+			status:    500,
+		},
+		"AWSNotImplemented": {
+			err:    awserr.NewRequestFailure(awserr.New("NotImplemented", "dummy", nil), 501, "id"),
+			status: 501,
+		},
+		"AWSSlowDown": {
+			err:       awserr.NewRequestFailure(awserr.New("SlowDown", "dummy", nil), 503, "id"),
+			retryable: true,
+			throttle:  true,
+			wait:      DefaultThrottleWait,
+			status:    503,
+		},
+		"AWSTooManyRequests": {
+			err:       awserr.NewRequestFailure(awserr.New("Dummy", "dummy", nil), 429, "id"),
+			retryable: true,
+			throttle:  true,
+			wait:      DefaultThrottleWait,
+			status:    429,
+		},
+		"AWSRetryAfter": {
+			err: &retryAfterError{
+				RequestFailure: awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "dummy", nil), 503, "id"),
+				retryAfter:     "10",
+			},
+			retryable: true,
+			throttle:  true,
+			wait:      10 * time.Second,
+			status:    503,
+		},
+		"AWSRetryAfterCapped": {
+			err: &retryAfterError{
+				RequestFailure: awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "dummy", nil), 503, "id"),
+				retryAfter:     "3600",
+			},
+			retryable: true,
+			throttle:  true,
+			wait:      DefaultMaxThrottleWait,
+			status:    503,
+		},
 		"AWSConnRefused": {
 			err:       errConnRefused,
 			retryable: true,
@@ -106,6 +151,27 @@ func TestErrorClassifier(t *testing.T) {
 			if wait != tt.wait {
 				t.Errorf("Expected wait for '%v': %v, got: %v", tt.err, tt.wait, wait)
 			}
+			status, ok := ec.HTTPStatus(tt.err)
+			if status != tt.status || ok != (tt.status != 0) {
+				t.Errorf("Expected HTTP status for '%v': %d, got: %d", tt.err, tt.status, status)
+			}
 		})
 	}
 }
+
+func TestErrorClassifierThrottleAt(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	ec := &ErrorClassifier{}
+
+	err := &retryAfterError{
+		RequestFailure: awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "dummy", nil), 503, "id"),
+		retryAfter:     now.Add(30 * time.Second).Format(http.TimeFormat),
+	}
+	wait, ok := ec.IsThrottleAt(err, now)
+	if !ok {
+		t.Fatal("Retry-After must be classified as throttle")
+	}
+	if wait != 30*time.Second {
+		t.Errorf("Expected wait: %v, got: %v", 30*time.Second, wait)
+	}
+}
@@ -54,4 +54,14 @@ func TestNew(t *testing.T) {
 			t.Errorf("Base API is expected to be *s3.S3, actually %T", d.API.(*wrapper).api)
 		}
 	})
+	t.Run("NewCopier", func(t *testing.T) {
+		c := NewCopier(sess, s3iot.UpDownloaderOptionFn(func(u *s3iot.UpDownloaderBase) {
+			if _, ok := u.API.(*wrapper).api.(*s3.S3); !ok {
+				t.Errorf("Base API is expected to be *s3.S3, actually %T", u.API.(*wrapper).api)
+			}
+		}))
+		if _, ok := c.API.(*wrapper).api.(*s3.S3); !ok {
+			t.Errorf("Base API is expected to be *s3.S3, actually %T", c.API.(*wrapper).api)
+		}
+	})
 }
@@ -55,6 +55,20 @@ func NewDownloader(c client.ConfigProvider, opts ...s3iot.DownloaderOption) *s3i
 	return d
 }
 
+// NewCopier creates s3iot.Copier from aws-sdk-go ConfigProvider (like Session).
+func NewCopier(c client.ConfigProvider, opts ...s3iot.CopierOption) *s3iot.Copier {
+	cp := &s3iot.Copier{
+		UpDownloaderBase: s3iot.UpDownloaderBase{
+			API:             NewAPI(s3.New(c)),
+			ErrorClassifier: &ErrorClassifier{},
+		},
+	}
+	for _, opt := range opts {
+		opt.ApplyToCopier(cp)
+	}
+	return cp
+}
+
 // NewAPI wraps s3iface.S3API to s3api.S3API.
 func NewAPI(api s3iface.S3API) s3api.S3API {
 	return &wrapper{api: api}
@@ -74,12 +88,10 @@ func (w *wrapper) PutObject(ctx context.Context, input *s3api.PutObjectInput) (*
 			ACL:         input.ACL,
 			Body:        input.Body,
 			ContentType: input.ContentType,
-		}, func(r *request.Request) {
-			req = r
-		},
+		}, storeRequest(&req),
 	)
 	if err != nil {
-		return nil, err
+		return nil, withRetryAfter(err, req)
 	}
 	u := *req.HTTPResponse.Request.URL
 	u.RawQuery = ""
@@ -92,6 +104,7 @@ func (w *wrapper) PutObject(ctx context.Context, input *s3api.PutObjectInput) (*
 }
 
 func (w *wrapper) GetObject(ctx context.Context, input *s3api.GetObjectInput) (*s3api.GetObjectOutput, error) {
+	var req *request.Request
 	out, err := w.api.GetObjectWithContext(
 		aws.Context(ctx),
 		&s3.GetObjectInput{
@@ -99,9 +112,9 @@ func (w *wrapper) GetObject(ctx context.Context, input *s3api.GetObjectInput) (*
 			Key:       input.Key,
 			Range:     input.Range,
 			VersionId: input.VersionID,
-		})
+		}, storeRequest(&req))
 	if err != nil {
-		return nil, err
+		return nil, withRetryAfter(err, req)
 	}
 	return &s3api.GetObjectOutput{
 		Body:          out.Body,
@@ -114,17 +127,54 @@ func (w *wrapper) GetObject(ctx context.Context, input *s3api.GetObjectInput) (*
 	}, nil
 }
 
+func (w *wrapper) HeadObject(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+	var req *request.Request
+	out, err := w.api.HeadObjectWithContext(
+		aws.Context(ctx),
+		&s3.HeadObjectInput{
+			Bucket:       input.Bucket,
+			Key:          input.Key,
+			VersionId:    input.VersionID,
+			ChecksumMode: input.ChecksumMode,
+		}, storeRequest(&req))
+	if err != nil {
+		return nil, withRetryAfter(err, req)
+	}
+	var metadata map[string]string
+	if out.Metadata != nil {
+		metadata = aws.StringValueMap(out.Metadata)
+	}
+	return &s3api.HeadObjectOutput{
+		ContentLength:  out.ContentLength,
+		ContentType:    out.ContentType,
+		ETag:           out.ETag,
+		LastModified:   out.LastModified,
+		VersionID:      out.VersionId,
+		Metadata:       metadata,
+		PartsCount:     out.PartsCount,
+		StorageClass:   out.StorageClass,
+		ChecksumCRC32:  out.ChecksumCRC32,
+		ChecksumCRC32C: out.ChecksumCRC32C,
+		ChecksumSHA1:   out.ChecksumSHA1,
+		ChecksumSHA256: out.ChecksumSHA256,
+		Restore:        out.Restore,
+	}, nil
+}
+
 func (w *wrapper) CreateMultipartUpload(ctx context.Context, input *s3api.CreateMultipartUploadInput) (*s3api.CreateMultipartUploadOutput, error) {
+	var req *request.Request
 	out, err := w.api.CreateMultipartUploadWithContext(
 		aws.Context(ctx),
 		&s3.CreateMultipartUploadInput{
-			Bucket:      input.Bucket,
-			Key:         input.Key,
-			ACL:         input.ACL,
-			ContentType: input.ContentType,
-		})
+			Bucket:       input.Bucket,
+			Key:          input.Key,
+			ACL:          input.ACL,
+			ContentType:  input.ContentType,
+			Metadata:     aws.StringMap(input.Metadata),
+			StorageClass: input.StorageClass,
+		}, storeRequest(&req))
 	if err != nil {
-		return nil, err
+		return nil, withRetryAfter(err, req)
 	}
 	return &s3api.CreateMultipartUploadOutput{
 		UploadID: out.UploadId,
@@ -139,6 +189,7 @@ func (w *wrapper) CompleteMultipartUpload(ctx context.Context, input *s3api.Comp
 			PartNumber: part.PartNumber,
 		})
 	}
+	var req *request.Request
 	out, err := w.api.CompleteMultipartUploadWithContext(
 		aws.Context(ctx),
 		&s3.CompleteMultipartUploadInput{
@@ -148,9 +199,9 @@ func (w *wrapper) CompleteMultipartUpload(ctx context.Context, input *s3api.Comp
 				Parts: parts,
 			},
 			UploadId: input.UploadID,
-		})
+		}, storeRequest(&req))
 	if err != nil {
-		return nil, err
+		return nil, withRetryAfter(err, req)
 	}
 	return &s3api.CompleteMultipartUploadOutput{
 		VersionID: out.VersionId,
@@ -160,20 +211,22 @@ func (w *wrapper) CompleteMultipartUpload(ctx context.Context, input *s3api.Comp
 }
 
 func (w *wrapper) AbortMultipartUpload(ctx context.Context, input *s3api.AbortMultipartUploadInput) (*s3api.AbortMultipartUploadOutput, error) {
+	var req *request.Request
 	_, err := w.api.AbortMultipartUploadWithContext(
 		aws.Context(ctx),
 		&s3.AbortMultipartUploadInput{
 			Bucket:   input.Bucket,
 			Key:      input.Key,
 			UploadId: input.UploadID,
-		})
+		}, storeRequest(&req))
 	if err != nil {
-		return nil, err
+		return nil, withRetryAfter(err, req)
 	}
 	return &s3api.AbortMultipartUploadOutput{}, nil
 }
 
 func (w *wrapper) UploadPart(ctx context.Context, input *s3api.UploadPartInput) (*s3api.UploadPartOutput, error) {
+	var req *request.Request
 	out, err := w.api.UploadPartWithContext(
 		aws.Context(ctx),
 		&s3.UploadPartInput{
@@ -182,25 +235,76 @@ func (w *wrapper) UploadPart(ctx context.Context, input *s3api.UploadPartInput)
 			Key:        input.Key,
 			PartNumber: input.PartNumber,
 			UploadId:   input.UploadID,
-		})
+		}, storeRequest(&req))
 	if err != nil {
-		return nil, err
+		return nil, withRetryAfter(err, req)
 	}
 	return &s3api.UploadPartOutput{
 		ETag: out.ETag,
 	}, nil
 }
 
+func (w *wrapper) CopyObject(ctx context.Context, input *s3api.CopyObjectInput) (*s3api.CopyObjectOutput, error) {
+	var req *request.Request
+	out, err := w.api.CopyObjectWithContext(
+		aws.Context(ctx),
+		&s3.CopyObjectInput{
+			Bucket:            input.Bucket,
+			Key:               input.Key,
+			ACL:               input.ACL,
+			CopySource:        aws.String(s3api.CopySource(input.SourceBucket, input.SourceKey, input.SourceVersionID)),
+			CopySourceIfMatch: input.SourceIfMatch,
+			StorageClass:      input.StorageClass,
+		}, storeRequest(&req))
+	if err != nil {
+		return nil, withRetryAfter(err, req)
+	}
+	var etag *string
+	if out.CopyObjectResult != nil {
+		etag = out.CopyObjectResult.ETag
+	}
+	return &s3api.CopyObjectOutput{
+		VersionID: out.VersionId,
+		ETag:      etag,
+	}, nil
+}
+
+func (w *wrapper) UploadPartCopy(ctx context.Context, input *s3api.UploadPartCopyInput) (*s3api.UploadPartCopyOutput, error) {
+	var req *request.Request
+	out, err := w.api.UploadPartCopyWithContext(
+		aws.Context(ctx),
+		&s3.UploadPartCopyInput{
+			Bucket:            input.Bucket,
+			Key:               input.Key,
+			PartNumber:        input.PartNumber,
+			UploadId:          input.UploadID,
+			CopySource:        aws.String(s3api.CopySource(input.SourceBucket, input.SourceKey, input.SourceVersionID)),
+			CopySourceIfMatch: input.SourceIfMatch,
+			CopySourceRange:   input.SourceRange,
+		}, storeRequest(&req))
+	if err != nil {
+		return nil, withRetryAfter(err, req)
+	}
+	var etag *string
+	if out.CopyPartResult != nil {
+		etag = out.CopyPartResult.ETag
+	}
+	return &s3api.UploadPartCopyOutput{
+		ETag: etag,
+	}, nil
+}
+
 func (w *wrapper) DeleteObject(ctx context.Context, input *s3api.DeleteObjectInput) (*s3api.DeleteObjectOutput, error) {
+	var req *request.Request
 	out, err := w.api.DeleteObjectWithContext(
 		aws.Context(ctx),
 		&s3.DeleteObjectInput{
 			Bucket:    input.Bucket,
 			Key:       input.Key,
 			VersionId: input.VersionID,
-		})
+		}, storeRequest(&req))
 	if err != nil {
-		return nil, err
+		return nil, withRetryAfter(err, req)
 	}
 	return &s3api.DeleteObjectOutput{
 		VersionID: out.VersionId,
@@ -208,16 +312,21 @@ func (w *wrapper) DeleteObject(ctx context.Context, input *s3api.DeleteObjectInp
 }
 
 func (w *wrapper) ListObjectsV2(ctx context.Context, input *s3api.ListObjectsV2Input) (*s3api.ListObjectsV2Output, error) {
+	var maxKeys *int64
+	if input.MaxKeys > 0 {
+		maxKeys = aws.Int64(int64(input.MaxKeys))
+	}
+	var req *request.Request
 	out, err := w.api.ListObjectsV2WithContext(
 		aws.Context(ctx),
 		&s3.ListObjectsV2Input{
 			Bucket:            input.Bucket,
 			ContinuationToken: input.ContinuationToken,
-			MaxKeys:           aws.Int64(int64(input.MaxKeys)),
+			MaxKeys:           maxKeys,
 			Prefix:            input.Prefix,
-		})
+		}, storeRequest(&req))
 	if err != nil {
-		return nil, err
+		return nil, withRetryAfter(err, req)
 	}
 	contents := make([]s3api.Object, len(out.Contents))
 	for i, c := range out.Contents {
@@ -262,6 +262,144 @@ func TestWrapper(t *testing.T) {
 			}
 			expectStringPtr(t, "ETag", out.ETag)
 		})
+		t.Run("HeadObject", func(t *testing.T) {
+			api := &mock_s3iface.MockS3API{
+				HeadObjectWithContextFunc: func(ctx context.Context, input *s3.HeadObjectInput, options ...request.Option) (*s3.HeadObjectOutput, error) {
+					expectStringPtr(t, "Bucket", input.Bucket)
+					expectStringPtr(t, "Key", input.Key)
+					expectStringPtr(t, "VersionID", input.VersionId)
+					expectStringPtr(t, "ENABLED", input.ChecksumMode)
+					return &s3.HeadObjectOutput{
+						ContentLength:  aws.Int64(100),
+						ContentType:    aws.String("ContentType"),
+						ETag:           aws.String("ETag"),
+						LastModified:   aws.Time(time.Unix(1, 2)),
+						VersionId:      aws.String("VersionID"),
+						Metadata:       map[string]*string{"Key": aws.String("Value")},
+						PartsCount:     aws.Int64(3),
+						StorageClass:   aws.String("StorageClass"),
+						ChecksumCRC32:  aws.String("CRC32"),
+						ChecksumCRC32C: aws.String("CRC32C"),
+						ChecksumSHA1:   aws.String("SHA1"),
+						ChecksumSHA256: aws.String("SHA256"),
+						Restore:        aws.String("Restore"),
+					}, nil
+				},
+			}
+			w := NewAPI(api)
+			out, err := w.HeadObject(context.TODO(),
+				&s3api.HeadObjectInput{
+					Bucket:       aws.String("Bucket"),
+					Key:          aws.String("Key"),
+					VersionID:    aws.String("VersionID"),
+					ChecksumMode: aws.String(s3api.ChecksumModeEnabled),
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(api.HeadObjectWithContextCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+			if *out.ContentLength != 100 {
+				t.Error("ContentLength differs")
+			}
+			expectStringPtr(t, "ContentType", out.ContentType)
+			expectStringPtr(t, "ETag", out.ETag)
+			if !out.LastModified.Equal(time.Unix(1, 2)) {
+				t.Error("LastModified differs")
+			}
+			expectStringPtr(t, "VersionID", out.VersionID)
+			if !reflect.DeepEqual(map[string]string{"Key": "Value"}, out.Metadata) {
+				t.Errorf("Expected Metadata: Key=Value, got: %v", out.Metadata)
+			}
+			if *out.PartsCount != 3 {
+				t.Error("PartsCount differs")
+			}
+			expectStringPtr(t, "StorageClass", out.StorageClass)
+			expectStringPtr(t, "CRC32", out.ChecksumCRC32)
+			expectStringPtr(t, "CRC32C", out.ChecksumCRC32C)
+			expectStringPtr(t, "SHA1", out.ChecksumSHA1)
+			expectStringPtr(t, "SHA256", out.ChecksumSHA256)
+			expectStringPtr(t, "Restore", out.Restore)
+		})
+		t.Run("CopyObject", func(t *testing.T) {
+			api := &mock_s3iface.MockS3API{
+				CopyObjectWithContextFunc: func(ctx context.Context, input *s3.CopyObjectInput, options ...request.Option) (*s3.CopyObjectOutput, error) {
+					expectStringPtr(t, "Bucket", input.Bucket)
+					expectStringPtr(t, "Key", input.Key)
+					expectStringPtr(t, "ACL", input.ACL)
+					expectStringPtr(t, "SrcBucket/Src%20Dir/Key?versionId=Version%2B1", input.CopySource)
+					expectStringPtr(t, "SrcETag", input.CopySourceIfMatch)
+					return &s3.CopyObjectOutput{
+						VersionId: aws.String("VersionID"),
+						CopyObjectResult: &s3.CopyObjectResult{
+							ETag: aws.String("ETag"),
+						},
+					}, nil
+				},
+			}
+			w := NewAPI(api)
+			out, err := w.CopyObject(context.TODO(),
+				&s3api.CopyObjectInput{
+					Bucket:          aws.String("Bucket"),
+					Key:             aws.String("Key"),
+					ACL:             aws.String("ACL"),
+					SourceBucket:    aws.String("SrcBucket"),
+					SourceKey:       aws.String("Src Dir/Key"),
+					SourceVersionID: aws.String("Version+1"),
+					SourceIfMatch:   aws.String("SrcETag"),
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(api.CopyObjectWithContextCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+			expectStringPtr(t, "VersionID", out.VersionID)
+			expectStringPtr(t, "ETag", out.ETag)
+		})
+		t.Run("UploadPartCopy", func(t *testing.T) {
+			api := &mock_s3iface.MockS3API{
+				UploadPartCopyWithContextFunc: func(ctx context.Context, input *s3.UploadPartCopyInput, options ...request.Option) (*s3.UploadPartCopyOutput, error) {
+					expectStringPtr(t, "Bucket", input.Bucket)
+					expectStringPtr(t, "Key", input.Key)
+					expectStringPtr(t, "UploadID", input.UploadId)
+					if *input.PartNumber != 10 {
+						t.Errorf("Expected PartNumber: 10, got: %d", *input.PartNumber)
+					}
+					expectStringPtr(t, "SrcBucket/SrcKey", input.CopySource)
+					expectStringPtr(t, "SrcETag", input.CopySourceIfMatch)
+					expectStringPtr(t, "bytes=0-99", input.CopySourceRange)
+					return &s3.UploadPartCopyOutput{
+						CopyPartResult: &s3.CopyPartResult{
+							ETag: aws.String("ETag"),
+						},
+					}, nil
+				},
+			}
+			w := NewAPI(api)
+			out, err := w.UploadPartCopy(context.TODO(),
+				&s3api.UploadPartCopyInput{
+					Bucket:        aws.String("Bucket"),
+					Key:           aws.String("Key"),
+					PartNumber:    aws.Int64(10),
+					UploadID:      aws.String("UploadID"),
+					SourceBucket:  aws.String("SrcBucket"),
+					SourceKey:     aws.String("SrcKey"),
+					SourceIfMatch: aws.String("SrcETag"),
+					SourceRange:   aws.String("bytes=0-99"),
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(api.UploadPartCopyWithContextCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+			expectStringPtr(t, "ETag", out.ETag)
+		})
 		t.Run("DeleteObject", func(t *testing.T) {
 			api := &mock_s3iface.MockS3API{
 				DeleteObjectWithContextFunc: func(ctx context.Context, input *s3.DeleteObjectInput, options ...request.Option) (*s3.DeleteObjectOutput, error) {
@@ -437,6 +575,48 @@ func TestWrapper(t *testing.T) {
 				t.Errorf("Expected calls: 1, actual: %d", n)
 			}
 		})
+		t.Run("HeadObject", func(t *testing.T) {
+			api := &mock_s3iface.MockS3API{
+				HeadObjectWithContextFunc: func(ctx context.Context, input *s3.HeadObjectInput, options ...request.Option) (*s3.HeadObjectOutput, error) {
+					return nil, errDummy
+				},
+			}
+			w := NewAPI(api)
+			if _, err := w.HeadObject(context.TODO(), &s3api.HeadObjectInput{}); err != errDummy {
+				t.Fatal("Expected error")
+			}
+			if n := len(api.HeadObjectWithContextCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+		})
+		t.Run("CopyObject", func(t *testing.T) {
+			api := &mock_s3iface.MockS3API{
+				CopyObjectWithContextFunc: func(ctx context.Context, input *s3.CopyObjectInput, options ...request.Option) (*s3.CopyObjectOutput, error) {
+					return nil, errDummy
+				},
+			}
+			w := NewAPI(api)
+			if _, err := w.CopyObject(context.TODO(), &s3api.CopyObjectInput{}); err != errDummy {
+				t.Fatal("Expected error")
+			}
+			if n := len(api.CopyObjectWithContextCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+		})
+		t.Run("UploadPartCopy", func(t *testing.T) {
+			api := &mock_s3iface.MockS3API{
+				UploadPartCopyWithContextFunc: func(ctx context.Context, input *s3.UploadPartCopyInput, options ...request.Option) (*s3.UploadPartCopyOutput, error) {
+					return nil, errDummy
+				},
+			}
+			w := NewAPI(api)
+			if _, err := w.UploadPartCopy(context.TODO(), &s3api.UploadPartCopyInput{}); err != errDummy {
+				t.Fatal("Expected error")
+			}
+			if n := len(api.UploadPartCopyWithContextCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+		})
 		t.Run("DeleteObject", func(t *testing.T) {
 			api := &mock_s3iface.MockS3API{
 				DeleteObjectWithContextFunc: func(ctx context.Context, input *s3.DeleteObjectInput, options ...request.Option) (*s3.DeleteObjectOutput, error) {
@@ -53,6 +53,19 @@ func NewDownloader(c aws.Config, opts ...s3iot.DownloaderOption) *s3iot.Download
 	return u
 }
 
+// NewCopier creates s3iot.Copier from aws-sdk-go-v2 Config.
+func NewCopier(c aws.Config, opts ...s3iot.CopierOption) *s3iot.Copier {
+	cp := &s3iot.Copier{
+		UpDownloaderBase: s3iot.UpDownloaderBase{
+			API: NewAPI(s3.NewFromConfig(c)),
+		},
+	}
+	for _, opt := range opts {
+		opt.ApplyToCopier(cp)
+	}
+	return cp
+}
+
 // NewAPI wraps s3.Client to s3api.S3API.
 func NewAPI(api S3API) s3api.S3API {
 	return &wrapper{api: api}
@@ -114,18 +127,65 @@ func (w *wrapper) GetObject(ctx context.Context, input *s3api.GetObjectInput) (*
 	}, nil
 }
 
+func (w *wrapper) HeadObject(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+	var checksumMode s3types.ChecksumMode
+	if input.ChecksumMode != nil {
+		checksumMode = s3types.ChecksumMode(*input.ChecksumMode)
+	}
+	out, err := w.api.HeadObject(
+		ctx,
+		&s3.HeadObjectInput{
+			Bucket:       input.Bucket,
+			Key:          input.Key,
+			VersionId:    input.VersionID,
+			ChecksumMode: checksumMode,
+		})
+	if err != nil {
+		return nil, err
+	}
+	var storageClass *string
+	if out.StorageClass != "" {
+		storageClass = aws.String(string(out.StorageClass))
+	}
+	var partsCount *int64
+	if out.PartsCount != 0 {
+		partsCount = aws.Int64(int64(out.PartsCount))
+	}
+	return &s3api.HeadObjectOutput{
+		ContentLength:  &out.ContentLength,
+		ContentType:    out.ContentType,
+		ETag:           out.ETag,
+		LastModified:   out.LastModified,
+		VersionID:      out.VersionId,
+		Metadata:       out.Metadata,
+		PartsCount:     partsCount,
+		StorageClass:   storageClass,
+		ChecksumCRC32:  out.ChecksumCRC32,
+		ChecksumCRC32C: out.ChecksumCRC32C,
+		ChecksumSHA1:   out.ChecksumSHA1,
+		ChecksumSHA256: out.ChecksumSHA256,
+		Restore:        out.Restore,
+	}, nil
+}
+
 func (w *wrapper) CreateMultipartUpload(ctx context.Context, input *s3api.CreateMultipartUploadInput) (*s3api.CreateMultipartUploadOutput, error) {
 	var acl s3types.ObjectCannedACL
 	if input.ACL != nil {
 		acl = s3types.ObjectCannedACL(*input.ACL)
 	}
+	var storageClass s3types.StorageClass
+	if input.StorageClass != nil {
+		storageClass = s3types.StorageClass(*input.StorageClass)
+	}
 	out, err := w.api.CreateMultipartUpload(
 		ctx,
 		&s3.CreateMultipartUploadInput{
-			Bucket:      input.Bucket,
-			Key:         input.Key,
-			ACL:         acl,
-			ContentType: input.ContentType,
+			Bucket:       input.Bucket,
+			Key:          input.Key,
+			ACL:          acl,
+			ContentType:  input.ContentType,
+			Metadata:     input.Metadata,
+			StorageClass: storageClass,
 		})
 	if err != nil {
 		return nil, err
@@ -199,6 +259,66 @@ func (w *wrapper) UploadPart(ctx context.Context, input *s3api.UploadPartInput)
 	}, nil
 }
 
+func (w *wrapper) CopyObject(ctx context.Context, input *s3api.CopyObjectInput) (*s3api.CopyObjectOutput, error) {
+	var acl s3types.ObjectCannedACL
+	if input.ACL != nil {
+		acl = s3types.ObjectCannedACL(*input.ACL)
+	}
+	var storageClass s3types.StorageClass
+	if input.StorageClass != nil {
+		storageClass = s3types.StorageClass(*input.StorageClass)
+	}
+	out, err := w.api.CopyObject(
+		ctx,
+		&s3.CopyObjectInput{
+			Bucket:            input.Bucket,
+			Key:               input.Key,
+			ACL:               acl,
+			CopySource:        aws.String(s3api.CopySource(input.SourceBucket, input.SourceKey, input.SourceVersionID)),
+			CopySourceIfMatch: input.SourceIfMatch,
+			StorageClass:      storageClass,
+		})
+	if err != nil {
+		return nil, err
+	}
+	var etag *string
+	if out.CopyObjectResult != nil {
+		etag = out.CopyObjectResult.ETag
+	}
+	return &s3api.CopyObjectOutput{
+		VersionID: out.VersionId,
+		ETag:      etag,
+	}, nil
+}
+
+func (w *wrapper) UploadPartCopy(ctx context.Context, input *s3api.UploadPartCopyInput) (*s3api.UploadPartCopyOutput, error) {
+	var pn int32
+	if input.PartNumber != nil {
+		pn = int32(*input.PartNumber)
+	}
+	out, err := w.api.UploadPartCopy(
+		ctx,
+		&s3.UploadPartCopyInput{
+			Bucket:            input.Bucket,
+			Key:               input.Key,
+			PartNumber:        pn,
+			UploadId:          input.UploadID,
+			CopySource:        aws.String(s3api.CopySource(input.SourceBucket, input.SourceKey, input.SourceVersionID)),
+			CopySourceIfMatch: input.SourceIfMatch,
+			CopySourceRange:   input.SourceRange,
+		})
+	if err != nil {
+		return nil, err
+	}
+	var etag *string
+	if out.CopyPartResult != nil {
+		etag = out.CopyPartResult.ETag
+	}
+	return &s3api.UploadPartCopyOutput{
+		ETag: etag,
+	}, nil
+}
+
 func (w *wrapper) DeleteObject(ctx context.Context, input *s3api.DeleteObjectInput) (*s3api.DeleteObjectOutput, error) {
 	out, err := w.api.DeleteObject(
 		ctx,
@@ -275,6 +275,142 @@ func TestWrapper(t *testing.T) {
 			}
 			expectStringPtr(t, "ETag", out.ETag)
 		})
+		t.Run("HeadObject", func(t *testing.T) {
+			api := &mock_awss3v2.MockS3API{
+				HeadObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+					expectStringPtr(t, "Bucket", params.Bucket)
+					expectStringPtr(t, "Key", params.Key)
+					expectStringPtr(t, "VersionID", params.VersionId)
+					expectString(t, "ENABLED", string(params.ChecksumMode))
+					return &s3.HeadObjectOutput{
+						ContentLength:  100,
+						ContentType:    aws.String("ContentType"),
+						ETag:           aws.String("ETag"),
+						LastModified:   aws.Time(time.Unix(1, 2)),
+						VersionId:      aws.String("VersionID"),
+						Metadata:       map[string]string{"Key": "Value"},
+						PartsCount:     3,
+						StorageClass:   types.StorageClass("StorageClass"),
+						ChecksumCRC32:  aws.String("CRC32"),
+						ChecksumCRC32C: aws.String("CRC32C"),
+						ChecksumSHA1:   aws.String("SHA1"),
+						ChecksumSHA256: aws.String("SHA256"),
+						Restore:        aws.String("Restore"),
+					}, nil
+				},
+			}
+			w := awss3v2.NewAPI(api)
+			out, err := w.HeadObject(context.TODO(),
+				&s3api.HeadObjectInput{
+					Bucket:       aws.String("Bucket"),
+					Key:          aws.String("Key"),
+					VersionID:    aws.String("VersionID"),
+					ChecksumMode: aws.String(s3api.ChecksumModeEnabled),
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(api.HeadObjectCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+			if *out.ContentLength != 100 {
+				t.Error("ContentLength differs")
+			}
+			expectStringPtr(t, "ContentType", out.ContentType)
+			expectStringPtr(t, "ETag", out.ETag)
+			if !out.LastModified.Equal(time.Unix(1, 2)) {
+				t.Error("LastModified differs")
+			}
+			expectStringPtr(t, "VersionID", out.VersionID)
+			if !reflect.DeepEqual(map[string]string{"Key": "Value"}, out.Metadata) {
+				t.Errorf("Expected Metadata: Key=Value, got: %v", out.Metadata)
+			}
+			if *out.PartsCount != 3 {
+				t.Error("PartsCount differs")
+			}
+			expectStringPtr(t, "StorageClass", out.StorageClass)
+			expectStringPtr(t, "CRC32", out.ChecksumCRC32)
+			expectStringPtr(t, "CRC32C", out.ChecksumCRC32C)
+			expectStringPtr(t, "SHA1", out.ChecksumSHA1)
+			expectStringPtr(t, "SHA256", out.ChecksumSHA256)
+			expectStringPtr(t, "Restore", out.Restore)
+		})
+		t.Run("CopyObject", func(t *testing.T) {
+			api := &mock_awss3v2.MockS3API{
+				CopyObjectFunc: func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+					expectStringPtr(t, "Bucket", params.Bucket)
+					expectStringPtr(t, "Key", params.Key)
+					expectString(t, "ACL", string(params.ACL))
+					expectStringPtr(t, "SrcBucket/Src%20Dir/Key?versionId=Version%2B1", params.CopySource)
+					expectStringPtr(t, "SrcETag", params.CopySourceIfMatch)
+					return &s3.CopyObjectOutput{
+						VersionId: aws.String("VersionID"),
+						CopyObjectResult: &types.CopyObjectResult{
+							ETag: aws.String("ETag"),
+						},
+					}, nil
+				},
+			}
+			w := awss3v2.NewAPI(api)
+			out, err := w.CopyObject(context.TODO(),
+				&s3api.CopyObjectInput{
+					Bucket:          aws.String("Bucket"),
+					Key:             aws.String("Key"),
+					ACL:             aws.String("ACL"),
+					SourceBucket:    aws.String("SrcBucket"),
+					SourceKey:       aws.String("Src Dir/Key"),
+					SourceVersionID: aws.String("Version+1"),
+					SourceIfMatch:   aws.String("SrcETag"),
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(api.CopyObjectCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+			expectStringPtr(t, "VersionID", out.VersionID)
+			expectStringPtr(t, "ETag", out.ETag)
+		})
+		t.Run("UploadPartCopy", func(t *testing.T) {
+			api := &mock_awss3v2.MockS3API{
+				UploadPartCopyFunc: func(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+					expectStringPtr(t, "Bucket", params.Bucket)
+					expectStringPtr(t, "Key", params.Key)
+					expectStringPtr(t, "UploadID", params.UploadId)
+					expectInt32(t, 10, params.PartNumber)
+					expectStringPtr(t, "SrcBucket/SrcKey", params.CopySource)
+					expectStringPtr(t, "SrcETag", params.CopySourceIfMatch)
+					expectStringPtr(t, "bytes=0-99", params.CopySourceRange)
+					return &s3.UploadPartCopyOutput{
+						CopyPartResult: &types.CopyPartResult{
+							ETag: aws.String("ETag"),
+						},
+					}, nil
+				},
+			}
+			w := awss3v2.NewAPI(api)
+			out, err := w.UploadPartCopy(context.TODO(),
+				&s3api.UploadPartCopyInput{
+					Bucket:        aws.String("Bucket"),
+					Key:           aws.String("Key"),
+					PartNumber:    aws.Int64(10),
+					UploadID:      aws.String("UploadID"),
+					SourceBucket:  aws.String("SrcBucket"),
+					SourceKey:     aws.String("SrcKey"),
+					SourceIfMatch: aws.String("SrcETag"),
+					SourceRange:   aws.String("bytes=0-99"),
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(api.UploadPartCopyCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+			expectStringPtr(t, "ETag", out.ETag)
+		})
 		t.Run("DeleteObject", func(t *testing.T) {
 			api := &mock_awss3v2.MockS3API{
 				DeleteObjectFunc: func(ctx context.Context, input *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
@@ -452,6 +588,48 @@ func TestWrapper(t *testing.T) {
 				t.Errorf("Expected calls: 1, actual: %d", n)
 			}
 		})
+		t.Run("HeadObject", func(t *testing.T) {
+			api := &mock_awss3v2.MockS3API{
+				HeadObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+					return nil, errDummy
+				},
+			}
+			w := awss3v2.NewAPI(api)
+			if _, err := w.HeadObject(context.TODO(), &s3api.HeadObjectInput{}); err != errDummy {
+				t.Fatal("Expected error")
+			}
+			if n := len(api.HeadObjectCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+		})
+		t.Run("CopyObject", func(t *testing.T) {
+			api := &mock_awss3v2.MockS3API{
+				CopyObjectFunc: func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+					return nil, errDummy
+				},
+			}
+			w := awss3v2.NewAPI(api)
+			if _, err := w.CopyObject(context.TODO(), &s3api.CopyObjectInput{}); err != errDummy {
+				t.Fatal("Expected error")
+			}
+			if n := len(api.CopyObjectCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+		})
+		t.Run("UploadPartCopy", func(t *testing.T) {
+			api := &mock_awss3v2.MockS3API{
+				UploadPartCopyFunc: func(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+					return nil, errDummy
+				},
+			}
+			w := awss3v2.NewAPI(api)
+			if _, err := w.UploadPartCopy(context.TODO(), &s3api.UploadPartCopyInput{}); err != errDummy {
+				t.Fatal("Expected error")
+			}
+			if n := len(api.UploadPartCopyCalls()); n != 1 {
+				t.Errorf("Expected calls: 1, actual: %d", n)
+			}
+		})
 		t.Run("DeleteObject", func(t *testing.T) {
 			api := &mock_awss3v2.MockS3API{
 				DeleteObjectFunc: func(ctx context.Context, input *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
@@ -0,0 +1,412 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package awss3v2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/netsim"
+	"github.com/at-wat/s3iot/s3api"
+	"github.com/at-wat/s3iot/s3api/s3apitest"
+	"github.com/at-wat/s3iot/s3fake"
+	"github.com/at-wat/s3iot/s3server"
+)
+
+func TestServer(t *testing.T) {
+	bucket, key, dstKey := "bucket", "dir/key+with space", "copied"
+	data := make([]byte, 250)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	newConfig := func(url, secret string) aws.Config {
+		return aws.Config{
+			Region:       "us-east-1",
+			Credentials:  credentials.NewStaticCredentialsProvider("id", secret, ""),
+			BaseEndpoint: aws.String(url),
+			Retryer: func() aws.Retryer {
+				return aws.NopRetryer{}
+			},
+		}
+	}
+	newServer := func(t *testing.T) (*s3server.Server, *httptest.Server) {
+		t.Helper()
+		s := s3server.New(s3fake.New())
+		s.Credentials = map[string]string{"id": "secret"}
+		srv := httptest.NewServer(s)
+		t.Cleanup(srv.Close)
+		return s, srv
+	}
+	retryer := s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{
+		WaitBase: time.Millisecond,
+		RetryMax: 2,
+	})
+	classifier := s3iot.WithErrorClassifier(s3iot.DefaultErrorClassifier)
+
+	upload := func(t *testing.T, cfg aws.Config) (s3iot.UploadContext, s3iot.UploadOutput, error) {
+		t.Helper()
+		u := NewUploader(cfg,
+			s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 100}),
+			retryer, classifier,
+		)
+		uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Body:   bytes.NewReader(data),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout")
+		case <-uc.Done():
+		}
+		out, err := uc.Result()
+		return uc, out, err
+	}
+
+	t.Run("UpDownload", func(t *testing.T) {
+		_, srv := newServer(t)
+		cfg := newConfig(srv.URL, "secret")
+
+		_, out, err := upload(t, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := srv.URL + "/bucket/dir/key+with%20space"; *out.Location != expected {
+			t.Errorf("Expected Location: %s, got: %s", expected, *out.Location)
+		}
+
+		c := NewCopier(cfg, s3iot.WithCopyPartSize(s3iot.MinCopyPartSize))
+		cc, err := c.Copy(context.TODO(), &s3iot.CopyInput{
+			Bucket:       &bucket,
+			Key:          &dstKey,
+			SourceBucket: &bucket,
+			SourceKey:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-cc.Done()
+		if _, err := cc.Result(); err != nil {
+			t.Fatal(err)
+		}
+
+		d := NewDownloader(cfg,
+			s3iot.WithDownloadSlicer(&s3iot.DefaultDownloadSlicerFactory{PartSize: 100}),
+			s3iot.WithHeadFirst(true),
+		)
+		buf := manager.NewWriteAtBuffer(nil)
+		dc, err := d.Download(context.TODO(), buf, &s3iot.DownloadInput{
+			Bucket: &bucket,
+			Key:    &dstKey,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-dc.Done()
+		if _, err := dc.Result(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, buf.Bytes()) {
+			t.Error("Downloaded data differs")
+		}
+
+		api := NewAPI(s3.NewFromConfig(cfg))
+		list, err := api.ListObjectsV2(context.TODO(), &s3api.ListObjectsV2Input{
+			Bucket:  &bucket,
+			MaxKeys: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if list.KeyCount != 1 || *list.Contents[0].Key != dstKey || list.NextContinuationToken == nil {
+			t.Errorf("Unexpected list output: %+v", list)
+		}
+		if _, err := api.DeleteObject(context.TODO(), &s3api.DeleteObjectInput{
+			Bucket: &bucket,
+			Key:    &dstKey,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = api.GetObject(context.TODO(), &s3api.GetObjectInput{
+			Bucket: &bucket,
+			Key:    &dstKey,
+		})
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NoSuchKey" {
+			t.Errorf("Expected NoSuchKey error, got: '%v'", err)
+		}
+		if (&ErrorClassifier{}).IsRetryable(err) {
+			t.Error("NoSuchKey must not be retryable")
+		}
+	})
+	t.Run("SignatureDoesNotMatch", func(t *testing.T) {
+		_, srv := newServer(t)
+		_, _, err := upload(t, newConfig(srv.URL, "wrong"))
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "SignatureDoesNotMatch" {
+			t.Errorf("Expected SignatureDoesNotMatch error, got: '%v'", err)
+		}
+	})
+	t.Run("ErrorDecoding", func(t *testing.T) {
+		s, srv := newServer(t)
+		api := NewAPI(s3.NewFromConfig(newConfig(srv.URL, "secret")))
+		s.Inject(s3server.Fault{Op: s3server.OpGetObject, StatusCode: 503, Code: "SlowDown"})
+		_, err := api.GetObject(context.TODO(), &s3api.GetObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "SlowDown" {
+			t.Fatalf("Expected SlowDown error, got: '%v'", err)
+		}
+		if _, ok := (&ErrorClassifier{}).IsThrottle(err); !ok {
+			t.Error("SlowDown must be classified as throttle")
+		}
+	})
+	t.Run("RetryAfter", func(t *testing.T) {
+		s, srv := newServer(t)
+		api := NewAPI(s3.NewFromConfig(newConfig(srv.URL, "secret")))
+		s.Inject(s3server.Fault{Op: s3server.OpGetObject, StatusCode: 503, RetryAfter: 2 * time.Second})
+		_, err := api.GetObject(context.TODO(), &s3api.GetObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		ec := &ErrorClassifier{}
+		if !ec.IsRetryable(err) {
+			t.Error("503 must be retryable")
+		}
+		if wait, ok := ec.IsThrottle(err); !ok || wait != 2*time.Second {
+			t.Errorf("Expected throttle wait requested by Retry-After, got (%v, %v)", wait, ok)
+		}
+		if status, ok := s3iot.HTTPStatus(ec, err); !ok || status != 503 {
+			t.Errorf("Expected HTTP status 503, got (%d, %v)", status, ok)
+		}
+	})
+	t.Run("Faults", func(t *testing.T) {
+		partial := int64(10)
+		testCases := map[string]struct {
+			fault s3server.Fault
+		}{
+			"SlowDown": {
+				fault: s3server.Fault{Op: s3server.OpUploadPart, PartNumber: 2, StatusCode: 503, Code: "SlowDown", Times: 1},
+			},
+			"InternalError": {
+				fault: s3server.Fault{Op: s3server.OpCompleteMultipartUpload, StatusCode: 500, Times: 1},
+			},
+			"ConnectionReset": {
+				fault: s3server.Fault{Op: s3server.OpUploadPart, PartNumber: 3, ResetConnection: true, Times: 1},
+			},
+			"PartialBody": {
+				fault: s3server.Fault{Op: s3server.OpGetObject, Call: 2, PartialBody: &partial, Times: 1},
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				s, srv := newServer(t)
+				cfg := newConfig(srv.URL, "secret")
+				s.Inject(tt.fault)
+
+				uc, _, err := upload(t, cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ustatus, _ := uc.Status()
+
+				d := NewDownloader(cfg,
+					s3iot.WithDownloadSlicer(&s3iot.DefaultDownloadSlicerFactory{PartSize: 100}),
+					retryer, classifier,
+				)
+				buf := manager.NewWriteAtBuffer(nil)
+				dc, err := d.Download(context.TODO(), buf, &s3iot.DownloadInput{
+					Bucket: &bucket,
+					Key:    &key,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				<-dc.Done()
+				_, err = dc.Result()
+				dstatus, _ := dc.Status()
+
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, buf.Bytes()) {
+					t.Error("Downloaded data differs")
+				}
+				if n := ustatus.NumRetries + dstatus.NumRetries; n != 1 {
+					t.Errorf("Expected 1 retry, got %d", n)
+				}
+			})
+		}
+	})
+	t.Run("NetworkImpairment", func(t *testing.T) {
+		_, srv := newServer(t)
+		cond := netsim.Conditions{
+			UploadBandwidth:   10 * 1024,
+			DownloadBandwidth: 10 * 1024,
+			Latency:           5 * time.Millisecond,
+			Jitter:            5 * time.Millisecond,
+			ResetRate:         0.5,
+			Outages:           []netsim.Outage{{Start: 0, End: 100 * time.Millisecond}},
+		}
+		tr := netsim.New(netsim.WithConditions(cond))
+		cfg := newConfig(srv.URL, "secret")
+		cfg.HTTPClient = tr.Client()
+		retryer := s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{
+			WaitBase: 10 * time.Millisecond,
+			WaitMax:  50 * time.Millisecond,
+			RetryMax: 20,
+		})
+
+		u := NewUploader(cfg,
+			s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 100}),
+			retryer, classifier,
+		)
+		uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Body:   bytes.NewReader(data),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-uc.Done()
+		if _, err := uc.Result(); err != nil {
+			t.Fatal(err)
+		}
+		ustatus, _ := uc.Status()
+		if stats := tr.Stats(); stats.Rejected == 0 || stats.Resets == 0 {
+			t.Errorf("Requests must be rejected and reset: %+v", stats)
+		} else if ustatus.NumRetries != stats.Rejected+stats.Resets {
+			t.Errorf("Expected %d retries, got %d", stats.Rejected+stats.Resets, ustatus.NumRetries)
+		}
+
+		// Downloader resumes the part from the received position
+		// on the connection reset during reading the body.
+		cond.Outages = []netsim.Outage{{Start: tr.Elapsed(), End: tr.Elapsed() + 100*time.Millisecond}}
+		tr.SetConditions(cond)
+		before := tr.Stats()
+
+		d := NewDownloader(cfg,
+			s3iot.WithDownloadSlicer(&s3iot.DefaultDownloadSlicerFactory{PartSize: 100}),
+			retryer, classifier,
+		)
+		buf := manager.NewWriteAtBuffer(nil)
+		dc, err := d.Download(context.TODO(), buf, &s3iot.DownloadInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-dc.Done()
+		if _, err := dc.Result(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, buf.Bytes()) {
+			t.Error("Downloaded data differs")
+		}
+
+		dstatus, _ := dc.Status()
+		stats := tr.Stats()
+		if stats.Rejected == before.Rejected || stats.Resets == before.Resets {
+			t.Errorf("Requests must be rejected and reset: %+v", stats)
+		} else if n := stats.Rejected - before.Rejected + stats.Resets - before.Resets; dstatus.NumRetries != n {
+			t.Errorf("Expected %d retries, got %d", n, dstatus.NumRetries)
+		}
+	})
+	t.Run("PauseResume", func(t *testing.T) {
+		_, srv := newServer(t)
+		tr := netsim.New()
+		tr.SetOffline(true)
+		cfg := newConfig(srv.URL, "secret")
+		cfg.HTTPClient = tr.Client()
+
+		u := NewUploader(cfg,
+			s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 100}),
+			s3iot.WithRetryer(&s3iot.PauseOnFailRetryerFactory{}),
+			classifier,
+		)
+		uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Body:   bytes.NewReader(data),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			status, _ := uc.Status()
+			if status.Paused {
+				break
+			}
+			select {
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timeout")
+			case <-uc.Done():
+				t.Fatal("Upload must be paused")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+
+		tr.SetOffline(false)
+		uc.Resume()
+		select {
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout")
+		case <-uc.Done():
+		}
+		if _, err := uc.Result(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestConformance(t *testing.T) {
+	store := s3fake.New()
+	store.MinPartSize = 1024
+	srv := httptest.NewServer(s3server.New(store))
+	defer srv.Close()
+
+	cfg := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("id", "secret", ""),
+		BaseEndpoint: aws.String(srv.URL),
+		Retryer: func() aws.Retryer {
+			return aws.NopRetryer{}
+		},
+	}
+	s3apitest.Run(t, NewAPI(s3.NewFromConfig(cfg)), s3apitest.Config{
+		Bucket:   "bucket",
+		PartSize: store.MinPartSize,
+	})
+}
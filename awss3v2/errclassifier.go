@@ -16,27 +16,41 @@ package awss3v2
 
 import (
 	"errors"
+	"net/http"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/at-wat/s3iot"
 )
 
-// ErrorClassifier classifies aws-sdk-go (v1) errors.
+// ErrorClassifier classifies aws-sdk-go-v2 errors.
+//
+// If the error response has Retry-After header, the error is classified as
+// throttle and the requested wait is used instead of ThrottleWait.
+// The wait is capped by MaxThrottleWait.
 type ErrorClassifier struct {
-	ThrottleWait time.Duration
+	ThrottleWait    time.Duration
+	MaxThrottleWait time.Duration
 }
 
 // DefaultThrottleWait is a default wait duration on throttle.
 var DefaultThrottleWait = 5 * time.Second
 
+// DefaultMaxThrottleWait is a default upper limit of the wait duration
+// requested by Retry-After header.
+var DefaultMaxThrottleWait = time.Minute
+
 // IsRetryable implements ErrorClassifier.
-func (ErrorClassifier) IsRetryable(err error) bool {
+func (c ErrorClassifier) IsRetryable(err error) bool {
 	for _, retryable := range retry.DefaultRetryables {
 		if retryable.IsErrorRetryable(err).Bool() {
 			return true
 		}
 	}
-	return false
+	_, ok := c.IsThrottle(err)
+	return ok
 }
 
 type errorCode interface {
@@ -45,13 +59,57 @@ type errorCode interface {
 
 // IsThrottle implements ErrorClassifier.
 func (c ErrorClassifier) IsThrottle(err error) (time.Duration, bool) {
-	var v errorCode
-	if errors.As(err, &v) && v.ErrorCode() == "SlowDown" {
-		wait := c.ThrottleWait
-		if wait == 0 {
-			return DefaultThrottleWait, true
+	return c.IsThrottleAt(err, time.Now())
+}
+
+// IsThrottleAt implements s3iot.ThrottleAtClassifier.
+func (c ErrorClassifier) IsThrottleAt(err error, now time.Time) (time.Duration, bool) {
+	if res := responseOf(err); res != nil {
+		if wait, ok := s3iot.ParseRetryAfter(res.Header.Get("Retry-After"), now); ok {
+			limit := c.MaxThrottleWait
+			if limit == 0 {
+				limit = DefaultMaxThrottleWait
+			}
+			if wait > limit {
+				wait = limit
+			}
+			return wait, true
 		}
-		return wait, true
+	}
+	if !isThrottle(err) {
+		return 0, false
+	}
+	wait := c.ThrottleWait
+	if wait == 0 {
+		return DefaultThrottleWait, true
+	}
+	return wait, true
+}
+
+// HTTPStatus implements s3iot.HTTPStatusClassifier.
+func (ErrorClassifier) HTTPStatus(err error) (int, bool) {
+	if res := responseOf(err); res != nil && res.StatusCode != 0 {
+		return res.StatusCode, true
 	}
 	return 0, false
 }
+
+// responseOf returns the HTTP response of the error if available.
+func responseOf(err error) *http.Response {
+	var re *smithyhttp.ResponseError
+	if errors.As(err, &re) && re.Response != nil {
+		return re.Response.Response
+	}
+	return nil
+}
+
+func isThrottle(err error) bool {
+	var v errorCode
+	if errors.As(err, &v) {
+		if _, ok := retry.DefaultThrottleErrorCodes[v.ErrorCode()]; ok {
+			return true
+		}
+	}
+	res := responseOf(err)
+	return res != nil && res.StatusCode == http.StatusTooManyRequests
+}
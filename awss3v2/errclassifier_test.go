@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	nethttp "net/http"
 	"testing"
 	"time"
 
@@ -77,11 +78,13 @@ func TestErrorClassifier(t *testing.T) {
 	})
 
 	testCases := map[string]struct {
-		err       error
-		retryable bool
-		throttle  bool
-		waitParam time.Duration
-		wait      time.Duration
+		err          error
+		retryable    bool
+		throttle     bool
+		waitParam    time.Duration
+		maxWaitParam time.Duration
+		wait         time.Duration
+		status       int
 	}{
 		"HTTP": {
 			err: &http.RequestSendError{
@@ -121,6 +124,40 @@ func TestErrorClassifier(t *testing.T) {
 			waitParam: time.Minute,
 			wait:      time.Minute,
 		},
+		"AWSInternalError": {
+			err:       newResponseError(500, "InternalError", ""),
+			retryable: true,
+			status:    500,
+		},
+		"AWSTooManyRequests": {
+			err:       newResponseError(429, "Dummy", ""),
+			retryable: true,
+			throttle:  true,
+			wait:      DefaultThrottleWait,
+			status:    429,
+		},
+		"AWSRetryAfter": {
+			err:       newResponseError(503, "ServiceUnavailable", "10"),
+			retryable: true,
+			throttle:  true,
+			wait:      10 * time.Second,
+			status:    503,
+		},
+		"AWSRetryAfterCapped": {
+			err:       newResponseError(503, "ServiceUnavailable", "3600"),
+			retryable: true,
+			throttle:  true,
+			wait:      DefaultMaxThrottleWait,
+			status:    503,
+		},
+		"AWSRetryAfterCappedParam": {
+			err:          newResponseError(503, "ServiceUnavailable", "3600"),
+			retryable:    true,
+			throttle:     true,
+			maxWaitParam: time.Hour,
+			wait:         time.Hour,
+			status:       503,
+		},
 		"AWSConnRefused": {
 			err:       errConnRefused,
 			retryable: true,
@@ -136,7 +173,8 @@ func TestErrorClassifier(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			t.Log(name, tt.err)
 			ec := &ErrorClassifier{
-				ThrottleWait: tt.waitParam,
+				ThrottleWait:    tt.waitParam,
+				MaxThrottleWait: tt.maxWaitParam,
 			}
 			if out := ec.IsRetryable(tt.err); out != tt.retryable {
 				t.Errorf("IsRetryable('%v') is expected to be %v, got %v", tt.err, tt.retryable, out)
@@ -148,6 +186,43 @@ func TestErrorClassifier(t *testing.T) {
 			if wait != tt.wait {
 				t.Errorf("Expected wait for '%v': %v, got: %v", tt.err, tt.wait, wait)
 			}
+			status, ok := ec.HTTPStatus(tt.err)
+			if status != tt.status || ok != (tt.status != 0) {
+				t.Errorf("Expected HTTP status for '%v': %d, got: %d", tt.err, tt.status, status)
+			}
 		})
 	}
 }
+
+func TestErrorClassifierThrottleAt(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	ec := &ErrorClassifier{}
+
+	err := newResponseError(503, "ServiceUnavailable", now.Add(30*time.Second).Format(nethttp.TimeFormat))
+	wait, ok := ec.IsThrottleAt(err, now)
+	if !ok {
+		t.Fatal("Retry-After must be classified as throttle")
+	}
+	if wait != 30*time.Second {
+		t.Errorf("Expected wait: %v, got: %v", 30*time.Second, wait)
+	}
+}
+
+func newResponseError(status int, code, retryAfter string) error {
+	header := nethttp.Header{}
+	if retryAfter != "" {
+		header.Set("Retry-After", retryAfter)
+	}
+	return &http.ResponseError{
+		Response: &http.Response{
+			Response: &nethttp.Response{
+				StatusCode: status,
+				Header:     header,
+			},
+		},
+		Err: &smithy.GenericAPIError{
+			Code:    code,
+			Message: "dummy",
+		},
+	}
+}
@@ -26,6 +26,9 @@ var _ awss3v2.S3API = &MockS3API{}
 //			CompleteMultipartUploadFunc: func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
 //				panic("mock out the CompleteMultipartUpload method")
 //			},
+//			CopyObjectFunc: func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+//				panic("mock out the CopyObject method")
+//			},
 //			CreateMultipartUploadFunc: func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
 //				panic("mock out the CreateMultipartUpload method")
 //			},
@@ -35,6 +38,9 @@ var _ awss3v2.S3API = &MockS3API{}
 //			GetObjectFunc: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
 //				panic("mock out the GetObject method")
 //			},
+//			HeadObjectFunc: func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+//				panic("mock out the HeadObject method")
+//			},
 //			ListObjectsV2Func: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
 //				panic("mock out the ListObjectsV2 method")
 //			},
@@ -44,6 +50,9 @@ var _ awss3v2.S3API = &MockS3API{}
 //			UploadPartFunc: func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
 //				panic("mock out the UploadPart method")
 //			},
+//			UploadPartCopyFunc: func(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+//				panic("mock out the UploadPartCopy method")
+//			},
 //		}
 //
 //		// use mockedS3API in code that requires awss3v2.S3API
@@ -57,6 +66,9 @@ type MockS3API struct {
 	// CompleteMultipartUploadFunc mocks the CompleteMultipartUpload method.
 	CompleteMultipartUploadFunc func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
 
+	// CopyObjectFunc mocks the CopyObject method.
+	CopyObjectFunc func(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+
 	// CreateMultipartUploadFunc mocks the CreateMultipartUpload method.
 	CreateMultipartUploadFunc func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
 
@@ -66,6 +78,9 @@ type MockS3API struct {
 	// GetObjectFunc mocks the GetObject method.
 	GetObjectFunc func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 
+	// HeadObjectFunc mocks the HeadObject method.
+	HeadObjectFunc func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+
 	// ListObjectsV2Func mocks the ListObjectsV2 method.
 	ListObjectsV2Func func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
 
@@ -75,6 +90,9 @@ type MockS3API struct {
 	// UploadPartFunc mocks the UploadPart method.
 	UploadPartFunc func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
 
+	// UploadPartCopyFunc mocks the UploadPartCopy method.
+	UploadPartCopyFunc func(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+
 	// calls tracks calls to the methods.
 	calls struct {
 		// AbortMultipartUpload holds details about calls to the AbortMultipartUpload method.
@@ -95,6 +113,15 @@ type MockS3API struct {
 			// OptFns is the optFns argument value.
 			OptFns []func(*s3.Options)
 		}
+		// CopyObject holds details about calls to the CopyObject method.
+		CopyObject []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Params is the params argument value.
+			Params *s3.CopyObjectInput
+			// OptFns is the optFns argument value.
+			OptFns []func(*s3.Options)
+		}
 		// CreateMultipartUpload holds details about calls to the CreateMultipartUpload method.
 		CreateMultipartUpload []struct {
 			// Ctx is the ctx argument value.
@@ -122,6 +149,15 @@ type MockS3API struct {
 			// OptFns is the optFns argument value.
 			OptFns []func(*s3.Options)
 		}
+		// HeadObject holds details about calls to the HeadObject method.
+		HeadObject []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Params is the params argument value.
+			Params *s3.HeadObjectInput
+			// OptFns is the optFns argument value.
+			OptFns []func(*s3.Options)
+		}
 		// ListObjectsV2 holds details about calls to the ListObjectsV2 method.
 		ListObjectsV2 []struct {
 			// Ctx is the ctx argument value.
@@ -149,15 +185,27 @@ type MockS3API struct {
 			// OptFns is the optFns argument value.
 			OptFns []func(*s3.Options)
 		}
+		// UploadPartCopy holds details about calls to the UploadPartCopy method.
+		UploadPartCopy []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Params is the params argument value.
+			Params *s3.UploadPartCopyInput
+			// OptFns is the optFns argument value.
+			OptFns []func(*s3.Options)
+		}
 	}
 	lockAbortMultipartUpload    sync.RWMutex
 	lockCompleteMultipartUpload sync.RWMutex
+	lockCopyObject              sync.RWMutex
 	lockCreateMultipartUpload   sync.RWMutex
 	lockDeleteObject            sync.RWMutex
 	lockGetObject               sync.RWMutex
+	lockHeadObject              sync.RWMutex
 	lockListObjectsV2           sync.RWMutex
 	lockPutObject               sync.RWMutex
 	lockUploadPart              sync.RWMutex
+	lockUploadPartCopy          sync.RWMutex
 }
 
 // AbortMultipartUpload calls AbortMultipartUploadFunc.
@@ -240,6 +288,46 @@ func (mock *MockS3API) CompleteMultipartUploadCalls() []struct {
 	return calls
 }
 
+// CopyObject calls CopyObjectFunc.
+func (mock *MockS3API) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if mock.CopyObjectFunc == nil {
+		panic("MockS3API.CopyObjectFunc: method is nil but S3API.CopyObject was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Params *s3.CopyObjectInput
+		OptFns []func(*s3.Options)
+	}{
+		Ctx:    ctx,
+		Params: params,
+		OptFns: optFns,
+	}
+	mock.lockCopyObject.Lock()
+	mock.calls.CopyObject = append(mock.calls.CopyObject, callInfo)
+	mock.lockCopyObject.Unlock()
+	return mock.CopyObjectFunc(ctx, params, optFns...)
+}
+
+// CopyObjectCalls gets all the calls that were made to CopyObject.
+// Check the length with:
+//
+//	len(mockedS3API.CopyObjectCalls())
+func (mock *MockS3API) CopyObjectCalls() []struct {
+	Ctx    context.Context
+	Params *s3.CopyObjectInput
+	OptFns []func(*s3.Options)
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Params *s3.CopyObjectInput
+		OptFns []func(*s3.Options)
+	}
+	mock.lockCopyObject.RLock()
+	calls = mock.calls.CopyObject
+	mock.lockCopyObject.RUnlock()
+	return calls
+}
+
 // CreateMultipartUpload calls CreateMultipartUploadFunc.
 func (mock *MockS3API) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
 	if mock.CreateMultipartUploadFunc == nil {
@@ -360,6 +448,46 @@ func (mock *MockS3API) GetObjectCalls() []struct {
 	return calls
 }
 
+// HeadObject calls HeadObjectFunc.
+func (mock *MockS3API) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if mock.HeadObjectFunc == nil {
+		panic("MockS3API.HeadObjectFunc: method is nil but S3API.HeadObject was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Params *s3.HeadObjectInput
+		OptFns []func(*s3.Options)
+	}{
+		Ctx:    ctx,
+		Params: params,
+		OptFns: optFns,
+	}
+	mock.lockHeadObject.Lock()
+	mock.calls.HeadObject = append(mock.calls.HeadObject, callInfo)
+	mock.lockHeadObject.Unlock()
+	return mock.HeadObjectFunc(ctx, params, optFns...)
+}
+
+// HeadObjectCalls gets all the calls that were made to HeadObject.
+// Check the length with:
+//
+//	len(mockedS3API.HeadObjectCalls())
+func (mock *MockS3API) HeadObjectCalls() []struct {
+	Ctx    context.Context
+	Params *s3.HeadObjectInput
+	OptFns []func(*s3.Options)
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Params *s3.HeadObjectInput
+		OptFns []func(*s3.Options)
+	}
+	mock.lockHeadObject.RLock()
+	calls = mock.calls.HeadObject
+	mock.lockHeadObject.RUnlock()
+	return calls
+}
+
 // ListObjectsV2 calls ListObjectsV2Func.
 func (mock *MockS3API) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
 	if mock.ListObjectsV2Func == nil {
@@ -479,3 +607,43 @@ func (mock *MockS3API) UploadPartCalls() []struct {
 	mock.lockUploadPart.RUnlock()
 	return calls
 }
+
+// UploadPartCopy calls UploadPartCopyFunc.
+func (mock *MockS3API) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	if mock.UploadPartCopyFunc == nil {
+		panic("MockS3API.UploadPartCopyFunc: method is nil but S3API.UploadPartCopy was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Params *s3.UploadPartCopyInput
+		OptFns []func(*s3.Options)
+	}{
+		Ctx:    ctx,
+		Params: params,
+		OptFns: optFns,
+	}
+	mock.lockUploadPartCopy.Lock()
+	mock.calls.UploadPartCopy = append(mock.calls.UploadPartCopy, callInfo)
+	mock.lockUploadPartCopy.Unlock()
+	return mock.UploadPartCopyFunc(ctx, params, optFns...)
+}
+
+// UploadPartCopyCalls gets all the calls that were made to UploadPartCopy.
+// Check the length with:
+//
+//	len(mockedS3API.UploadPartCopyCalls())
+func (mock *MockS3API) UploadPartCopyCalls() []struct {
+	Ctx    context.Context
+	Params *s3.UploadPartCopyInput
+	OptFns []func(*s3.Options)
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Params *s3.UploadPartCopyInput
+		OptFns []func(*s3.Options)
+	}
+	mock.lockUploadPartCopy.RLock()
+	calls = mock.calls.UploadPartCopy
+	mock.lockUploadPartCopy.RUnlock()
+	return calls
+}
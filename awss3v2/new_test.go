@@ -52,4 +52,14 @@ func TestNew(t *testing.T) {
 			t.Errorf("Base API is expected to be *s3.Client, actually %T", d.API.(*wrapper).api)
 		}
 	})
+	t.Run("NewCopier", func(t *testing.T) {
+		c := NewCopier(cfg, s3iot.UpDownloaderOptionFn(func(u *s3iot.UpDownloaderBase) {
+			if _, ok := u.API.(*wrapper).api.(*s3.Client); !ok {
+				t.Errorf("Base API is expected to be *s3.Client, actually %T", u.API.(*wrapper).api)
+			}
+		}))
+		if _, ok := c.API.(*wrapper).api.(*s3.Client); !ok {
+			t.Errorf("Base API is expected to be *s3.Client, actually %T", c.API.(*wrapper).api)
+		}
+	})
 }
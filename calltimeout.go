@@ -0,0 +1,262 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultCallTimeoutMargin is the default multiplier of the estimated transfer time.
+const DefaultCallTimeoutMargin = 2
+
+// CallTimeout calculates the timeout of each API call attempt.
+//
+// The timeout is Base plus the estimated transfer time of the call multiplied
+// by Margin. The transfer time is estimated from the size of the part and
+// the throughput observed by the preceding calls of the transfer.
+// MinThroughput is used if no throughput is observed yet or the observed
+// throughput is lower than MinThroughput, so that the call slower than
+// MinThroughput is canceled.
+// The timeout is capped by Max if set.
+// Zero value disables the timeout.
+type CallTimeout struct {
+	Base          time.Duration
+	MinThroughput int64 // bytes per second
+	Margin        float64
+	Max           time.Duration
+}
+
+// Timeout returns the timeout of the call transferring size bytes
+// under the observed throughput in bytes per second.
+// Zero means no timeout.
+func (t CallTimeout) Timeout(size int64, throughput float64) time.Duration {
+	if t == (CallTimeout{}) {
+		return 0
+	}
+	d := t.Base
+	rate := float64(t.MinThroughput)
+	if throughput > rate {
+		rate = throughput
+	}
+	if size > 0 && rate > 0 {
+		margin := t.Margin
+		if margin <= 0 {
+			margin = DefaultCallTimeoutMargin
+		}
+		d += time.Duration(float64(size) / rate * margin * float64(time.Second))
+	}
+	if t.Max > 0 && (d <= 0 || d > t.Max) {
+		d = t.Max
+	}
+	return d
+}
+
+// apiCall tracks an API call attempt to cancel it on force pause,
+// timeout and stall.
+type apiCall struct {
+	c      *upDownloadContext
+	cancel func()
+	done   chan struct{}
+	start  time.Time
+
+	mu     sync.Mutex
+	reason error
+	ended  bool
+	idle   bool
+	last   time.Time
+	pos    int64
+	maxPos int64
+}
+
+// currentCallContext returns the context of the API call attempt
+// transferring size bytes.
+// If stream is true, the stall watchdog monitors the body transfer
+// through the readers returned by apiCall.
+func (c *upDownloadContext) currentCallContext(ctx context.Context, size int64, stream bool) (context.Context, *apiCall) {
+	ctx2, cancel := context.WithCancel(ctx)
+	now := c.clock.Now()
+	call := &apiCall{
+		c:      c,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		start:  now,
+		idle:   !stream,
+		last:   now,
+	}
+	c.mu.Lock()
+	c.calls[call] = struct{}{}
+	timeout := c.callTimeout.Timeout(size, c.throughput)
+	c.mu.Unlock()
+
+	stall := c.stallTimeout
+	if !stream {
+		stall = 0
+	}
+	if timeout > 0 || stall > 0 {
+		go call.watch(timeout, stall)
+	}
+	return ctx2, call
+}
+
+func (a *apiCall) watch(timeout, stall time.Duration) {
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timeoutCh = a.c.clock.After(timeout)
+	}
+	wait := stall
+	for {
+		var stallCh <-chan time.Time
+		if stall > 0 {
+			stallCh = a.c.clock.After(wait)
+		}
+		select {
+		case <-a.done:
+			return
+		case <-timeoutCh:
+			a.abort(ErrCallTimeout)
+			return
+		case <-stallCh:
+			a.mu.Lock()
+			idle, last := a.idle, a.last
+			a.mu.Unlock()
+			if idle {
+				wait = stall
+				continue
+			}
+			elapsed := a.c.clock.Now().Sub(last)
+			if elapsed >= stall {
+				a.abort(ErrStalled)
+				return
+			}
+			wait = stall - elapsed
+		}
+	}
+}
+
+// abort cancels the call and records the reason.
+func (a *apiCall) abort(reason error) {
+	a.mu.Lock()
+	if !a.ended && a.reason == nil {
+		a.reason = reason
+	}
+	a.mu.Unlock()
+	a.cancel()
+}
+
+// end finishes the call and returns the reason of the cancel:
+// ErrForcePaused, ErrCallTimeout, ErrStalled or nil.
+// Timeout and stall are counted as retries.
+// The throughput is observed if the call is not canceled.
+func (a *apiCall) end() error {
+	a.mu.Lock()
+	if a.ended {
+		a.mu.Unlock()
+		return a.reason
+	}
+	a.ended = true
+	close(a.done)
+	reason, n := a.reason, a.maxPos
+	a.mu.Unlock()
+	a.cancel()
+
+	a.c.mu.Lock()
+	delete(a.c.calls, a)
+	a.c.mu.Unlock()
+
+	switch {
+	case reason == ErrCallTimeout || reason == ErrStalled:
+		a.c.countRetry()
+	case reason == nil && n > 0:
+		a.c.observe(n, a.c.clock.Now().Sub(a.start))
+	}
+	return reason
+}
+
+func (a *apiCall) progress(n int, eof bool) {
+	a.mu.Lock()
+	if n > 0 {
+		a.pos += int64(n)
+		if a.pos > a.maxPos {
+			a.maxPos = a.pos
+		}
+		a.last = a.c.clock.Now()
+		a.idle = false
+	}
+	if eof {
+		// Waiting for the response after sending the body is not a stall.
+		a.idle = true
+	}
+	a.mu.Unlock()
+}
+
+func (a *apiCall) seek(pos int64) {
+	a.mu.Lock()
+	a.pos = pos
+	a.last = a.c.clock.Now()
+	a.idle = false
+	a.mu.Unlock()
+}
+
+// bodyReader returns io.Reader to monitor the transfer of the body.
+func (a *apiCall) bodyReader(r io.Reader) io.Reader {
+	return &callReader{Reader: r, call: a}
+}
+
+// bodyReadSeeker returns io.ReadSeeker to monitor the transfer of the body.
+func (a *apiCall) bodyReadSeeker(r io.ReadSeeker) io.ReadSeeker {
+	return &callReadSeeker{callReader: callReader{Reader: r, call: a}, seeker: r}
+}
+
+type callReader struct {
+	io.Reader
+	call *apiCall
+}
+
+func (r *callReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.call.progress(n, err == io.EOF)
+	return n, err
+}
+
+type callReadSeeker struct {
+	callReader
+	seeker io.Seeker
+}
+
+func (r *callReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.seeker.Seek(offset, whence)
+	if err == nil {
+		r.call.seek(pos)
+	}
+	return pos, err
+}
+
+// observe updates the throughput of the transfer by the moving average.
+func (c *upDownloadContext) observe(n int64, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := float64(n) / d.Seconds()
+	c.mu.Lock()
+	if c.throughput == 0 {
+		c.throughput = t
+	} else {
+		c.throughput = (c.throughput + t) / 2
+	}
+	c.mu.Unlock()
+}
@@ -0,0 +1,306 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/clocktest"
+	"github.com/at-wat/s3iot/internal/iotest"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func TestCallTimeout(t *testing.T) {
+	testCases := map[string]struct {
+		timeout    s3iot.CallTimeout
+		size       int64
+		throughput float64
+		expected   time.Duration
+	}{
+		"Disabled": {
+			size:       100,
+			throughput: 10,
+		},
+		"Base": {
+			timeout:  s3iot.CallTimeout{Base: time.Second},
+			size:     100,
+			expected: time.Second,
+		},
+		"MinThroughput": {
+			timeout:  s3iot.CallTimeout{Base: time.Second, MinThroughput: 10},
+			size:     100,
+			expected: 21 * time.Second,
+		},
+		"Observed": {
+			timeout:    s3iot.CallTimeout{Base: time.Second, MinThroughput: 10},
+			size:       100,
+			throughput: 50,
+			expected:   5 * time.Second,
+		},
+		"SlowerThanMin": {
+			timeout:    s3iot.CallTimeout{Base: time.Second, MinThroughput: 10},
+			size:       100,
+			throughput: 1,
+			expected:   21 * time.Second,
+		},
+		"Margin": {
+			timeout:  s3iot.CallTimeout{MinThroughput: 10, Margin: 1.5},
+			size:     100,
+			expected: 15 * time.Second,
+		},
+		"Max": {
+			timeout:  s3iot.CallTimeout{Base: time.Second, MinThroughput: 10, Max: 10 * time.Second},
+			size:     100,
+			expected: 10 * time.Second,
+		},
+		"MaxOnly": {
+			timeout:  s3iot.CallTimeout{Max: 10 * time.Second},
+			size:     100,
+			expected: 10 * time.Second,
+		},
+		"NoBody": {
+			timeout:    s3iot.CallTimeout{Base: time.Second, MinThroughput: 10},
+			throughput: 50,
+			expected:   time.Second,
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			if d := tt.timeout.Timeout(tt.size, tt.throughput); d != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, d)
+			}
+		})
+	}
+}
+
+func TestUploader_CallTimeout(t *testing.T) {
+	var (
+		bucket = "Bucket"
+		key    = "Key"
+	)
+	data := make([]byte, 128)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	testCases := map[string]struct {
+		opts    []s3iot.UploaderOption
+		block   func(ctx context.Context, r io.Reader)
+		err     error
+		elapsed time.Duration
+	}{
+		"Timeout": {
+			opts: []s3iot.UploaderOption{
+				s3iot.WithCallTimeout(s3iot.CallTimeout{
+					Base:          time.Second,
+					MinThroughput: 10,
+				}),
+			},
+			block: func(ctx context.Context, r io.Reader) {
+				<-ctx.Done()
+			},
+			err:     s3iot.ErrCallTimeout,
+			elapsed: 11 * time.Second,
+		},
+		"Stall": {
+			opts: []s3iot.UploaderOption{
+				s3iot.WithStallTimeout(10 * time.Second),
+			},
+			block: func(ctx context.Context, r io.Reader) {
+				_, _ = r.Read(make([]byte, 10))
+				<-ctx.Done()
+			},
+			err:     s3iot.ErrStalled,
+			elapsed: 10 * time.Second,
+		},
+		"StallAfterBody": {
+			// Waiting for the response after sending the whole body is not a stall.
+			opts: []s3iot.UploaderOption{
+				s3iot.WithStallTimeout(10 * time.Second),
+				s3iot.WithCallTimeout(s3iot.CallTimeout{Max: time.Minute}),
+			},
+			block: func(ctx context.Context, r io.Reader) {
+				_, _ = io.Copy(io.Discard, r)
+				<-ctx.Done()
+			},
+			err:     s3iot.ErrCallTimeout,
+			elapsed: time.Minute,
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			api := newUploadMockAPI(buf, nil, nil)
+			var once sync.Once
+			uploadPart := api.UploadPartFunc
+			api.UploadPartFunc = func(ctx context.Context, input *s3api.UploadPartInput) (*s3api.UploadPartOutput, error) {
+				var first bool
+				once.Do(func() { first = true })
+				if first {
+					tt.block(ctx, input.Body)
+					return nil, ctx.Err()
+				}
+				return uploadPart(ctx, input)
+			}
+
+			var mu sync.Mutex
+			var errs []error
+			t0 := time.Now()
+			clock := clocktest.New(t0)
+			u := &s3iot.Uploader{}
+			s3iot.WithAPI(api).ApplyToUploader(u)
+			s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 50}).ApplyToUploader(u)
+			s3iot.WithRetryer(&s3iot.RetryerHookFactory{
+				Base: &s3iot.ExponentialBackoffRetryerFactory{WaitBase: time.Millisecond},
+				OnError: func(bucket, key string, err error) {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				},
+			}).ApplyToUploader(u)
+			s3iot.WithClock(clock).ApplyToUploader(u)
+			for _, o := range tt.opts {
+				o.ApplyToUploader(u)
+			}
+
+			uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+				Bucket: &bucket,
+				Key:    &key,
+				Body:   bytes.NewReader(data),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			advanceUntilDone(t, clock, uc.Done())
+
+			if _, err := uc.Result(); err != nil {
+				t.Fatal(err)
+			}
+			status, err := uc.Status()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.NumRetries != 1 {
+				t.Errorf("Expected NumRetries: 1, got: %d", status.NumRetries)
+			}
+			mu.Lock()
+			if len(errs) != 1 || errs[0] != tt.err {
+				t.Errorf("Expected error: '%v', got: %v", tt.err, errs)
+			}
+			mu.Unlock()
+			if elapsed := clock.Now().Sub(t0); elapsed < tt.elapsed {
+				t.Errorf("Expected to be canceled after %v, elapsed: %v", tt.elapsed, elapsed)
+			}
+			if !bytes.Equal(data, buf.Bytes()) {
+				t.Error("Uploaded data differs")
+			}
+		})
+	}
+}
+
+func TestDownloader_StallTimeout(t *testing.T) {
+	var (
+		bucket = "Bucket"
+		key    = "Key"
+	)
+	data := make([]byte, 128)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	api := newDownloadMockAPI(t, data, 0, nil, nil)
+	var once sync.Once
+	getObject := api.GetObjectFunc
+	api.GetObjectFunc = func(ctx context.Context, input *s3api.GetObjectInput) (*s3api.GetObjectOutput, error) {
+		out, err := getObject(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		once.Do(func() {
+			out.Body = io.NopCloser(io.MultiReader(
+				io.LimitReader(out.Body, 10),
+				&blockReader{ctx: ctx},
+			))
+		})
+		return out, nil
+	}
+
+	clock := clocktest.New(time.Now())
+	buf := iotest.BufferAt(make([]byte, 128))
+	d := &s3iot.Downloader{}
+	s3iot.WithAPI(api).ApplyToDownloader(d)
+	s3iot.WithDownloadSlicer(&s3iot.DefaultDownloadSlicerFactory{PartSize: 50}).ApplyToDownloader(d)
+	s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{WaitBase: time.Millisecond}).ApplyToDownloader(d)
+	s3iot.WithStallTimeout(10 * time.Second).ApplyToDownloader(d)
+	s3iot.WithClock(clock).ApplyToDownloader(d)
+
+	dc, err := d.Download(context.TODO(), buf, &s3iot.DownloadInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	advanceUntilDone(t, clock, dc.Done())
+
+	if _, err := dc.Result(); err != nil {
+		t.Fatal(err)
+	}
+	status, err := dc.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.NumRetries != 1 {
+		t.Errorf("Expected NumRetries: 1, got: %d", status.NumRetries)
+	}
+	if !bytes.Equal(data, []byte(buf)) {
+		t.Error("Downloaded data differs")
+	}
+}
+
+func advanceUntilDone(t *testing.T, clock *clocktest.Clock, done <-chan struct{}) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case <-timeout:
+			t.Fatal("Timeout")
+		case <-done:
+			return
+		default:
+		}
+		if d, ok := clock.Next(); ok {
+			clock.Advance(d)
+		} else {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+type blockReader struct {
+	ctx context.Context
+}
+
+func (r *blockReader) Read([]byte) (int, error) {
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
@@ -0,0 +1,439 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Default CircuitBreakerRetryerFactory parameters.
+const (
+	DefaultRetryBudgetCapacity       = 100
+	DefaultRetryBudgetRefillInterval = time.Second
+	DefaultCircuitBreakerThreshold   = 5
+	DefaultCircuitBreakerOpenTimeout = 30 * time.Second
+)
+
+// CircuitState represents the state of the circuit breaker.
+type CircuitState int
+
+// Circuit breaker states.
+const (
+	// CircuitClosed allows API calls and retries.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen pauses all transfers.
+	CircuitOpen
+	// CircuitHalfOpen resumes one transfer to probe the recovery.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerRetryerFactory wraps RetryerFactory to share the retry budget
+// and the circuit breaker across all transfers created by the factory.
+//
+// Each retry consumes a token of the retry budget, which is refilled by one
+// every refill interval up to the capacity. Retry is given up if the budget
+// is exhausted.
+//
+// The circuit opens after the threshold number of consecutive failures
+// across all transfers, and pauses every transfer through their Pausers.
+// After the open timeout, the circuit becomes half-open and resumes one
+// transfer to probe. If the probe succeeds, the circuit is closed and all
+// transfers are resumed. Otherwise, the circuit opens again.
+// Failures while the circuit is open don't consume the retry budget,
+// but are still counted by the base Retryer to bound the retries.
+//
+// Throttle waits requested by the server are shared across the transfers.
+// Retries of all transfers are held off until the end of the longest wait.
+//
+// Transfers are tracked until the Pauser notifies completion through
+// DoneNotifier. Pausers implementing SharedPauser are kept paused
+// while they are paused by the user or the other owners.
+// The other Pausers are resumed by the circuit breaker regardless of
+// the pause by the others.
+type CircuitBreakerRetryerFactory struct {
+	base RetryerFactory
+
+	mu              sync.Mutex
+	clock           Clock
+	budgetCapacity  int
+	budgetRefill    time.Duration
+	tokens          int
+	lastRefill      time.Time
+	threshold       int
+	openTimeout     time.Duration
+	failures        int
+	state           CircuitState
+	generation      int
+	pausers         []Pauser
+	pausedByBreaker map[Pauser]bool
+	probe           Pauser
+	throttledUntil  time.Time
+	// actions are the pauses and resumes to be applied outside the lock.
+	actions  []pauseAction
+	applying bool
+}
+
+type pauseAction struct {
+	p     Pauser
+	pause bool
+}
+
+// CircuitBreakerOption configures CircuitBreakerRetryerFactory.
+type CircuitBreakerOption func(*CircuitBreakerRetryerFactory)
+
+// CircuitBreakerRetryBudget sets the capacity and the refill interval
+// of the retry budget.
+// Zero capacity disables the retry budget.
+func CircuitBreakerRetryBudget(capacity int, refillInterval time.Duration) CircuitBreakerOption {
+	return func(f *CircuitBreakerRetryerFactory) {
+		f.budgetCapacity = capacity
+		f.budgetRefill = refillInterval
+	}
+}
+
+// CircuitBreakerThreshold sets the number of the consecutive failures
+// to open the circuit.
+// Zero threshold disables the circuit breaker.
+func CircuitBreakerThreshold(n int) CircuitBreakerOption {
+	return func(f *CircuitBreakerRetryerFactory) {
+		f.threshold = n
+	}
+}
+
+// CircuitBreakerOpenTimeout sets the duration from opening the circuit
+// to probing the recovery.
+func CircuitBreakerOpenTimeout(d time.Duration) CircuitBreakerOption {
+	return func(f *CircuitBreakerRetryerFactory) {
+		f.openTimeout = d
+	}
+}
+
+// CircuitBreakerClock sets Clock used by the retry budget and the open timeout.
+func CircuitBreakerClock(c Clock) CircuitBreakerOption {
+	return func(f *CircuitBreakerRetryerFactory) {
+		f.clock = c
+	}
+}
+
+// NewCircuitBreakerRetryerFactory creates CircuitBreakerRetryerFactory.
+// If base is nil, DefaultRetryer is used.
+func NewCircuitBreakerRetryerFactory(base RetryerFactory, opts ...CircuitBreakerOption) *CircuitBreakerRetryerFactory {
+	if base == nil {
+		base = DefaultRetryer
+	}
+	f := &CircuitBreakerRetryerFactory{
+		base:            base,
+		clock:           DefaultClock,
+		budgetCapacity:  DefaultRetryBudgetCapacity,
+		budgetRefill:    DefaultRetryBudgetRefillInterval,
+		threshold:       DefaultCircuitBreakerThreshold,
+		openTimeout:     DefaultCircuitBreakerOpenTimeout,
+		pausedByBreaker: make(map[Pauser]bool),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	f.tokens = f.budgetCapacity
+	f.lastRefill = f.clock.Now()
+	return f
+}
+
+// New creates CircuitBreakerRetryer.
+// Transfer created while the circuit is not closed is paused
+// until the circuit is closed.
+func (f *CircuitBreakerRetryerFactory) New(p Pauser) Retryer {
+	f.mu.Lock()
+	f.pausers = append(f.pausers, p)
+	if f.state != CircuitClosed {
+		f.pausedByBreaker[p] = true
+		f.pauseLocked(p)
+	}
+	f.mu.Unlock()
+	f.applyActions()
+	if dn, ok := p.(DoneNotifier); ok {
+		go func() {
+			<-dn.Done()
+			f.remove(p)
+		}()
+	}
+	return &circuitBreakerRetryer{
+		factory: f,
+		base:    f.base.New(p),
+	}
+}
+
+// State returns the current state of the circuit.
+func (f *CircuitBreakerRetryerFactory) State() CircuitState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+// Tokens returns the number of the remaining tokens of the retry budget.
+func (f *CircuitBreakerRetryerFactory) Tokens() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.refillLocked()
+	return f.tokens
+}
+
+func (f *CircuitBreakerRetryerFactory) refillLocked() {
+	if f.budgetRefill <= 0 {
+		return
+	}
+	now := f.clock.Now()
+	n := int(now.Sub(f.lastRefill) / f.budgetRefill)
+	if n <= 0 {
+		return
+	}
+	f.tokens += n
+	f.lastRefill = f.lastRefill.Add(time.Duration(n) * f.budgetRefill)
+	if f.tokens >= f.budgetCapacity {
+		f.tokens = f.budgetCapacity
+		f.lastRefill = now
+	}
+}
+
+func (f *CircuitBreakerRetryerFactory) throttle(wait time.Duration) {
+	f.mu.Lock()
+	if until := f.clock.Now().Add(wait); until.After(f.throttledUntil) {
+		f.throttledUntil = until
+	}
+	f.mu.Unlock()
+}
+
+// waitThrottle waits until the end of the shared throttle wait.
+func (f *CircuitBreakerRetryerFactory) waitThrottle(ctx context.Context) {
+	f.mu.Lock()
+	wait := f.throttledUntil.Sub(f.clock.Now())
+	f.mu.Unlock()
+	if wait <= 0 {
+		return
+	}
+	select {
+	case <-f.clock.After(wait):
+	case <-ctx.Done():
+	}
+}
+
+func (f *CircuitBreakerRetryerFactory) takeToken() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.budgetCapacity <= 0 {
+		return true
+	}
+	f.refillLocked()
+	if f.tokens <= 0 {
+		return false
+	}
+	f.tokens--
+	return true
+}
+
+// onFail records the failure and returns true if the circuit is open
+// and the transfer is paused.
+func (f *CircuitBreakerRetryerFactory) onFail() bool {
+	f.mu.Lock()
+	if f.threshold <= 0 {
+		f.mu.Unlock()
+		return false
+	}
+	f.failures++
+	switch f.state {
+	case CircuitClosed:
+		if f.failures < f.threshold {
+			f.mu.Unlock()
+			return false
+		}
+		f.openLocked()
+	case CircuitHalfOpen:
+		f.openLocked()
+	}
+	for _, p := range f.pausers {
+		if !f.pausedByBreaker[p] {
+			f.pausedByBreaker[p] = true
+			f.pauseLocked(p)
+		}
+	}
+	f.mu.Unlock()
+	f.applyActions()
+	return true
+}
+
+func (f *CircuitBreakerRetryerFactory) onSuccess() {
+	f.mu.Lock()
+	f.failures = 0
+	if f.state == CircuitClosed {
+		f.mu.Unlock()
+		return
+	}
+	f.closeLocked()
+	f.mu.Unlock()
+	f.applyActions()
+}
+
+func (f *CircuitBreakerRetryerFactory) pauseLocked(p Pauser) {
+	f.actions = append(f.actions, pauseAction{p: p, pause: true})
+}
+
+func (f *CircuitBreakerRetryerFactory) resumeLocked(p Pauser) {
+	f.actions = append(f.actions, pauseAction{p: p})
+}
+
+// applyActions calls the queued pauses and resumes in order without holding
+// the lock, since the Pausers may call back the factory.
+// If another goroutine is applying, the actions are applied by it.
+func (f *CircuitBreakerRetryerFactory) applyActions() {
+	f.mu.Lock()
+	if f.applying {
+		f.mu.Unlock()
+		return
+	}
+	f.applying = true
+	for len(f.actions) > 0 {
+		actions := f.actions
+		f.actions = nil
+		f.mu.Unlock()
+		for _, a := range actions {
+			if a.pause {
+				PauseBy(a.p, f, false)
+			} else {
+				ResumeBy(a.p, f)
+			}
+		}
+		f.mu.Lock()
+	}
+	f.applying = false
+	f.mu.Unlock()
+}
+
+func (f *CircuitBreakerRetryerFactory) openLocked() {
+	f.state = CircuitOpen
+	f.probe = nil
+	f.generation++
+	gen := f.generation
+	after := f.clock.After(f.openTimeout)
+	go func() {
+		<-after
+		f.halfOpen(gen)
+	}()
+}
+
+func (f *CircuitBreakerRetryerFactory) closeLocked() {
+	f.state = CircuitClosed
+	f.probe = nil
+	f.generation++
+	for _, p := range f.pausers {
+		if f.pausedByBreaker[p] {
+			f.resumeLocked(p)
+		}
+	}
+	f.pausedByBreaker = make(map[Pauser]bool)
+}
+
+func (f *CircuitBreakerRetryerFactory) halfOpen(gen int) {
+	f.mu.Lock()
+	if f.generation != gen || f.state != CircuitOpen {
+		f.mu.Unlock()
+		return
+	}
+	f.probeLocked()
+	f.mu.Unlock()
+	f.applyActions()
+}
+
+// probeLocked resumes one of the paused transfers to probe the recovery.
+// If no transfer remains, the circuit is closed.
+func (f *CircuitBreakerRetryerFactory) probeLocked() {
+	for _, p := range f.pausers {
+		if f.pausedByBreaker[p] {
+			f.state = CircuitHalfOpen
+			f.probe = p
+			delete(f.pausedByBreaker, p)
+			f.resumeLocked(p)
+			return
+		}
+	}
+	f.closeLocked()
+}
+
+func (f *CircuitBreakerRetryerFactory) remove(p Pauser) {
+	f.mu.Lock()
+	for i, pp := range f.pausers {
+		if pp == p {
+			f.pausers = append(f.pausers[:i], f.pausers[i+1:]...)
+			break
+		}
+	}
+	delete(f.pausedByBreaker, p)
+	if f.state == CircuitHalfOpen && f.probe == p {
+		f.probeLocked()
+	}
+	f.mu.Unlock()
+	f.applyActions()
+}
+
+type circuitBreakerRetryer struct {
+	factory *CircuitBreakerRetryerFactory
+	base    Retryer
+}
+
+func (r *circuitBreakerRetryer) OnFail(ctx context.Context, id int64, err error) bool {
+	if r.factory.onFail() {
+		// Retry after resumed by the circuit breaker
+		// unless the base Retryer gives up.
+		return r.base.OnFail(ctx, id, err)
+	}
+	r.factory.waitThrottle(ctx)
+	if !r.factory.takeToken() {
+		return false
+	}
+	return r.base.OnFail(ctx, id, err)
+}
+
+// OnThrottle implements ThrottleObserver.
+func (r *circuitBreakerRetryer) OnThrottle(id int64, wait time.Duration) {
+	r.factory.throttle(wait)
+	if to, ok := r.base.(ThrottleObserver); ok {
+		to.OnThrottle(id, wait)
+	}
+}
+
+func (r *circuitBreakerRetryer) classifyError(err error) (ErrorClass, bool) {
+	if ec, ok := r.base.(errorClassProvider); ok {
+		return ec.classifyError(err)
+	}
+	return 0, false
+}
+
+func (r *circuitBreakerRetryer) OnSuccess(id int64) {
+	r.factory.onSuccess()
+	r.base.OnSuccess(id)
+}
@@ -0,0 +1,529 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot/clocktest"
+	mock_s3api "github.com/at-wat/s3iot/internal/moq/s3api"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+var _ RetryerFactory = &CircuitBreakerRetryerFactory{}
+
+func TestCircuitBreakerRetryerFactory(t *testing.T) {
+	t.Run("RetryBudget", func(t *testing.T) {
+		clock := clocktest.New(time.Now())
+		f := NewCircuitBreakerRetryerFactory(
+			&continueRetryerFactory{},
+			CircuitBreakerRetryBudget(3, time.Minute),
+			CircuitBreakerThreshold(0),
+			CircuitBreakerClock(clock),
+		)
+		r1, r2 := f.New(newTestPauser()), f.New(newTestPauser())
+
+		for i, r := range []Retryer{r1, r2, r1} {
+			if !r.OnFail(context.TODO(), 0, errDummy) {
+				t.Fatalf("Retry %d must be allowed", i)
+			}
+		}
+		if f.Tokens() != 0 {
+			t.Fatalf("Expected no token, remains %d", f.Tokens())
+		}
+		if r2.OnFail(context.TODO(), 0, errDummy) {
+			t.Fatal("Retry must be denied after exhausting the budget")
+		}
+
+		clock.Advance(time.Minute)
+		if f.Tokens() != 1 {
+			t.Fatalf("Expected 1 token, remains %d", f.Tokens())
+		}
+		if !r2.OnFail(context.TODO(), 0, errDummy) {
+			t.Fatal("Retry must be allowed after refilled")
+		}
+
+		clock.Advance(time.Hour)
+		if f.Tokens() != 3 {
+			t.Fatalf("Tokens must be refilled up to the capacity, remains %d", f.Tokens())
+		}
+	})
+	t.Run("CircuitBreaker", func(t *testing.T) {
+		clock := clocktest.New(time.Now())
+		f := NewCircuitBreakerRetryerFactory(
+			&continueRetryerFactory{},
+			CircuitBreakerRetryBudget(1, time.Hour),
+			CircuitBreakerThreshold(3),
+			CircuitBreakerOpenTimeout(time.Minute),
+			CircuitBreakerClock(clock),
+		)
+		p := []*testPauser{newTestPauser(), newTestPauser(), newTestPauser()}
+		r := []Retryer{f.New(p[0]), f.New(p[1]), f.New(p[2])}
+
+		checkPaused := func(t *testing.T, expected ...bool) {
+			t.Helper()
+			for i := range p {
+				if paused := p[i].isPaused(); paused != expected[i] {
+					t.Errorf("Expected paused state of %d: %v, got: %v", i, expected[i], paused)
+				}
+			}
+		}
+
+		// Success resets the consecutive failures.
+		r[0].OnFail(context.TODO(), 0, errDummy)
+		r[1].OnSuccess(0)
+		r[1].OnFail(context.TODO(), 0, errDummy)
+		if f.State() != CircuitClosed {
+			t.Fatalf("Expected state: %v, got: %v", CircuitClosed, f.State())
+		}
+		// Retry budget is exhausted but the circuit is opened at the threshold.
+		if r[2].OnFail(context.TODO(), 0, errDummy) {
+			t.Fatal("Retry must be denied after exhausting the budget")
+		}
+		if !r[0].OnFail(context.TODO(), 0, errDummy) {
+			t.Fatal("Retry must be continued after resumed")
+		}
+		if f.State() != CircuitOpen {
+			t.Fatalf("Expected state: %v, got: %v", CircuitOpen, f.State())
+		}
+		checkPaused(t, true, true, true)
+
+		// Failures during open state don't pause twice.
+		if !r[1].OnFail(context.TODO(), 0, errDummy) {
+			t.Fatal("Retry must be continued after resumed")
+		}
+		for i := range p {
+			if n := p[i].numPauses(); n != 1 {
+				t.Errorf("Pauser %d must be paused once, paused %d times", i, n)
+			}
+		}
+
+		// Probe fails.
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		waitState(t, f, CircuitHalfOpen)
+		checkPaused(t, false, true, true)
+		r[0].OnFail(context.TODO(), 0, errDummy)
+		if f.State() != CircuitOpen {
+			t.Fatalf("Expected state: %v, got: %v", CircuitOpen, f.State())
+		}
+		checkPaused(t, true, true, true)
+
+		// Probe transfer is finished without result.
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		waitState(t, f, CircuitHalfOpen)
+		checkPaused(t, false, true, true)
+		p[0].finish()
+		waitPaused(t, p[1], false)
+		checkPaused(t, false, false, true)
+
+		// Probe succeeds.
+		r[1].OnSuccess(0)
+		if f.State() != CircuitClosed {
+			t.Fatalf("Expected state: %v, got: %v", CircuitClosed, f.State())
+		}
+		checkPaused(t, false, false, false)
+	})
+	t.Run("Throttle", func(t *testing.T) {
+		clock := clocktest.New(time.Now())
+		f := NewCircuitBreakerRetryerFactory(
+			&continueRetryerFactory{},
+			CircuitBreakerThreshold(0),
+			CircuitBreakerClock(clock),
+		)
+		r1, r2 := f.New(newTestPauser()), f.New(newTestPauser())
+
+		r1.(ThrottleObserver).OnThrottle(0, time.Minute)
+		r1.(ThrottleObserver).OnThrottle(0, time.Second)
+		clock.Advance(10 * time.Second)
+
+		done := make(chan bool)
+		go func() {
+			done <- r2.OnFail(context.TODO(), 1, errDummy)
+		}()
+		clock.BlockUntil(1)
+		if wait, _ := clock.Next(); wait != 50*time.Second {
+			t.Fatalf("Expected to wait the rest of the longest throttle wait, got %v", wait)
+		}
+		select {
+		case <-done:
+			t.Fatal("Retry must be held off")
+		case <-time.After(10 * time.Millisecond):
+		}
+		clock.Advance(50 * time.Second)
+		if !<-done {
+			t.Fatal("Retry must be allowed after the throttle wait")
+		}
+		if !r1.OnFail(context.TODO(), 0, errDummy) {
+			t.Fatal("Retry must be allowed without wait")
+		}
+	})
+	t.Run("NoTransfer", func(t *testing.T) {
+		clock := clocktest.New(time.Now())
+		f := NewCircuitBreakerRetryerFactory(
+			&continueRetryerFactory{},
+			CircuitBreakerThreshold(1),
+			CircuitBreakerClock(clock),
+		)
+		p := newTestPauser()
+		f.New(p).OnFail(context.TODO(), 0, errDummy)
+		if f.State() != CircuitOpen {
+			t.Fatalf("Expected state: %v, got: %v", CircuitOpen, f.State())
+		}
+		p.finish()
+		clock.BlockUntil(1)
+		clock.Advance(DefaultCircuitBreakerOpenTimeout)
+		waitState(t, f, CircuitClosed)
+	})
+	t.Run("RetryMaxWhileOpen", func(t *testing.T) {
+		f := NewCircuitBreakerRetryerFactory(
+			&ExponentialBackoffRetryerFactory{WaitBase: time.Nanosecond, RetryMax: 2},
+			CircuitBreakerThreshold(1),
+		)
+		r := f.New(newTestPauser())
+		for i := 0; i < 2; i++ {
+			if !r.OnFail(context.TODO(), 0, errDummy) {
+				t.Fatalf("Retry %d must be allowed", i)
+			}
+		}
+		if f.State() != CircuitOpen {
+			t.Fatalf("Expected state: %v, got: %v", CircuitOpen, f.State())
+		}
+		if r.OnFail(context.TODO(), 0, errDummy) {
+			t.Fatal("Retry must be denied after exceeding RetryMax of the base Retryer")
+		}
+	})
+	t.Run("NewWhileOpen", func(t *testing.T) {
+		clock := clocktest.New(time.Now())
+		f := NewCircuitBreakerRetryerFactory(
+			&continueRetryerFactory{},
+			CircuitBreakerThreshold(1),
+			CircuitBreakerOpenTimeout(time.Minute),
+			CircuitBreakerClock(clock),
+		)
+		p0 := newTestPauser()
+		r0 := f.New(p0)
+		r0.OnFail(context.TODO(), 0, errDummy)
+		waitPaused(t, p0, true)
+
+		p1 := newTestPauser()
+		f.New(p1)
+		if !p1.isPaused() {
+			t.Fatal("Transfer created while the circuit is open must be paused")
+		}
+
+		// Probe by p0 closes the circuit and resumes p1.
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		waitState(t, f, CircuitHalfOpen)
+		waitPaused(t, p0, false)
+		r0.OnSuccess(0)
+		waitState(t, f, CircuitClosed)
+		waitPaused(t, p1, false)
+	})
+	t.Run("PauseWithoutLock", func(t *testing.T) {
+		f := NewCircuitBreakerRetryerFactory(
+			&continueRetryerFactory{},
+			CircuitBreakerThreshold(1),
+		)
+		var states []CircuitState
+		p := &callbackPauser{
+			testPauser: newTestPauser(),
+			fn: func() {
+				// Deadlocks if Pause is called under the lock.
+				states = append(states, f.State())
+			},
+		}
+		done := make(chan struct{})
+		go func() {
+			f.New(p).OnFail(context.TODO(), 0, errDummy)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		}
+		if len(states) != 1 || states[0] != CircuitOpen {
+			t.Errorf("Expected Pause to be called once while the circuit is open, got: %v", states)
+		}
+	})
+	t.Run("OpenDuringNew", func(t *testing.T) {
+		clock := clocktest.New(time.Now())
+		var other Retryer
+		f := NewCircuitBreakerRetryerFactory(
+			&hookRetryerFactory{
+				fn: func(Pauser) {
+					if other != nil {
+						// Opens the circuit and pauses the transfer being created.
+						other.OnFail(context.TODO(), 0, errDummy)
+					}
+				},
+			},
+			CircuitBreakerThreshold(1),
+			CircuitBreakerOpenTimeout(time.Minute),
+			CircuitBreakerClock(clock),
+		)
+		p := newTestPauser()
+		other = f.New(p)
+
+		api := &mock_s3api.MockS3API{
+			PutObjectFunc: func(ctx context.Context, input *s3api.PutObjectInput) (*s3api.PutObjectOutput, error) {
+				return &s3api.PutObjectOutput{}, nil
+			},
+		}
+		u := &Uploader{}
+		WithAPI(api).ApplyToUploader(u)
+		WithRetryer(f).ApplyToUploader(u)
+		bucket, key := "bucket", "key"
+		uc, err := u.Upload(context.TODO(), &UploadInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Body:   bytes.NewReader([]byte{0}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitStatus(t, uc, func(s UploadStatus) bool { return s.Paused })
+
+		p.finish()
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		select {
+		case <-uc.Done():
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		}
+		if _, err := uc.Result(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("Uploader", func(t *testing.T) {
+		clock := clocktest.New(time.Now())
+		f := NewCircuitBreakerRetryerFactory(
+			&ExponentialBackoffRetryerFactory{WaitBase: time.Millisecond},
+			CircuitBreakerThreshold(3),
+			CircuitBreakerOpenTimeout(time.Minute),
+			CircuitBreakerClock(clock),
+		)
+		var mu sync.Mutex
+		var calls int
+		down := true
+		api := &mock_s3api.MockS3API{
+			PutObjectFunc: func(ctx context.Context, input *s3api.PutObjectInput) (*s3api.PutObjectOutput, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls++
+				if down {
+					return nil, errDummy
+				}
+				return &s3api.PutObjectOutput{}, nil
+			},
+		}
+		u := &Uploader{}
+		WithAPI(api).ApplyToUploader(u)
+		WithRetryer(f).ApplyToUploader(u)
+
+		var ucs []UploadContext
+		for i := 0; i < 3; i++ {
+			bucket, key := "bucket", "key"
+			uc, err := u.Upload(context.TODO(), &UploadInput{
+				Bucket: &bucket,
+				Key:    &key,
+				Body:   bytes.NewReader([]byte{0}),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ucs = append(ucs, uc)
+		}
+		for _, uc := range ucs {
+			waitStatus(t, uc, func(s UploadStatus) bool { return s.Paused })
+		}
+		// Pause by the user is kept after the circuit is closed.
+		ucs[2].Pause()
+		if f.State() != CircuitOpen {
+			t.Fatalf("Expected state: %v, got: %v", CircuitOpen, f.State())
+		}
+		mu.Lock()
+		if calls != 3 {
+			t.Errorf("Expected 3 calls, got %d", calls)
+		}
+		down = false
+		mu.Unlock()
+
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		for _, uc := range ucs[:2] {
+			select {
+			case <-uc.Done():
+			case <-time.After(time.Second):
+				t.Fatal("Timeout")
+			}
+		}
+		if s, _ := ucs[2].Status(); !s.Paused {
+			t.Fatal("Transfer paused by the user must be kept paused")
+		}
+		ucs[2].Resume()
+		for _, uc := range ucs {
+			select {
+			case <-uc.Done():
+			case <-time.After(time.Second):
+				t.Fatal("Timeout")
+			}
+			if _, err := uc.Result(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if f.State() != CircuitClosed {
+			t.Fatalf("Expected state: %v, got: %v", CircuitClosed, f.State())
+		}
+	})
+}
+
+func TestCircuitState(t *testing.T) {
+	for s, expected := range map[CircuitState]string{
+		CircuitClosed:    "closed",
+		CircuitOpen:      "open",
+		CircuitHalfOpen:  "half-open",
+		CircuitState(-1): "unknown",
+	} {
+		if str := s.String(); str != expected {
+			t.Errorf("Expected %s, got %s", expected, str)
+		}
+	}
+}
+
+func waitState(t *testing.T, f *CircuitBreakerRetryerFactory, s CircuitState) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for f.State() != s {
+		select {
+		case <-timeout:
+			t.Fatalf("Timeout waiting state %v, current: %v", s, f.State())
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func waitPaused(t *testing.T, p *testPauser, paused bool) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for p.isPaused() != paused {
+		select {
+		case <-timeout:
+			t.Fatalf("Timeout waiting paused=%v", paused)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func waitStatus(t *testing.T, uc UploadContext, fn func(UploadStatus) bool) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		s, _ := uc.Status()
+		if fn(s) {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("Timeout waiting status, current: %+v", s)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+type continueRetryerFactory struct{}
+
+func (continueRetryerFactory) New(Pauser) Retryer {
+	return &continueRetryer{}
+}
+
+type continueRetryer struct{}
+
+func (continueRetryer) OnFail(context.Context, int64, error) bool {
+	return true
+}
+
+func (continueRetryer) OnSuccess(int64) {}
+
+type hookRetryerFactory struct {
+	fn func(Pauser)
+}
+
+func (f *hookRetryerFactory) New(p Pauser) Retryer {
+	f.fn(p)
+	return &continueRetryer{}
+}
+
+type callbackPauser struct {
+	*testPauser
+	fn func()
+}
+
+func (p *callbackPauser) Pause() {
+	p.testPauser.Pause()
+	p.fn()
+}
+
+type testPauser struct {
+	mu     sync.Mutex
+	paused bool
+	pauses int
+	done   chan struct{}
+}
+
+func newTestPauser() *testPauser {
+	return &testPauser{done: make(chan struct{})}
+}
+
+func (p *testPauser) Pause() {
+	p.mu.Lock()
+	p.paused = true
+	p.pauses++
+	p.mu.Unlock()
+}
+
+func (p *testPauser) Resume() {
+	p.mu.Lock()
+	p.paused = false
+	p.mu.Unlock()
+}
+
+func (p *testPauser) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *testPauser) finish() {
+	close(p.done)
+}
+
+func (p *testPauser) isPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+func (p *testPauser) numPauses() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pauses
+}
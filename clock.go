@@ -0,0 +1,72 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"time"
+)
+
+// Clock provides current time and timers.
+// It is used to wait retry intervals and bandwidth limit
+// so that the timing can be controlled by tests.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+// ClockProvider provides Clock.
+// Pauser passed to RetryerFactory implements ClockProvider
+// to share the Clock of the Uploader, Downloader or Copier.
+type ClockProvider interface {
+	Clock() Clock
+}
+
+// DefaultClock is the default Clock used by Uploader, Downloader and Copier.
+var DefaultClock Clock = SystemClock{}
+
+// SystemClock is Clock based on the system time.
+type SystemClock struct{}
+
+// Now implements Clock.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After implements Clock.
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Sleep implements Clock.
+func (SystemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// clockOf returns Clock provided by p or DefaultClock.
+func clockOf(p interface{}) Clock {
+	if cp, ok := p.(ClockProvider); ok {
+		if c := cp.Clock(); c != nil {
+			return c
+		}
+	}
+	return DefaultClock
+}
+
+// clockSetter is implemented by the built-in ReadInterceptors
+// to use the Clock of the Uploader.
+type clockSetter interface {
+	setClock(Clock)
+}
@@ -0,0 +1,146 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clocktest provides fake s3iot.Clock for testing.
+package clocktest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is fake s3iot.Clock.
+// The time doesn't advance until Advance or Set is called.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+	changed chan struct{}
+}
+
+type waiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+// New creates fake Clock starting from the given time.
+func New(now time.Time) *Clock {
+	return &Clock{
+		now:     now,
+		changed: make(chan struct{}),
+	}
+}
+
+// Now implements s3iot.Clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After implements s3iot.Clock.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, &waiter{
+		until: c.now.Add(d),
+		ch:    ch,
+	})
+	c.notify()
+	return ch
+}
+
+// Sleep implements s3iot.Clock.
+func (c *Clock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Advance advances the time and fires the expired timers.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	now := c.now.Add(d)
+	c.mu.Unlock()
+	c.Set(now)
+}
+
+// Set sets the time and fires the expired timers.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].until.Before(c.waiters[j].until)
+	})
+	var n int
+	for _, w := range c.waiters {
+		if w.until.After(now) {
+			break
+		}
+		w.ch <- now
+		n++
+	}
+	if n > 0 {
+		c.waiters = c.waiters[n:]
+		c.notify()
+	}
+}
+
+// Waiters returns the number of the pending timers.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// Next returns the duration until the earliest pending timer expires.
+// It returns false if no timer is pending.
+func (c *Clock) Next() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waiters) == 0 {
+		return 0, false
+	}
+	next := c.waiters[0].until
+	for _, w := range c.waiters[1:] {
+		if w.until.Before(next) {
+			next = w.until
+		}
+	}
+	return next.Sub(c.now), true
+}
+
+// BlockUntil blocks until the number of the pending timers reaches n.
+func (c *Clock) BlockUntil(n int) {
+	for {
+		c.mu.Lock()
+		if len(c.waiters) >= n {
+			c.mu.Unlock()
+			return
+		}
+		changed := c.changed
+		c.mu.Unlock()
+		<-changed
+	}
+}
+
+func (c *Clock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
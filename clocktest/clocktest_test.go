@@ -0,0 +1,111 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clocktest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+)
+
+var _ s3iot.Clock = &Clock{}
+
+func TestClock(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("After", func(t *testing.T) {
+		c := New(t0)
+		ch1 := c.After(2 * time.Second)
+		ch2 := c.After(time.Second)
+		if n := c.Waiters(); n != 2 {
+			t.Fatalf("Expected 2 waiters, got %d", n)
+		}
+		if d, ok := c.Next(); !ok || d != time.Second {
+			t.Errorf("Expected next timer in 1s, got %v, %v", d, ok)
+		}
+
+		c.Advance(500 * time.Millisecond)
+		select {
+		case <-ch1:
+			t.Fatal("Timer must not be fired")
+		case <-ch2:
+			t.Fatal("Timer must not be fired")
+		default:
+		}
+
+		c.Advance(500 * time.Millisecond)
+		select {
+		case now := <-ch2:
+			if expected := t0.Add(time.Second); !now.Equal(expected) {
+				t.Errorf("Expected %v, got %v", expected, now)
+			}
+		default:
+			t.Fatal("Timer must be fired")
+		}
+		select {
+		case <-ch1:
+			t.Fatal("Timer must not be fired")
+		default:
+		}
+
+		c.Set(t0.Add(time.Hour))
+		select {
+		case <-ch1:
+		default:
+			t.Fatal("Timer must be fired")
+		}
+		if n := c.Waiters(); n != 0 {
+			t.Errorf("Expected no waiter, got %d", n)
+		}
+		if _, ok := c.Next(); ok {
+			t.Error("No timer must be pending")
+		}
+		if now := c.Now(); !now.Equal(t0.Add(time.Hour)) {
+			t.Errorf("Unexpected time: %v", now)
+		}
+	})
+	t.Run("Immediate", func(t *testing.T) {
+		c := New(t0)
+		select {
+		case now := <-c.After(0):
+			if !now.Equal(t0) {
+				t.Errorf("Expected %v, got %v", t0, now)
+			}
+		default:
+			t.Fatal("Timer must be fired immediately")
+		}
+	})
+	t.Run("Sleep", func(t *testing.T) {
+		c := New(t0)
+		done := make(chan struct{})
+		go func() {
+			c.Sleep(time.Minute)
+			close(done)
+		}()
+		c.BlockUntil(1)
+		select {
+		case <-done:
+			t.Fatal("Sleep must be blocked")
+		default:
+		}
+		c.Advance(time.Minute)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		}
+	})
+}
@@ -0,0 +1,452 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+const journalUpdateInterval = time.Second
+
+// client runs the transfers configured by the flags.
+type client struct {
+	env        *env
+	cfg        *config
+	api        s3api.S3API
+	uploader   *s3iot.Uploader
+	downloader *s3iot.Downloader
+	copier     *s3iot.Copier
+	journal    *journal
+	pausers    *pauseGroup
+	progress   *progress
+	cancel     func()
+}
+
+func newClient(ctx context.Context, e *env, cfg *config) (*client, error) {
+	api, err := cfg.api(ctx)
+	if err != nil {
+		return nil, err
+	}
+	retryer, err := cfg.retryer()
+	if err != nil {
+		return nil, err
+	}
+	logger, level, err := cfg.logger(e)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.concurrency < 1 {
+		return nil, fmt.Errorf("invalid concurrency %d", cfg.concurrency)
+	}
+
+	base := s3iot.UpDownloaderBase{
+		API:             api,
+		RetryerFactory:  retryer,
+		ErrorClassifier: cfg.errorClassifier(),
+		ForcePause:      cfg.forcePause,
+		StallTimeout:    cfg.stallTimeout,
+		Logger:          logger,
+		LogLevel:        level,
+	}
+	c := &client{
+		env:        e,
+		cfg:        cfg,
+		api:        api,
+		uploader:   &s3iot.Uploader{UpDownloaderBase: base},
+		downloader: &s3iot.Downloader{UpDownloaderBase: base},
+		copier:     &s3iot.Copier{UpDownloaderBase: base},
+		journal:    &journal{dir: cfg.stateDir},
+		pausers:    &pauseGroup{members: make(map[s3iot.Pauser]struct{})},
+	}
+	// Object size is learned by HeadObject to download empty objects
+	// which can't be requested by the ranged GetObject.
+	if _, ok := api.(s3api.HeadAPI); ok {
+		c.downloader.HeadFirst = true
+	}
+	if cfg.partSize > 0 {
+		c.uploader.UploadSlicerFactory = &s3iot.DefaultUploadSlicerFactory{PartSize: int64(cfg.partSize)}
+		c.downloader.DownloadSlicerFactory = &s3iot.DefaultDownloadSlicerFactory{PartSize: int64(cfg.partSize)}
+		// Copy part size is kept within the S3 limits
+		// since small parts are allowed on the other backends.
+		c.copier.PartSize = int64(cfg.partSize)
+		if c.copier.PartSize < s3iot.MinCopyPartSize {
+			c.copier.PartSize = s3iot.MinCopyPartSize
+		}
+		if c.copier.PartSize > s3iot.MaxCopyPartSize {
+			c.copier.PartSize = s3iot.MaxCopyPartSize
+		}
+	}
+	if cfg.bandwidth > 0 {
+		wait := time.Second / time.Duration(cfg.bandwidth)
+		if wait == 0 {
+			return nil, fmt.Errorf("too large bandwidth %d", cfg.bandwidth)
+		}
+		c.uploader.ReadInterceptorFactory = s3iot.NewWaitReadInterceptorFactory(wait)
+	}
+	c.progress = newProgress(e.stderr, cfg.progress, c.pausers.paused)
+
+	ctx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	go c.watchSignals(ctx)
+	return c, nil
+}
+
+func (c *client) close() {
+	c.cancel()
+	c.progress.close()
+}
+
+func (c *client) watchSignals(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-c.env.signals:
+			switch sig {
+			case pauseSignal:
+				c.pausers.Pause()
+				c.progress.println(c.env.stderr, "paused")
+			case resumeSignal:
+				c.pausers.Resume()
+				c.progress.println(c.env.stderr, "resumed")
+			}
+		}
+	}
+}
+
+// printf prints the message to stdout.
+func (c *client) printf(format string, a ...interface{}) {
+	c.progress.println(c.env.stdout, fmt.Sprintf(format, a...))
+}
+
+// pauseGroup pauses and resumes the active transfers.
+// Transfers added during pause are paused immediately.
+type pauseGroup struct {
+	mu       sync.Mutex
+	isPaused bool
+	members  map[s3iot.Pauser]struct{}
+}
+
+func (g *pauseGroup) add(p s3iot.Pauser) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.members[p] = struct{}{}
+	if g.isPaused {
+		p.Pause()
+	}
+}
+
+func (g *pauseGroup) remove(p s3iot.Pauser) {
+	g.mu.Lock()
+	delete(g.members, p)
+	g.mu.Unlock()
+}
+
+func (g *pauseGroup) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.isPaused
+}
+
+func (g *pauseGroup) Pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.isPaused = true
+	for p := range g.members {
+		p.Pause()
+	}
+}
+
+func (g *pauseGroup) Resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.isPaused = false
+	for p := range g.members {
+		p.Resume()
+	}
+}
+
+// transfer is the common interface of UploadContext, DownloadContext
+// and CopyContext.
+type transfer interface {
+	s3iot.Pauser
+	s3iot.DoneNotifier
+	status() (s3iot.Status, string)
+	result() (skipped bool, err error)
+}
+
+type uploadTransfer struct{ s3iot.UploadContext }
+
+func (t uploadTransfer) status() (s3iot.Status, string) {
+	s, _ := t.Status()
+	s.CompletedSize += s.SkippedSize
+	return s.Status, s.UploadID
+}
+
+func (t uploadTransfer) result() (bool, error) {
+	out, err := t.Result()
+	return out.Skipped, err
+}
+
+type downloadTransfer struct{ s3iot.DownloadContext }
+
+func (t downloadTransfer) status() (s3iot.Status, string) {
+	s, _ := t.Status()
+	return s.Status, ""
+}
+
+func (t downloadTransfer) result() (bool, error) {
+	_, err := t.Result()
+	return false, err
+}
+
+type copyTransfer struct{ s3iot.CopyContext }
+
+func (t copyTransfer) status() (s3iot.Status, string) {
+	s, _ := t.Status()
+	return s.Status, s.UploadID
+}
+
+func (t copyTransfer) result() (bool, error) {
+	_, err := t.Result()
+	return false, err
+}
+
+// newJob creates the job of the transfer between the locations.
+func newJob(src, dst location) (*job, error) {
+	var op string
+	switch {
+	case !src.remote() && dst.remote():
+		op = s3iot.OperationUpload
+	case src.remote() && !dst.remote():
+		op = s3iot.OperationDownload
+	case src.remote() && dst.remote():
+		op = s3iot.OperationCopy
+	default:
+		return nil, errors.New("either source or destination must be s3://BUCKET/KEY")
+	}
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	return &job{
+		ID:        id,
+		Operation: op,
+		Src:       src.String(),
+		Dst:       dst.String(),
+	}, nil
+}
+
+// run runs the job recording it in the journal until it succeeds.
+// Unchanged objects are not uploaded if skipUnchanged is true.
+func (c *client) run(ctx context.Context, jb *job, skipUnchanged bool) error {
+	src, err := parseLocation(jb.Src)
+	if err != nil {
+		return err
+	}
+	dst, err := parseLocation(jb.Dst)
+	if err != nil {
+		return err
+	}
+	jb.UploadID = ""
+	jb.Started = time.Now()
+	if err := c.journal.save(jb); err != nil {
+		return err
+	}
+
+	var t transfer
+	var cleanup func(success bool) error
+	switch jb.Operation {
+	case s3iot.OperationUpload:
+		t, cleanup, err = c.upload(ctx, src, dst, skipUnchanged)
+	case s3iot.OperationDownload:
+		t, cleanup, err = c.download(ctx, src, dst)
+	case s3iot.OperationCopy:
+		t, cleanup, err = c.copy(ctx, src, dst)
+	default:
+		err = fmt.Errorf("unknown operation %q", jb.Operation)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.pausers.add(t)
+	done := c.progress.add(func() s3iot.Status {
+		s, _ := t.status()
+		return s
+	})
+	c.wait(t, jb)
+	done()
+	c.pausers.remove(t)
+
+	skipped, err := t.result()
+	if errCleanup := cleanup(err == nil); err == nil {
+		err = errCleanup
+	}
+	if err != nil {
+		// Multipart upload is aborted by the library on failure.
+		jb.UploadID = ""
+		_ = c.journal.save(jb)
+		return fmt.Errorf("%s %s to %s: %w", strings.ToLower(jb.Operation), jb.Src, jb.Dst, err)
+	}
+	if err := c.journal.remove(jb); err != nil {
+		return err
+	}
+	if skipped {
+		c.printf("skip: %s to %s", jb.Src, jb.Dst)
+		return nil
+	}
+	c.printf("%s: %s to %s", strings.ToLower(jb.Operation), jb.Src, jb.Dst)
+	return nil
+}
+
+// wait waits the transfer recording the upload ID to the journal
+// to abort it if the process is terminated.
+func (c *client) wait(t transfer, jb *job) {
+	tick := time.NewTicker(journalUpdateInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-t.Done():
+			return
+		case <-tick.C:
+			if _, id := t.status(); id != jb.UploadID {
+				jb.UploadID = id
+				if err := c.journal.save(jb); err != nil {
+					c.progress.println(c.env.stderr, "failed to update journal:", err)
+				}
+			}
+		}
+	}
+}
+
+func (c *client) upload(ctx context.Context, src, dst location, skipUnchanged bool) (transfer, func(bool) error, error) {
+	f, err := os.Open(src.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	u := *c.uploader
+	u.SkipUnchanged = skipUnchanged
+	input := &s3iot.UploadInput{
+		Bucket: &dst.bucket,
+		Key:    &dst.key,
+		Body:   f,
+	}
+	if typ := mime.TypeByExtension(filepath.Ext(src.path)); typ != "" {
+		input.ContentType = &typ
+	}
+	uc, err := u.Upload(ctx, input)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return uploadTransfer{uc}, func(bool) error { return f.Close() }, nil
+}
+
+// download writes the object to a temporary file and renames it on success.
+func (c *client) download(ctx context.Context, src, dst location) (transfer, func(bool) error, error) {
+	dir := filepath.Dir(dst.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(dst.path)+".*.tmp")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func(success bool) error {
+		err := f.Close()
+		if success && err == nil {
+			return os.Rename(f.Name(), dst.path)
+		}
+		_ = os.Remove(f.Name())
+		return err
+	}
+	dc, err := c.downloader.Download(ctx, f, &s3iot.DownloadInput{
+		Bucket: &src.bucket,
+		Key:    &src.key,
+	})
+	if err != nil {
+		_ = cleanup(false)
+		return nil, nil, err
+	}
+	return downloadTransfer{dc}, cleanup, nil
+}
+
+func (c *client) copy(ctx context.Context, src, dst location) (transfer, func(bool) error, error) {
+	cc, err := c.copier.Copy(ctx, &s3iot.CopyInput{
+		Bucket:       &dst.bucket,
+		Key:          &dst.key,
+		SourceBucket: &src.bucket,
+		SourceKey:    &src.key,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return copyTransfer{cc}, func(bool) error { return nil }, nil
+}
+
+// runJobs runs the jobs with the concurrency limit and returns the first error.
+// The rest of the jobs are run even if a job failed.
+func (c *client) runJobs(ctx context.Context, jobs []*job, skipUnchanged bool) error {
+	sem := make(chan struct{}, c.cfg.concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	var nErr int
+	for _, jb := range jobs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(jb *job) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := c.run(ctx, jb, skipUnchanged); err != nil {
+				c.progress.println(c.env.stderr, "failed:", err)
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				nErr++
+				mu.Unlock()
+			}
+		}(jb)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if nErr > 1 {
+		return fmt.Errorf("%d transfers failed", nErr)
+	}
+	return firstErr
+}
@@ -0,0 +1,284 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	awsv1 "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	s3v1 "github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/awss3v1"
+	"github.com/at-wat/s3iot/awss3v2"
+	"github.com/at-wat/s3iot/localfs"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// Backends.
+const (
+	backendV1    = "v1"
+	backendV2    = "v2"
+	backendLocal = "local"
+)
+
+// Retry policies.
+const (
+	retryExponential = "exponential"
+	retryPauseOnFail = "pause-on-fail"
+	retryNone        = "none"
+)
+
+// config is the flags common to the commands.
+type config struct {
+	backend   string
+	endpoint  string
+	region    string
+	pathStyle bool
+	root      string
+
+	partSize    sizeValue
+	concurrency int
+	bandwidth   sizeValue
+
+	retry           string
+	retryMax        int
+	retryWaitBase   time.Duration
+	retryWaitMax    time.Duration
+	retryMaxElapsed time.Duration
+	forcePause      bool
+	stallTimeout    time.Duration
+
+	progress bool
+	stateDir string
+	logLevel string
+}
+
+func (c *config) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.backend, "backend", backendV2, "API backend: v1 (aws-sdk-go), v2 (aws-sdk-go-v2) or local")
+	fs.StringVar(&c.endpoint, "endpoint", "", "custom S3 endpoint URL")
+	fs.StringVar(&c.region, "region", "", "AWS region")
+	fs.BoolVar(&c.pathStyle, "path-style", false, "use path-style addressing")
+	fs.StringVar(&c.root, "root", "", "root directory of the local backend")
+
+	fs.Var(&c.partSize, "part-size", "part size like 8M (default of the library if not set, copy part size is limited to 5M-5G)")
+	fs.IntVar(&c.concurrency, "concurrency", 4, "number of the objects transferred concurrently")
+	fs.Var(&c.bandwidth, "bandwidth", "upload bandwidth limit per transfer in bytes/s like 1M (unlimited if not set)")
+
+	fs.StringVar(&c.retry, "retry", retryExponential, "retry policy: exponential, pause-on-fail or none")
+	fs.IntVar(&c.retryMax, "retry-max", 0, "maximum number of the retries (default of the library if zero)")
+	fs.DurationVar(&c.retryWaitBase, "retry-wait-base", 0, "initial wait of the retry (default of the library if zero)")
+	fs.DurationVar(&c.retryWaitMax, "retry-wait-max", 0, "maximum wait of the retry (default of the library if zero)")
+	fs.DurationVar(&c.retryMaxElapsed, "retry-max-elapsed", 0, "give up retrying after the duration (unlimited if zero)")
+	fs.BoolVar(&c.forcePause, "force-pause", false, "cancel the ongoing API call on pause")
+	fs.DurationVar(&c.stallTimeout, "stall-timeout", time.Minute, "retry the API call if no bytes are transferred for the duration (disabled if zero)")
+
+	fs.BoolVar(&c.progress, "progress", true, "show progress bar")
+	fs.StringVar(&c.stateDir, "state-dir", defaultStateDir(), "directory to store the journal of the transfers")
+	fs.StringVar(&c.logLevel, "log-level", "", "log level of the transfers: debug, info, warn or error (no logs if not set)")
+}
+
+func defaultStateDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ".s3iot-state"
+	}
+	return filepath.Join(dir, "s3iot")
+}
+
+func (c *config) api(ctx context.Context) (s3api.S3API, error) {
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			// Total timeout is not set since transferring a large part can take
+			// long time on a slow network. Stalled body transfer is detected
+			// by the StallTimeout of the uploader and downloader.
+			ResponseHeaderTimeout: time.Minute,
+		},
+	}
+
+	switch c.backend {
+	case backendV1:
+		cfg := &awsv1.Config{
+			HTTPClient:       httpClient,
+			MaxRetries:       awsv1.Int(0), // Use retry logic in s3iot
+			S3ForcePathStyle: awsv1.Bool(c.pathStyle),
+		}
+		if c.region != "" {
+			cfg.Region = awsv1.String(c.region)
+		}
+		if c.endpoint != "" {
+			cfg.Endpoint = awsv1.String(c.endpoint)
+		}
+		sess, err := session.NewSessionWithOptions(session.Options{
+			Config:            *cfg,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return awss3v1.NewAPI(s3v1.New(sess)), nil
+	case backendV2:
+		opts := []func(*awsconfig.LoadOptions) error{
+			awsconfig.WithHTTPClient(httpClient),
+			awsconfig.WithRetryer(func() aws.Retryer {
+				return aws.NopRetryer{} // Use retry logic in s3iot
+			}),
+		}
+		if c.region != "" {
+			opts = append(opts, awsconfig.WithRegion(c.region))
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return awss3v2.NewAPI(s3.NewFromConfig(cfg, func(o *s3.Options) {
+			if c.endpoint != "" {
+				o.BaseEndpoint = aws.String(c.endpoint)
+			}
+			o.UsePathStyle = c.pathStyle
+		})), nil
+	case backendLocal:
+		if c.root == "" {
+			return nil, fmt.Errorf("-root must be set for %s backend", backendLocal)
+		}
+		return localfs.New(c.root), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q", c.backend)
+	}
+}
+
+// errorClassifier returns the ErrorClassifier of the backend.
+func (c *config) errorClassifier() s3iot.ErrorClassifier {
+	switch c.backend {
+	case backendV1:
+		return &awss3v1.ErrorClassifier{}
+	case backendV2:
+		return &awss3v2.ErrorClassifier{}
+	default:
+		// Client errors of the local backend like NoSuchKey are not retried.
+		return &s3iot.RuleErrorClassifier{
+			Rules: []s3iot.ErrorRule{
+				{Match: func(err error) bool {
+					status, ok := s3iot.HTTPStatus(nil, err)
+					return ok && status >= 400 && status < 500
+				}},
+			},
+		}
+	}
+}
+
+func (c *config) retryer() (s3iot.RetryerFactory, error) {
+	exp := &s3iot.ExponentialBackoffRetryerFactory{
+		WaitBase:       c.retryWaitBase,
+		WaitMax:        c.retryWaitMax,
+		RetryMax:       c.retryMax,
+		Jitter:         s3iot.FullJitter,
+		MaxElapsedTime: c.retryMaxElapsed,
+	}
+	switch c.retry {
+	case retryExponential:
+		return exp, nil
+	case retryPauseOnFail:
+		return &s3iot.PauseOnFailRetryerFactory{Base: exp}, nil
+	case retryNone:
+		return &s3iot.NoRetryerFactory{}, nil
+	default:
+		return nil, fmt.Errorf("unknown retry policy %q", c.retry)
+	}
+}
+
+func (c *config) logger(e *env) (s3iot.Logger, s3iot.LogLevel, error) {
+	var level slog.Level
+	switch c.logLevel {
+	case "":
+		return nil, 0, nil
+	case "debug":
+		level = slog.LevelDebug
+	case "info":
+		level = slog.LevelInfo
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		return nil, 0, fmt.Errorf("unknown log level %q", c.logLevel)
+	}
+	l := slog.New(slog.NewTextHandler(e.stderr, &slog.HandlerOptions{Level: level}))
+	return l, s3iot.LogLevel(level), nil
+}
+
+// sizeValue is flag.Value of the byte size with the optional binary unit
+// prefix like 8M.
+type sizeValue int64
+
+func (v *sizeValue) String() string {
+	if v == nil || *v == 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(*v), 10)
+}
+
+func (v *sizeValue) Set(s string) error {
+	n, err := parseSize(s)
+	if err != nil {
+		return err
+	}
+	*v = sizeValue(n)
+	return nil
+}
+
+func parseSize(s string) (int64, error) {
+	str := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	mul := int64(1)
+	if n := len(str); n > 0 {
+		switch str[n-1] {
+		case 'K':
+			mul = 1 << 10
+		case 'M':
+			mul = 1 << 20
+		case 'G':
+			mul = 1 << 30
+		}
+		if mul > 1 {
+			str = str[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mul, nil
+}
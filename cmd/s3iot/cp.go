@@ -0,0 +1,65 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func runCp(ctx context.Context, e *env, args []string) error {
+	fs, cfg := newFlagSet(e, "cp", "SRC DST", "copy a file or an object")
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+	src, err := parseLocation(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	dst, err := parseLocation(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if src.remote() && src.dir() {
+		return errors.New("source key must be specified")
+	}
+	switch {
+	case dst.remote() && dst.dir() && src.remote():
+		dst = dst.join(path.Base(src.key))
+	case dst.remote() && dst.dir():
+		dst = dst.join(filepath.Base(src.path))
+	case !dst.remote():
+		if st, err := os.Stat(dst.path); (err == nil && st.IsDir()) ||
+			strings.HasSuffix(dst.path, string(filepath.Separator)) {
+			dst.path = filepath.Join(dst.path, path.Base(src.key))
+		}
+	}
+
+	c, err := newClient(ctx, e, cfg)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	jb, err := newJob(src, dst)
+	if err != nil {
+		return err
+	}
+	return c.run(ctx, jb, false)
+}
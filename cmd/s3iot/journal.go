@@ -0,0 +1,119 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const journalSuffix = ".json"
+
+// job is a transfer recorded in the journal until it succeeds.
+type job struct {
+	ID        string    `json:"id"`
+	Operation string    `json:"operation"`
+	Src       string    `json:"src"`
+	Dst       string    `json:"dst"`
+	UploadID  string    `json:"uploadId,omitempty"`
+	Started   time.Time `json:"started"`
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// journal stores the jobs in the directory to restart the transfers
+// interrupted by the process termination.
+type journal struct {
+	dir string
+}
+
+func (j *journal) path(id string) string {
+	return filepath.Join(j.dir, id+journalSuffix)
+}
+
+// save writes the job atomically.
+func (j *journal) save(jb *job) error {
+	if err := os.MkdirAll(j.dir, 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(jb)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(j.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), j.path(jb.ID))
+}
+
+func (j *journal) remove(jb *job) error {
+	if err := os.Remove(j.path(jb.ID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// list returns the jobs ordered by the start time.
+func (j *journal) list() ([]*job, error) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var jobs []*job
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, journalSuffix) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(j.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		jb := &job{}
+		if err := json.Unmarshal(b, jb); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, jb)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].Started.Before(jobs[b].Started)
+	})
+	return jobs, nil
+}
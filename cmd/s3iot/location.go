@@ -0,0 +1,64 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const s3Scheme = "s3://"
+
+// location is a local path or an object on S3.
+type location struct {
+	bucket string
+	key    string
+	path   string
+}
+
+func parseLocation(s string) (location, error) {
+	if !strings.HasPrefix(s, s3Scheme) {
+		return location{path: s}, nil
+	}
+	bucketKey := strings.TrimPrefix(s, s3Scheme)
+	bucket, key, _ := strings.Cut(bucketKey, "/")
+	if bucket == "" {
+		return location{}, fmt.Errorf("bucket is not specified in %q", s)
+	}
+	return location{bucket: bucket, key: key}, nil
+}
+
+func (l location) remote() bool {
+	return l.bucket != ""
+}
+
+// dir returns true if the location is a prefix on S3.
+func (l location) dir() bool {
+	return l.remote() && (l.key == "" || strings.HasSuffix(l.key, "/"))
+}
+
+// join returns the location of the object under the prefix.
+func (l location) join(key string) location {
+	l.key = path.Join(l.key, key)
+	return l
+}
+
+func (l location) String() string {
+	if !l.remote() {
+		return l.path
+	}
+	return s3Scheme + l.bucket + "/" + l.key
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func runLs(ctx context.Context, e *env, args []string) error {
+	fs, cfg := newFlagSet(e, "ls", "s3://BUCKET[/PREFIX]", "list objects")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+	loc, err := parseLocation(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !loc.remote() {
+		return errors.New("s3://BUCKET[/PREFIX] must be specified")
+	}
+	api, err := cfg.api(ctx)
+	if err != nil {
+		return err
+	}
+	return listObjects(ctx, api, loc.bucket, loc.key, func(obj s3api.Object) error {
+		var lastModified string
+		if obj.LastModified != nil {
+			lastModified = obj.LastModified.Local().Format(time.DateTime)
+		}
+		_, err := fmt.Fprintf(e.stdout, "%19s %12d %s\n", lastModified, obj.Size, *obj.Key)
+		return err
+	})
+}
+
+// listObjects calls fn for all objects under the prefix following
+// the continuation tokens.
+func listObjects(ctx context.Context, api s3api.ListAPI, bucket, prefix string, fn func(s3api.Object) error) error {
+	input := &s3api.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	}
+	for {
+		out, err := api.ListObjectsV2(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, obj := range out.Contents {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+		if out.NextContinuationToken == nil || *out.NextContinuationToken == "" {
+			return nil
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command s3iot copies and synchronizes objects on S3 with retry,
+// pause/resume and bandwidth limit provided by s3iot.
+//
+// Usage:
+//
+//	s3iot <command> [flags] [args]
+//
+// Commands:
+//
+//	cp          copy a file or an object
+//	sync        synchronize a directory and a prefix
+//	ls          list objects
+//	rm          remove objects
+//	restart     restart the interrupted transfers from the beginning
+//	abort-stale abort the multipart uploads left by the interrupted transfers
+//
+// Objects are specified as s3://bucket/key and the other arguments are
+// treated as local paths.
+// Transfers are paused by SIGUSR1 and resumed by SIGUSR2.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name  string
+	short string
+	run   func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = []command{
+	{name: "cp", short: "copy a file or an object", run: runCp},
+	{name: "sync", short: "synchronize a directory and a prefix", run: runSync},
+	{name: "ls", short: "list objects", run: runLs},
+	{name: "rm", short: "remove objects", run: runRm},
+	{name: "restart", short: "restart the interrupted transfers from the beginning", run: runRestart},
+	{name: "abort-stale", short: "abort the multipart uploads left by the interrupted transfers", run: runAbortStale},
+}
+
+// env is the environment of the command.
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+	// signals notifies pause and resume requests.
+	signals <-chan os.Signal
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: s3iot <command> [flags] [args]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(w, "\nrun 's3iot <command> -h' for the flags of the command\n")
+}
+
+// newFlagSet creates FlagSet of the command having the common flags.
+func newFlagSet(e *env, name, args, short string) (*flag.FlagSet, *config) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "usage: s3iot %s [flags] %s\n\n%s\n\nflags:\n", name, args, short)
+		fs.PrintDefaults()
+	}
+	cfg := &config{}
+	cfg.register(fs)
+	return fs, cfg
+}
+
+// parseFlags parses the flags and checks the number of the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string, nArgsMin, nArgsMax int) error {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errUsage
+	}
+	if n := fs.NArg(); n < nArgsMin || n > nArgsMax {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func run(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		usage(e.stderr)
+		return errUsage
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			err := c.run(ctx, e, args[1:])
+			if err == flag.ErrHelp {
+				return nil
+			}
+			return err
+		}
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(e.stdout)
+		return nil
+	}
+	fmt.Fprintf(e.stderr, "unknown command %q\n\n", args[0])
+	usage(e.stderr)
+	return errUsage
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	if len(pauseResumeSignals) > 0 {
+		signal.Notify(sig, pauseResumeSignals...)
+	}
+
+	err := run(ctx, &env{
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+		signals: sig,
+	}, os.Args[1:])
+	switch {
+	case err == nil:
+	case err == errUsage:
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "s3iot:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,507 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot/localfs"
+	"github.com/at-wat/s3iot/s3api"
+	"github.com/at-wat/s3iot/s3server"
+)
+
+type testEnv struct {
+	root  string
+	state string
+	local string
+	sig   chan os.Signal
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	te := &testEnv{
+		root:  t.TempDir(),
+		state: t.TempDir(),
+		local: t.TempDir(),
+		sig:   make(chan os.Signal, 1),
+	}
+	return te
+}
+
+// run runs the command with the local backend and returns stdout.
+func (te *testEnv) run(t *testing.T, cmd string, args ...string) string {
+	t.Helper()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	a := append([]string{
+		cmd,
+		"-backend", "local",
+		"-root", te.root,
+		"-state-dir", te.state,
+		"-progress=false",
+		"-part-size", "100",
+	}, args...)
+	if err := run(context.TODO(), &env{stdout: stdout, stderr: stderr, signals: te.sig}, a); err != nil {
+		t.Fatalf("%s failed: %v\n%s", cmd, err, stderr.String())
+	}
+	return stdout.String()
+}
+
+func (te *testEnv) writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	p := filepath.Join(te.local, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func (te *testEnv) readObject(t *testing.T, bucket, key string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(te.root, bucket, filepath.FromSlash(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func (te *testEnv) journal(t *testing.T) []*job {
+	t.Helper()
+	jobs, err := (&journal{dir: te.state}).list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+func sortedLines(s string) []string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestCp(t *testing.T) {
+	te := newTestEnv(t)
+	data := testData(250)
+	src := te.writeFile(t, "file.bin", data)
+
+	t.Run("Upload", func(t *testing.T) {
+		out := te.run(t, "cp", src, "s3://bucket/dir/")
+		if expected := "upload: " + src + " to s3://bucket/dir/file.bin\n"; out != expected {
+			t.Errorf("Expected output %q, got %q", expected, out)
+		}
+		if b := te.readObject(t, "bucket", "dir/file.bin"); !bytes.Equal(data, b) {
+			t.Error("Uploaded data differs")
+		}
+	})
+	t.Run("Copy", func(t *testing.T) {
+		te.run(t, "cp", "s3://bucket/dir/file.bin", "s3://bucket/copied")
+		if b := te.readObject(t, "bucket", "copied"); !bytes.Equal(data, b) {
+			t.Error("Copied data differs")
+		}
+	})
+	t.Run("Download", func(t *testing.T) {
+		dir := t.TempDir()
+		te.run(t, "cp", "s3://bucket/copied", dir)
+		b, err := os.ReadFile(filepath.Join(dir, "copied"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, b) {
+			t.Error("Downloaded data differs")
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("Temporary file must be removed, got %v", entries)
+		}
+	})
+	t.Run("Ls", func(t *testing.T) {
+		out := te.run(t, "ls", "s3://bucket/")
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		if len(lines) != 2 ||
+			!strings.HasSuffix(lines[0], "250 copied") ||
+			!strings.HasSuffix(lines[1], "250 dir/file.bin") {
+			t.Errorf("Unexpected list:\n%s", out)
+		}
+	})
+	t.Run("Rm", func(t *testing.T) {
+		te.run(t, "rm", "s3://bucket/copied")
+		out := te.run(t, "rm", "-r", "s3://bucket/dir/")
+		if expected := "delete: s3://bucket/dir/file.bin\n"; out != expected {
+			t.Errorf("Expected output %q, got %q", expected, out)
+		}
+		if out := te.run(t, "ls", "s3://bucket/"); out != "" {
+			t.Errorf("All objects must be removed, got:\n%s", out)
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		src := te.writeFile(t, "empty.bin", nil)
+		te.run(t, "cp", src, "s3://bucket/empty.bin")
+		dir := t.TempDir()
+		te.run(t, "cp", "s3://bucket/empty.bin", dir)
+		info, err := os.Stat(filepath.Join(dir, "empty.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 0 {
+			t.Errorf("Expected empty file, got %d bytes", info.Size())
+		}
+		te.run(t, "rm", "s3://bucket/empty.bin")
+	})
+	if jobs := te.journal(t); len(jobs) != 0 {
+		t.Errorf("Journal must be empty, got %v", jobs)
+	}
+}
+
+func TestSync(t *testing.T) {
+	te := newTestEnv(t)
+	te.writeFile(t, "a.txt", testData(10))
+	te.writeFile(t, "sub/b.bin", testData(300))
+	// Listing requires the bucket to exist.
+	if err := os.Mkdir(filepath.Join(te.root, "bucket"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	out := te.run(t, "sync", te.local, "s3://bucket/prefix")
+	expected := []string{
+		"upload: " + filepath.Join(te.local, "a.txt") + " to s3://bucket/prefix/a.txt",
+		"upload: " + filepath.Join(te.local, "sub", "b.bin") + " to s3://bucket/prefix/sub/b.bin",
+	}
+	if lines := sortedLines(out); !reflect.DeepEqual(expected, lines) {
+		t.Errorf("Expected:\n%v\ngot:\n%v", expected, lines)
+	}
+
+	if out := te.run(t, "sync", te.local, "s3://bucket/prefix"); out != "" {
+		t.Errorf("Unchanged files must not be uploaded, got:\n%s", out)
+	}
+
+	if err := os.Remove(filepath.Join(te.local, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	te.writeFile(t, "c.txt", testData(20))
+	te.writeFile(t, "d.tmp", testData(20))
+	out = te.run(t, "sync", "-delete", "-exclude", "*.tmp", "-dry-run", te.local, "s3://bucket/prefix")
+	expected = []string{
+		"(dryrun) delete: s3://bucket/prefix/a.txt",
+		"(dryrun) upload: " + filepath.Join(te.local, "c.txt") + " to s3://bucket/prefix/c.txt (new)",
+	}
+	if lines := sortedLines(out); !reflect.DeepEqual(expected, lines) {
+		t.Errorf("Expected:\n%v\ngot:\n%v", expected, lines)
+	}
+	out = te.run(t, "sync", "-delete", "-exclude", "*.tmp", te.local, "s3://bucket/prefix")
+	expected = []string{
+		"delete: s3://bucket/prefix/a.txt",
+		"upload: " + filepath.Join(te.local, "c.txt") + " to s3://bucket/prefix/c.txt",
+	}
+	if lines := sortedLines(out); !reflect.DeepEqual(expected, lines) {
+		t.Errorf("Expected:\n%v\ngot:\n%v", expected, lines)
+	}
+
+	dir := t.TempDir()
+	te.run(t, "sync", "s3://bucket/prefix", dir)
+	for _, name := range []string{"c.txt", "sub/b.bin"} {
+		a, err := os.ReadFile(filepath.Join(te.local, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("Downloaded %s differs", name)
+		}
+	}
+	if out := te.run(t, "sync", "s3://bucket/prefix", dir); out != "" {
+		t.Errorf("Unchanged files must not be downloaded, got:\n%s", out)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	te := newTestEnv(t)
+	data := testData(250)
+	src := te.writeFile(t, "file.bin", data)
+
+	// Simulate the upload interrupted by the process termination.
+	api := localfs.New(te.root)
+	bucket, key := "bucket", "file.bin"
+	out, err := api.CreateMultipartUpload(context.TODO(), &s3api.CreateMultipartUploadInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jr := &journal{dir: te.state}
+	stale := &job{
+		ID:        "stale",
+		Operation: "Upload",
+		Src:       src,
+		Dst:       "s3://bucket/file.bin",
+		UploadID:  *out.UploadID,
+		Started:   time.Now().Add(-48 * time.Hour),
+	}
+	if err := jr.save(stale); err != nil {
+		t.Fatal(err)
+	}
+	recent := &job{
+		ID:        "recent",
+		Operation: "Upload",
+		Src:       src,
+		Dst:       "s3://bucket/file2.bin",
+		Started:   time.Now(),
+	}
+	if err := jr.save(recent); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("AbortStale", func(t *testing.T) {
+		out := te.run(t, "abort-stale", "-older-than", "24h")
+		if expected := "abort: s3://bucket/file.bin " + stale.UploadID + "\n"; out != expected {
+			t.Errorf("Expected output %q, got %q", expected, out)
+		}
+		if _, err := api.AbortMultipartUpload(context.TODO(), &s3api.AbortMultipartUploadInput{
+			Bucket:   &bucket,
+			Key:      &key,
+			UploadID: &stale.UploadID,
+		}); err == nil {
+			t.Error("Multipart upload must be aborted")
+		}
+		jobs := te.journal(t)
+		if len(jobs) != 2 || jobs[0].UploadID != "" {
+			t.Errorf("Aborted transfers must be kept without upload ID, got %v", jobs)
+		}
+	})
+	t.Run("Restart", func(t *testing.T) {
+		out := te.run(t, "restart")
+		expected := []string{
+			"upload: " + src + " to s3://bucket/file.bin",
+			"upload: " + src + " to s3://bucket/file2.bin",
+		}
+		if lines := sortedLines(out); !reflect.DeepEqual(expected, lines) {
+			t.Errorf("Expected:\n%v\ngot:\n%v", expected, lines)
+		}
+		for _, key := range []string{"file.bin", "file2.bin"} {
+			if b := te.readObject(t, "bucket", key); !bytes.Equal(data, b) {
+				t.Errorf("Uploaded %s differs", key)
+			}
+		}
+		if jobs := te.journal(t); len(jobs) != 0 {
+			t.Errorf("Journal must be empty, got %v", jobs)
+		}
+	})
+}
+
+func TestFailedTransferKeptInJournal(t *testing.T) {
+	te := newTestEnv(t)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := run(context.TODO(), &env{stdout: stdout, stderr: stderr}, []string{
+		"cp",
+		"-backend", "local",
+		"-root", te.root,
+		"-state-dir", te.state,
+		"-progress=false",
+		"s3://bucket/not-exist", te.local,
+	})
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	jobs := te.journal(t)
+	if len(jobs) != 1 || jobs[0].Operation != "Download" {
+		t.Errorf("Failed transfer must be kept in the journal, got %v", jobs)
+	}
+}
+
+type pauserFunc struct {
+	pause, resume func()
+}
+
+func (p *pauserFunc) Pause()  { p.pause() }
+func (p *pauserFunc) Resume() { p.resume() }
+
+func TestPauseSignal(t *testing.T) {
+	te := newTestEnv(t)
+	fs, cfg := newFlagSet(&env{stderr: &bytes.Buffer{}}, "test", "", "")
+	if err := fs.Parse([]string{"-backend", "local", "-root", te.root, "-progress=false"}); err != nil {
+		t.Fatal(err)
+	}
+	stderr := &bytes.Buffer{}
+	c, err := newClient(context.TODO(), &env{stdout: &bytes.Buffer{}, stderr: stderr, signals: te.sig}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	events := make(chan string, 10)
+	p := &pauserFunc{
+		pause:  func() { events <- "pause" },
+		resume: func() { events <- "resume" },
+	}
+	c.pausers.add(p)
+
+	expect := func(event string) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e != event {
+				t.Fatalf("Expected %s, got %s", event, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting %s", event)
+		}
+	}
+	te.sig <- pauseSignal
+	expect("pause")
+	te.sig <- resumeSignal
+	expect("resume")
+
+	te.sig <- pauseSignal
+	expect("pause")
+	// Transfer started during pause must be paused.
+	c.pausers.add(&pauserFunc{
+		pause:  func() { events <- "pause2" },
+		resume: func() { events <- "resume2" },
+	})
+	expect("pause2")
+}
+
+func TestParseSize(t *testing.T) {
+	testCases := map[string]int64{
+		"100":  100,
+		"8K":   8 << 10,
+		"8m":   8 << 20,
+		"1MiB": 1 << 20,
+		"2GB":  2 << 30,
+	}
+	for in, expected := range testCases {
+		n, err := parseSize(in)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", in, err)
+			continue
+		}
+		if n != expected {
+			t.Errorf("%s: expected %d, got %d", in, expected, n)
+		}
+	}
+	for _, in := range []string{"", "M", "-1", "1X"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	testCases := map[string]struct {
+		expected location
+		dir      bool
+	}{
+		"local/path":          {expected: location{path: "local/path"}},
+		"s3://bucket":         {expected: location{bucket: "bucket"}, dir: true},
+		"s3://bucket/prefix/": {expected: location{bucket: "bucket", key: "prefix/"}, dir: true},
+		"s3://bucket/a/b":     {expected: location{bucket: "bucket", key: "a/b"}},
+	}
+	for in, tt := range testCases {
+		l, err := parseLocation(in)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", in, err)
+			continue
+		}
+		if l != tt.expected || l.dir() != tt.dir {
+			t.Errorf("%s: expected %+v (dir: %v), got %+v (dir: %v)", in, tt.expected, tt.dir, l, l.dir())
+		}
+	}
+	if _, err := parseLocation("s3:///key"); err == nil {
+		t.Error("Expected error for empty bucket")
+	}
+}
+
+func TestBackends(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CA_BUNDLE", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	for _, backend := range []string{backendV1, backendV2} {
+		backend := backend
+		t.Run(backend, func(t *testing.T) {
+			te := newTestEnv(t)
+			s := s3server.New(localfs.New(te.root))
+			s.Credentials = map[string]string{"id": "secret"}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			data := testData(250)
+			src := te.writeFile(t, "file.bin", data)
+
+			run := func(args ...string) string {
+				t.Helper()
+				stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+				a := append([]string{
+					args[0],
+					"-backend", backend,
+					"-endpoint", srv.URL,
+					"-path-style",
+					"-region", "us-east-1",
+					"-state-dir", te.state,
+					"-progress=false",
+					"-part-size", "100",
+				}, args[1:]...)
+				if err := run(context.TODO(), &env{stdout: stdout, stderr: stderr}, a); err != nil {
+					t.Fatalf("%s failed: %v\n%s", args[0], err, stderr.String())
+				}
+				return stdout.String()
+			}
+			run("cp", src, "s3://bucket/file.bin")
+			if b := te.readObject(t, "bucket", "file.bin"); !bytes.Equal(data, b) {
+				t.Error("Uploaded data differs")
+			}
+			if out := run("ls", "s3://bucket"); !strings.HasSuffix(out, "250 file.bin\n") {
+				t.Errorf("Unexpected list:\n%s", out)
+			}
+			dst := filepath.Join(t.TempDir(), "downloaded")
+			run("cp", "s3://bucket/file.bin", dst)
+			b, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, b) {
+				t.Error("Downloaded data differs")
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/at-wat/s3iot"
+)
+
+const (
+	progressInterval = 200 * time.Millisecond
+	progressBarWidth = 30
+	clearLine        = "\r\x1b[K"
+)
+
+// progress draws the progress bar of the transfers fed by their Status().
+// Messages are printed by println to avoid being mixed with the bar.
+type progress struct {
+	w       io.Writer
+	enabled bool
+	paused  func() bool
+
+	mu       sync.Mutex
+	active   map[int]func() s3iot.Status
+	nextID   int
+	doneSize int64
+	doneNum  int
+	drawn    bool
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+func newProgress(w io.Writer, enabled bool, paused func() bool) *progress {
+	p := &progress{
+		w:       w,
+		enabled: enabled,
+		paused:  paused,
+		active:  make(map[int]func() s3iot.Status),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if !enabled {
+		close(p.stopped)
+		return p
+	}
+	go func() {
+		defer close(p.stopped)
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				p.mu.Lock()
+				p.draw()
+				p.mu.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// add adds the transfer and returns the function to call on finish.
+func (p *progress) add(status func() s3iot.Status) func() {
+	p.mu.Lock()
+	id := p.nextID
+	p.nextID++
+	p.active[id] = status
+	p.mu.Unlock()
+	return func() {
+		s := status()
+		p.mu.Lock()
+		delete(p.active, id)
+		p.doneSize += s.Size
+		p.doneNum++
+		p.mu.Unlock()
+	}
+}
+
+func (p *progress) println(w io.Writer, a ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.drawn {
+		fmt.Fprint(p.w, clearLine)
+		p.drawn = false
+	}
+	fmt.Fprintln(w, a...)
+}
+
+// close stops drawing and leaves the last state of the bar.
+func (p *progress) close() {
+	if p.enabled {
+		close(p.stop)
+	}
+	<-p.stopped
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.enabled && p.doneNum > 0 {
+		p.draw()
+		fmt.Fprintln(p.w)
+	}
+}
+
+func (p *progress) draw() {
+	size, completed := p.doneSize, p.doneSize
+	var retries int
+	for _, status := range p.active {
+		s := status()
+		size += s.Size
+		completed += s.CompletedSize
+		retries += s.NumRetries
+	}
+	if size == 0 && len(p.active) == 0 {
+		return
+	}
+	ratio := 1.0
+	if size > 0 {
+		ratio = float64(completed) / float64(size)
+	}
+	n := int(ratio * progressBarWidth)
+	bar := strings.Repeat("=", n) + strings.Repeat(" ", progressBarWidth-n)
+	if n > 0 && n < progressBarWidth {
+		bar = bar[:n-1] + ">" + bar[n:]
+	}
+	line := fmt.Sprintf("[%s] %5.1f%% %s/%s files %d/%d",
+		bar, ratio*100, formatSize(completed), formatSize(size),
+		p.doneNum, p.doneNum+len(p.active),
+	)
+	if retries > 0 {
+		line += fmt.Sprintf(" retries %d", retries)
+	}
+	if p.paused != nil && p.paused() {
+		line += " (paused)"
+	}
+	fmt.Fprint(p.w, clearLine+line)
+	p.drawn = true
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
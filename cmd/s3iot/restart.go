@@ -0,0 +1,113 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func runRestart(ctx context.Context, e *env, args []string) error {
+	fs, cfg := newFlagSet(e, "restart", "", "restart the interrupted transfers recorded in the journal from the beginning")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	c, err := newClient(ctx, e, cfg)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	jobs, err := c.journal.list()
+	if err != nil {
+		return err
+	}
+	for _, jb := range jobs {
+		// Multipart upload of the interrupted transfer can't be continued
+		// by Uploader, so the transfer is restarted from the beginning.
+		if err := abortJob(ctx, c.api, jb); err != nil {
+			c.printf("failed to abort %s %s: %v", jb.Dst, jb.UploadID, err)
+		}
+	}
+	// Objects uploaded before the interruption are skipped.
+	return c.runJobs(ctx, jobs, true)
+}
+
+func runAbortStale(ctx context.Context, e *env, args []string) error {
+	fs, cfg := newFlagSet(e, "abort-stale", "", "abort the multipart uploads left by the interrupted transfers")
+	olderThan := fs.Duration("older-than", 24*time.Hour, "abort the multipart uploads started before the duration")
+	forget := fs.Bool("forget", false, "remove the stale transfers from the journal instead of keeping them for restart")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	api, err := cfg.api(ctx)
+	if err != nil {
+		return err
+	}
+	jr := &journal{dir: cfg.stateDir}
+	jobs, err := jr.list()
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(-*olderThan)
+	for _, jb := range jobs {
+		if jb.Started.After(deadline) {
+			continue
+		}
+		if jb.UploadID != "" {
+			if err := abortJob(ctx, api, jb); err != nil {
+				return err
+			}
+			fmt.Fprintf(e.stdout, "abort: %s %s\n", jb.Dst, jb.UploadID)
+			jb.UploadID = ""
+		}
+		if *forget {
+			err = jr.remove(jb)
+		} else {
+			err = jr.save(jb)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var matchNoSuchUpload = s3iot.MatchErrorCode("NoSuchUpload")
+
+// abortJob aborts the multipart upload of the job.
+// Already aborted or completed upload is ignored.
+func abortJob(ctx context.Context, api s3api.UploadAPI, jb *job) error {
+	if jb.UploadID == "" {
+		return nil
+	}
+	dst, err := parseLocation(jb.Dst)
+	if err != nil {
+		return err
+	}
+	_, err = api.AbortMultipartUpload(ctx, &s3api.AbortMultipartUploadInput{
+		Bucket:   &dst.bucket,
+		Key:      &dst.key,
+		UploadID: &jb.UploadID,
+	})
+	if err != nil && !matchNoSuchUpload(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func runRm(ctx context.Context, e *env, args []string) error {
+	fs, cfg := newFlagSet(e, "rm", "s3://BUCKET/KEY", "remove objects")
+	recursive := fs.Bool("r", false, "remove all objects under the prefix")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+	loc, err := parseLocation(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !loc.remote() || (!*recursive && loc.dir()) {
+		return errors.New("s3://BUCKET/KEY must be specified")
+	}
+	api, err := cfg.api(ctx)
+	if err != nil {
+		return err
+	}
+
+	remove := func(key string) error {
+		if _, err := api.DeleteObject(ctx, &s3api.DeleteObjectInput{
+			Bucket: &loc.bucket,
+			Key:    &key,
+		}); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(e.stdout, "delete: %s\n", location{bucket: loc.bucket, key: key})
+		return err
+	}
+	if !*recursive {
+		return remove(loc.key)
+	}
+	// Collect the keys first since deleting objects during listing may
+	// shift the pages.
+	var keys []string
+	if err := listObjects(ctx, api, loc.bucket, loc.key, func(obj s3api.Object) error {
+		keys = append(keys, *obj.Key)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := remove(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
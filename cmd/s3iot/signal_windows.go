@@ -0,0 +1,28 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// SIGUSR1 and SIGUSR2 are not available on Windows.
+var pauseResumeSignals []os.Signal
+
+var (
+	pauseSignal  os.Signal = syscall.Signal(-1)
+	resumeSignal os.Signal = syscall.Signal(-2)
+)
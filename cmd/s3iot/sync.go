@@ -0,0 +1,149 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/at-wat/s3iot/dirsync"
+)
+
+func runSync(ctx context.Context, e *env, args []string) error {
+	flags, cfg := newFlagSet(e, "sync", "SRC DST", "synchronize a directory and a prefix")
+	var include, exclude stringsValue
+	flags.Var(&include, "include", "glob `pattern` of the paths to be synchronized (repeatable)")
+	flags.Var(&exclude, "exclude", "glob `pattern` of the paths not to be synchronized (repeatable)")
+	compare := flags.String("compare", "size,modtime", "comma separated attributes to detect changes: size, modtime and etag")
+	del := flags.Bool("delete", false, "delete the files or objects not existing in the source")
+	dryRun := flags.Bool("dry-run", false, "show the actions without running them")
+	if err := parseFlags(flags, args, 2, 2); err != nil {
+		return err
+	}
+	src, err := parseLocation(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	dst, err := parseLocation(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	if src.remote() == dst.remote() {
+		return errors.New("either source or destination must be s3://BUCKET[/PREFIX]")
+	}
+	cmp, err := parseCompare(*compare)
+	if err != nil {
+		return err
+	}
+
+	c, err := newClient(ctx, e, cfg)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	dir, local, remote := dirsync.Upload, src, dst
+	if src.remote() {
+		dir, local, remote = dirsync.Download, dst, src
+	}
+	s := dirsync.New(c.uploader, c.downloader,
+		dirsync.WithInclude(include...),
+		dirsync.WithExclude(exclude...),
+		dirsync.WithCompare(cmp),
+		dirsync.WithDelete(*del),
+		dirsync.WithConcurrency(cfg.concurrency),
+		dirsync.WithOnFinish(func(a dirsync.Action, err error) {
+			if err == nil {
+				c.printf("%s", a)
+			}
+		}),
+	)
+	plan, err := s.Plan(ctx, dir, local.path, remote.bucket, remote.key)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		for _, a := range plan.Actions {
+			if a.Type != dirsync.ActionSkip {
+				c.printf("(dryrun) %s", a)
+			}
+		}
+		return nil
+	}
+
+	// Transfers are run as the journaled jobs to be restarted after
+	// the process termination.
+	var jobs []*job
+	var deletes []dirsync.Action
+	for _, a := range plan.Actions {
+		var jb *job
+		switch a.Type {
+		case dirsync.ActionUpload:
+			jb, err = newJob(location{path: a.LocalPath}, location{bucket: a.Bucket, key: a.Key})
+		case dirsync.ActionDownload:
+			jb, err = newJob(location{bucket: a.Bucket, key: a.Key}, location{path: a.LocalPath})
+		case dirsync.ActionDelete:
+			deletes = append(deletes, a)
+		}
+		if err != nil {
+			return err
+		}
+		if jb != nil {
+			jobs = append(jobs, jb)
+		}
+	}
+	if err := c.runJobs(ctx, jobs, false); err != nil {
+		return err
+	}
+	// Deletions are applied after all transfers succeeded.
+	plan.Actions = deletes
+	_, err = s.Apply(ctx, plan)
+	return err
+}
+
+// stringsValue is flag.Value accepting the flag multiple times.
+type stringsValue []string
+
+func (v *stringsValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, ",")
+}
+
+func (v *stringsValue) Set(s string) error {
+	*v = append(*v, s)
+	return nil
+}
+
+func parseCompare(s string) (dirsync.Compare, error) {
+	var cmp dirsync.Compare
+	for _, attr := range strings.Split(s, ",") {
+		switch strings.TrimSpace(attr) {
+		case "size":
+			cmp |= dirsync.CompareSize
+		case "modtime":
+			cmp |= dirsync.CompareModTime
+		case "etag":
+			cmp |= dirsync.CompareETag
+		case "":
+		default:
+			return 0, fmt.Errorf("unknown compare attribute %q", attr)
+		}
+	}
+	return cmp, nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connectivity provides a controller to pause and resume transfers
+// according to the network connectivity.
+//
+// Controller periodically checks the reachability through the Probe and
+// pauses all registered transfers when the link is lost so that the retries
+// are not wasted during the outage. Transfers are resumed when the link
+// returns. Link state can also be pushed by Report, for example from the
+// events of the modem manager.
+//
+//	c := connectivity.New(
+//		&connectivity.TCPProbe{Address: "s3.amazonaws.com:443"},
+//		connectivity.WithInterval(10*time.Second),
+//		connectivity.WithThreshold(2, 3),
+//	)
+//	go c.Run(ctx)
+//	uc, err := uploader.Upload(ctx, input)
+//	c.Add(uc)
+package connectivity
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/at-wat/s3iot"
+)
+
+// Default Controller parameters.
+const (
+	DefaultInterval         = 10 * time.Second
+	DefaultTimeout          = 5 * time.Second
+	DefaultOnlineThreshold  = 1
+	DefaultOfflineThreshold = 1
+)
+
+// Controller pauses and resumes the registered Pausers according to
+// the connectivity.
+//
+// The link state changes after the threshold number of consecutive probe
+// results different from the current state to avoid flapping.
+// The link is assumed to be online at the beginning.
+// Pausers implementing s3iot.SharedPauser are kept paused while they are
+// paused by the others like s3iot.CircuitBreakerRetryerFactory.
+type Controller struct {
+	probe Probe
+
+	interval         time.Duration
+	timeout          time.Duration
+	onlineThreshold  int
+	offlineThreshold int
+	forcePause       bool
+	clock            s3iot.Clock
+	onChange         func(online bool)
+
+	mu       sync.Mutex
+	online   bool
+	count    int
+	lastErr  error
+	pausers  []s3iot.Pauser
+	pausedBy map[s3iot.Pauser]bool
+}
+
+// Option configures Controller.
+type Option func(*Controller)
+
+// WithInterval sets the interval of the probe.
+func WithInterval(d time.Duration) Option {
+	return func(c *Controller) {
+		c.interval = d
+	}
+}
+
+// WithTimeout sets the timeout of each probe.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Controller) {
+		c.timeout = d
+	}
+}
+
+// WithThreshold sets the numbers of the consecutive probe results to
+// change the link state to online and offline.
+func WithThreshold(online, offline int) Option {
+	return func(c *Controller) {
+		c.onlineThreshold = online
+		c.offlineThreshold = offline
+	}
+}
+
+// WithForcePause enables to forcefully pause the transfers when the link
+// is lost.
+// Ongoing API calls of the Pausers implementing s3iot.ForcePauser
+// are canceled and retried on resume.
+func WithForcePause(f bool) Option {
+	return func(c *Controller) {
+		c.forcePause = f
+	}
+}
+
+// WithClock sets Clock used to wait the probe interval.
+func WithClock(clock s3iot.Clock) Option {
+	return func(c *Controller) {
+		c.clock = clock
+	}
+}
+
+// WithOnChange sets the callback called when the link state is changed.
+func WithOnChange(fn func(online bool)) Option {
+	return func(c *Controller) {
+		c.onChange = fn
+	}
+}
+
+// New creates Controller.
+// Probe may be nil if the link state is only provided by Report.
+func New(probe Probe, opts ...Option) *Controller {
+	c := &Controller{
+		probe:            probe,
+		interval:         DefaultInterval,
+		timeout:          DefaultTimeout,
+		onlineThreshold:  DefaultOnlineThreshold,
+		offlineThreshold: DefaultOfflineThreshold,
+		clock:            s3iot.DefaultClock,
+		online:           true,
+		pausedBy:         make(map[s3iot.Pauser]bool),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Add registers the Pauser.
+// The Pauser is paused immediately if the link is offline.
+// If the Pauser implements s3iot.DoneNotifier, it is removed after
+// the completion.
+func (c *Controller) Add(p s3iot.Pauser) {
+	c.mu.Lock()
+	c.pausers = append(c.pausers, p)
+	if !c.online {
+		c.pauseLocked(p)
+	}
+	c.mu.Unlock()
+
+	if dn, ok := p.(s3iot.DoneNotifier); ok {
+		go func() {
+			<-dn.Done()
+			c.Remove(p)
+		}()
+	}
+}
+
+// Remove unregisters the Pauser.
+// The Pauser paused by the Controller is resumed.
+func (c *Controller) Remove(p s3iot.Pauser) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pp := range c.pausers {
+		if pp == p {
+			c.pausers = append(c.pausers[:i], c.pausers[i+1:]...)
+			break
+		}
+	}
+	if c.pausedBy[p] {
+		delete(c.pausedBy, p)
+		s3iot.ResumeBy(p, c)
+	}
+}
+
+// Online returns the current link state and the last probe error.
+func (c *Controller) Online() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.online, c.lastErr
+}
+
+// Report feeds the probe result.
+// Nil err means that the endpoint is reachable.
+func (c *Controller) Report(err error) {
+	c.mu.Lock()
+	c.lastErr = err
+	reachable := err == nil
+	if reachable == c.online {
+		c.count = 0
+		c.mu.Unlock()
+		return
+	}
+	c.count++
+	threshold := c.offlineThreshold
+	if reachable {
+		threshold = c.onlineThreshold
+	}
+	if c.count < threshold {
+		c.mu.Unlock()
+		return
+	}
+	c.count = 0
+	c.online = reachable
+	// Pause and resume are called under the lock to keep their order.
+	if reachable {
+		for _, p := range c.pausers {
+			if c.pausedBy[p] {
+				s3iot.ResumeBy(p, c)
+			}
+		}
+		c.pausedBy = make(map[s3iot.Pauser]bool)
+	} else {
+		for _, p := range c.pausers {
+			c.pauseLocked(p)
+		}
+	}
+	onChange := c.onChange
+	c.mu.Unlock()
+
+	if onChange != nil {
+		onChange(reachable)
+	}
+}
+
+func (c *Controller) pauseLocked(p s3iot.Pauser) {
+	if c.pausedBy[p] {
+		return
+	}
+	c.pausedBy[p] = true
+	s3iot.PauseBy(p, c, c.forcePause)
+}
+
+// Run probes the connectivity every interval until ctx is canceled.
+// Run must not be called if the Controller has no Probe.
+func (c *Controller) Run(ctx context.Context) error {
+	for {
+		ctx2, cancel := context.WithTimeout(ctx, c.timeout)
+		err := c.probe.Probe(ctx2)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.Report(err)
+
+		select {
+		case <-c.clock.After(c.interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/clocktest"
+)
+
+var errUnreachable = errors.New("unreachable")
+
+func TestController(t *testing.T) {
+	t.Run("Hysteresis", func(t *testing.T) {
+		var changes []bool
+		c := New(nil,
+			WithThreshold(2, 3),
+			WithOnChange(func(online bool) {
+				changes = append(changes, online)
+			}),
+		)
+		p1, p2 := newPauser(), newPauser()
+		c.Add(p1)
+		c.Add(p2)
+
+		testCases := []struct {
+			err            error
+			expectedOnline bool
+		}{
+			{errUnreachable, true},
+			{errUnreachable, true},
+			{nil, true},
+			{errUnreachable, true},
+			{errUnreachable, true},
+			{errUnreachable, false},
+			{nil, false},
+			{errUnreachable, false},
+			{nil, false},
+			{nil, true},
+		}
+		for i, tt := range testCases {
+			c.Report(tt.err)
+			online, err := c.Online()
+			if online != tt.expectedOnline {
+				t.Fatalf("%d: Expected online: %v, got: %v", i, tt.expectedOnline, online)
+			}
+			if err != tt.err {
+				t.Fatalf("%d: Expected error: %v, got: %v", i, tt.err, err)
+			}
+			for _, p := range []*pauser{p1, p2} {
+				if p.isPaused() == online {
+					t.Fatalf("%d: Expected paused: %v", i, !online)
+				}
+			}
+		}
+		for _, p := range []*pauser{p1, p2} {
+			if p.pauses != 1 || p.resumes != 1 {
+				t.Errorf("Expected to be paused/resumed once, paused %d times, resumed %d times", p.pauses, p.resumes)
+			}
+		}
+		if len(changes) != 2 || changes[0] || !changes[1] {
+			t.Errorf("Unexpected state changes: %v", changes)
+		}
+	})
+	t.Run("AddWhileOffline", func(t *testing.T) {
+		c := New(nil)
+		c.Report(errUnreachable)
+
+		p := newPauser()
+		c.Add(p)
+		if !p.isPaused() {
+			t.Fatal("Pauser added while offline must be paused")
+		}
+		c.Remove(p)
+		if p.isPaused() {
+			t.Fatal("Removed Pauser must be resumed")
+		}
+		c.Report(nil)
+		if p.resumes != 1 {
+			t.Fatalf("Removed Pauser must not be resumed again, resumed %d times", p.resumes)
+		}
+	})
+	t.Run("Done", func(t *testing.T) {
+		c := New(nil)
+		p := newPauser()
+		c.Add(p)
+		c.Report(errUnreachable)
+		close(p.done)
+
+		timeout := time.After(time.Second)
+		for p.isPaused() {
+			select {
+			case <-timeout:
+				t.Fatal("Timeout")
+			case <-time.After(time.Millisecond):
+			}
+		}
+	})
+	t.Run("ForcePause", func(t *testing.T) {
+		for name, tt := range map[string]struct {
+			forcePause     bool
+			expectedForced int
+		}{
+			"Enabled":  {true, 1},
+			"Disabled": {false, 0},
+		} {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				c := New(nil, WithForcePause(tt.forcePause))
+				p := newPauser()
+				c.Add(p)
+				c.Report(errUnreachable)
+				if !p.isPaused() {
+					t.Fatal("Pauser must be paused")
+				}
+				if p.forced != tt.expectedForced {
+					t.Errorf("Expected to be forcefully paused %d times, got %d", tt.expectedForced, p.forced)
+				}
+			})
+		}
+	})
+	t.Run("SharedPauser", func(t *testing.T) {
+		c := New(nil, WithForcePause(true))
+		p := &sharedPauser{owners: make(map[interface{}]bool)}
+		c.Add(p)
+		c.Report(errUnreachable)
+		p.PauseBy("other", false)
+		if !p.owners[c] || !p.forced {
+			t.Fatal("Pauser must be forcefully paused by the Controller")
+		}
+		c.Report(nil)
+		if p.owners[c] || !p.owners["other"] {
+			t.Fatalf("Only the pause by the Controller must be released, remains: %v", p.owners)
+		}
+	})
+	t.Run("Run", func(t *testing.T) {
+		clock := clocktest.New(time.Now())
+		chProbe := make(chan error)
+		c := New(
+			ProbeFunc(func(ctx context.Context) error {
+				select {
+				case err := <-chProbe:
+					return err
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}),
+			WithInterval(time.Minute),
+			WithClock(clock),
+		)
+		p := newPauser()
+		c.Add(p)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		chErr := make(chan error)
+		go func() {
+			chErr <- c.Run(ctx)
+		}()
+
+		for _, err := range []error{errUnreachable, nil} {
+			chProbe <- err
+			clock.BlockUntil(1)
+			if paused := p.isPaused(); paused != (err != nil) {
+				t.Fatalf("Expected paused: %v", err != nil)
+			}
+			clock.Advance(time.Minute)
+		}
+
+		cancel()
+		select {
+		case err := <-chErr:
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Expected error: %v, got: %v", context.Canceled, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		}
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		var mu sync.Mutex
+		var errs []error
+		c := New(
+			ProbeFunc(func(ctx context.Context) error {
+				<-ctx.Done()
+				mu.Lock()
+				errs = append(errs, ctx.Err())
+				mu.Unlock()
+				return ctx.Err()
+			}),
+			WithTimeout(10*time.Millisecond),
+			WithInterval(time.Hour),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		go func() {
+			_ = c.Run(ctx)
+		}()
+
+		for {
+			if online, _ := c.Online(); !online {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatal("Timeout")
+			case <-time.After(time.Millisecond):
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(errs) != 1 || !errors.Is(errs[0], context.DeadlineExceeded) {
+			t.Fatalf("Probe must be timed out, got: %v", errs)
+		}
+	})
+}
+
+type sharedPauser struct {
+	owners map[interface{}]bool
+	forced bool
+}
+
+func (p *sharedPauser) Pause()  { p.PauseBy(nil, false) }
+func (p *sharedPauser) Resume() { p.ResumeBy(nil) }
+
+func (p *sharedPauser) PauseBy(owner interface{}, force bool) {
+	p.owners[owner] = true
+	p.forced = p.forced || force
+}
+
+func (p *sharedPauser) ResumeBy(owner interface{}) {
+	delete(p.owners, owner)
+}
+
+type pauser struct {
+	mu      sync.Mutex
+	paused  bool
+	pauses  int
+	forced  int
+	resumes int
+	done    chan struct{}
+}
+
+var _ s3iot.ForcePauser = &pauser{}
+
+func newPauser() *pauser {
+	return &pauser{done: make(chan struct{})}
+}
+
+func (p *pauser) Pause() {
+	p.mu.Lock()
+	p.paused = true
+	p.pauses++
+	p.mu.Unlock()
+}
+
+func (p *pauser) ForcePause() {
+	p.mu.Lock()
+	p.paused = true
+	p.pauses++
+	p.forced++
+	p.mu.Unlock()
+}
+
+func (p *pauser) Resume() {
+	p.mu.Lock()
+	p.paused = false
+	p.resumes++
+	p.mu.Unlock()
+}
+
+func (p *pauser) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *pauser) isPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
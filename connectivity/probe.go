@@ -0,0 +1,83 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// Probe checks the reachability of the endpoint.
+type Probe interface {
+	// Probe returns nil if the endpoint is reachable.
+	Probe(ctx context.Context) error
+}
+
+// ProbeFunc is a function implementing Probe.
+type ProbeFunc func(ctx context.Context) error
+
+// Probe implements Probe.
+func (f ProbeFunc) Probe(ctx context.Context) error {
+	return f(ctx)
+}
+
+// TCPProbe checks the reachability by establishing TCP connection.
+type TCPProbe struct {
+	// Address is the endpoint in host:port format.
+	Address string
+	// Dialer is used to connect. If nil, zero value of net.Dialer is used.
+	Dialer *net.Dialer
+}
+
+// Probe implements Probe.
+func (p *TCPProbe) Probe(ctx context.Context) error {
+	d := p.Dialer
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	conn, err := d.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// HTTPProbe checks the reachability by HEAD request.
+// Any HTTP response including error status means that the endpoint is
+// reachable since S3 endpoints may respond 403 to the anonymous request.
+type HTTPProbe struct {
+	// URL is the endpoint URL.
+	URL string
+	// Client is used to send the request. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Probe implements Probe.
+func (p *HTTPProbe) Probe(ctx context.Context) error {
+	cli := p.Client
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/at-wat/s3iot/netsim"
+)
+
+func TestTCPProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	p := &TCPProbe{Address: addr}
+	if err := p.Probe(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = ln.Close()
+	if err := p.Probe(context.TODO()); err == nil {
+		t.Fatal("Expected error on closed port")
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("Expected method: %s, got: %s", http.MethodHead, r.Method)
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	tr := netsim.New(netsim.WithBase(ts.Client().Transport))
+	p := &HTTPProbe{URL: ts.URL, Client: tr.Client()}
+
+	if err := p.Probe(context.TODO()); err != nil {
+		t.Fatalf("Error status must be treated as reachable: %v", err)
+	}
+
+	tr.SetOffline(true)
+	if err := p.Probe(context.TODO()); !errors.Is(err, netsim.ErrOffline) {
+		t.Fatalf("Expected error: %v, got: %v", netsim.ErrOffline, err)
+	}
+}
@@ -18,18 +18,26 @@ package contentrange
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 // Exposed errors.
 var (
-	ErrInvalidFormat = errors.New("invalid range header format")
-	ErrInvalidUnit   = errors.New("invalid range unit")
-	ErrInvalidRange  = errors.New("invalid range format")
+	ErrInvalidFormat  = errors.New("invalid range header format")
+	ErrInvalidUnit    = errors.New("invalid range unit")
+	ErrInvalidRange   = errors.New("invalid range format")
+	ErrMultipleRanges = errors.New("multiple ranges are specified")
+	ErrUnsatisfiable  = errors.New("range not satisfiable")
 )
 
 // Range stores content range.
+//
+// Start is -1 on suffix range (e.g. bytes=-500) and End stores
+// the suffix length in that case.
+// End is -1 on open-ended range (e.g. bytes=500-).
+// Size is -1 if the complete length is unknown.
 type Range struct {
 	Unit  RangeUnit
 	Start int64
@@ -37,6 +45,9 @@ type Range struct {
 	Size  int64
 }
 
+// Ranges stores list of the ranges.
+type Ranges []Range
+
 // RangeUnit represents type of range specifier.
 type RangeUnit string
 
@@ -55,38 +66,249 @@ func (u RangeUnit) Validate() error {
 	}
 }
 
+// IsSuffix returns true if the range is suffix range like bytes=-500.
+func (r Range) IsSuffix() bool {
+	return r.Start < 0
+}
+
+// IsOpenEnded returns true if the range is open-ended range like bytes=500-.
+func (r Range) IsOpenEnded() bool {
+	return r.Start >= 0 && r.End < 0
+}
+
+// Length returns the number of the units in the range.
+// Range must be resolved by Resolve() to get correct length of suffix or open-ended range.
+func (r Range) Length() int64 {
+	if r.Start < 0 || r.End < 0 {
+		return -1
+	}
+	return r.End - r.Start + 1
+}
+
 // String returns data in HTML Range request header format.
 func (r Range) String() string {
-	return fmt.Sprintf("%s=%d-%d", r.Unit, r.Start, r.End)
+	return fmt.Sprintf("%s=%s", r.Unit, r.spec())
+}
+
+func (r Range) spec() string {
+	switch {
+	case r.IsSuffix():
+		return fmt.Sprintf("-%d", r.End)
+	case r.IsOpenEnded():
+		return fmt.Sprintf("%d-", r.Start)
+	default:
+		return fmt.Sprintf("%d-%d", r.Start, r.End)
+	}
 }
 
 // ContentRange returns data in HTML ContentRange header format.
 func (r Range) ContentRange() string {
-	return fmt.Sprintf("%s %d-%d/%d", r.Unit, r.Start, r.End, r.Size)
+	size := "*"
+	if r.Size >= 0 {
+		size = strconv.FormatInt(r.Size, 10)
+	}
+	if r.Start < 0 || r.End < 0 {
+		return fmt.Sprintf("%s */%s", r.Unit, size)
+	}
+	return fmt.Sprintf("%s %d-%d/%s", r.Unit, r.Start, r.End, size)
+}
+
+// Resolve returns the absolute range in the content of the given size.
+// End exceeding the content is truncated to the last position.
+// ErrUnsatisfiable is returned if the range has no overlap with the content.
+func (r Range) Resolve(size int64) (Range, error) {
+	ret := Range{
+		Unit:  r.Unit,
+		Start: r.Start,
+		End:   r.End,
+		Size:  size,
+	}
+	switch {
+	case r.IsSuffix():
+		if r.End == 0 || size == 0 {
+			return Range{}, fmt.Errorf("%s: %w", r, ErrUnsatisfiable)
+		}
+		ret.Start = size - r.End
+		if ret.Start < 0 {
+			ret.Start = 0
+		}
+		ret.End = size - 1
+	case r.Start >= size:
+		return Range{}, fmt.Errorf("%s: %w", r, ErrUnsatisfiable)
+	case r.End < 0 || r.End >= size:
+		ret.End = size - 1
+	}
+	return ret, nil
+}
+
+// Intersect returns overlapped part of the ranges.
+// Both ranges must be absolute ones.
+// Returned bool is false if the ranges have no overlap.
+func (r Range) Intersect(r2 Range) (Range, bool) {
+	ret := r
+	if r2.Start > ret.Start {
+		ret.Start = r2.Start
+	}
+	if r2.End < ret.End {
+		ret.End = r2.End
+	}
+	if ret.Start > ret.End {
+		return Range{}, false
+	}
+	return ret, true
+}
+
+// Split splits the range into the ranges with the length of partSize.
+// The last range may be shorter than partSize.
+// Range must be absolute one.
+func (r Range) Split(partSize int64) Ranges {
+	if partSize <= 0 || r.Length() <= 0 {
+		return nil
+	}
+	rs := make(Ranges, 0, (r.Length()+partSize-1)/partSize)
+	for start := r.Start; start <= r.End; start += partSize {
+		end := start + partSize - 1
+		if end > r.End {
+			end = r.End
+		}
+		rs = append(rs, Range{
+			Unit:  r.Unit,
+			Start: start,
+			End:   end,
+			Size:  r.Size,
+		})
+	}
+	return rs
+}
+
+// String returns data in HTML Range request header format.
+func (rs Ranges) String() string {
+	if len(rs) == 0 {
+		return ""
+	}
+	specs := make([]string, len(rs))
+	for i, r := range rs {
+		specs[i] = r.spec()
+	}
+	return fmt.Sprintf("%s=%s", rs[0].Unit, strings.Join(specs, ","))
+}
+
+// Resolve returns absolute ranges in the content of the given size.
+// Unsatisfiable ranges are omitted and ErrUnsatisfiable is returned if none of the ranges is satisfiable.
+func (rs Ranges) Resolve(size int64) (Ranges, error) {
+	ret := make(Ranges, 0, len(rs))
+	for _, r := range rs {
+		r2, err := r.Resolve(size)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, r2)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("%s: %w", rs, ErrUnsatisfiable)
+	}
+	return ret, nil
+}
+
+// Merge returns sorted ranges with overlapped or adjacent ranges coalesced.
+// All ranges must be absolute ones.
+func (rs Ranges) Merge() Ranges {
+	if len(rs) == 0 {
+		return nil
+	}
+	sorted := make(Ranges, len(rs))
+	copy(sorted, rs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+	ret := Ranges{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &ret[len(ret)-1]
+		if r.Start > last.End+1 {
+			ret = append(ret, r)
+			continue
+		}
+		if r.End > last.End {
+			last.End = r.End
+		}
+	}
+	return ret
 }
 
 // Parse HTML Range request header.
+// ErrMultipleRanges is returned if the header contains multiple ranges.
+// Use ParseRanges to handle multiple ranges.
 func Parse(s string) (*Range, error) {
+	rs, err := ParseRanges(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) != 1 {
+		return nil, ErrMultipleRanges
+	}
+	return &rs[0], nil
+}
+
+// ParseRanges parses HTML Range request header which may contain multiple ranges.
+func ParseRanges(s string) (Ranges, error) {
 	ur := strings.Split(s, "=")
 	if len(ur) != 2 {
 		return nil, ErrInvalidFormat
 	}
-	r := &Range{
-		Unit: RangeUnit(ur[0]),
-	}
-	if err := r.Unit.Validate(); err != nil {
+	unit := RangeUnit(strings.TrimSpace(ur[0]))
+	if err := unit.Validate(); err != nil {
 		return nil, err
 	}
-	var err error
-	se := strings.Split(ur[1], "-")
-	if len(se) != 2 {
+	var rs Ranges
+	for _, spec := range strings.Split(ur[1], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		r, err := parseSpec(unit, spec)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, *r)
+	}
+	if len(rs) == 0 {
 		return nil, ErrInvalidRange
 	}
-	if r.Start, err = strconv.ParseInt(se[0], 10, 64); err != nil {
-		return nil, fmt.Errorf("content range start: %w", err)
+	return rs, nil
+}
+
+func parseSpec(unit RangeUnit, spec string) (*Range, error) {
+	r := &Range{
+		Unit: unit,
 	}
-	if r.End, err = strconv.ParseInt(se[1], 10, 64); err != nil {
-		return nil, fmt.Errorf("content range end: %w", err)
+	se := strings.Split(spec, "-")
+	if len(se) != 2 {
+		return nil, ErrInvalidRange
+	}
+	var err error
+	switch {
+	case se[0] == "" && se[1] == "":
+		return nil, ErrInvalidRange
+	case se[0] == "":
+		r.Start = -1
+		if r.End, err = parseInt(se[1]); err != nil {
+			return nil, fmt.Errorf("content range suffix length: %w", err)
+		}
+	case se[1] == "":
+		if r.Start, err = parseInt(se[0]); err != nil {
+			return nil, fmt.Errorf("content range start: %w", err)
+		}
+		r.End = -1
+	default:
+		if r.Start, err = parseInt(se[0]); err != nil {
+			return nil, fmt.Errorf("content range start: %w", err)
+		}
+		if r.End, err = parseInt(se[1]); err != nil {
+			return nil, fmt.Errorf("content range end: %w", err)
+		}
+		if r.End < r.Start {
+			return nil, ErrInvalidRange
+		}
 	}
 	return r, nil
 }
@@ -111,7 +333,7 @@ func ParseContentRange(s string) (*Range, error) {
 		r.Size = -1
 	} else {
 		var err error
-		if r.Size, err = strconv.ParseInt(rs[1], 10, 64); err != nil {
+		if r.Size, err = parseInt(rs[1]); err != nil {
 			return nil, fmt.Errorf("content range size: %w", err)
 		}
 	}
@@ -124,12 +346,21 @@ func ParseContentRange(s string) (*Range, error) {
 		if len(se) != 2 {
 			return nil, ErrInvalidRange
 		}
-		if r.Start, err = strconv.ParseInt(se[0], 10, 64); err != nil {
+		if r.Start, err = parseInt(se[0]); err != nil {
 			return nil, fmt.Errorf("content range start: %w", err)
 		}
-		if r.End, err = strconv.ParseInt(se[1], 10, 64); err != nil {
+		if r.End, err = parseInt(se[1]); err != nil {
 			return nil, fmt.Errorf("content range end: %w", err)
 		}
+		if r.End < r.Start || (r.Size >= 0 && r.End >= r.Size) {
+			return nil, ErrInvalidRange
+		}
 	}
 	return r, nil
 }
+
+func parseInt(s string) (int64, error) {
+	// ParseUint rejects sign prefix which is not allowed in the range header.
+	v, err := strconv.ParseUint(s, 10, 63)
+	return int64(v), err
+}
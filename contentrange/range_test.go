@@ -35,19 +35,57 @@ func TestRange(t *testing.T) {
 			t.Errorf("Expected: '%s', got: '%s'", expected, s)
 		}
 	})
-	t.Run("ContentRange", func(t *testing.T) {
+	t.Run("StringerSuffix", func(t *testing.T) {
 		r := Range{
 			Unit:  RangeUnitBytes,
-			Start: 10,
-			End:   31,
-			Size:  12345,
+			Start: -1,
+			End:   500,
+		}
+		s := r.String()
+		expected := "bytes=-500"
+		if s != expected {
+			t.Errorf("Expected: '%s', got: '%s'", expected, s)
+		}
+	})
+	t.Run("StringerOpenEnded", func(t *testing.T) {
+		r := Range{
+			Unit:  RangeUnitBytes,
+			Start: 500,
+			End:   -1,
 		}
-		s := r.ContentRange()
-		expected := "bytes 10-31/12345"
+		s := r.String()
+		expected := "bytes=500-"
 		if s != expected {
 			t.Errorf("Expected: '%s', got: '%s'", expected, s)
 		}
 	})
+	t.Run("ContentRange", func(t *testing.T) {
+		testCases := map[string]struct {
+			input    Range
+			expected string
+		}{
+			"Full": {
+				input:    Range{Unit: RangeUnitBytes, Start: 10, End: 31, Size: 12345},
+				expected: "bytes 10-31/12345",
+			},
+			"UnknownSize": {
+				input:    Range{Unit: RangeUnitBytes, Start: 10, End: 31, Size: -1},
+				expected: "bytes 10-31/*",
+			},
+			"Unsatisfied": {
+				input:    Range{Unit: RangeUnitBytes, Start: -1, End: -1, Size: 100},
+				expected: "bytes */100",
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				if s := tt.input.ContentRange(); s != tt.expected {
+					t.Errorf("Expected: '%s', got: '%s'", tt.expected, s)
+				}
+			})
+		}
+	})
 	t.Run("Parse", func(t *testing.T) {
 		testCases := map[string]struct {
 			input    string
@@ -62,10 +100,50 @@ func TestRange(t *testing.T) {
 					End:   30,
 				},
 			},
+			"Suffix": {
+				input: "bytes=-500",
+				expected: Range{
+					Unit:  RangeUnitBytes,
+					Start: -1,
+					End:   500,
+				},
+			},
+			"OpenEnded": {
+				input: "bytes=500-",
+				expected: Range{
+					Unit:  RangeUnitBytes,
+					Start: 500,
+					End:   -1,
+				},
+			},
 			"InvalidFormat": {
 				input: "bytes 1-10",
 				err:   ErrInvalidFormat,
 			},
+			"MultipleRanges": {
+				input: "bytes=0-99,200-299",
+				err:   ErrMultipleRanges,
+			},
+			"NoRange": {
+				input: "bytes=",
+				err:   ErrInvalidRange,
+			},
+			"NoStartEnd": {
+				input: "bytes=-",
+				err:   ErrInvalidRange,
+			},
+			"Reversed": {
+				input: "bytes=10-5",
+				err:   ErrInvalidRange,
+			},
+			"Signed": {
+				input: "bytes=+1-5",
+				err:   strconv.ErrSyntax,
+			},
+			"InvalidSuffix": {
+				input: "bytes=-$",
+				err:   strconv.ErrSyntax,
+			},
 			"InvalidUnit": {
 				input: "meters=1-10",
 				err:   ErrInvalidUnit,
@@ -164,6 +242,10 @@ func TestRange(t *testing.T) {
 				input: "bytes 1-10/$",
 				err:   strconv.ErrSyntax,
 			},
+			"EndExceedsSize": {
+				input: "bytes 1-100/100",
+				err:   ErrInvalidRange,
+			},
 		}
 		for name, tt := range testCases {
 			tt := tt
@@ -184,4 +266,223 @@ func TestRange(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("ParseRanges", func(t *testing.T) {
+		testCases := map[string]struct {
+			input    string
+			err      error
+			expected Ranges
+			str      string
+		}{
+			"Single": {
+				input: "bytes=0-99",
+				expected: Ranges{
+					{Unit: RangeUnitBytes, Start: 0, End: 99},
+				},
+				str: "bytes=0-99",
+			},
+			"Multiple": {
+				input: "bytes=0-99, 200-, -50",
+				expected: Ranges{
+					{Unit: RangeUnitBytes, Start: 0, End: 99},
+					{Unit: RangeUnitBytes, Start: 200, End: -1},
+					{Unit: RangeUnitBytes, Start: -1, End: 50},
+				},
+				str: "bytes=0-99,200-,-50",
+			},
+			"EmptyElement": {
+				input: "bytes=0-99,,200-299",
+				expected: Ranges{
+					{Unit: RangeUnitBytes, Start: 0, End: 99},
+					{Unit: RangeUnitBytes, Start: 200, End: 299},
+				},
+				str: "bytes=0-99,200-299",
+			},
+			"InvalidElement": {
+				input: "bytes=0-99,a",
+				err:   ErrInvalidRange,
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				rs, err := ParseRanges(tt.input)
+				if err != nil {
+					if tt.err == nil {
+						t.Fatal(err)
+					}
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("Expected error: '%v', got: '%v'", tt.err, err)
+					}
+					return
+				}
+				if !reflect.DeepEqual(tt.expected, rs) {
+					t.Errorf("Expected: %+v, got: %+v", tt.expected, rs)
+				}
+				if s := rs.String(); s != tt.str {
+					t.Errorf("Expected: '%s', got: '%s'", tt.str, s)
+				}
+			})
+		}
+	})
+	t.Run("Resolve", func(t *testing.T) {
+		testCases := map[string]struct {
+			input    Range
+			size     int64
+			err      error
+			expected Range
+		}{
+			"Normal": {
+				input:    Range{Unit: RangeUnitBytes, Start: 10, End: 19},
+				size:     100,
+				expected: Range{Unit: RangeUnitBytes, Start: 10, End: 19, Size: 100},
+			},
+			"EndExceeded": {
+				input:    Range{Unit: RangeUnitBytes, Start: 10, End: 199},
+				size:     100,
+				expected: Range{Unit: RangeUnitBytes, Start: 10, End: 99, Size: 100},
+			},
+			"OpenEnded": {
+				input:    Range{Unit: RangeUnitBytes, Start: 10, End: -1},
+				size:     100,
+				expected: Range{Unit: RangeUnitBytes, Start: 10, End: 99, Size: 100},
+			},
+			"Suffix": {
+				input:    Range{Unit: RangeUnitBytes, Start: -1, End: 30},
+				size:     100,
+				expected: Range{Unit: RangeUnitBytes, Start: 70, End: 99, Size: 100},
+			},
+			"SuffixExceeded": {
+				input:    Range{Unit: RangeUnitBytes, Start: -1, End: 300},
+				size:     100,
+				expected: Range{Unit: RangeUnitBytes, Start: 0, End: 99, Size: 100},
+			},
+			"StartExceeded": {
+				input: Range{Unit: RangeUnitBytes, Start: 100, End: 199},
+				size:  100,
+				err:   ErrUnsatisfiable,
+			},
+			"ZeroSuffix": {
+				input: Range{Unit: RangeUnitBytes, Start: -1, End: 0},
+				size:  100,
+				err:   ErrUnsatisfiable,
+			},
+			"EmptyContent": {
+				input: Range{Unit: RangeUnitBytes, Start: -1, End: 10},
+				size:  0,
+				err:   ErrUnsatisfiable,
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				r, err := tt.input.Resolve(tt.size)
+				if err != nil {
+					if tt.err == nil {
+						t.Fatal(err)
+					}
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("Expected error: '%v', got: '%v'", tt.err, err)
+					}
+					return
+				}
+				if !reflect.DeepEqual(tt.expected, r) {
+					t.Errorf("Expected: %+v, got: %+v", tt.expected, r)
+				}
+			})
+		}
+	})
+	t.Run("ResolveRanges", func(t *testing.T) {
+		rs := Ranges{
+			{Unit: RangeUnitBytes, Start: 200, End: 299},
+			{Unit: RangeUnitBytes, Start: 0, End: 9},
+			{Unit: RangeUnitBytes, Start: -1, End: 10},
+		}
+		resolved, err := rs.Resolve(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := Ranges{
+			{Unit: RangeUnitBytes, Start: 0, End: 9, Size: 100},
+			{Unit: RangeUnitBytes, Start: 90, End: 99, Size: 100},
+		}
+		if !reflect.DeepEqual(expected, resolved) {
+			t.Errorf("Expected: %+v, got: %+v", expected, resolved)
+		}
+
+		if _, err := rs[:1].Resolve(100); !errors.Is(err, ErrUnsatisfiable) {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrUnsatisfiable, err)
+		}
+	})
+	t.Run("Merge", func(t *testing.T) {
+		rs := Ranges{
+			{Unit: RangeUnitBytes, Start: 50, End: 59},
+			{Unit: RangeUnitBytes, Start: 0, End: 9},
+			{Unit: RangeUnitBytes, Start: 10, End: 19},
+			{Unit: RangeUnitBytes, Start: 55, End: 70},
+			{Unit: RangeUnitBytes, Start: 80, End: 89},
+			{Unit: RangeUnitBytes, Start: 81, End: 82},
+		}
+		expected := Ranges{
+			{Unit: RangeUnitBytes, Start: 0, End: 19},
+			{Unit: RangeUnitBytes, Start: 50, End: 70},
+			{Unit: RangeUnitBytes, Start: 80, End: 89},
+		}
+		if merged := rs.Merge(); !reflect.DeepEqual(expected, merged) {
+			t.Errorf("Expected: %+v, got: %+v", expected, merged)
+		}
+		if rs[0].Start != 50 {
+			t.Error("Original ranges must not be modified")
+		}
+	})
+	t.Run("Split", func(t *testing.T) {
+		r := Range{Unit: RangeUnitBytes, Start: 10, End: 34, Size: 100}
+		expected := Ranges{
+			{Unit: RangeUnitBytes, Start: 10, End: 19, Size: 100},
+			{Unit: RangeUnitBytes, Start: 20, End: 29, Size: 100},
+			{Unit: RangeUnitBytes, Start: 30, End: 34, Size: 100},
+		}
+		if rs := r.Split(10); !reflect.DeepEqual(expected, rs) {
+			t.Errorf("Expected: %+v, got: %+v", expected, rs)
+		}
+		if rs := r.Split(0); rs != nil {
+			t.Errorf("Expected nil, got: %+v", rs)
+		}
+	})
+	t.Run("Intersect", func(t *testing.T) {
+		testCases := map[string]struct {
+			a, b     Range
+			expected Range
+			ok       bool
+		}{
+			"Overlapped": {
+				a:        Range{Unit: RangeUnitBytes, Start: 10, End: 29},
+				b:        Range{Unit: RangeUnitBytes, Start: 20, End: 39},
+				expected: Range{Unit: RangeUnitBytes, Start: 20, End: 29},
+				ok:       true,
+			},
+			"Contained": {
+				a:        Range{Unit: RangeUnitBytes, Start: 10, End: 29},
+				b:        Range{Unit: RangeUnitBytes, Start: 15, End: 16},
+				expected: Range{Unit: RangeUnitBytes, Start: 15, End: 16},
+				ok:       true,
+			},
+			"Disjoint": {
+				a: Range{Unit: RangeUnitBytes, Start: 10, End: 29},
+				b: Range{Unit: RangeUnitBytes, Start: 30, End: 39},
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				r, ok := tt.a.Intersect(tt.b)
+				if ok != tt.ok {
+					t.Fatalf("Expected ok: %v, got: %v", tt.ok, ok)
+				}
+				if !reflect.DeepEqual(tt.expected, r) {
+					t.Errorf("Expected: %+v, got: %+v", tt.expected, r)
+				}
+			})
+		}
+	})
 }
@@ -0,0 +1,321 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/at-wat/s3iot/contentrange"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// Default copy parameters.
+const (
+	DefaultCopyPartSize = 1024 * 1024 * 64
+)
+
+// Copy part size limits of S3.
+// Parts except the last one must be at least MinCopyPartSize,
+// and single CopyObject call can copy up to MaxCopyPartSize.
+const (
+	MinCopyPartSize = 1024 * 1024 * 5
+	MaxCopyPartSize = 1024 * 1024 * 1024 * 5
+)
+
+// ErrInvalidCopyPartSize is returned if the copy part size is out of the S3 limits.
+var ErrInvalidCopyPartSize = errors.New("invalid copy part size")
+
+type copyAPI interface {
+	s3api.UploadAPI
+	s3api.HeadAPI
+	s3api.CopyAPI
+}
+
+// Copy an object on S3.
+// Object larger than PartSize is copied by multipart copy.
+// PartSize must be between MinCopyPartSize and MaxCopyPartSize.
+// API must implement s3api.HeadAPI and s3api.CopyAPI.
+func (c Copier) Copy(ctx context.Context, input *CopyInput) (CopyContext, error) {
+	if c.PartSize == 0 {
+		c.PartSize = DefaultCopyPartSize
+	}
+	if c.PartSize < MinCopyPartSize || c.PartSize > MaxCopyPartSize {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidCopyPartSize, c.PartSize)
+	}
+	if c.RetryerFactory == nil {
+		c.RetryerFactory = DefaultRetryer
+	}
+	if c.ErrorClassifier == nil {
+		c.ErrorClassifier = DefaultErrorClassifier
+	}
+	api, ok := c.API.(copyAPI)
+	if !ok {
+		return nil, ErrUnsupportedAPI
+	}
+	cc := &copyContext{
+		copyAPI:  api,
+		input:    input,
+		partSize: c.PartSize,
+	}
+	cc.upDownloadContext = newUpDownloadContext(
+		c.UpDownloaderBase, &cc.status.Paused, &cc.status.NumRetries,
+	)
+	ctx = cc.startTransfer(ctx, TransferInfo{
+		Operation:    OperationCopy,
+		Bucket:       *input.Bucket,
+		Key:          *input.Key,
+		SourceBucket: *input.SourceBucket,
+		SourceKey:    *input.SourceKey,
+	})
+	go cc.run(ctx)
+	return cc, nil
+}
+
+type copyContext struct {
+	*upDownloadContext
+
+	copyAPI  copyAPI
+	input    *CopyInput
+	partSize int64
+
+	status CopyStatus
+	output CopyOutput
+}
+
+func (cc *copyContext) BucketKey() (bucket, key string) {
+	return *cc.input.Bucket, *cc.input.Key
+}
+
+func (cc *copyContext) Status() (CopyStatus, error) {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	return cc.status, cc.err
+}
+
+func (cc *copyContext) Result() (CopyOutput, error) {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	return cc.output, cc.err
+}
+
+func (cc *copyContext) run(ctx context.Context) {
+	var head *s3api.HeadObjectOutput
+	if err := cc.retry(ctx, "HeadObject", 0, func(ctx context.Context) error {
+		ctx2, call := cc.currentCallContext(ctx, 0, false)
+		out, err := cc.copyAPI.HeadObject(ctx2, &s3api.HeadObjectInput{
+			Bucket:    cc.input.SourceBucket,
+			Key:       cc.input.SourceKey,
+			VersionID: cc.input.SourceVersionID,
+		})
+		if err := call.end(); err != nil {
+			return err
+		}
+		if err != nil {
+			cc.countRetry()
+			return err
+		}
+		head = out
+		return nil
+	}); err != nil {
+		cc.fail(err)
+		return
+	}
+
+	var size int64
+	if head.ContentLength != nil {
+		size = *head.ContentLength
+	}
+	cc.mu.Lock()
+	cc.status.Size = size
+	cc.mu.Unlock()
+
+	if size <= cc.partSize {
+		cc.single(ctx, head)
+		return
+	}
+	cc.multi(ctx, head)
+}
+
+func (cc *copyContext) single(ctx context.Context, head *s3api.HeadObjectOutput) {
+	var output CopyOutput
+	if err := cc.retryPart(ctx, "CopyObject", 0, func(ctx context.Context) error {
+		ctx2, call := cc.currentCallContext(ctx, cc.status.Size, false)
+		out, err := cc.copyAPI.CopyObject(ctx2, &s3api.CopyObjectInput{
+			Bucket:          cc.input.Bucket,
+			Key:             cc.input.Key,
+			ACL:             cc.input.ACL,
+			SourceBucket:    cc.input.SourceBucket,
+			SourceKey:       cc.input.SourceKey,
+			SourceVersionID: cc.input.SourceVersionID,
+			SourceIfMatch:   head.ETag,
+			StorageClass:    cc.storageClass(head),
+		})
+		if err := call.end(); err != nil {
+			return err
+		}
+		if err != nil {
+			cc.countRetry()
+			return err
+		}
+		cc.mu.Lock()
+		cc.status.CompletedSize = cc.status.Size
+		cc.mu.Unlock()
+		cc.transferred(cc.status.Size)
+		output = CopyOutput{
+			VersionID: out.VersionID,
+			ETag:      out.ETag,
+		}
+		return nil
+	}); err != nil {
+		cc.fail(err)
+		return
+	}
+	cc.success(output)
+}
+
+func (cc *copyContext) multi(ctx context.Context, head *s3api.HeadObjectOutput) {
+	if err := cc.retry(ctx, "CreateMultipartUpload", 0, func(ctx context.Context) error {
+		out, err := cc.copyAPI.CreateMultipartUpload(ctx, &s3api.CreateMultipartUploadInput{
+			Bucket:       cc.input.Bucket,
+			Key:          cc.input.Key,
+			ACL:          cc.input.ACL,
+			ContentType:  head.ContentType,
+			Metadata:     head.Metadata,
+			StorageClass: cc.storageClass(head),
+		})
+		if err != nil {
+			cc.countRetry()
+			return err
+		}
+		cc.mu.Lock()
+		cc.status.UploadID = *out.UploadID
+		cc.mu.Unlock()
+		cc.log(ctx, LogLevelInfo, "multipart upload created", LogKeyUploadID, *out.UploadID)
+		return nil
+	}); err != nil {
+		cc.fail(err)
+		return
+	}
+
+	partSize := cc.partSize
+	if n := (cc.status.Size + partSize - 1) / partSize; n > MaxUploadParts {
+		partSize = (cc.status.Size + MaxUploadParts - 1) / MaxUploadParts
+	}
+	whole := contentrange.Range{
+		Unit:  contentrange.RangeUnitBytes,
+		Start: 0,
+		End:   cc.status.Size - 1,
+		Size:  cc.status.Size,
+	}
+
+	var parts completedParts
+	for n, rn := range whole.Split(partSize) {
+		i := int64(n + 1)
+		r := rn.String()
+		if err := cc.retryPart(ctx, "UploadPartCopy", i, func(ctx context.Context) error {
+			ctx2, call := cc.currentCallContext(ctx, rn.Length(), false)
+			out, err := cc.copyAPI.UploadPartCopy(ctx2, &s3api.UploadPartCopyInput{
+				Bucket:          cc.input.Bucket,
+				Key:             cc.input.Key,
+				PartNumber:      &i,
+				UploadID:        &cc.status.UploadID,
+				SourceBucket:    cc.input.SourceBucket,
+				SourceKey:       cc.input.SourceKey,
+				SourceVersionID: cc.input.SourceVersionID,
+				SourceIfMatch:   head.ETag,
+				SourceRange:     &r,
+			})
+			if err := call.end(); err != nil {
+				return err
+			}
+			if err != nil {
+				cc.countRetry()
+				return err
+			}
+			parts = append(parts, &s3api.CompletedPart{
+				PartNumber: &i,
+				ETag:       out.ETag,
+			})
+			return nil
+		}); err != nil {
+			cc.fail(err)
+			return
+		}
+		cc.mu.Lock()
+		cc.status.CompletedSize += rn.Length()
+		cc.mu.Unlock()
+		cc.transferred(rn.Length())
+	}
+
+	var output CopyOutput
+	if err := cc.retry(ctx, "CompleteMultipartUpload", -1, func(ctx context.Context) error {
+		out, err := cc.copyAPI.CompleteMultipartUpload(ctx, &s3api.CompleteMultipartUploadInput{
+			Bucket:         cc.input.Bucket,
+			Key:            cc.input.Key,
+			CompletedParts: parts,
+			UploadID:       &cc.status.UploadID,
+		})
+		if err != nil {
+			cc.countRetry()
+			return err
+		}
+		output = CopyOutput{
+			VersionID: out.VersionID,
+			ETag:      out.ETag,
+		}
+		return nil
+	}); err != nil {
+		cc.fail(err)
+		return
+	}
+	cc.success(output)
+}
+
+// storageClass returns the storage class of the destination.
+// Source storage class is inherited if not specified.
+func (cc *copyContext) storageClass(head *s3api.HeadObjectOutput) *string {
+	if cc.input.StorageClass != nil {
+		return cc.input.StorageClass
+	}
+	return head.StorageClass
+}
+
+func (cc *copyContext) fail(err error) {
+	cc.mu.Lock()
+	cc.err = err
+	uploadID := cc.status.UploadID
+	cc.mu.Unlock()
+
+	if uploadID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+		_, errAbort := cc.copyAPI.AbortMultipartUpload(ctx, &s3api.AbortMultipartUploadInput{
+			Bucket:   cc.input.Bucket,
+			Key:      cc.input.Key,
+			UploadID: &uploadID,
+		})
+		cancel()
+		cc.logAbort(uploadID, errAbort)
+	}
+	cc.finish(err)
+}
+
+func (cc *copyContext) success(out CopyOutput) {
+	cc.mu.Lock()
+	cc.output = out
+	cc.mu.Unlock()
+	cc.finish(nil)
+}
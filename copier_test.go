@@ -0,0 +1,380 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	mock_s3api "github.com/at-wat/s3iot/internal/moq/s3api"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func TestCopier(t *testing.T) {
+	var (
+		bucket    = "Bucket"
+		key       = "Key"
+		srcBucket = "SrcBucket"
+		srcKey    = "SrcKey"
+	)
+	const partSize = s3iot.MinCopyPartSize
+	input := &s3iot.CopyInput{
+		Bucket:       &bucket,
+		Key:          &key,
+		SourceBucket: &srcBucket,
+		SourceKey:    &srcKey,
+	}
+
+	t.Run("SinglePart", func(t *testing.T) {
+		api := newCopyMockAPI(partSize, 0, nil)
+		c := &s3iot.Copier{}
+		s3iot.WithAPI(api).ApplyToCopier(c)
+		s3iot.WithCopyPartSize(partSize).ApplyToCopier(c)
+
+		cc, err := c.Copy(context.TODO(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		case <-cc.Done():
+		}
+		out, err := cc.Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *out.ETag != "COPIED" {
+			t.Errorf("Expected ETag: COPIED, got: %s", *out.ETag)
+		}
+		if n := len(api.CopyObjectCalls()); n != 1 {
+			t.Fatalf("CopyObject must be called once, but called %d times", n)
+		}
+		if n := len(api.UploadPartCopyCalls()); n != 0 {
+			t.Fatalf("UploadPartCopy must not be called, but called %d times", n)
+		}
+		in := api.CopyObjectCalls()[0].Input
+		if *in.SourceBucket != srcBucket || *in.SourceKey != srcKey || *in.SourceIfMatch != "SRCTAG" {
+			t.Errorf("Unexpected CopyObject input: %+v", in)
+		}
+		if *in.StorageClass != "STANDARD_IA" {
+			t.Errorf("Source storage class must be inherited, got: %s", *in.StorageClass)
+		}
+		status, err := cc.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Size != partSize || status.CompletedSize != partSize {
+			t.Errorf("Expected Size/CompletedSize: %d/%d, got: %d/%d", partSize, partSize, status.Size, status.CompletedSize)
+		}
+	})
+	t.Run("MultiPart", func(t *testing.T) {
+		testCases := map[string]struct {
+			num   int
+			err   error
+			calls int
+		}{
+			"NoAPIError": {
+				calls: 3,
+			},
+			"OneAPIError": {
+				num:   1,
+				calls: 4,
+			},
+			"TwoAPIErrors": {
+				num: 2,
+				err: errTemp,
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				api := newCopyMockAPI(partSize*5/2, tt.num, nil)
+				c := &s3iot.Copier{}
+				s3iot.WithAPI(api).ApplyToCopier(c)
+				s3iot.WithCopyPartSize(partSize).ApplyToCopier(c)
+				s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{
+					WaitBase: time.Millisecond,
+					RetryMax: 1,
+				}).ApplyToCopier(c)
+
+				cc, err := c.Copy(context.TODO(), input)
+				if err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case <-time.After(time.Second):
+					t.Fatal("Timeout")
+				case <-cc.Done():
+				}
+				out, err := cc.Result()
+				if tt.err != nil {
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("Expected error: '%v', got: '%v'", tt.err, err)
+					}
+					if n := len(api.AbortMultipartUploadCalls()); n != 1 {
+						t.Errorf("AbortMultipartUpload must be called once, but called %d times", n)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *out.ETag != "COMPLETED" {
+					t.Errorf("Expected ETag: COMPLETED, got: %s", *out.ETag)
+				}
+
+				calls := api.UploadPartCopyCalls()
+				if n := len(calls); n != tt.calls {
+					t.Fatalf("UploadPartCopy must be called %d times, but called %d times", tt.calls, n)
+				}
+				var ranges []string
+				for _, call := range calls {
+					if *call.Input.SourceIfMatch != "SRCTAG" {
+						t.Errorf("Expected SourceIfMatch: SRCTAG, got: %s", *call.Input.SourceIfMatch)
+					}
+					ranges = append(ranges, *call.Input.SourceRange)
+				}
+				expectedRanges := []string{
+					fmt.Sprintf("bytes=0-%d", partSize-1),
+					fmt.Sprintf("bytes=%d-%d", partSize, partSize*2-1),
+					fmt.Sprintf("bytes=%d-%d", partSize*2, partSize*5/2-1),
+				}
+				if !reflect.DeepEqual(expectedRanges, ranges[tt.num:]) {
+					t.Errorf("Expected ranges: %v, got: %v", expectedRanges, ranges)
+				}
+
+				parts := api.CompleteMultipartUploadCalls()[0].Input.CompletedParts
+				for i, p := range parts {
+					if *p.PartNumber != int64(i+1) || *p.ETag != fmt.Sprintf("PART%d", i+1) {
+						t.Errorf("Unexpected part %d: %d, %s", i, *p.PartNumber, *p.ETag)
+					}
+				}
+
+				create := api.CreateMultipartUploadCalls()[0].Input
+				if *create.ContentType != "ContentType" || create.Metadata["Key"] != "Value" ||
+					*create.StorageClass != "STANDARD_IA" {
+					t.Errorf("Source metadata must be inherited: %+v", create)
+				}
+
+				status, err := cc.Status()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if status.CompletedSize != partSize*5/2 {
+					t.Errorf("Expected CompletedSize: %d, got: %d", partSize*5/2, status.CompletedSize)
+				}
+				if status.NumRetries != tt.num {
+					t.Errorf("Expected NumRetries: %d, got: %d", tt.num, status.NumRetries)
+				}
+				if status.UploadID != "UPLOAD0" {
+					t.Errorf("Expected UploadID: UPLOAD0, got: %s", status.UploadID)
+				}
+			})
+		}
+	})
+	t.Run("PauseResume", func(t *testing.T) {
+		ch := make(chan interface{})
+		api := newCopyMockAPI(partSize*5/2, 0, ch)
+		c := &s3iot.Copier{}
+		s3iot.WithAPI(api).ApplyToCopier(c)
+		s3iot.WithCopyPartSize(partSize).ApplyToCopier(c)
+
+		cc, err := c.Copy(context.TODO(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		case <-ch:
+		}
+		time.Sleep(50 * time.Millisecond)
+		cc.Pause()
+		go func() {
+			<-ch
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		status, err := cc.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Paused {
+			t.Error("Paused flag must be set")
+		}
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-cc.Done():
+			t.Fatal("Copy should be paused")
+		}
+		if n := len(api.UploadPartCopyCalls()); n != 2 {
+			t.Fatalf("UploadPartCopy must be called twice before resume, but called %d times", n)
+		}
+
+		cc.Resume()
+		go func() {
+			<-ch
+		}()
+
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		case <-cc.Done():
+		}
+		if _, err := cc.Result(); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(api.UploadPartCopyCalls()); n != 3 {
+			t.Fatalf("UploadPartCopy must be called 3 times, but called %d times", n)
+		}
+	})
+	t.Run("StorageClass", func(t *testing.T) {
+		storageClass := "GLACIER"
+		input := *input
+		input.StorageClass = &storageClass
+
+		for name, size := range map[string]int64{
+			"SinglePart": partSize,
+			"MultiPart":  partSize * 2,
+		} {
+			size := size
+			t.Run(name, func(t *testing.T) {
+				api := newCopyMockAPI(size, 0, nil)
+				c := &s3iot.Copier{}
+				s3iot.WithAPI(api).ApplyToCopier(c)
+				s3iot.WithCopyPartSize(partSize).ApplyToCopier(c)
+
+				cc, err := c.Copy(context.TODO(), &input)
+				if err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case <-time.After(time.Second):
+					t.Fatal("Timeout")
+				case <-cc.Done():
+				}
+				if _, err := cc.Result(); err != nil {
+					t.Fatal(err)
+				}
+				var sc *string
+				if calls := api.CopyObjectCalls(); len(calls) > 0 {
+					sc = calls[0].Input.StorageClass
+				} else {
+					sc = api.CreateMultipartUploadCalls()[0].Input.StorageClass
+				}
+				if *sc != storageClass {
+					t.Errorf("Expected StorageClass: %s, got: %s", storageClass, *sc)
+				}
+			})
+		}
+	})
+	t.Run("InvalidPartSize", func(t *testing.T) {
+		for name, size := range map[string]int64{
+			"TooSmall": s3iot.MinCopyPartSize - 1,
+			"TooLarge": s3iot.MaxCopyPartSize + 1,
+		} {
+			size := size
+			t.Run(name, func(t *testing.T) {
+				api := newCopyMockAPI(partSize, 0, nil)
+				c := &s3iot.Copier{}
+				s3iot.WithAPI(api).ApplyToCopier(c)
+				s3iot.WithCopyPartSize(size).ApplyToCopier(c)
+
+				if _, err := c.Copy(context.TODO(), input); !errors.Is(err, s3iot.ErrInvalidCopyPartSize) {
+					t.Fatalf("Expected error: '%v', got: '%v'", s3iot.ErrInvalidCopyPartSize, err)
+				}
+				if n := len(api.HeadObjectCalls()); n != 0 {
+					t.Errorf("HeadObject must not be called, but called %d times", n)
+				}
+			})
+		}
+	})
+	t.Run("UnsupportedAPI", func(t *testing.T) {
+		api := newCopyMockAPI(partSize, 0, nil)
+		c := &s3iot.Copier{}
+		s3iot.WithAPI(struct{ s3api.UpDownloadAPI }{api}).ApplyToCopier(c)
+
+		if _, err := c.Copy(context.TODO(), input); err != s3iot.ErrUnsupportedAPI {
+			t.Fatalf("Expected error: '%v', got: '%v'", s3iot.ErrUnsupportedAPI, err)
+		}
+	})
+}
+
+func newCopyMockAPI(size int64, num int, ch chan interface{}) *mock_s3api.MockS3API {
+	var mu sync.Mutex
+	var cnt int
+	count := func() int {
+		mu.Lock()
+		count := cnt
+		cnt++
+		mu.Unlock()
+		return count
+	}
+	etag := "SRCTAG"
+	contentType := "ContentType"
+	storageClass := "STANDARD_IA"
+	uploadID := "UPLOAD0"
+
+	return &mock_s3api.MockS3API{
+		HeadObjectFunc: func(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+			return &s3api.HeadObjectOutput{
+				ContentLength: &size,
+				ContentType:   &contentType,
+				ETag:          &etag,
+				Metadata:      map[string]string{"Key": "Value"},
+				StorageClass:  &storageClass,
+			}, nil
+		},
+		CopyObjectFunc: func(ctx context.Context, input *s3api.CopyObjectInput) (*s3api.CopyObjectOutput, error) {
+			if count() < num {
+				return nil, errTemp
+			}
+			etag := "COPIED"
+			return &s3api.CopyObjectOutput{ETag: &etag}, nil
+		},
+		CreateMultipartUploadFunc: func(ctx context.Context, input *s3api.CreateMultipartUploadInput) (*s3api.CreateMultipartUploadOutput, error) {
+			return &s3api.CreateMultipartUploadOutput{UploadID: &uploadID}, nil
+		},
+		UploadPartCopyFunc: func(ctx context.Context, input *s3api.UploadPartCopyInput) (*s3api.UploadPartCopyOutput, error) {
+			if count() < num {
+				return nil, errTemp
+			}
+			if ch != nil {
+				select {
+				case ch <- input:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			etag := fmt.Sprintf("PART%d", *input.PartNumber)
+			return &s3api.UploadPartCopyOutput{ETag: &etag}, nil
+		},
+		CompleteMultipartUploadFunc: func(ctx context.Context, input *s3api.CompleteMultipartUploadInput) (*s3api.CompleteMultipartUploadOutput, error) {
+			etag := "COMPLETED"
+			return &s3api.CompleteMultipartUploadOutput{ETag: &etag}, nil
+		},
+		AbortMultipartUploadFunc: func(ctx context.Context, input *s3api.AbortMultipartUploadInput) (*s3api.AbortMultipartUploadOutput, error) {
+			return &s3api.AbortMultipartUploadOutput{}, nil
+		},
+	}
+}
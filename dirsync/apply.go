@@ -0,0 +1,208 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dirsync
+
+import (
+	"context"
+	"mime"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// Apply runs the actions of the plan with the concurrency limit.
+// Failed actions don't stop the others and are reported in the Summary.
+// The first ActionError is returned if any action is failed.
+// If the context is canceled, the remaining actions are not started and
+// the context error is returned.
+func (s *Syncer) Apply(ctx context.Context, plan *Plan) (*Summary, error) {
+	concurrency := s.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	start := time.Now()
+	summary := &Summary{}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	var errCtx error
+L_ACTIONS:
+	for _, a := range plan.Actions {
+		if a.Type == ActionSkip {
+			summary.Skipped++
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errCtx = ctx.Err()
+			break L_ACTIONS
+		}
+		if errCtx = ctx.Err(); errCtx != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(a Action) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			skipped, err := s.apply(ctx, plan, a)
+			if s.onFinish != nil {
+				s.onFinish(a, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				summary.Failed++
+				summary.Errors = append(summary.Errors, &ActionError{Action: a, Err: err})
+			case skipped:
+				summary.Skipped++
+			case a.Type == ActionUpload:
+				summary.Uploaded++
+				summary.Bytes += a.Size
+			case a.Type == ActionDownload:
+				summary.Downloaded++
+				summary.Bytes += a.Size
+			case a.Type == ActionDelete:
+				summary.Deleted++
+			}
+		}(a)
+	}
+	wg.Wait()
+	summary.Duration = time.Since(start)
+
+	if errCtx != nil {
+		return summary, errCtx
+	}
+	if len(summary.Errors) > 0 {
+		return summary, summary.Errors[0]
+	}
+	return summary, nil
+}
+
+// apply runs the action and returns true if the transfer is skipped
+// by the Uploader.
+func (s *Syncer) apply(ctx context.Context, plan *Plan, a Action) (bool, error) {
+	switch a.Type {
+	case ActionUpload:
+		return s.upload(ctx, a)
+	case ActionDownload:
+		return false, s.download(ctx, a)
+	case ActionDelete:
+		if s.onStart != nil {
+			s.onStart(a, nil)
+		}
+		if plan.Direction == Download {
+			return false, os.Remove(a.LocalPath)
+		}
+		_, err := s.uploader.API.(s3api.DeleteAPI).DeleteObject(ctx, &s3api.DeleteObjectInput{
+			Bucket: &a.Bucket,
+			Key:    &a.Key,
+		})
+		return false, err
+	}
+	return false, nil
+}
+
+func (s *Syncer) upload(ctx context.Context, a Action) (bool, error) {
+	f, err := os.Open(a.LocalPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	input := &s3iot.UploadInput{
+		Bucket: &a.Bucket,
+		Key:    &a.Key,
+		Body:   f,
+	}
+	if typ := mime.TypeByExtension(filepath.Ext(a.LocalPath)); typ != "" {
+		input.ContentType = &typ
+	}
+	uc, err := s.uploader.Upload(ctx, input)
+	if err != nil {
+		return false, err
+	}
+	if s.onStart != nil {
+		s.onStart(a, uc)
+	}
+	<-uc.Done()
+	out, err := uc.Result()
+	return out.Skipped, err
+}
+
+// download writes the object to a temporary file and renames it on success.
+// Modification time of the file is set to the LastModified of the object.
+// Empty object is not downloaded since ranged GET of zero bytes is
+// not satisfiable.
+func (s *Syncer) download(ctx context.Context, a Action) error {
+	dir := filepath.Dir(a.LocalPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(a.LocalPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	modTime := a.ModTime
+	if a.Size > 0 {
+		dc, err := s.downloader.Download(ctx, f, &s3iot.DownloadInput{
+			Bucket: &a.Bucket,
+			Key:    &a.Key,
+		})
+		if err != nil {
+			return fail(err)
+		}
+		if s.onStart != nil {
+			s.onStart(a, dc)
+		}
+		<-dc.Done()
+		out, err := dc.Result()
+		if err != nil {
+			return fail(err)
+		}
+		if out.LastModified != nil {
+			modTime = *out.LastModified
+		}
+	} else if s.onStart != nil {
+		s.onStart(a, nil)
+	}
+	if err := f.Close(); err != nil {
+		return fail(err)
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(f.Name(), modTime, modTime); err != nil {
+			return fail(err)
+		}
+	}
+	if err := os.Rename(f.Name(), a.LocalPath); err != nil {
+		return fail(err)
+	}
+	return nil
+}
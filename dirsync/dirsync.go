@@ -0,0 +1,314 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dirsync provides a synchronizer between a local directory and
+// a prefix on S3.
+//
+// Syncer lists the local files and the remote objects, compares them by
+// the size, the modification time and the ETag, and transfers the changed
+// ones using s3iot.Uploader or s3iot.Downloader with the concurrency limit.
+// Plan doesn't change anything and can be used as a dry-run.
+//
+//	s := dirsync.New(uploader, downloader,
+//		dirsync.WithExclude("*.tmp"),
+//		dirsync.WithDelete(true),
+//	)
+//	plan, err := s.Plan(ctx, dirsync.Upload, "/var/log/app", "bucket", "logs/")
+//	summary, err := s.Apply(ctx, plan)
+package dirsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/at-wat/s3iot"
+)
+
+// DefaultConcurrency is the default number of the concurrent transfers.
+const DefaultConcurrency = 4
+
+// ErrNoUploader indicates Upload is requested to the Syncer without the Uploader.
+var ErrNoUploader = errors.New("uploader is not set")
+
+// ErrNoDownloader indicates Download is requested to the Syncer without the Downloader.
+var ErrNoDownloader = errors.New("downloader is not set")
+
+// Direction represents the direction of the synchronization.
+type Direction int
+
+// Directions.
+const (
+	// Upload synchronizes the local directory to the remote prefix.
+	Upload Direction = iota
+	// Download synchronizes the remote prefix to the local directory.
+	Download
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Upload:
+		return "upload"
+	case Download:
+		return "download"
+	default:
+		return "unknown"
+	}
+}
+
+// Compare is a set of the attributes to detect the changes.
+type Compare int
+
+// Attributes to be compared.
+const (
+	// CompareSize detects the change by the size.
+	CompareSize Compare = 1 << iota
+	// CompareModTime detects the change if the source is newer than
+	// the destination.
+	// Modification times are compared in seconds since S3 doesn't store
+	// the sub-second precision.
+	CompareModTime
+	// CompareETag detects the change by the ETag.
+	// ETag of the local file is calculated by Uploader.ETag and requires
+	// reading the whole file.
+	// Multipart objects uploaded with the different part size are always
+	// detected as changed.
+	CompareETag
+
+	// DefaultCompare is the default set of the attributes.
+	DefaultCompare = CompareSize | CompareModTime
+)
+
+// ActionType represents the type of the action.
+type ActionType int
+
+// Action types.
+const (
+	ActionSkip ActionType = iota
+	ActionUpload
+	ActionDownload
+	ActionDelete
+)
+
+func (t ActionType) String() string {
+	switch t {
+	case ActionSkip:
+		return "skip"
+	case ActionUpload:
+		return "upload"
+	case ActionDownload:
+		return "download"
+	case ActionDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Reason represents why the action is planned.
+type Reason string
+
+// Reasons.
+const (
+	ReasonNew        Reason = "new"
+	ReasonSize       Reason = "size"
+	ReasonModTime    Reason = "modtime"
+	ReasonETag       Reason = "etag"
+	ReasonUnchanged  Reason = "unchanged"
+	ReasonExtraneous Reason = "extraneous"
+)
+
+// Action represents a planned operation on a file or an object.
+type Action struct {
+	Type   ActionType
+	Reason Reason
+	// Path is the slash separated path relative to the local directory
+	// and the remote prefix.
+	Path      string
+	LocalPath string
+	Bucket    string
+	Key       string
+	// Size and ModTime are the attributes of the source of the transfer
+	// or the deleted file or object.
+	Size    int64
+	ModTime time.Time
+}
+
+func (a Action) String() string {
+	switch a.Type {
+	case ActionUpload:
+		return fmt.Sprintf("upload: %s to s3://%s/%s (%s)", a.LocalPath, a.Bucket, a.Key, a.Reason)
+	case ActionDownload:
+		return fmt.Sprintf("download: s3://%s/%s to %s (%s)", a.Bucket, a.Key, a.LocalPath, a.Reason)
+	case ActionDelete:
+		if a.LocalPath != "" {
+			return fmt.Sprintf("delete: %s", a.LocalPath)
+		}
+		return fmt.Sprintf("delete: s3://%s/%s", a.Bucket, a.Key)
+	default:
+		return fmt.Sprintf("skip: %s", a.Path)
+	}
+}
+
+// ActionError is returned if the action is failed.
+type ActionError struct {
+	Action Action
+	Err    error
+}
+
+// Error implements error.
+func (e *ActionError) Error() string {
+	return e.Action.Type.String() + " " + e.Action.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns original error.
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
+// Summary is the report of the synchronization.
+type Summary struct {
+	Uploaded   int
+	Downloaded int
+	Deleted    int
+	Skipped    int
+	Failed     int
+	// Bytes is the total size of the transferred files.
+	Bytes    int64
+	Duration time.Duration
+	Errors   []*ActionError
+}
+
+func (s *Summary) String() string {
+	return fmt.Sprintf(
+		"%d uploaded, %d downloaded, %d deleted, %d skipped, %d failed, %d bytes in %s",
+		s.Uploaded, s.Downloaded, s.Deleted, s.Skipped, s.Failed, s.Bytes, s.Duration,
+	)
+}
+
+// Syncer synchronizes a local directory and a remote prefix.
+type Syncer struct {
+	uploader   *s3iot.Uploader
+	downloader *s3iot.Downloader
+
+	include     []string
+	exclude     []string
+	compare     Compare
+	delete      bool
+	concurrency int
+	pageSize    int
+	onStart     func(Action, s3iot.Pauser)
+	onFinish    func(Action, error)
+}
+
+// Option configures Syncer.
+type Option func(*Syncer)
+
+// WithInclude sets the glob patterns of the paths to be synchronized.
+// Pattern without slash is matched against the base name and the other
+// patterns are matched against the whole path relative to the directory.
+// "**" matches zero or more directories.
+// All paths are synchronized if no include pattern is set.
+func WithInclude(patterns ...string) Option {
+	return func(s *Syncer) {
+		s.include = append(s.include, patterns...)
+	}
+}
+
+// WithExclude sets the glob patterns of the paths not to be synchronized.
+// Exclude patterns take precedence over the include patterns.
+// Excluded paths are never deleted.
+func WithExclude(patterns ...string) Option {
+	return func(s *Syncer) {
+		s.exclude = append(s.exclude, patterns...)
+	}
+}
+
+// WithCompare sets the attributes to detect the changes.
+func WithCompare(c Compare) Option {
+	return func(s *Syncer) {
+		s.compare = c
+	}
+}
+
+// WithDelete enables to delete the destination files or objects
+// not existing on the source.
+func WithDelete(d bool) Option {
+	return func(s *Syncer) {
+		s.delete = d
+	}
+}
+
+// WithConcurrency sets the maximum number of the concurrent actions.
+func WithConcurrency(n int) Option {
+	return func(s *Syncer) {
+		s.concurrency = n
+	}
+}
+
+// WithPageSize sets the maximum number of the objects listed by
+// a ListObjectsV2 call.
+// Zero uses the server default.
+func WithPageSize(n int) Option {
+	return func(s *Syncer) {
+		s.pageSize = n
+	}
+}
+
+// WithOnStart sets the callback called when the transfer is started.
+// Pauser can be registered to the pause controller like
+// connectivity.Controller.
+// Pauser is nil on delete actions and downloads of empty objects.
+// Callback may be called concurrently.
+func WithOnStart(fn func(Action, s3iot.Pauser)) Option {
+	return func(s *Syncer) {
+		s.onStart = fn
+	}
+}
+
+// WithOnFinish sets the callback called when the action is finished.
+// Callback may be called concurrently.
+func WithOnFinish(fn func(Action, error)) Option {
+	return func(s *Syncer) {
+		s.onFinish = fn
+	}
+}
+
+// New creates Syncer.
+// Uploader is required to Upload and Downloader is required to Download,
+// and the other one may be nil.
+// API of them must implement s3api.ListAPI, and s3api.DeleteAPI if
+// WithDelete is enabled on Upload.
+func New(u *s3iot.Uploader, d *s3iot.Downloader, opts ...Option) *Syncer {
+	s := &Syncer{
+		uploader:    u,
+		downloader:  d,
+		compare:     DefaultCompare,
+		concurrency: DefaultConcurrency,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Sync plans and applies the synchronization.
+func (s *Syncer) Sync(ctx context.Context, dir Direction, localDir, bucket, prefix string) (*Summary, error) {
+	plan, err := s.Plan(ctx, dir, localDir, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return s.Apply(ctx, plan)
+}
@@ -0,0 +1,481 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dirsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/s3api"
+	"github.com/at-wat/s3iot/s3fake"
+)
+
+const bucket = "bucket"
+
+func newSyncer(api *s3fake.API, opts ...Option) *Syncer {
+	u := &s3iot.Uploader{}
+	d := &s3iot.Downloader{}
+	for _, opt := range []s3iot.UpDownloaderOption{
+		s3iot.WithAPI(api),
+		s3iot.WithRetryer(&s3iot.NoRetryerFactory{}),
+	} {
+		opt.ApplyToUploader(u)
+		opt.ApplyToDownloader(d)
+	}
+	return New(u, d, opts...)
+}
+
+func putObjects(t *testing.T, api *s3fake.API, objs map[string]string) {
+	t.Helper()
+	for key, data := range objs {
+		key := key
+		b := bucket
+		if _, err := api.PutObject(context.TODO(), &s3api.PutObjectInput{
+			Bucket: &b,
+			Key:    &key,
+			Body:   strings.NewReader(data),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeFiles writes the files with the modification time of an hour ago.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	old := time.Now().Add(-time.Hour)
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type plannedAction struct {
+	Type   ActionType
+	Reason Reason
+	Path   string
+}
+
+func planned(plan *Plan) []plannedAction {
+	var as []plannedAction
+	for _, a := range plan.Actions {
+		as = append(as, plannedAction{Type: a.Type, Reason: a.Reason, Path: a.Path})
+	}
+	return as
+}
+
+func TestSyncer(t *testing.T) {
+	t.Run("Upload", func(t *testing.T) {
+		api := s3fake.New()
+		putObjects(t, api, map[string]string{
+			"prefix/a.txt":         "a",
+			"prefix/old.txt":       "old",
+			"prefix/unchanged.txt": "unchanged",
+			"prefix/excluded.tmp":  "excluded",
+			"other/b.txt":          "other",
+		})
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{
+			"a.txt":         "aaa",
+			"sub/b.log":     "bbbb",
+			"sub/c.tmp":     "c",
+			"unchanged.txt": "unchanged",
+		})
+
+		var mu sync.Mutex
+		var started []string
+		s := newSyncer(api,
+			WithExclude("*.tmp"),
+			WithDelete(true),
+			WithPageSize(1),
+			WithConcurrency(2),
+			WithOnStart(func(a Action, _ s3iot.Pauser) {
+				mu.Lock()
+				started = append(started, a.Path)
+				mu.Unlock()
+			}),
+		)
+		plan, err := s.Plan(context.TODO(), Upload, dir, bucket, "prefix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := api.Calls(s3fake.OpListObjectsV2); n < 4 {
+			t.Errorf("Listing must be paginated, but ListObjectsV2 called %d times", n)
+		}
+		expected := []plannedAction{
+			{ActionUpload, ReasonSize, "a.txt"},
+			{ActionDelete, ReasonExtraneous, "old.txt"},
+			{ActionUpload, ReasonNew, "sub/b.log"},
+			{ActionSkip, ReasonUnchanged, "unchanged.txt"},
+		}
+		if a := planned(plan); !reflect.DeepEqual(expected, a) {
+			t.Fatalf("Expected plan:\n%v\ngot:\n%v", expected, a)
+		}
+		if _, ok := api.Object(bucket, "prefix/sub/b.log"); ok {
+			t.Fatal("Plan must not change anything")
+		}
+
+		summary, err := s.Apply(context.TODO(), plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Uploaded != 2 || summary.Deleted != 1 || summary.Skipped != 1 ||
+			summary.Failed != 0 || summary.Bytes != 7 {
+			t.Errorf("Unexpected summary: %s", summary)
+		}
+		if len(started) != 3 {
+			t.Errorf("Expected 3 started actions, got %v", started)
+		}
+		for key, expected := range map[string]string{
+			"prefix/a.txt":        "aaa",
+			"prefix/sub/b.log":    "bbbb",
+			"prefix/excluded.tmp": "excluded",
+			"other/b.txt":         "other",
+		} {
+			if data, ok := api.Object(bucket, key); !ok || string(data) != expected {
+				t.Errorf("%s: expected %q, got %q", key, expected, data)
+			}
+		}
+		if _, ok := api.Object(bucket, "prefix/old.txt"); ok {
+			t.Error("Extraneous object must be deleted")
+		}
+
+		plan, err = s.Plan(context.TODO(), Upload, dir, bucket, "prefix/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := plan.Count(ActionSkip); n != len(plan.Actions) || n != 3 {
+			t.Errorf("All files must be unchanged after sync, got %v", planned(plan))
+		}
+	})
+	t.Run("Download", func(t *testing.T) {
+		api := s3fake.New()
+		putObjects(t, api, map[string]string{
+			"prefix/a.txt":         "aaa",
+			"prefix/sub/b.log":     "bbbb",
+			"prefix/unchanged.txt": "unchanged",
+			"prefix/dir/":          "",
+		})
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{
+			"a.txt":         "aa",
+			"old.txt":       "old",
+			"unchanged.txt": "unchanged",
+		})
+		now := time.Now()
+		if err := os.Chtimes(filepath.Join(dir, "unchanged.txt"), now, now); err != nil {
+			t.Fatal(err)
+		}
+
+		s := newSyncer(api, WithDelete(true))
+		s.uploader = nil
+		plan, err := s.Plan(context.TODO(), Download, dir, bucket, "prefix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []plannedAction{
+			{ActionDownload, ReasonSize, "a.txt"},
+			{ActionDelete, ReasonExtraneous, "old.txt"},
+			{ActionDownload, ReasonNew, "sub/b.log"},
+			{ActionSkip, ReasonUnchanged, "unchanged.txt"},
+		}
+		if a := planned(plan); !reflect.DeepEqual(expected, a) {
+			t.Fatalf("Expected plan:\n%v\ngot:\n%v", expected, a)
+		}
+
+		summary, err := s.Apply(context.TODO(), plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Downloaded != 2 || summary.Deleted != 1 || summary.Skipped != 1 ||
+			summary.Failed != 0 || summary.Bytes != 7 {
+			t.Errorf("Unexpected summary: %s", summary)
+		}
+		for name, expected := range map[string]string{
+			"a.txt":     "aaa",
+			"sub/b.log": "bbbb",
+		} {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != expected {
+				t.Errorf("%s: expected %q, got %q", name, expected, data)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "old.txt")); !os.IsNotExist(err) {
+			t.Errorf("Extraneous file must be deleted: %v", err)
+		}
+		matches, err := filepath.Glob(filepath.Join(dir, "*", ".*.tmp"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 0 {
+			t.Errorf("Temporary files must be removed: %v", matches)
+		}
+
+		plan, err = s.Plan(context.TODO(), Download, dir, bucket, "prefix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := plan.Count(ActionSkip); n != len(plan.Actions) || n != 3 {
+			t.Errorf("All files must be unchanged after sync, got %v", planned(plan))
+		}
+	})
+	t.Run("DownloadToNewDirectory", func(t *testing.T) {
+		api := s3fake.New()
+		putObjects(t, api, map[string]string{"prefix/a.txt": "aaa"})
+		dir := filepath.Join(t.TempDir(), "new")
+
+		s := newSyncer(api)
+		summary, err := s.Sync(context.TODO(), Download, dir, bucket, "prefix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Downloaded != 1 {
+			t.Errorf("Unexpected summary: %s", summary)
+		}
+		if _, err := s.Plan(context.TODO(), Upload, filepath.Join(dir, "nonexistent"), bucket, "prefix"); !os.IsNotExist(err) {
+			t.Errorf("Expected not exist error on upload, got %v", err)
+		}
+	})
+	t.Run("DownloadEmpty", func(t *testing.T) {
+		api := s3fake.New()
+		putObjects(t, api, map[string]string{"prefix/empty.txt": ""})
+		dir := t.TempDir()
+
+		s := newSyncer(api)
+		summary, err := s.Sync(context.TODO(), Download, dir, bucket, "prefix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Downloaded != 1 || summary.Failed != 0 {
+			t.Errorf("Unexpected summary: %s", summary)
+		}
+		info, err := os.Stat(filepath.Join(dir, "empty.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 0 {
+			t.Errorf("Expected empty file, got %d bytes", info.Size())
+		}
+
+		plan, err := s.Plan(context.TODO(), Download, dir, bucket, "prefix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := plan.Count(ActionSkip); n != 1 {
+			t.Errorf("Empty file must be unchanged after sync, got %v", planned(plan))
+		}
+	})
+	t.Run("CompareETag", func(t *testing.T) {
+		api := s3fake.New()
+		putObjects(t, api, map[string]string{
+			"a.txt": "aaa",
+			"b.txt": "bbb",
+		})
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{
+			"a.txt": "aaa",
+			"b.txt": "BBB",
+		})
+
+		for _, tt := range []struct {
+			compare  Compare
+			expected []plannedAction
+		}{
+			{
+				compare: DefaultCompare,
+				expected: []plannedAction{
+					{ActionSkip, ReasonUnchanged, "a.txt"},
+					{ActionSkip, ReasonUnchanged, "b.txt"},
+				},
+			},
+			{
+				compare: CompareSize | CompareETag,
+				expected: []plannedAction{
+					{ActionSkip, ReasonUnchanged, "a.txt"},
+					{ActionUpload, ReasonETag, "b.txt"},
+				},
+			},
+		} {
+			s := newSyncer(api, WithCompare(tt.compare))
+			plan, err := s.Plan(context.TODO(), Upload, dir, bucket, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a := planned(plan); !reflect.DeepEqual(tt.expected, a) {
+				t.Errorf("Compare %d: expected plan:\n%v\ngot:\n%v", tt.compare, tt.expected, a)
+			}
+		}
+	})
+	t.Run("Include", func(t *testing.T) {
+		api := s3fake.New()
+		putObjects(t, api, map[string]string{"other/x": "x"})
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{
+			"logs/a.log":     "a",
+			"logs/sub/b.log": "b",
+			"logs/c.txt":     "c",
+			"data/d.log":     "d",
+		})
+		s := newSyncer(api, WithInclude("logs/**/*.log"))
+		plan, err := s.Plan(context.TODO(), Upload, dir, bucket, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []plannedAction{
+			{ActionUpload, ReasonNew, "logs/a.log"},
+			{ActionUpload, ReasonNew, "logs/sub/b.log"},
+		}
+		if a := planned(plan); !reflect.DeepEqual(expected, a) {
+			t.Fatalf("Expected plan:\n%v\ngot:\n%v", expected, a)
+		}
+	})
+	t.Run("Failure", func(t *testing.T) {
+		api := s3fake.New()
+		putObjects(t, api, map[string]string{"other/x": "x"})
+		errPut := errors.New("put failed")
+		api.Inject(s3fake.Fault{
+			Op:  s3fake.OpPutObject,
+			Key: "b.txt",
+			Err: errPut,
+		})
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{
+			"a.txt": "a",
+			"b.txt": "b",
+			"c.txt": "c",
+		})
+
+		var finished []string
+		s := newSyncer(api,
+			WithConcurrency(1),
+			WithOnFinish(func(a Action, err error) {
+				if err != nil {
+					finished = append(finished, a.Path+" failed")
+					return
+				}
+				finished = append(finished, a.Path)
+			}),
+		)
+		summary, err := s.Sync(context.TODO(), Upload, dir, bucket, "")
+		var ae *ActionError
+		if !errors.As(err, &ae) || ae.Action.Path != "b.txt" || !errors.Is(err, errPut) {
+			t.Fatalf("Expected ActionError of b.txt, got %v", err)
+		}
+		if summary.Uploaded != 2 || summary.Failed != 1 || len(summary.Errors) != 1 {
+			t.Errorf("Unexpected summary: %s", summary)
+		}
+		expected := []string{"a.txt", "b.txt failed", "c.txt"}
+		if !reflect.DeepEqual(expected, finished) {
+			t.Errorf("Expected finished actions %v, got %v", expected, finished)
+		}
+		if data, _ := api.Object(bucket, "c.txt"); !bytes.Equal(data, []byte("c")) {
+			t.Error("Actions after the failure must be applied")
+		}
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		api := s3fake.New()
+		putObjects(t, api, map[string]string{"other/x": "x"})
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"a.txt": "a"})
+		s := newSyncer(api)
+		plan, err := s.Plan(context.TODO(), Upload, dir, bucket, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		summary, err := s.Apply(ctx, plan)
+		if err != context.Canceled {
+			t.Fatalf("Expected %v, got %v", context.Canceled, err)
+		}
+		if summary.Uploaded != 0 {
+			t.Errorf("Unexpected summary: %s", summary)
+		}
+	})
+	t.Run("ListRetry", func(t *testing.T) {
+		api := s3fake.New()
+		putObjects(t, api, map[string]string{
+			"prefix/a.txt": "a",
+			"prefix/b.txt": "b",
+		})
+		api.Inject(s3fake.Fault{
+			Op:    s3fake.OpListObjectsV2,
+			Call:  2,
+			Times: 1,
+			Err:   s3fake.ErrInternalError,
+		})
+		dir := t.TempDir()
+
+		s := newSyncer(api, WithPageSize(1))
+		s.downloader.RetryerFactory = &s3iot.ExponentialBackoffRetryerFactory{
+			WaitBase: time.Millisecond,
+		}
+		s.downloader.ErrorClassifier = &s3fake.ErrorClassifier{}
+		summary, err := s.Sync(context.TODO(), Download, dir, bucket, "prefix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Downloaded != 2 {
+			t.Errorf("Unexpected summary: %s", summary)
+		}
+
+		api.Inject(s3fake.Fault{
+			Op:  s3fake.OpListObjectsV2,
+			Err: s3fake.ErrNoSuchBucket,
+		})
+		if _, err := s.Plan(context.TODO(), Download, dir, bucket, "prefix"); !errors.Is(err, s3fake.ErrNoSuchBucket) {
+			t.Errorf("Expected %v, got %v", s3fake.ErrNoSuchBucket, err)
+		}
+	})
+	t.Run("Errors", func(t *testing.T) {
+		api := s3fake.New()
+		dir := t.TempDir()
+
+		if _, err := New(nil, nil).Plan(context.TODO(), Upload, dir, bucket, ""); err != ErrNoUploader {
+			t.Errorf("Expected %v, got %v", ErrNoUploader, err)
+		}
+		if _, err := New(nil, nil).Plan(context.TODO(), Download, dir, bucket, ""); err != ErrNoDownloader {
+			t.Errorf("Expected %v, got %v", ErrNoDownloader, err)
+		}
+		u := &s3iot.Uploader{}
+		s3iot.WithAPI(struct{ s3api.UpDownloadAPI }{api}).ApplyToUploader(u)
+		if _, err := New(u, nil).Plan(context.TODO(), Upload, dir, bucket, ""); err != s3iot.ErrUnsupportedAPI {
+			t.Errorf("Expected %v, got %v", s3iot.ErrUnsupportedAPI, err)
+		}
+		if _, err := newSyncer(api, WithExclude("[")).Plan(context.TODO(), Upload, dir, bucket, ""); err == nil {
+			t.Error("Invalid pattern must be error")
+		}
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dirsync
+
+import (
+	"path"
+	"strings"
+)
+
+// filter selects the paths by the include and exclude glob patterns.
+type filter struct {
+	include []string
+	exclude []string
+}
+
+func newFilter(include, exclude []string) (*filter, error) {
+	for _, patterns := range [][]string{include, exclude} {
+		for _, p := range patterns {
+			if err := validatePattern(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &filter{include: include, exclude: exclude}, nil
+}
+
+// selected reports whether the slash separated path is synchronized.
+// Path must match one of the include patterns if specified and must not
+// match any of the exclude patterns.
+func (f *filter) selected(name string) bool {
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+	return !matchAny(f.exclude, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func validatePattern(pattern string) error {
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match reports whether the slash separated path matches the pattern.
+// Pattern without slash is matched against the base name.
+// Otherwise, the pattern is matched against the whole path and
+// "**" element matches zero or more path elements.
+func match(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
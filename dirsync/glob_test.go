@@ -0,0 +1,73 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dirsync
+
+import (
+	"path"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.log", "a.log", true},
+		{"*.log", "dir/sub/a.log", true},
+		{"*.log", "a.txt", false},
+		{"dir/*.log", "dir/a.log", true},
+		{"dir/*.log", "dir/sub/a.log", false},
+		{"dir/*.log", "other/a.log", false},
+		{"dir/**", "dir/a.log", true},
+		{"dir/**", "dir/sub/a.log", true},
+		{"dir/**", "other/a.log", false},
+		{"**/*.log", "a.log", true},
+		{"**/*.log", "dir/sub/a.log", true},
+		{"dir/**/a.log", "dir/a.log", true},
+		{"dir/**/a.log", "dir/x/y/a.log", true},
+		{"dir/**/a.log", "dir/x/y/b.log", false},
+		{"d?r/[ab].log", "dir/b.log", true},
+	}
+	for _, tt := range testCases {
+		tt := tt
+		t.Run(tt.pattern+"/"+tt.name, func(t *testing.T) {
+			if m := match(tt.pattern, tt.name); m != tt.match {
+				t.Errorf("Expected %v, got %v", tt.match, m)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f, err := newFilter([]string{"logs/**"}, []string{"*.tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]bool{
+		"logs/a.log":     true,
+		"logs/sub/a.log": true,
+		"logs/a.tmp":     false,
+		"data/a.log":     false,
+	} {
+		if s := f.selected(name); s != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, s)
+		}
+	}
+
+	if _, err := newFilter(nil, []string{"dir/[a"}); err != path.ErrBadPattern {
+		t.Errorf("Expected %v, got %v", path.ErrBadPattern, err)
+	}
+}
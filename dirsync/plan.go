@@ -0,0 +1,287 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dirsync
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/internal/etag"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// Plan is the list of the actions to synchronize.
+type Plan struct {
+	Direction Direction
+	LocalDir  string
+	Bucket    string
+	// Prefix is the remote prefix ending with slash or empty.
+	Prefix string
+	// Actions are sorted by the path.
+	// Unchanged files are included as ActionSkip.
+	Actions []Action
+}
+
+// Count returns the number of the actions of the type.
+func (p *Plan) Count(t ActionType) int {
+	var n int
+	for _, a := range p.Actions {
+		if a.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+type localFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Plan compares the local directory and the remote prefix and
+// returns the actions to synchronize them without changing anything.
+// Prefix is treated as a directory and slash is appended if missing.
+// Non-existent local directory is treated as empty on Download.
+func (s *Syncer) Plan(ctx context.Context, dir Direction, localDir, bucket, prefix string) (*Plan, error) {
+	var base *s3iot.UpDownloaderBase
+	switch dir {
+	case Upload:
+		if s.uploader == nil {
+			return nil, ErrNoUploader
+		}
+		base = &s.uploader.UpDownloaderBase
+	case Download:
+		if s.downloader == nil {
+			return nil, ErrNoDownloader
+		}
+		base = &s.downloader.UpDownloaderBase
+	default:
+		return nil, errors.New("unknown direction")
+	}
+	listAPI, ok := base.API.(s3api.ListAPI)
+	if !ok {
+		return nil, s3iot.ErrUnsupportedAPI
+	}
+	if _, ok := base.API.(s3api.DeleteAPI); !ok && s.delete && dir == Upload {
+		return nil, s3iot.ErrUnsupportedAPI
+	}
+	f, err := newFilter(s.include, s.exclude)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	locals, err := listLocal(localDir, f)
+	if err != nil {
+		if dir != Download || !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	remotes, err := s.listRemote(ctx, base, listAPI, bucket, prefix, f)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(locals)+len(remotes))
+	for p := range locals {
+		paths = append(paths, p)
+	}
+	for p := range remotes {
+		if _, ok := locals[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	plan := &Plan{
+		Direction: dir,
+		LocalDir:  localDir,
+		Bucket:    bucket,
+		Prefix:    prefix,
+	}
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		a := Action{
+			Path:      p,
+			LocalPath: filepath.Join(localDir, filepath.FromSlash(p)),
+			Bucket:    bucket,
+			Key:       prefix + p,
+		}
+		local, hasLocal := locals[p]
+		remote, hasRemote := remotes[p]
+		switch {
+		case dir == Upload && !hasLocal, dir == Download && !hasRemote:
+			if !s.delete {
+				continue
+			}
+			a.Type, a.Reason = ActionDelete, ReasonExtraneous
+			if dir == Upload {
+				a.LocalPath = ""
+				a.Size = remote.Size
+				if remote.LastModified != nil {
+					a.ModTime = *remote.LastModified
+				}
+			} else {
+				a.Size, a.ModTime = local.size, local.modTime
+			}
+		case dir == Upload:
+			a.Size, a.ModTime = local.size, local.modTime
+			a.Type = ActionUpload
+			if a.Reason, err = s.compareFile(local, remote, hasRemote, local.modTime, remote.LastModified); err != nil {
+				return nil, err
+			}
+		default:
+			a.Size = remote.Size
+			if remote.LastModified != nil {
+				a.ModTime = *remote.LastModified
+			}
+			a.Type = ActionDownload
+			var lm *time.Time
+			if hasLocal {
+				lm = &local.modTime
+			}
+			if a.Reason, err = s.compareFile(local, remote, hasLocal, a.ModTime, lm); err != nil {
+				return nil, err
+			}
+		}
+		if a.Reason == ReasonUnchanged {
+			a.Type = ActionSkip
+		}
+		plan.Actions = append(plan.Actions, a)
+	}
+	return plan, nil
+}
+
+// compareFile returns the reason to transfer the file.
+// src is the modification time of the source and dst is of
+// the destination if known.
+func (s *Syncer) compareFile(local localFile, remote s3api.Object, exists bool, src time.Time, dst *time.Time) (Reason, error) {
+	if !exists {
+		return ReasonNew, nil
+	}
+	if s.compare&CompareSize != 0 && local.size != remote.Size {
+		return ReasonSize, nil
+	}
+	if s.compare&CompareModTime != 0 && dst != nil &&
+		src.Truncate(time.Second).After(dst.Truncate(time.Second)) {
+		return ReasonModTime, nil
+	}
+	if s.compare&CompareETag != 0 {
+		if remote.ETag == nil {
+			return ReasonETag, nil
+		}
+		tag, err := s.localETag(local.path)
+		if err != nil {
+			return "", err
+		}
+		if !etag.Equal(tag, *remote.ETag) {
+			return ReasonETag, nil
+		}
+	}
+	return ReasonUnchanged, nil
+}
+
+func (s *Syncer) localETag(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	u := s.uploader
+	if u == nil {
+		u = &s3iot.Uploader{}
+	}
+	return u.ETag(f)
+}
+
+// listLocal returns the regular files under the directory
+// mapped by the slash separated relative path.
+func listLocal(dir string, f *filter) (map[string]localFile, error) {
+	files := make(map[string]localFile)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !f.selected(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[rel] = localFile{
+			path:    p,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}
+		return nil
+	})
+	return files, err
+}
+
+// listRemote returns the objects under the prefix mapped by the path
+// relative to the prefix following the continuation tokens.
+// Directory placeholder objects ending with slash are ignored.
+// Each page is retried using the Retryer of the Uploader or Downloader.
+func (s *Syncer) listRemote(ctx context.Context, base *s3iot.UpDownloaderBase, api s3api.ListAPI, bucket, prefix string, f *filter) (map[string]s3api.Object, error) {
+	objs := make(map[string]s3api.Object)
+	input := &s3api.ListObjectsV2Input{
+		Bucket:  &bucket,
+		Prefix:  &prefix,
+		MaxKeys: s.pageSize,
+	}
+	for {
+		var out *s3api.ListObjectsV2Output
+		err := retry(ctx, base, func() error {
+			var err error
+			out, err = api.ListObjectsV2(ctx, input)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range out.Contents {
+			if obj.Key == nil {
+				continue
+			}
+			rel := strings.TrimPrefix(*obj.Key, prefix)
+			if rel == "" || strings.HasSuffix(rel, "/") || !f.selected(rel) {
+				continue
+			}
+			objs[rel] = obj
+		}
+		if out.NextContinuationToken == nil || *out.NextContinuationToken == "" {
+			return objs, nil
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+}
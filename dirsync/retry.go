@@ -0,0 +1,133 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dirsync
+
+import (
+	"context"
+	"sync"
+
+	"github.com/at-wat/s3iot"
+)
+
+// listPauser is passed to the Retryer of the listing.
+// Retry of the listing is held while paused.
+type listPauser struct {
+	clock s3iot.Clock
+	done  chan struct{}
+
+	mu      sync.Mutex
+	resumed chan struct{}
+}
+
+func newListPauser(clock s3iot.Clock) *listPauser {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &listPauser{
+		clock:   clock,
+		done:    make(chan struct{}),
+		resumed: resumed,
+	}
+}
+
+// Pause implements s3iot.Pauser.
+func (p *listPauser) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.resumed:
+		p.resumed = make(chan struct{})
+	default:
+	}
+}
+
+// Resume implements s3iot.Pauser.
+func (p *listPauser) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.resumed:
+	default:
+		close(p.resumed)
+	}
+}
+
+// Clock implements s3iot.ClockProvider.
+func (p *listPauser) Clock() s3iot.Clock {
+	return p.clock
+}
+
+// Done implements s3iot.DoneNotifier.
+func (p *listPauser) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *listPauser) wait(ctx context.Context) error {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retry calls fn until it succeeds using the Retryer and the ErrorClassifier
+// configured to the Uploader or Downloader.
+func retry(ctx context.Context, base *s3iot.UpDownloaderBase, fn func() error) error {
+	rf := base.RetryerFactory
+	if rf == nil {
+		rf = s3iot.DefaultRetryer
+	}
+	ec := base.ErrorClassifier
+	if ec == nil {
+		ec = s3iot.DefaultErrorClassifier
+	}
+	clock := base.Clock
+	if clock == nil {
+		clock = s3iot.DefaultClock
+	}
+	p := newListPauser(clock)
+	defer close(p.done)
+	r := rf.New(p)
+
+	for {
+		if err := p.wait(ctx); err != nil {
+			return err
+		}
+		err := fn()
+		if err == nil {
+			r.OnSuccess(0)
+			return nil
+		}
+		if ctx.Err() != nil || !ec.IsRetryable(err) {
+			return err
+		}
+		if wait, ok := s3iot.IsThrottleAt(ec, err, clock.Now()); ok {
+			if to, ok := r.(s3iot.ThrottleObserver); ok {
+				to.OnThrottle(0, wait)
+			}
+			select {
+			case <-clock.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if !r.OnFail(ctx, 0, err) {
+			return err
+		}
+	}
+}
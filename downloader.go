@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/at-wat/s3iot/contentrange"
 	"github.com/at-wat/s3iot/s3api"
@@ -41,17 +42,28 @@ func (u Downloader) Download(ctx context.Context, w io.WriterAt, input *Download
 	if u.ErrorClassifier == nil {
 		u.ErrorClassifier = DefaultErrorClassifier
 	}
+	var headAPI s3api.HeadAPI
+	if u.HeadFirst {
+		var ok bool
+		if headAPI, ok = u.API.(s3api.HeadAPI); !ok {
+			return nil, ErrUnsupportedAPI
+		}
+	}
 	dc := &downloadContext{
-		upDownloadContext: newUpDownloadContext(
-			u.API,
-			u.RetryerFactory,
-			u.ErrorClassifier,
-			u.ForcePause,
-		),
-		slicer: u.DownloadSlicerFactory.New(w),
-		input:  input,
+		slicer:      u.DownloadSlicerFactory.New(w),
+		input:       input,
+		headAPI:     headAPI,
+		w:           w,
+		concurrency: u.Concurrency,
 	}
-	dc.setStatePtr(&dc.status.Paused, &dc.status.NumRetries)
+	dc.upDownloadContext = newUpDownloadContext(
+		u.UpDownloaderBase, &dc.status.Paused, &dc.status.NumRetries,
+	)
+	ctx = dc.startTransfer(ctx, TransferInfo{
+		Operation: OperationDownload,
+		Bucket:    *input.Bucket,
+		Key:       *input.Key,
+	})
 	go dc.multi(ctx)
 	return dc, nil
 }
@@ -59,8 +71,11 @@ func (u Downloader) Download(ctx context.Context, w io.WriterAt, input *Download
 type downloadContext struct {
 	*upDownloadContext
 
-	slicer DownloadSlicer
-	input  *DownloadInput
+	slicer      DownloadSlicer
+	input       *DownloadInput
+	headAPI     s3api.HeadAPI
+	w           io.WriterAt
+	concurrency int
 
 	status DownloadStatus
 	output DownloadOutput
@@ -82,78 +97,74 @@ func (dc *downloadContext) Result() (DownloadOutput, error) {
 	return dc.output, dc.err
 }
 
-func (dc *downloadContext) multi(ctx context.Context) {
-	for i := int64(1); ; i++ {
-		i := i
-		w, rn := dc.slicer.NextWriter()
-		var n int64
-		var fatal bool
-		if err := withRetry(ctx, i, dc.retryer, dc.errClassifier, func() error {
-			dc.pauseCheck(ctx)
-			r := rn.String()
-			ctx2, isForcePaused := dc.currentCallContext(ctx)
-			out, err := dc.api.GetObject(ctx2, &s3api.GetObjectInput{
-				Bucket:    dc.input.Bucket,
-				Key:       dc.input.Key,
-				Range:     &r,
-				VersionID: dc.input.VersionID,
-			})
-			if isForcePaused() {
-				return ErrForcePaused
-			}
-			if err != nil {
-				dc.countRetry()
-				return err
-			}
-			defer out.Body.Close()
-
-			rn2, err := contentrange.ParseContentRange(*out.ContentRange)
-			if err != nil {
-				dc.countRetry()
-				return &retryableError{err}
-			}
-			if rn.Start != rn2.Start {
-				dc.countRetry()
-				return &retryableError{fmt.Errorf(
-					"requested range=%s, returned range=%s: %w",
-					rn, rn2,
-					ErrUnexpectedServerResponse,
-				)}
-			}
-			rn = *rn2
+type truncater interface {
+	Truncate(int64) error
+}
 
-			dc.mu.Lock()
-			if dc.status.ETag != nil && *dc.status.ETag != *out.ETag {
-				// File is changed during download.
-				err := fmt.Errorf(
-					"initial ETag=%s, current ETag=%s: %w",
-					*dc.status.ETag, *out.ETag,
-					ErrChangedDuringDownload,
-				)
-				dc.mu.Unlock()
-				dc.fail(err)
-				fatal = true
-				return nil
-			}
-			dc.status.Size = rn2.Size
-			dc.status.ContentType = out.ContentType
-			dc.status.ETag = out.ETag
-			dc.status.LastModified = out.LastModified
-			dc.status.VersionID = out.VersionID
-			dc.mu.Unlock()
+// head gets the object metadata and returns true if the size is known.
+func (dc *downloadContext) head(ctx context.Context) (bool, error) {
+	var known bool
+	if err := dc.retry(ctx, "HeadObject", 0, func(ctx context.Context) error {
+		ctx2, call := dc.currentCallContext(ctx, 0, false)
+		out, err := dc.headAPI.HeadObject(ctx2, &s3api.HeadObjectInput{
+			Bucket:    dc.input.Bucket,
+			Key:       dc.input.Key,
+			VersionID: dc.input.VersionID,
+		})
+		if err := call.end(); err != nil {
+			return err
+		}
+		if err != nil {
+			dc.countRetry()
+			return err
+		}
+		dc.mu.Lock()
+		if out.ContentLength != nil {
+			dc.status.Size = *out.ContentLength
+			known = true
+		}
+		dc.status.ContentType = out.ContentType
+		dc.status.ETag = out.ETag
+		dc.status.LastModified = out.LastModified
+		dc.status.VersionID = out.VersionID
+		dc.mu.Unlock()
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	if !known {
+		return false, nil
+	}
+	if t, ok := dc.w.(truncater); ok {
+		if err := t.Truncate(dc.status.Size); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
 
-			n, err = io.Copy(&atWriter{w: w}, out.Body)
-			if err != nil {
-				dc.fail(err)
-				fatal = true
-				return nil
-			}
-			return nil
-		}); err != nil {
+func (dc *downloadContext) multi(ctx context.Context) {
+	if dc.headAPI != nil {
+		known, err := dc.head(ctx)
+		if err != nil {
 			dc.fail(err)
 			return
 		}
-		if fatal {
+		// Size is learned from the first part if unknown.
+		if known && dc.status.Size == 0 {
+			dc.success(dc.status.DownloadOutput)
+			return
+		}
+		if known && dc.concurrency > 1 {
+			dc.parallel(ctx)
+			return
+		}
+	}
+	for i := int64(1); ; i++ {
+		w, rn := dc.slicer.NextWriter()
+		n, err := dc.part(ctx, i, w, rn)
+		if err != nil {
+			dc.fail(err)
 			return
 		}
 
@@ -161,6 +172,7 @@ func (dc *downloadContext) multi(ctx context.Context) {
 		dc.status.CompletedSize += n
 		done := dc.status.CompletedSize >= dc.status.Size
 		dc.mu.Unlock()
+		dc.transferred(n)
 
 		if done {
 			dc.success(dc.status.DownloadOutput)
@@ -169,16 +181,166 @@ func (dc *downloadContext) multi(ctx context.Context) {
 	}
 }
 
+// parallel downloads the parts planned from the object size
+// up to the concurrency.
+func (dc *downloadContext) parallel(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var errFirst error
+	size := dc.status.Size
+	sem := make(chan struct{}, dc.concurrency)
+	for i := int64(1); ; i++ {
+		w, rn := dc.slicer.NextWriter()
+		if rn.Start >= size {
+			break
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int64) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			n, err := dc.part(ctx, i, w, rn)
+			if err != nil {
+				once.Do(func() {
+					errFirst = err
+					cancel()
+				})
+				return
+			}
+			dc.mu.Lock()
+			dc.status.CompletedSize += n
+			dc.mu.Unlock()
+			dc.transferred(n)
+		}(i)
+	}
+	wg.Wait()
+
+	if errFirst == nil {
+		errFirst = ctx.Err()
+	}
+	if errFirst != nil {
+		dc.fail(errFirst)
+		return
+	}
+	dc.success(dc.status.DownloadOutput)
+}
+
+// part downloads the range and returns the number of the received bytes.
+func (dc *downloadContext) part(ctx context.Context, i int64, w io.WriterAt, rn contentrange.Range) (int64, error) {
+	// n is the number of the bytes of the part received so far.
+	// Retry after the body transfer failure requests the rest of the part.
+	var n int64
+	err := dc.retryPart(ctx, "GetObject", i, func(ctx context.Context) error {
+		req := rn
+		req.Start += n
+		if n > 0 && req.Start > req.End {
+			// Whole part was received before the failure.
+			return nil
+		}
+		r := req.String()
+		// Call context must be alive until the body is read.
+		ctx2, call := dc.currentCallContext(ctx, req.Length(), true)
+		defer call.end()
+		out, err := dc.api.GetObject(ctx2, &s3api.GetObjectInput{
+			Bucket:    dc.input.Bucket,
+			Key:       dc.input.Key,
+			Range:     &r,
+			VersionID: dc.input.VersionID,
+		})
+		if err != nil {
+			if err := call.end(); err != nil {
+				return err
+			}
+			dc.countRetry()
+			return err
+		}
+		defer out.Body.Close()
+
+		rn2, err := contentrange.ParseContentRange(*out.ContentRange)
+		if err != nil {
+			dc.countRetry()
+			return &retryableError{err}
+		}
+		if req.Start != rn2.Start {
+			dc.countRetry()
+			return &retryableError{fmt.Errorf(
+				"requested range=%s, returned range=%s: %w",
+				req, rn2,
+				ErrUnexpectedServerResponse,
+			)}
+		}
+		rn.End = rn2.End
+
+		dc.mu.Lock()
+		if dc.status.ETag != nil && *dc.status.ETag != *out.ETag {
+			// File is changed during download.
+			err := fmt.Errorf(
+				"initial ETag=%s, current ETag=%s: %w",
+				*dc.status.ETag, *out.ETag,
+				ErrChangedDuringDownload,
+			)
+			dc.mu.Unlock()
+			return &fatalError{err}
+		}
+		dc.status.Size = rn2.Size
+		dc.status.ContentType = out.ContentType
+		dc.status.ETag = out.ETag
+		dc.status.LastModified = out.LastModified
+		dc.status.VersionID = out.VersionID
+		dc.mu.Unlock()
+
+		m, err := io.Copy(&bodyWriter{atWriter{w: w, offset: n}}, call.bodyReader(out.Body))
+		n += m
+		if err := call.end(); err != nil {
+			return err
+		}
+		if err != nil {
+			if _, ok := err.(*fatalError); !ok {
+				// Connection is lost during the body transfer.
+				dc.countRetry()
+			}
+			return err
+		}
+		return nil
+	})
+	return n, err
+}
+
+// bodyWriter marks the write error as fatal to distinguish it from
+// the read error of the response body which can be retried.
+type bodyWriter struct {
+	atWriter
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	n, err := w.atWriter.Write(b)
+	if err != nil {
+		return n, &fatalError{err}
+	}
+	return n, nil
+}
+
 func (dc *downloadContext) fail(err error) {
 	dc.mu.Lock()
 	dc.err = err
 	dc.mu.Unlock()
-	close(dc.done)
+	dc.finish(err)
 }
 
 func (dc *downloadContext) success(out DownloadOutput) {
 	dc.mu.Lock()
 	dc.output = out
 	dc.mu.Unlock()
-	close(dc.done)
+	dc.finish(nil)
 }
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"io"
 	"math/rand"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -185,6 +186,82 @@ func TestDownloader(t *testing.T) {
 			})
 		}
 	})
+	t.Run("ResumeOnBodyError", func(t *testing.T) {
+		testCases := map[string]struct {
+			received int64
+			ranges   []string
+		}{
+			"Middle": {
+				received: 20,
+				ranges:   []string{"bytes=0-49", "bytes=20-49", "bytes=50-99", "bytes=100-149"},
+			},
+			// Rest of the part is not requested if the connection is reset
+			// after receiving whole part.
+			"End": {
+				received: 50,
+				ranges:   []string{"bytes=0-49", "bytes=50-99", "bytes=100-149"},
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				buf := iotest.BufferAt(make([]byte, 128))
+				api := newDownloadMockAPI(t, data, 0, nil, nil)
+				getObj := api.GetObjectFunc
+				var once sync.Once
+				api.GetObjectFunc = func(ctx context.Context, input *s3api.GetObjectInput) (*s3api.GetObjectOutput, error) {
+					out, err := getObj(ctx, input)
+					once.Do(func() {
+						out.Body = io.NopCloser(io.MultiReader(
+							io.LimitReader(out.Body, tt.received),
+							iotest.ReadErrorer{Err: errTemp},
+						))
+					})
+					return out, err
+				}
+				d := &s3iot.Downloader{}
+				s3iot.WithAPI(api).ApplyToDownloader(d)
+				s3iot.WithDownloadSlicer(
+					&s3iot.DefaultDownloadSlicerFactory{PartSize: 50},
+				).ApplyToDownloader(d)
+				s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{
+					WaitBase: time.Millisecond,
+					RetryMax: 1,
+				}).ApplyToDownloader(d)
+
+				dc, err := d.Download(context.TODO(), buf, &s3iot.DownloadInput{
+					Bucket: &bucket,
+					Key:    &key,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case <-time.After(time.Second):
+					t.Fatal("Timeout")
+				case <-dc.Done():
+				}
+				if _, err := dc.Result(); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, buf) {
+					t.Error("Downloaded data differs")
+				}
+				status, _ := dc.Status()
+				if status.NumRetries != 1 {
+					t.Errorf("Expected 1 retry, got %d", status.NumRetries)
+				}
+
+				var ranges []string
+				for _, call := range api.GetObjectCalls() {
+					ranges = append(ranges, *call.Input.Range)
+				}
+				if !reflect.DeepEqual(tt.ranges, ranges) {
+					t.Errorf("Expected ranges: %v, got: %v", tt.ranges, ranges)
+				}
+			})
+		}
+	})
 	t.Run("WriteError", func(t *testing.T) {
 		d := &s3iot.Downloader{}
 		s3iot.WithAPI(
@@ -395,6 +472,187 @@ func TestDownloader(t *testing.T) {
 			t.Error("Downloaded data differs")
 		}
 	})
+	t.Run("HeadFirst", func(t *testing.T) {
+		testCases := map[string]struct {
+			data        []byte
+			headErr     int
+			noLength    bool
+			concurrency int
+			getCalls    int
+			err         error
+		}{
+			"Normal": {
+				data:     data,
+				getCalls: 3,
+			},
+			"NoContentLength": {
+				data:     data,
+				noLength: true,
+				getCalls: 3,
+			},
+			"Parallel": {
+				data:        data,
+				concurrency: 3,
+				getCalls:    3,
+			},
+			"ParallelEmpty": {
+				data:        []byte{},
+				concurrency: 3,
+			},
+			"Empty": {
+				data: []byte{},
+			},
+			"HeadRetry": {
+				data:     data,
+				headErr:  1,
+				getCalls: 3,
+			},
+			"HeadError": {
+				data:    data,
+				headErr: 2,
+				err:     errTemp,
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				buf := &iotest.TruncatableBufferAt{}
+				if tt.noLength {
+					// Not preallocated without the size.
+					buf.Buf = make([]byte, len(tt.data))
+				}
+				api := newDownloadMockAPI(t, tt.data, 0, nil, nil)
+				var headCnt int
+				api.HeadObjectFunc = func(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+					headCnt++
+					if headCnt <= tt.headErr {
+						return nil, errTemp
+					}
+					size := int64(len(tt.data))
+					etag := "TAG0"
+					out := &s3api.HeadObjectOutput{ETag: &etag}
+					if !tt.noLength {
+						out.ContentLength = &size
+					}
+					return out, nil
+				}
+				if tt.concurrency > 1 {
+					// All parts must be requested in parallel.
+					var wg sync.WaitGroup
+					wg.Add(tt.getCalls)
+					getObj := api.GetObjectFunc
+					api.GetObjectFunc = func(ctx context.Context, input *s3api.GetObjectInput) (*s3api.GetObjectOutput, error) {
+						wg.Done()
+						wg.Wait()
+						return getObj(ctx, input)
+					}
+				}
+				d := &s3iot.Downloader{}
+				s3iot.WithAPI(api).ApplyToDownloader(d)
+				s3iot.WithHeadFirst(true).ApplyToDownloader(d)
+				s3iot.WithDownloadConcurrency(tt.concurrency).ApplyToDownloader(d)
+				s3iot.WithDownloadSlicer(
+					&s3iot.DefaultDownloadSlicerFactory{PartSize: 50},
+				).ApplyToDownloader(d)
+				s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{
+					WaitBase: time.Millisecond,
+					RetryMax: 1,
+				}).ApplyToDownloader(d)
+
+				dc, err := d.Download(context.TODO(), buf, &s3iot.DownloadInput{
+					Bucket: &bucket,
+					Key:    &key,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case <-time.After(time.Second):
+					t.Fatal("Timeout")
+				case <-dc.Done():
+				}
+				out, err := dc.Result()
+				if tt.err != nil {
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("Expected error: '%v', got: '%v'", tt.err, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := len(api.HeadObjectCalls()); n != tt.headErr+1 {
+					t.Errorf("HeadObject must be called %d times, but called %d times", tt.headErr+1, n)
+				}
+				if n := len(api.GetObjectCalls()); n != tt.getCalls {
+					t.Errorf("GetObject must be called %d times, but called %d times", tt.getCalls, n)
+				}
+				if *out.ETag != "TAG0" {
+					t.Errorf("Expected ETag: TAG0, got: %s", *out.ETag)
+				}
+				if !bytes.Equal(tt.data, buf.Buf) {
+					t.Error("Downloaded data differs")
+				}
+			})
+		}
+	})
+	t.Run("HeadFirstParallelError", func(t *testing.T) {
+		buf := &iotest.TruncatableBufferAt{}
+		api := newDownloadMockAPI(t, data, 0, nil, nil)
+		api.HeadObjectFunc = func(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+			size := int64(len(data))
+			etag := "TAG0"
+			return &s3api.HeadObjectOutput{ContentLength: &size, ETag: &etag}, nil
+		}
+		getObj := api.GetObjectFunc
+		api.GetObjectFunc = func(ctx context.Context, input *s3api.GetObjectInput) (*s3api.GetObjectOutput, error) {
+			if *input.Range == "bytes=50-99" {
+				return nil, errTemp
+			}
+			return getObj(ctx, input)
+		}
+		d := &s3iot.Downloader{}
+		s3iot.WithAPI(api).ApplyToDownloader(d)
+		s3iot.WithHeadFirst(true).ApplyToDownloader(d)
+		s3iot.WithDownloadConcurrency(2).ApplyToDownloader(d)
+		s3iot.WithDownloadSlicer(
+			&s3iot.DefaultDownloadSlicerFactory{PartSize: 50},
+		).ApplyToDownloader(d)
+		s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{
+			WaitBase: time.Millisecond,
+			RetryMax: 1,
+		}).ApplyToDownloader(d)
+
+		dc, err := d.Download(context.TODO(), buf, &s3iot.DownloadInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		case <-dc.Done():
+		}
+		if _, err := dc.Result(); !errors.Is(err, errTemp) {
+			t.Fatalf("Expected error: '%v', got: '%v'", errTemp, err)
+		}
+	})
+	t.Run("HeadFirstUnsupportedAPI", func(t *testing.T) {
+		api := newDownloadMockAPI(t, data, 0, nil, nil)
+		d := &s3iot.Downloader{}
+		s3iot.WithAPI(struct{ s3api.UpDownloadAPI }{api}).ApplyToDownloader(d)
+		s3iot.WithHeadFirst(true).ApplyToDownloader(d)
+
+		_, err := d.Download(context.TODO(), iotest.BufferAt(make([]byte, 128)), &s3iot.DownloadInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != s3iot.ErrUnsupportedAPI {
+			t.Fatalf("Expected error: '%v', got: '%v'", s3iot.ErrUnsupportedAPI, err)
+		}
+	})
 	t.Run("ContextCanceled", func(t *testing.T) {
 		buf := iotest.BufferAt(make([]byte, 128))
 		api := newDownloadMockAPI(t, data, 0, nil, nil)
@@ -461,13 +719,16 @@ func newDownloadMockAPI(t *testing.T, data []byte, num int, ch chan interface{},
 			if err != nil {
 				t.Error(err)
 			}
-			r.Size = int64(len(data))
-			if r.End > int64(len(data)) {
-				r.End = int64(len(data)) - 1
+			rn, err := r.Resolve(int64(len(data)))
+			if err != nil {
+				t.Error(err)
 			}
-			cr := r.ContentRange()
+			cr := rn.ContentRange()
 			return &s3api.GetObjectOutput{
-				Body:         io.NopCloser(bytes.NewReader(data[r.Start : r.End+1])),
+				Body: io.NopCloser(&iotest.ContextReader{
+					Ctx: ctx,
+					R:   bytes.NewReader(data[rn.Start : rn.End+1]),
+				}),
 				ContentRange: &cr,
 				ETag:         &etag,
 			}, nil
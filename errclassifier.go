@@ -15,6 +15,11 @@
 package s3iot
 
 import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -34,6 +39,63 @@ func (NaiveErrorClassifier) IsThrottle(error) (time.Duration, bool) {
 	return 0, false
 }
 
+// HTTPStatus returns the HTTP status code of the error response.
+// If ec implements HTTPStatusClassifier, it is used.
+// Otherwise, the status code is extracted from the error implementing
+// HTTPStatusCode() int (like aws-sdk-go-v2 errors) or
+// StatusCode() int (like aws-sdk-go awserr.RequestFailure).
+func HTTPStatus(ec ErrorClassifier, err error) (int, bool) {
+	if hc, ok := ec.(HTTPStatusClassifier); ok {
+		return hc.HTTPStatus(err)
+	}
+	var hs interface{ HTTPStatusCode() int }
+	if errors.As(err, &hs) {
+		return hs.HTTPStatusCode(), true
+	}
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		return sc.StatusCode(), true
+	}
+	return 0, false
+}
+
+// IsThrottleAt returns the throttle wait of the error at the given time.
+// If ec implements ThrottleAtClassifier, it is used.
+// Otherwise, ec.IsThrottle is used.
+func IsThrottleAt(ec ErrorClassifier, err error, now time.Time) (time.Duration, bool) {
+	if tc, ok := ec.(ThrottleAtClassifier); ok {
+		return tc.IsThrottleAt(err, now)
+	}
+	return ec.IsThrottle(err)
+}
+
+// ParseRetryAfter parses the value of Retry-After header
+// in either of delay-seconds or HTTP-date format.
+// Negative delay is rounded to zero.
+func ParseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		switch {
+		case sec < 0:
+			return 0, true
+		case sec > int64(math.MaxInt64/time.Second):
+			return math.MaxInt64, true
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
 type retryableError struct {
 	error
 }
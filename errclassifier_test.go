@@ -15,7 +15,10 @@
 package s3iot
 
 import (
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 )
 
 var _ ErrorClassifier = &NaiveErrorClassifier{}
@@ -29,3 +32,91 @@ func TestNaiveErrorClassifier(t *testing.T) {
 		t.Errorf("IsThrottle should return (0, false), got (%v, %v)", d, ok)
 	}
 }
+
+type statusCodeError int
+
+func (e statusCodeError) Error() string   { return fmt.Sprintf("status %d", int(e)) }
+func (e statusCodeError) StatusCode() int { return int(e) }
+
+type httpStatusCodeError int
+
+func (e httpStatusCodeError) Error() string       { return fmt.Sprintf("status %d", int(e)) }
+func (e httpStatusCodeError) HTTPStatusCode() int { return int(e) }
+
+type statusClassifier struct {
+	NaiveErrorClassifier
+}
+
+func (statusClassifier) HTTPStatus(error) (int, bool) {
+	return 418, true
+}
+
+func TestHTTPStatus(t *testing.T) {
+	testCases := map[string]struct {
+		ec       ErrorClassifier
+		err      error
+		status   int
+		hasValue bool
+	}{
+		"Unknown": {
+			ec:  &NaiveErrorClassifier{},
+			err: errors.New("an error"),
+		},
+		"StatusCode": {
+			ec:       &NaiveErrorClassifier{},
+			err:      fmt.Errorf("wrapped: %w", statusCodeError(503)),
+			status:   503,
+			hasValue: true,
+		},
+		"HTTPStatusCode": {
+			ec:       &NaiveErrorClassifier{},
+			err:      fmt.Errorf("wrapped: %w", httpStatusCodeError(500)),
+			status:   500,
+			hasValue: true,
+		},
+		"Classifier": {
+			ec:       &statusClassifier{},
+			err:      httpStatusCodeError(500),
+			status:   418,
+			hasValue: true,
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			status, ok := HTTPStatus(tt.ec, tt.err)
+			if status != tt.status || ok != tt.hasValue {
+				t.Errorf("Expected (%d, %v), got (%d, %v)", tt.status, tt.hasValue, status, ok)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		value    string
+		wait     time.Duration
+		hasValue bool
+	}{
+		"Empty":     {"", 0, false},
+		"Invalid":   {"soon", 0, false},
+		"Seconds":   {"120", 2 * time.Minute, true},
+		"Spaces":    {" 3 ", 3 * time.Second, true},
+		"Negative":  {"-1", 0, true},
+		"Overflow":  {"99999999999999999", time.Duration(1<<63 - 1), true},
+		"HTTPDate":  {"Fri, 01 Jan 2021 00:00:30 GMT", 30 * time.Second, true},
+		"PastDate":  {"Thu, 31 Dec 2020 23:59:00 GMT", 0, true},
+		"RFC850":    {"Friday, 01-Jan-21 00:01:00 GMT", time.Minute, true},
+		"ANSICDate": {"Fri Jan  1 00:00:10 2021", 10 * time.Second, true},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			wait, ok := ParseRetryAfter(tt.value, now)
+			if wait != tt.wait || ok != tt.hasValue {
+				t.Errorf("Expected (%v, %v), got (%v, %v)", tt.wait, tt.hasValue, wait, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrInvalidErrorRule is returned if the error rule config is invalid.
+var ErrInvalidErrorRule = errors.New("invalid error rule")
+
+// ErrorRule classifies the errors matched by Match.
+// Throttle rule with positive ThrottleWait is also treated as retryable.
+type ErrorRule struct {
+	Match        ErrorMatcher
+	Retryable    bool
+	ThrottleWait time.Duration
+}
+
+// RuleErrorClassifier classifies errors by the first matching rule.
+// Errors not matched by any of the rules are classified by Fallback.
+// If Fallback is nil, DefaultErrorClassifier is used.
+//
+// For example, network errors can be retried and AccessDenied can be
+// treated as fatal on top of the SDK specific classifier:
+//
+//	ec := &s3iot.RuleErrorClassifier{
+//		Rules: []s3iot.ErrorRule{
+//			{Match: s3iot.MatchErrorCode("AccessDenied")},
+//			{Match: s3iot.MatchAny(s3iot.MatchNetError(), s3iot.MatchDNSError()), Retryable: true},
+//		},
+//		Fallback: &awss3v2.ErrorClassifier{},
+//	}
+type RuleErrorClassifier struct {
+	Rules    []ErrorRule
+	Fallback ErrorClassifier
+}
+
+func (c *RuleErrorClassifier) match(err error) (ErrorRule, bool) {
+	for _, r := range c.Rules {
+		if r.Match(err) {
+			return r, true
+		}
+	}
+	return ErrorRule{}, false
+}
+
+func (c *RuleErrorClassifier) fallback() ErrorClassifier {
+	if c.Fallback == nil {
+		return DefaultErrorClassifier
+	}
+	return c.Fallback
+}
+
+// IsRetryable implements ErrorClassifier.
+func (c *RuleErrorClassifier) IsRetryable(err error) bool {
+	if r, ok := c.match(err); ok {
+		return r.Retryable || r.ThrottleWait > 0
+	}
+	return c.fallback().IsRetryable(err)
+}
+
+// IsThrottle implements ErrorClassifier.
+func (c *RuleErrorClassifier) IsThrottle(err error) (time.Duration, bool) {
+	if r, ok := c.match(err); ok {
+		return r.ThrottleWait, r.ThrottleWait > 0
+	}
+	return c.fallback().IsThrottle(err)
+}
+
+// IsThrottleAt implements ThrottleAtClassifier.
+func (c *RuleErrorClassifier) IsThrottleAt(err error, now time.Time) (time.Duration, bool) {
+	if r, ok := c.match(err); ok {
+		return r.ThrottleWait, r.ThrottleWait > 0
+	}
+	return IsThrottleAt(c.fallback(), err, now)
+}
+
+// HTTPStatus implements HTTPStatusClassifier.
+func (c *RuleErrorClassifier) HTTPStatus(err error) (int, bool) {
+	return HTTPStatus(c.fallback(), err)
+}
+
+// AnyRetryableErrorClassifier combines ErrorClassifiers.
+// Error is retryable if any of the classifiers reports it retryable.
+// Error is throttle if any of the classifiers reports it throttle,
+// and the longest wait is used.
+type AnyRetryableErrorClassifier []ErrorClassifier
+
+// IsRetryable implements ErrorClassifier.
+func (c AnyRetryableErrorClassifier) IsRetryable(err error) bool {
+	for _, ec := range c {
+		if ec.IsRetryable(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsThrottle implements ErrorClassifier.
+func (c AnyRetryableErrorClassifier) IsThrottle(err error) (time.Duration, bool) {
+	return c.isThrottle(func(ec ErrorClassifier) (time.Duration, bool) {
+		return ec.IsThrottle(err)
+	})
+}
+
+// IsThrottleAt implements ThrottleAtClassifier.
+func (c AnyRetryableErrorClassifier) IsThrottleAt(err error, now time.Time) (time.Duration, bool) {
+	return c.isThrottle(func(ec ErrorClassifier) (time.Duration, bool) {
+		return IsThrottleAt(ec, err, now)
+	})
+}
+
+func (c AnyRetryableErrorClassifier) isThrottle(fn func(ErrorClassifier) (time.Duration, bool)) (time.Duration, bool) {
+	var wait time.Duration
+	var throttle bool
+	for _, ec := range c {
+		if w, ok := fn(ec); ok {
+			throttle = true
+			if w > wait {
+				wait = w
+			}
+		}
+	}
+	return wait, throttle
+}
+
+// HTTPStatus implements HTTPStatusClassifier.
+func (c AnyRetryableErrorClassifier) HTTPStatus(err error) (int, bool) {
+	for _, ec := range c {
+		if status, ok := HTTPStatus(ec, err); ok {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// Actions of ErrorRuleConfig.
+const (
+	ErrorRuleActionRetry    = "retry"
+	ErrorRuleActionFatal    = "fatal"
+	ErrorRuleActionThrottle = "throttle"
+)
+
+// Error kinds of ErrorRuleConfig.
+const (
+	ErrorKindNet             = "net"
+	ErrorKindDNS             = "dns"
+	ErrorKindTimeout         = "timeout"
+	ErrorKindConnectionReset = "connection_reset"
+	ErrorKindUnexpectedEOF   = "unexpected_eof"
+)
+
+var errorKindMatchers = map[string]func() ErrorMatcher{
+	ErrorKindNet:             MatchNetError,
+	ErrorKindDNS:             MatchDNSError,
+	ErrorKindTimeout:         MatchTimeout,
+	ErrorKindConnectionReset: MatchConnectionReset,
+	ErrorKindUnexpectedEOF:   MatchUnexpectedEOF,
+}
+
+// ErrorRuleConfig is the declarative representation of ErrorRule.
+// The rule matches the error if any of the conditions matches.
+//
+// Example in JSON:
+//
+//	[
+//	  {"codes": ["AccessDenied", "InvalidAccessKeyId"], "action": "fatal"},
+//	  {"kinds": ["net", "dns"], "messages": ["vpn: reset"], "action": "retry"},
+//	  {"statuses": [429], "action": "throttle", "wait": "10s"}
+//	]
+type ErrorRuleConfig struct {
+	// Codes matches the API error codes.
+	Codes []string `json:"codes,omitempty"`
+	// Statuses matches the HTTP status codes.
+	Statuses []int `json:"statuses,omitempty"`
+	// Messages matches the substrings of the error messages.
+	Messages []string `json:"messages,omitempty"`
+	// Kinds matches the kinds of the errors: net, dns, timeout,
+	// connection_reset and unexpected_eof.
+	Kinds []string `json:"kinds,omitempty"`
+	// Action is one of retry, fatal and throttle.
+	Action string `json:"action"`
+	// Wait is the throttle wait in time.ParseDuration format.
+	// Required if Action is throttle.
+	Wait string `json:"wait,omitempty"`
+}
+
+// Rule converts the config to ErrorRule.
+func (c ErrorRuleConfig) Rule() (ErrorRule, error) {
+	var matchers []ErrorMatcher
+	if len(c.Codes) > 0 {
+		matchers = append(matchers, MatchErrorCode(c.Codes...))
+	}
+	if len(c.Statuses) > 0 {
+		matchers = append(matchers, MatchHTTPStatus(c.Statuses...))
+	}
+	if len(c.Messages) > 0 {
+		matchers = append(matchers, MatchErrorMessage(c.Messages...))
+	}
+	for _, k := range c.Kinds {
+		m, ok := errorKindMatchers[k]
+		if !ok {
+			return ErrorRule{}, fmt.Errorf("%w: unknown error kind %q", ErrInvalidErrorRule, k)
+		}
+		matchers = append(matchers, m())
+	}
+	if len(matchers) == 0 {
+		return ErrorRule{}, fmt.Errorf("%w: no condition", ErrInvalidErrorRule)
+	}
+	rule := ErrorRule{Match: MatchAny(matchers...)}
+
+	switch c.Action {
+	case ErrorRuleActionRetry:
+		rule.Retryable = true
+	case ErrorRuleActionFatal:
+	case ErrorRuleActionThrottle:
+		wait, err := time.ParseDuration(c.Wait)
+		if err != nil || wait <= 0 {
+			return ErrorRule{}, fmt.Errorf("%w: invalid throttle wait %q", ErrInvalidErrorRule, c.Wait)
+		}
+		rule.Retryable = true
+		rule.ThrottleWait = wait
+	default:
+		return ErrorRule{}, fmt.Errorf("%w: unknown action %q", ErrInvalidErrorRule, c.Action)
+	}
+	return rule, nil
+}
+
+// NewErrorRules converts the configs to ErrorRules.
+func NewErrorRules(configs []ErrorRuleConfig) ([]ErrorRule, error) {
+	rules := make([]ErrorRule, 0, len(configs))
+	for i, c := range configs {
+		r, err := c.Rule()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// LoadErrorRules reads JSON array of ErrorRuleConfig and converts to ErrorRules.
+func LoadErrorRules(r io.Reader) ([]ErrorRule, error) {
+	var configs []ErrorRuleConfig
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&configs); err != nil {
+		return nil, err
+	}
+	return NewErrorRules(configs)
+}
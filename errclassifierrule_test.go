@@ -0,0 +1,185 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	_ ErrorClassifier      = &RuleErrorClassifier{}
+	_ HTTPStatusClassifier = &RuleErrorClassifier{}
+	_ ErrorClassifier      = AnyRetryableErrorClassifier{}
+	_ HTTPStatusClassifier = AnyRetryableErrorClassifier{}
+)
+
+type fixedErrorClassifier struct {
+	retryable bool
+	wait      time.Duration
+	status    int
+}
+
+func (c fixedErrorClassifier) IsRetryable(error) bool {
+	return c.retryable
+}
+
+func (c fixedErrorClassifier) IsThrottle(error) (time.Duration, bool) {
+	return c.wait, c.wait > 0
+}
+
+func (c fixedErrorClassifier) HTTPStatus(error) (int, bool) {
+	return c.status, c.status != 0
+}
+
+type codeStatusError struct {
+	code   string
+	status int
+}
+
+func (e codeStatusError) Error() string   { return e.code }
+func (e codeStatusError) Code() string    { return e.code }
+func (e codeStatusError) StatusCode() int { return e.status }
+
+func TestRuleErrorClassifier(t *testing.T) {
+	ec := &RuleErrorClassifier{
+		Rules: []ErrorRule{
+			{Match: MatchErrorCode("AccessDenied")},
+			{Match: MatchErrorCode("SlowDown"), ThrottleWait: time.Minute},
+			{Match: MatchAny(MatchNetError(), MatchDNSError()), Retryable: true},
+			{Match: MatchHTTPStatus(503), Retryable: true},
+		},
+		Fallback: fixedErrorClassifier{wait: time.Second, status: 418},
+	}
+
+	testCases := map[string]struct {
+		err       error
+		retryable bool
+		wait      time.Duration
+		throttle  bool
+	}{
+		"Fatal":      {codeError("AccessDenied"), false, 0, false},
+		"Throttle":   {codeError("SlowDown"), true, time.Minute, true},
+		"Retryable":  {&net.DNSError{}, true, 0, false},
+		"FirstMatch": {codeStatusError{"AccessDenied", 503}, false, 0, false},
+		"Status":     {statusCodeError(503), true, 0, false},
+		"Fallback":   {errDummy, false, time.Second, true},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			if retryable := ec.IsRetryable(tt.err); retryable != tt.retryable {
+				t.Errorf("Expected retryable: %v, got: %v", tt.retryable, retryable)
+			}
+			if wait, throttle := ec.IsThrottle(tt.err); wait != tt.wait || throttle != tt.throttle {
+				t.Errorf("Expected throttle: (%v, %v), got: (%v, %v)", tt.wait, tt.throttle, wait, throttle)
+			}
+		})
+	}
+	if status, ok := ec.HTTPStatus(errDummy); !ok || status != 418 {
+		t.Errorf("HTTPStatus must be provided by the fallback, got (%d, %v)", status, ok)
+	}
+
+	t.Run("DefaultFallback", func(t *testing.T) {
+		ec := &RuleErrorClassifier{}
+		if !ec.IsRetryable(errDummy) {
+			t.Error("DefaultErrorClassifier must be used as the fallback")
+		}
+	})
+	t.Run("WithRetry", func(t *testing.T) {
+		var n int
+		err := withRetry(context.TODO(), DefaultClock, 0, (&NoRetryerFactory{}).New(nil), ec, func() error {
+			n++
+			return codeError("AccessDenied")
+		})
+		if n != 1 || !errors.Is(err, codeError("AccessDenied")) {
+			t.Errorf("Fatal error must not be retried, called %d times, got: %v", n, err)
+		}
+	})
+}
+
+func TestAnyRetryableErrorClassifier(t *testing.T) {
+	ec := AnyRetryableErrorClassifier{
+		fixedErrorClassifier{},
+		fixedErrorClassifier{retryable: true, wait: time.Second},
+		fixedErrorClassifier{wait: time.Minute, status: 503},
+	}
+	if !ec.IsRetryable(errDummy) {
+		t.Error("Error must be retryable")
+	}
+	if wait, ok := ec.IsThrottle(errDummy); !ok || wait != time.Minute {
+		t.Errorf("Expected the longest throttle wait, got (%v, %v)", wait, ok)
+	}
+	if status, ok := ec.HTTPStatus(errDummy); !ok || status != 503 {
+		t.Errorf("Expected HTTP status 503, got (%d, %v)", status, ok)
+	}
+
+	ec = AnyRetryableErrorClassifier{fixedErrorClassifier{}, fixedErrorClassifier{}}
+	if ec.IsRetryable(errDummy) {
+		t.Error("Error must not be retryable")
+	}
+	if _, ok := ec.IsThrottle(errDummy); ok {
+		t.Error("Error must not be throttle")
+	}
+}
+
+func TestLoadErrorRules(t *testing.T) {
+	rules, err := LoadErrorRules(strings.NewReader(`[
+		{"codes": ["AccessDenied"], "action": "fatal"},
+		{"kinds": ["net", "dns"], "messages": ["vpn: reset"], "action": "retry"},
+		{"statuses": [429], "action": "throttle", "wait": "10s"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec := &RuleErrorClassifier{Rules: rules, Fallback: fixedErrorClassifier{}}
+
+	if ec.IsRetryable(codeError("AccessDenied")) {
+		t.Error("AccessDenied must be fatal")
+	}
+	if !ec.IsRetryable(&net.DNSError{}) || !ec.IsRetryable(errors.New("vpn: reset by gateway")) {
+		t.Error("Network errors must be retryable")
+	}
+	if wait, ok := ec.IsThrottle(statusCodeError(429)); !ok || wait != 10*time.Second {
+		t.Errorf("Expected throttle wait 10s, got (%v, %v)", wait, ok)
+	}
+	if ec.IsRetryable(errDummy) {
+		t.Error("Unmatched error must be classified by the fallback")
+	}
+
+	for name, config := range map[string]string{
+		"NoCondition":     `[{"action": "retry"}]`,
+		"UnknownKind":     `[{"kinds": ["foo"], "action": "retry"}]`,
+		"UnknownAction":   `[{"codes": ["SlowDown"], "action": "ignore"}]`,
+		"NoThrottleWait":  `[{"codes": ["SlowDown"], "action": "throttle"}]`,
+		"BadThrottleWait": `[{"codes": ["SlowDown"], "action": "throttle", "wait": "-1s"}]`,
+	} {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadErrorRules(strings.NewReader(config)); !errors.Is(err, ErrInvalidErrorRule) {
+				t.Errorf("Expected error: %v, got: %v", ErrInvalidErrorRule, err)
+			}
+		})
+	}
+	t.Run("UnknownField", func(t *testing.T) {
+		if _, err := LoadErrorRules(strings.NewReader(`[{"code": ["SlowDown"], "action": "retry"}]`)); err == nil {
+			t.Error("Unknown field must be error")
+		}
+	})
+}
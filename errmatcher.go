@@ -0,0 +1,156 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrorMatcher reports whether the error matches the condition.
+type ErrorMatcher func(error) bool
+
+// ErrorCode returns the API error code of the error implementing
+// ErrorCode() string (like aws-sdk-go-v2 errors) or
+// Code() string (like aws-sdk-go awserr.Error).
+func ErrorCode(err error) (string, bool) {
+	var ec interface{ ErrorCode() string }
+	if errors.As(err, &ec) {
+		return ec.ErrorCode(), true
+	}
+	var c interface{ Code() string }
+	if errors.As(err, &c) {
+		return c.Code(), true
+	}
+	return "", false
+}
+
+// MatchErrorCode matches the errors having one of the API error codes.
+func MatchErrorCode(codes ...string) ErrorMatcher {
+	return func(err error) bool {
+		code, ok := ErrorCode(err)
+		if !ok {
+			return false
+		}
+		for _, c := range codes {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchHTTPStatus matches the error responses having one of the HTTP status codes.
+func MatchHTTPStatus(statuses ...int) ErrorMatcher {
+	return func(err error) bool {
+		status, ok := HTTPStatus(nil, err)
+		if !ok {
+			return false
+		}
+		for _, s := range statuses {
+			if s == status {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchError matches the errors wrapping one of the targets
+// according to errors.Is.
+func MatchError(targets ...error) ErrorMatcher {
+	return func(err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchErrorMessage matches the errors having one of the substrings
+// in the message.
+func MatchErrorMessage(substrs ...string) ErrorMatcher {
+	return func(err error) bool {
+		msg := err.Error()
+		for _, s := range substrs {
+			if strings.Contains(msg, s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchAny matches the errors matched by any of the matchers.
+func MatchAny(matchers ...ErrorMatcher) ErrorMatcher {
+	return func(err error) bool {
+		for _, m := range matchers {
+			if m(err) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchNetError matches the network errors wrapping net.OpError.
+func MatchNetError() ErrorMatcher {
+	return func(err error) bool {
+		var oe *net.OpError
+		return errors.As(err, &oe)
+	}
+}
+
+// MatchDNSError matches the name resolution errors.
+func MatchDNSError() ErrorMatcher {
+	return func(err error) bool {
+		var de *net.DNSError
+		return errors.As(err, &de)
+	}
+}
+
+// MatchTimeout matches the network timeout errors and
+// context.DeadlineExceeded.
+func MatchTimeout() ErrorMatcher {
+	return func(err error) bool {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return true
+		}
+		var ne net.Error
+		return errors.As(err, &ne) && ne.Timeout()
+	}
+}
+
+// MatchConnectionReset matches the connection reset errors.
+func MatchConnectionReset() ErrorMatcher {
+	return MatchAny(
+		MatchError(syscall.ECONNRESET, syscall.EPIPE),
+		// Some SDK errors only have the message of the reset error.
+		MatchErrorMessage("connection reset"),
+	)
+}
+
+// MatchUnexpectedEOF matches the errors of the connection closed
+// in the middle of the response.
+func MatchUnexpectedEOF() ErrorMatcher {
+	return MatchError(io.EOF, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type codeError string
+
+func (e codeError) Error() string { return "code " + string(e) }
+func (e codeError) Code() string  { return string(e) }
+
+type errorCodeError string
+
+func (e errorCodeError) Error() string     { return "code " + string(e) }
+func (e errorCodeError) ErrorCode() string { return string(e) }
+
+func TestErrorCode(t *testing.T) {
+	if code, ok := ErrorCode(fmt.Errorf("wrapped: %w", codeError("SlowDown"))); !ok || code != "SlowDown" {
+		t.Errorf("Expected (SlowDown, true), got (%s, %v)", code, ok)
+	}
+	if code, ok := ErrorCode(fmt.Errorf("wrapped: %w", errorCodeError("NoSuchKey"))); !ok || code != "NoSuchKey" {
+		t.Errorf("Expected (NoSuchKey, true), got (%s, %v)", code, ok)
+	}
+	if code, ok := ErrorCode(errDummy); ok {
+		t.Errorf("Expected no code, got %s", code)
+	}
+}
+
+func TestErrorMatcher(t *testing.T) {
+	errOpReset := &net.OpError{
+		Op:  "read",
+		Net: "tcp",
+		Err: os.NewSyscallError("read", syscall.ECONNRESET),
+	}
+	errDNS := &net.DNSError{Err: "no such host", Name: "s3.example.com"}
+	errTimeout := &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+
+	testCases := map[string]struct {
+		matcher    ErrorMatcher
+		matched    []error
+		notMatched []error
+	}{
+		"ErrorCode": {
+			matcher:    MatchErrorCode("AccessDenied", "InvalidAccessKeyId"),
+			matched:    []error{codeError("AccessDenied"), errorCodeError("InvalidAccessKeyId")},
+			notMatched: []error{codeError("SlowDown"), errDummy},
+		},
+		"HTTPStatus": {
+			matcher:    MatchHTTPStatus(500, 503),
+			matched:    []error{statusCodeError(500), httpStatusCodeError(503)},
+			notMatched: []error{statusCodeError(404), errDummy},
+		},
+		"Error": {
+			matcher:    MatchError(io.ErrClosedPipe),
+			matched:    []error{fmt.Errorf("wrapped: %w", io.ErrClosedPipe)},
+			notMatched: []error{errDummy},
+		},
+		"ErrorMessage": {
+			matcher:    MatchErrorMessage("vpn: tunnel reset"),
+			matched:    []error{errors.New("write: vpn: tunnel reset by gateway")},
+			notMatched: []error{errDummy},
+		},
+		"NetError": {
+			matcher:    MatchNetError(),
+			matched:    []error{fmt.Errorf("wrapped: %w", errOpReset)},
+			notMatched: []error{errDNS, errDummy},
+		},
+		"DNSError": {
+			matcher:    MatchDNSError(),
+			matched:    []error{fmt.Errorf("wrapped: %w", errDNS)},
+			notMatched: []error{errOpReset, errDummy},
+		},
+		"Timeout": {
+			matcher:    MatchTimeout(),
+			matched:    []error{errTimeout, fmt.Errorf("wrapped: %w", context.DeadlineExceeded)},
+			notMatched: []error{errDNS, context.Canceled},
+		},
+		"ConnectionReset": {
+			matcher:    MatchConnectionReset(),
+			matched:    []error{errOpReset, errors.New("read tcp: connection reset by peer")},
+			notMatched: []error{errDNS, errDummy},
+		},
+		"UnexpectedEOF": {
+			matcher:    MatchUnexpectedEOF(),
+			matched:    []error{io.EOF, fmt.Errorf("wrapped: %w", io.ErrUnexpectedEOF)},
+			notMatched: []error{errDummy},
+		},
+		"Any": {
+			matcher:    MatchAny(MatchErrorCode("AccessDenied"), MatchHTTPStatus(403)),
+			matched:    []error{codeError("AccessDenied"), statusCodeError(403)},
+			notMatched: []error{codeError("SlowDown"), statusCodeError(503)},
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			for _, err := range tt.matched {
+				if !tt.matcher(err) {
+					t.Errorf("'%v' must be matched", err)
+				}
+			}
+			for _, err := range tt.notMatched {
+				if tt.matcher(err) {
+					t.Errorf("'%v' must not be matched", err)
+				}
+			}
+		})
+	}
+}
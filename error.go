@@ -21,6 +21,15 @@ import (
 // ErrForcePaused indicates part up/download is canceled due to force pause.
 var ErrForcePaused = &retryableError{errors.New("force paused")}
 
+// ErrCallTimeout indicates API call is canceled due to the timeout.
+var ErrCallTimeout = &retryableError{errors.New("call timed out")}
+
+// ErrStalled indicates API call is canceled since the body transfer is stalled.
+var ErrStalled = &retryableError{errors.New("call stalled")}
+
+// ErrUnsupportedAPI indicates the API doesn't implement the interface required by the option.
+var ErrUnsupportedAPI = errors.New("operation is not supported by the API")
+
 // RetryError is returned when retry is exceeded limit.
 type RetryError struct {
 	error
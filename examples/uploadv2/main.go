@@ -17,6 +17,7 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
@@ -88,6 +89,7 @@ func main() {
 				log.Println(bucket, key, err)
 			},
 		}),
+		s3iot.WithLogger(slog.Default(), s3iot.LogLevelInfo),
 	)
 	uc, err := uploader.Upload(ctx, &s3iot.UploadInput{
 		Bucket: aws.String(os.Args[2]),
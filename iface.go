@@ -58,12 +58,34 @@ type Retryer interface {
 	OnSuccess(id int64)
 }
 
+// ThrottleObserver is implemented by Retryer to be notified the wait
+// on throttle before retrying.
+// Retryers sharing the state across the transfers can use it to hold off
+// the retries of the other transfers.
+type ThrottleObserver interface {
+	OnThrottle(id int64, wait time.Duration)
+}
+
 // ErrorClassifier distinguishes given error is retryable.
 type ErrorClassifier interface {
 	IsRetryable(error) bool
 	IsThrottle(error) (time.Duration, bool)
 }
 
+// HTTPStatusClassifier is implemented by ErrorClassifier to provide
+// the raw HTTP status code of the error response for custom policies.
+type HTTPStatusClassifier interface {
+	HTTPStatus(error) (int, bool)
+}
+
+// ThrottleAtClassifier is implemented by ErrorClassifier to calculate
+// the throttle wait relative to the given time, like the wait until
+// the HTTP-date of Retry-After header.
+// The current time of the Clock of the transfer is passed.
+type ThrottleAtClassifier interface {
+	IsThrottleAt(err error, now time.Time) (time.Duration, bool)
+}
+
 // ReadInterceptorFactory creates ReadInterceptor.
 // ReadInterceptor will be created for each Upload() call.
 type ReadInterceptorFactory interface {
@@ -81,6 +103,25 @@ type Pauser interface {
 	Resume()
 }
 
+// ForcePauser provides forceful pause interface.
+// ForcePause pauses and cancels the ongoing API call regardless of
+// the ForcePause option. Canceled call is retried on resume.
+type ForcePauser interface {
+	ForcePause()
+}
+
+// SharedPauser provides pause/resume interface shared by multiple owners
+// like the circuit breaker, connectivity controller and scheduler.
+// The transfer is paused while any of the owners pauses it, and resumed
+// after all of them resume it.
+// Pause and Resume of Pauser are treated as the requests of the user,
+// one of the owners.
+// Owner must be comparable.
+type SharedPauser interface {
+	PauseBy(owner interface{}, force bool)
+	ResumeBy(owner interface{})
+}
+
 // BucketKeyer provides getter of target bucket and key.
 type BucketKeyer interface {
 	BucketKey() (_, _ string)
@@ -102,10 +143,12 @@ type UploadInput struct {
 }
 
 // UploadOutput represents upload result.
+// Skipped is true if the upload is skipped since the object is unchanged.
 type UploadOutput struct {
 	VersionID *string
 	ETag      *string
 	Location  *string
+	Skipped   bool
 }
 
 // DownloadInput represents upload destination and data.
@@ -123,6 +166,25 @@ type DownloadOutput struct {
 	VersionID    *string
 }
 
+// CopyInput represents copy source and destination.
+type CopyInput struct {
+	Bucket          *string
+	Key             *string
+	ACL             *string
+	SourceBucket    *string
+	SourceKey       *string
+	SourceVersionID *string
+	// StorageClass of the destination object.
+	// Defaults to the storage class of the source object.
+	StorageClass *string
+}
+
+// CopyOutput represents copy result.
+type CopyOutput struct {
+	VersionID *string
+	ETag      *string
+}
+
 // UploadContext provides access to the upload progress and the result.
 type UploadContext interface {
 	// Result reutrns the upload status or error.
@@ -145,6 +207,17 @@ type DownloadContext interface {
 	DoneNotifier
 }
 
+// CopyContext provides access to the copy progress and the result.
+type CopyContext interface {
+	// Result reutrns the copy status or error.
+	Status() (CopyStatus, error)
+	// Result reutrns the copy result or error.
+	Result() (CopyOutput, error)
+
+	Pauser
+	DoneNotifier
+}
+
 // Status represents upload/download status.
 type Status struct {
 	Size          int64
@@ -154,10 +227,12 @@ type Status struct {
 }
 
 // UploadStatus represents upload status.
+// SkippedSize is the size of the data not uploaded since the object is unchanged.
 type UploadStatus struct {
 	Status
 
-	UploadID string
+	UploadID    string
+	SkippedSize int64
 }
 
 // DownloadStatus represents download status.
@@ -165,3 +240,10 @@ type DownloadStatus struct {
 	Status
 	DownloadOutput
 }
+
+// CopyStatus represents copy status.
+type CopyStatus struct {
+	Status
+
+	UploadID string
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package etag calculates S3 compatible ETag of unencrypted objects.
+package etag
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Single returns quoted ETag of the object uploaded by PutObject.
+func Single(sum []byte) string {
+	return `"` + hex.EncodeToString(sum) + `"`
+}
+
+// Multipart returns quoted ETag of the object uploaded by multipart upload.
+func Multipart(partSums [][]byte) string {
+	h := md5.New()
+	for _, sum := range partSums {
+		h.Write(sum)
+	}
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(h.Sum(nil)), len(partSums))
+}
+
+// Sum returns MD5 digest of the data read from the reader.
+func Sum(r io.Reader) ([]byte, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Equal compares ETags ignoring the quotes.
+func Equal(a, b string) bool {
+	return strings.Trim(a, `"`) == strings.Trim(b, `"`)
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etag
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	sum := func(s string) []byte {
+		b, err := Sum(bytes.NewReader([]byte(s)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	t.Run("Single", func(t *testing.T) {
+		// echo -n test | md5sum
+		expected := `"098f6bcd4621d373cade4e832627b4f6"`
+		if e := Single(sum("test")); e != expected {
+			t.Errorf("Expected: %s, got: %s", expected, e)
+		}
+	})
+	t.Run("Multipart", func(t *testing.T) {
+		// (echo -n test | md5sum -b | xxd -r -p; echo -n data | md5sum -b | xxd -r -p) | md5sum
+		expected := `"e7acff55da37329f9240994edfba9722-2"`
+		if e := Multipart([][]byte{sum("test"), sum("data")}); e != expected {
+			t.Errorf("Expected: %s, got: %s", expected, e)
+		}
+	})
+	t.Run("Equal", func(t *testing.T) {
+		if !Equal(`"abc"`, "abc") {
+			t.Error("Quoted and unquoted ETags must be equal")
+		}
+		if Equal(`"abc"`, `"abd"`) {
+			t.Error("Different ETags must not be equal")
+		}
+	})
+}
@@ -22,3 +22,21 @@ type BufferAt []byte
 func (b BufferAt) WriteAt(p []byte, offset int64) (int, error) {
 	return copy(b[int(offset):int(offset)+len(p)], p), nil
 }
+
+// TruncatableBufferAt implements io.WriterAt with Truncate method like os.File.
+type TruncatableBufferAt struct {
+	Buf []byte
+}
+
+// WriteAt implements io.WriterAt.
+func (b *TruncatableBufferAt) WriteAt(p []byte, offset int64) (int, error) {
+	return BufferAt(b.Buf).WriteAt(p, offset)
+}
+
+// Truncate changes the size of the buffer.
+func (b *TruncatableBufferAt) Truncate(size int64) error {
+	buf := make([]byte, size)
+	copy(buf, b.Buf)
+	b.Buf = buf
+	return nil
+}
@@ -15,6 +15,7 @@
 package iotest
 
 import (
+	"context"
 	"io"
 )
 
@@ -52,3 +53,18 @@ type ReadErrorer struct {
 func (r ReadErrorer) Read([]byte) (int, error) {
 	return 0, r.Err
 }
+
+// ContextReader fails reading after the context is canceled
+// like the response body of net/http.
+type ContextReader struct {
+	Ctx context.Context
+	R   io.Reader
+}
+
+// Read implements io.Reader.
+func (r *ContextReader) Read(b []byte) (int, error) {
+	if err := r.Ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.R.Read(b)
+}
@@ -25,6 +25,9 @@ var _ s3api.S3API = &MockS3API{}
 //			CompleteMultipartUploadFunc: func(ctx context.Context, input *s3api.CompleteMultipartUploadInput) (*s3api.CompleteMultipartUploadOutput, error) {
 //				panic("mock out the CompleteMultipartUpload method")
 //			},
+//			CopyObjectFunc: func(ctx context.Context, input *s3api.CopyObjectInput) (*s3api.CopyObjectOutput, error) {
+//				panic("mock out the CopyObject method")
+//			},
 //			CreateMultipartUploadFunc: func(ctx context.Context, input *s3api.CreateMultipartUploadInput) (*s3api.CreateMultipartUploadOutput, error) {
 //				panic("mock out the CreateMultipartUpload method")
 //			},
@@ -34,6 +37,9 @@ var _ s3api.S3API = &MockS3API{}
 //			GetObjectFunc: func(ctx context.Context, input *s3api.GetObjectInput) (*s3api.GetObjectOutput, error) {
 //				panic("mock out the GetObject method")
 //			},
+//			HeadObjectFunc: func(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+//				panic("mock out the HeadObject method")
+//			},
 //			ListObjectsV2Func: func(ctx context.Context, input *s3api.ListObjectsV2Input) (*s3api.ListObjectsV2Output, error) {
 //				panic("mock out the ListObjectsV2 method")
 //			},
@@ -43,6 +49,9 @@ var _ s3api.S3API = &MockS3API{}
 //			UploadPartFunc: func(ctx context.Context, input *s3api.UploadPartInput) (*s3api.UploadPartOutput, error) {
 //				panic("mock out the UploadPart method")
 //			},
+//			UploadPartCopyFunc: func(ctx context.Context, input *s3api.UploadPartCopyInput) (*s3api.UploadPartCopyOutput, error) {
+//				panic("mock out the UploadPartCopy method")
+//			},
 //		}
 //
 //		// use mockedS3API in code that requires s3api.S3API
@@ -56,6 +65,9 @@ type MockS3API struct {
 	// CompleteMultipartUploadFunc mocks the CompleteMultipartUpload method.
 	CompleteMultipartUploadFunc func(ctx context.Context, input *s3api.CompleteMultipartUploadInput) (*s3api.CompleteMultipartUploadOutput, error)
 
+	// CopyObjectFunc mocks the CopyObject method.
+	CopyObjectFunc func(ctx context.Context, input *s3api.CopyObjectInput) (*s3api.CopyObjectOutput, error)
+
 	// CreateMultipartUploadFunc mocks the CreateMultipartUpload method.
 	CreateMultipartUploadFunc func(ctx context.Context, input *s3api.CreateMultipartUploadInput) (*s3api.CreateMultipartUploadOutput, error)
 
@@ -65,6 +77,9 @@ type MockS3API struct {
 	// GetObjectFunc mocks the GetObject method.
 	GetObjectFunc func(ctx context.Context, input *s3api.GetObjectInput) (*s3api.GetObjectOutput, error)
 
+	// HeadObjectFunc mocks the HeadObject method.
+	HeadObjectFunc func(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error)
+
 	// ListObjectsV2Func mocks the ListObjectsV2 method.
 	ListObjectsV2Func func(ctx context.Context, input *s3api.ListObjectsV2Input) (*s3api.ListObjectsV2Output, error)
 
@@ -74,6 +89,9 @@ type MockS3API struct {
 	// UploadPartFunc mocks the UploadPart method.
 	UploadPartFunc func(ctx context.Context, input *s3api.UploadPartInput) (*s3api.UploadPartOutput, error)
 
+	// UploadPartCopyFunc mocks the UploadPartCopy method.
+	UploadPartCopyFunc func(ctx context.Context, input *s3api.UploadPartCopyInput) (*s3api.UploadPartCopyOutput, error)
+
 	// calls tracks calls to the methods.
 	calls struct {
 		// AbortMultipartUpload holds details about calls to the AbortMultipartUpload method.
@@ -90,6 +108,13 @@ type MockS3API struct {
 			// Input is the input argument value.
 			Input *s3api.CompleteMultipartUploadInput
 		}
+		// CopyObject holds details about calls to the CopyObject method.
+		CopyObject []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Input is the input argument value.
+			Input *s3api.CopyObjectInput
+		}
 		// CreateMultipartUpload holds details about calls to the CreateMultipartUpload method.
 		CreateMultipartUpload []struct {
 			// Ctx is the ctx argument value.
@@ -111,6 +136,13 @@ type MockS3API struct {
 			// Input is the input argument value.
 			Input *s3api.GetObjectInput
 		}
+		// HeadObject holds details about calls to the HeadObject method.
+		HeadObject []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Input is the input argument value.
+			Input *s3api.HeadObjectInput
+		}
 		// ListObjectsV2 holds details about calls to the ListObjectsV2 method.
 		ListObjectsV2 []struct {
 			// Ctx is the ctx argument value.
@@ -132,15 +164,25 @@ type MockS3API struct {
 			// Input is the input argument value.
 			Input *s3api.UploadPartInput
 		}
+		// UploadPartCopy holds details about calls to the UploadPartCopy method.
+		UploadPartCopy []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Input is the input argument value.
+			Input *s3api.UploadPartCopyInput
+		}
 	}
 	lockAbortMultipartUpload    sync.RWMutex
 	lockCompleteMultipartUpload sync.RWMutex
+	lockCopyObject              sync.RWMutex
 	lockCreateMultipartUpload   sync.RWMutex
 	lockDeleteObject            sync.RWMutex
 	lockGetObject               sync.RWMutex
+	lockHeadObject              sync.RWMutex
 	lockListObjectsV2           sync.RWMutex
 	lockPutObject               sync.RWMutex
 	lockUploadPart              sync.RWMutex
+	lockUploadPartCopy          sync.RWMutex
 }
 
 // AbortMultipartUpload calls AbortMultipartUploadFunc.
@@ -215,6 +257,42 @@ func (mock *MockS3API) CompleteMultipartUploadCalls() []struct {
 	return calls
 }
 
+// CopyObject calls CopyObjectFunc.
+func (mock *MockS3API) CopyObject(ctx context.Context, input *s3api.CopyObjectInput) (*s3api.CopyObjectOutput, error) {
+	if mock.CopyObjectFunc == nil {
+		panic("MockS3API.CopyObjectFunc: method is nil but S3API.CopyObject was just called")
+	}
+	callInfo := struct {
+		Ctx   context.Context
+		Input *s3api.CopyObjectInput
+	}{
+		Ctx:   ctx,
+		Input: input,
+	}
+	mock.lockCopyObject.Lock()
+	mock.calls.CopyObject = append(mock.calls.CopyObject, callInfo)
+	mock.lockCopyObject.Unlock()
+	return mock.CopyObjectFunc(ctx, input)
+}
+
+// CopyObjectCalls gets all the calls that were made to CopyObject.
+// Check the length with:
+//
+//	len(mockedS3API.CopyObjectCalls())
+func (mock *MockS3API) CopyObjectCalls() []struct {
+	Ctx   context.Context
+	Input *s3api.CopyObjectInput
+} {
+	var calls []struct {
+		Ctx   context.Context
+		Input *s3api.CopyObjectInput
+	}
+	mock.lockCopyObject.RLock()
+	calls = mock.calls.CopyObject
+	mock.lockCopyObject.RUnlock()
+	return calls
+}
+
 // CreateMultipartUpload calls CreateMultipartUploadFunc.
 func (mock *MockS3API) CreateMultipartUpload(ctx context.Context, input *s3api.CreateMultipartUploadInput) (*s3api.CreateMultipartUploadOutput, error) {
 	if mock.CreateMultipartUploadFunc == nil {
@@ -323,6 +401,42 @@ func (mock *MockS3API) GetObjectCalls() []struct {
 	return calls
 }
 
+// HeadObject calls HeadObjectFunc.
+func (mock *MockS3API) HeadObject(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+	if mock.HeadObjectFunc == nil {
+		panic("MockS3API.HeadObjectFunc: method is nil but S3API.HeadObject was just called")
+	}
+	callInfo := struct {
+		Ctx   context.Context
+		Input *s3api.HeadObjectInput
+	}{
+		Ctx:   ctx,
+		Input: input,
+	}
+	mock.lockHeadObject.Lock()
+	mock.calls.HeadObject = append(mock.calls.HeadObject, callInfo)
+	mock.lockHeadObject.Unlock()
+	return mock.HeadObjectFunc(ctx, input)
+}
+
+// HeadObjectCalls gets all the calls that were made to HeadObject.
+// Check the length with:
+//
+//	len(mockedS3API.HeadObjectCalls())
+func (mock *MockS3API) HeadObjectCalls() []struct {
+	Ctx   context.Context
+	Input *s3api.HeadObjectInput
+} {
+	var calls []struct {
+		Ctx   context.Context
+		Input *s3api.HeadObjectInput
+	}
+	mock.lockHeadObject.RLock()
+	calls = mock.calls.HeadObject
+	mock.lockHeadObject.RUnlock()
+	return calls
+}
+
 // ListObjectsV2 calls ListObjectsV2Func.
 func (mock *MockS3API) ListObjectsV2(ctx context.Context, input *s3api.ListObjectsV2Input) (*s3api.ListObjectsV2Output, error) {
 	if mock.ListObjectsV2Func == nil {
@@ -430,3 +544,39 @@ func (mock *MockS3API) UploadPartCalls() []struct {
 	mock.lockUploadPart.RUnlock()
 	return calls
 }
+
+// UploadPartCopy calls UploadPartCopyFunc.
+func (mock *MockS3API) UploadPartCopy(ctx context.Context, input *s3api.UploadPartCopyInput) (*s3api.UploadPartCopyOutput, error) {
+	if mock.UploadPartCopyFunc == nil {
+		panic("MockS3API.UploadPartCopyFunc: method is nil but S3API.UploadPartCopy was just called")
+	}
+	callInfo := struct {
+		Ctx   context.Context
+		Input *s3api.UploadPartCopyInput
+	}{
+		Ctx:   ctx,
+		Input: input,
+	}
+	mock.lockUploadPartCopy.Lock()
+	mock.calls.UploadPartCopy = append(mock.calls.UploadPartCopy, callInfo)
+	mock.lockUploadPartCopy.Unlock()
+	return mock.UploadPartCopyFunc(ctx, input)
+}
+
+// UploadPartCopyCalls gets all the calls that were made to UploadPartCopy.
+// Check the length with:
+//
+//	len(mockedS3API.UploadPartCopyCalls())
+func (mock *MockS3API) UploadPartCopyCalls() []struct {
+	Ctx   context.Context
+	Input *s3api.UploadPartCopyInput
+} {
+	var calls []struct {
+		Ctx   context.Context
+		Input *s3api.UploadPartCopyInput
+	}
+	mock.lockUploadPartCopy.RLock()
+	calls = mock.calls.UploadPartCopy
+	mock.lockUploadPartCopy.RUnlock()
+	return calls
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3err provides S3 compatible API errors shared by the fake and
+// the local filesystem backed API implementations.
+package s3err
+
+// Error represents S3 compatible API error.
+type Error struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// ErrorCode returns S3 error code.
+func (e *Error) ErrorCode() string {
+	return e.Code
+}
+
+// HTTPStatusCode returns HTTP status code.
+func (e *Error) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// Errors having the same error codes and HTTP status codes as Amazon S3.
+var (
+	ErrNoSuchBucket       = &Error{Code: "NoSuchBucket", Message: "the specified bucket does not exist", StatusCode: 404}
+	ErrNoSuchKey          = &Error{Code: "NoSuchKey", Message: "the specified key does not exist", StatusCode: 404}
+	ErrNoSuchUpload       = &Error{Code: "NoSuchUpload", Message: "the specified multipart upload does not exist", StatusCode: 404}
+	ErrInvalidArgument    = &Error{Code: "InvalidArgument", Message: "invalid argument", StatusCode: 400}
+	ErrInvalidPart        = &Error{Code: "InvalidPart", Message: "one or more of the specified parts could not be found", StatusCode: 400}
+	ErrInvalidPartOrder   = &Error{Code: "InvalidPartOrder", Message: "the list of parts was not in ascending order", StatusCode: 400}
+	ErrInvalidRange       = &Error{Code: "InvalidRange", Message: "the requested range is not satisfiable", StatusCode: 416}
+	ErrPreconditionFailed = &Error{Code: "PreconditionFailed", Message: "at least one of the preconditions did not hold", StatusCode: 412}
+)
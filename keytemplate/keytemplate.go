@@ -0,0 +1,394 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keytemplate generates object keys from templates like
+//
+//	raw/device={device}/dt={time:2006-01-02}/hour={time:15}/{uuid}.json.gz
+//
+// Placeholders are enclosed by braces and may have an argument after
+// the colon:
+//
+//	{time:LAYOUT}        time formatted by the Go time layout
+//	{time@ZONE:LAYOUT}   time in the IANA time zone like Asia/Tokyo
+//	{unix}               Unix time in seconds
+//	{hostname}           host name
+//	{device}             device ID set by WithDeviceID
+//	{uuid}               UUIDv7
+//	{sha256}, {sha256:N} hex SHA-256 of the content, optionally the first N digits
+//	{md5}, {md5:N}       hex MD5 of the content, optionally the first N digits
+//	{seq}, {seq:N}       sequence number, optionally zero-padded to N digits
+//	{path}               slash separated path of the source file
+//	{name}               base name of the source file
+//	{stem}               base name without the extension
+//	{ext}                extension including the dot
+//
+// Time is in UTC unless the location is specified by WithLocation or
+// the placeholder.
+// Templates and generated keys are validated against the S3 key
+// restrictions by Validate.
+package keytemplate
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/at-wat/s3iot"
+)
+
+// DefaultTimeLayout is the layout of {time} without the argument.
+const DefaultTimeLayout = "20060102T150405Z"
+
+// Template errors.
+var (
+	ErrSyntax             = errors.New("template syntax error")
+	ErrUnknownPlaceholder = errors.New("unknown placeholder")
+	ErrMissingValue       = errors.New("missing value of the placeholder")
+)
+
+// Values are the inputs of the placeholders.
+type Values struct {
+	// Time is used by {time} and {unix}.
+	// Current time of the Clock is used if zero.
+	Time time.Time
+	// Path is the slash separated path of the source file used by
+	// {path}, {name}, {stem} and {ext}.
+	Path string
+	// Body is the content used by {sha256} and {md5}.
+	// It is read to the end and rewound to the beginning.
+	Body io.ReadSeeker
+}
+
+// Template generates the object keys.
+// Template is safe for concurrent use.
+type Template struct {
+	text     string
+	segments []segment
+
+	loc      *time.Location
+	hostname string
+	deviceID string
+	clock    s3iot.Clock
+	rand     io.Reader
+	seq      uint64
+}
+
+type segment struct {
+	literal string
+	name    string
+	arg     string
+	loc     *time.Location
+	width   int
+}
+
+// Option configures Template.
+type Option func(*Template)
+
+// WithLocation sets the time zone of the time placeholders.
+func WithLocation(loc *time.Location) Option {
+	return func(t *Template) {
+		t.loc = loc
+	}
+}
+
+// WithHostname overrides the host name used by {hostname}.
+func WithHostname(h string) Option {
+	return func(t *Template) {
+		t.hostname = h
+	}
+}
+
+// WithDeviceID sets the device ID used by {device}.
+func WithDeviceID(id string) Option {
+	return func(t *Template) {
+		t.deviceID = id
+	}
+}
+
+// WithSequenceStart sets the first number of {seq}.
+func WithSequenceStart(n uint64) Option {
+	return func(t *Template) {
+		t.seq = n
+	}
+}
+
+// WithClock sets Clock used as the time if Values.Time is zero and
+// as the timestamp of UUIDv7.
+func WithClock(c s3iot.Clock) Option {
+	return func(t *Template) {
+		t.clock = c
+	}
+}
+
+// WithRand sets the random source of UUIDv7.
+func WithRand(r io.Reader) Option {
+	return func(t *Template) {
+		t.rand = r
+	}
+}
+
+// Parse parses and validates the template.
+func Parse(text string, opts ...Option) (*Template, error) {
+	t := &Template{
+		text:  text,
+		loc:   time.UTC,
+		clock: s3iot.DefaultClock,
+		rand:  rand.Reader,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	var sample strings.Builder
+	for s := text; s != ""; {
+		i := strings.IndexAny(s, "{}")
+		if i < 0 {
+			t.segments = append(t.segments, segment{literal: s})
+			sample.WriteString(s)
+			break
+		}
+		if s[i] == '}' {
+			return nil, fmt.Errorf("%w: unexpected '}' at %d", ErrSyntax, len(text)-len(s)+i)
+		}
+		if i > 0 {
+			t.segments = append(t.segments, segment{literal: s[:i]})
+			sample.WriteString(s[:i])
+		}
+		j := strings.IndexAny(s[i+1:], "{}")
+		if j < 0 || s[i+1+j] != '}' {
+			return nil, fmt.Errorf("%w: unclosed '{' at %d", ErrSyntax, len(text)-len(s)+i)
+		}
+		seg, err := t.parsePlaceholder(s[i+1 : i+1+j])
+		if err != nil {
+			return nil, err
+		}
+		t.segments = append(t.segments, seg)
+		sample.WriteString("x")
+		s = s[i+j+2:]
+	}
+	if err := Validate(sample.String()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// MustParse is like Parse but panics on error.
+func MustParse(text string, opts ...Option) *Template {
+	t, err := Parse(text, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (t *Template) parsePlaceholder(s string) (segment, error) {
+	seg := segment{name: s, loc: t.loc}
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		seg.name, seg.arg = s[:i], s[i+1:]
+	}
+	if i := strings.IndexByte(seg.name, '@'); i >= 0 {
+		if seg.name[:i] != "time" {
+			return seg, fmt.Errorf("%w: time zone is not supported by {%s}", ErrSyntax, s)
+		}
+		loc, err := time.LoadLocation(seg.name[i+1:])
+		if err != nil {
+			return seg, fmt.Errorf("%w: {%s}: %v", ErrSyntax, s, err)
+		}
+		seg.name, seg.loc = seg.name[:i], loc
+	}
+
+	switch seg.name {
+	case "time":
+		if seg.arg == "" {
+			seg.arg = DefaultTimeLayout
+		}
+		return seg, nil
+	case "sha256", "md5", "seq":
+		if seg.arg == "" {
+			return seg, nil
+		}
+		n, err := strconv.Atoi(seg.arg)
+		if err != nil || n <= 0 {
+			return seg, fmt.Errorf("%w: invalid width of {%s}", ErrSyntax, s)
+		}
+		seg.width = n
+		return seg, nil
+	case "hostname":
+		if t.hostname == "" {
+			h, err := os.Hostname()
+			if err != nil {
+				return seg, err
+			}
+			t.hostname = h
+		}
+		if err := validateChars(t.hostname); err != nil {
+			return seg, err
+		}
+	case "device":
+		if t.deviceID == "" {
+			return seg, fmt.Errorf("%w: {device} requires WithDeviceID", ErrMissingValue)
+		}
+		if err := validateChars(t.deviceID); err != nil {
+			return seg, err
+		}
+	case "unix", "uuid", "path", "name", "stem", "ext":
+	default:
+		return seg, fmt.Errorf("%w: {%s}", ErrUnknownPlaceholder, s)
+	}
+	if seg.arg != "" {
+		return seg, fmt.Errorf("%w: {%s} takes no argument", ErrSyntax, seg.name)
+	}
+	return seg, nil
+}
+
+// String returns the template text.
+func (t *Template) String() string {
+	return t.text
+}
+
+// NeedsBody returns true if the template uses the content hash.
+func (t *Template) NeedsBody() bool {
+	for _, seg := range t.segments {
+		if seg.name == "sha256" || seg.name == "md5" {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute generates the key and validates it.
+// Sequence number is incremented on each call.
+func (t *Template) Execute(v Values) (string, error) {
+	now := v.Time
+	if now.IsZero() {
+		now = t.clock.Now()
+	}
+	var b strings.Builder
+	var sums map[string]string
+	for _, seg := range t.segments {
+		switch seg.name {
+		case "":
+			b.WriteString(seg.literal)
+		case "time":
+			b.WriteString(now.In(seg.loc).Format(seg.arg))
+		case "unix":
+			b.WriteString(strconv.FormatInt(now.Unix(), 10))
+		case "hostname":
+			b.WriteString(t.hostname)
+		case "device":
+			b.WriteString(t.deviceID)
+		case "uuid":
+			id, err := newUUIDv7(t.clock.Now(), t.rand)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(id)
+		case "sha256", "md5":
+			if v.Body == nil {
+				return "", fmt.Errorf("%w: {%s} requires Body", ErrMissingValue, seg.name)
+			}
+			sum, ok := sums[seg.name]
+			if !ok {
+				var err error
+				if sum, err = hexSum(seg.name, v.Body); err != nil {
+					return "", err
+				}
+				if sums == nil {
+					sums = make(map[string]string)
+				}
+				sums[seg.name] = sum
+			}
+			if seg.width > 0 && seg.width < len(sum) {
+				sum = sum[:seg.width]
+			}
+			b.WriteString(sum)
+		case "seq":
+			n := atomic.AddUint64(&t.seq, 1) - 1
+			s := strconv.FormatUint(n, 10)
+			if pad := seg.width - len(s); pad > 0 {
+				s = strings.Repeat("0", pad) + s
+			}
+			b.WriteString(s)
+		case "path", "name", "stem", "ext":
+			if v.Path == "" {
+				return "", fmt.Errorf("%w: {%s} requires Path", ErrMissingValue, seg.name)
+			}
+			b.WriteString(pathElem(seg.name, v.Path))
+		}
+	}
+	key := b.String()
+	if err := Validate(key); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// UploadInput creates s3iot.UploadInput uploading the body to the key
+// generated by the template.
+// Body is used as Values.Body if it is io.ReadSeeker and Values.Body is nil.
+func (t *Template) UploadInput(bucket string, body io.Reader, v Values) (*s3iot.UploadInput, error) {
+	if rs, ok := body.(io.ReadSeeker); ok && v.Body == nil {
+		v.Body = rs
+	}
+	key, err := t.Execute(v)
+	if err != nil {
+		return nil, err
+	}
+	return &s3iot.UploadInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   body,
+	}, nil
+}
+
+func pathElem(name, p string) string {
+	switch name {
+	case "path":
+		return strings.TrimPrefix(path.Clean("/"+p), "/")
+	case "name":
+		return path.Base(p)
+	case "stem":
+		base := path.Base(p)
+		return strings.TrimSuffix(base, path.Ext(base))
+	default:
+		return path.Ext(p)
+	}
+}
+
+func hexSum(name string, r io.ReadSeeker) (string, error) {
+	var h hash.Hash
+	if name == "md5" {
+		h = md5.New()
+	} else {
+		h = sha256.New()
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
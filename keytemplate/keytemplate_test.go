@@ -0,0 +1,196 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keytemplate
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot/clocktest"
+)
+
+func TestTemplate(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2026, 10, 17, 3, 4, 5, 0, time.UTC)
+	clock := clocktest.New(time.UnixMilli(0x0123456789ab))
+	opts := []Option{
+		WithClock(clock),
+		WithRand(bytes.NewReader(bytes.Repeat([]byte{0xff}, 10))),
+		WithHostname("host1"),
+		WithDeviceID("abc"),
+	}
+
+	testCases := map[string]struct {
+		template string
+		opts     []Option
+		values   Values
+		expected string
+	}{
+		"Partitioned": {
+			template: "raw/device={device}/dt={time:2006-01-02}/hour={time:15}/{uuid}.json.gz",
+			values:   Values{Time: ts},
+			expected: "raw/device=abc/dt=2026-10-17/hour=03/01234567-89ab-7fff-bfff-ffffffffffff.json.gz",
+		},
+		"DefaultTime": {
+			template: "{time}",
+			values:   Values{Time: ts},
+			expected: "20261017T030405Z",
+		},
+		"Location": {
+			template: "{time:2006-01-02T15}",
+			opts:     []Option{WithLocation(tokyo)},
+			values:   Values{Time: ts},
+			expected: "2026-10-17T12",
+		},
+		"PlaceholderLocation": {
+			template: "{time@Asia/Tokyo:15}/{time:15}",
+			values:   Values{Time: ts},
+			expected: "12/03",
+		},
+		"ClockTime": {
+			template: "{unix}",
+			expected: "1250999896",
+		},
+		"Hostname": {
+			template: "{hostname}/{name}",
+			values:   Values{Path: "dir/a.log"},
+			expected: "host1/a.log",
+		},
+		"PathElems": {
+			template: "logs/{path}/{stem}{ext}",
+			values:   Values{Path: "../dir/a.tar.gz"},
+			expected: "logs/dir/a.tar.gz/a.tar.gz",
+		},
+		"Hash": {
+			template: "{sha256:8}/{md5}/{sha256}",
+			values:   Values{Body: strings.NewReader("data")},
+			expected: "3a6eb079/8d777f385d3dfec8815d20f7496026dc/" +
+				"3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7",
+		},
+		"Sequence": {
+			template: "{seq:4}-{seq}",
+			opts:     []Option{WithSequenceStart(7)},
+			expected: "0007-8",
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template, append(append([]Option{}, opts...), tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := tmpl.Execute(tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, key)
+			}
+			if tt.values.Body != nil {
+				if n, _ := tt.values.Body.Seek(0, io.SeekCurrent); n != 0 {
+					t.Errorf("Body must be rewound, but at %d", n)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplate_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		values   Values
+		err      error
+	}{
+		"Unclosed":         {template: "a/{time", err: ErrSyntax},
+		"Nested":           {template: "a/{time{seq}}", err: ErrSyntax},
+		"UnexpectedClose":  {template: "a/}", err: ErrSyntax},
+		"Unknown":          {template: "a/{foo}", err: ErrUnknownPlaceholder},
+		"UnexpectedArg":    {template: "a/{uuid:4}", err: ErrSyntax},
+		"InvalidWidth":     {template: "a/{seq:x}", err: ErrSyntax},
+		"InvalidZone":      {template: "a/{time@Mars/Olympus}", err: ErrSyntax},
+		"ZoneNotSupported": {template: "a/{unix@UTC}", err: ErrSyntax},
+		"NoDeviceID":       {template: "a/{device}", err: ErrMissingValue},
+		"LeadingSlash":     {template: "/a/{uuid}", err: ErrInvalidKey},
+		"EmptyElement":     {template: "a//{uuid}", err: ErrInvalidKey},
+		"InvalidChar":      {template: "a#/{uuid}", err: ErrInvalidKey},
+		"NoBody":           {template: "a/{sha256}", values: Values{}, err: ErrMissingValue},
+		"NoPath":           {template: "a/{name}", values: Values{}, err: ErrMissingValue},
+		"EmptyExt":         {template: "a/{ext}", values: Values{Path: "a"}, err: ErrInvalidKey},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err == nil {
+				_, err = tmpl.Execute(tt.values)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestTemplate_Concurrent(t *testing.T) {
+	tmpl := MustParse("{seq:3}/{uuid}")
+	var mu sync.Mutex
+	keys := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, err := tmpl.Execute(Values{})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			keys[key[:3]] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(keys) != 10 {
+		t.Errorf("Sequence numbers must be unique: %v", keys)
+	}
+}
+
+func TestUploadInput(t *testing.T) {
+	tmpl := MustParse("{sha256:8}{ext}")
+	input, err := tmpl.UploadInput("bucket", strings.NewReader("data"), Values{Path: "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *input.Bucket != "bucket" || *input.Key != "3a6eb079.txt" {
+		t.Errorf("Unexpected input: %s %s", *input.Bucket, *input.Key)
+	}
+	b, err := io.ReadAll(input.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "data" {
+		t.Errorf("Body must be rewound, got %q", b)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keytemplate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxKeyLength is the maximum length of the object key in bytes.
+const MaxKeyLength = 1024
+
+// ErrInvalidKey indicates the key violates the S3 key restrictions.
+var ErrInvalidKey = errors.New("invalid object key")
+
+// avoidChars are the characters recommended to avoid in the object keys.
+const avoidChars = "\\{}^%`[]\"<>~#|"
+
+// Validate checks the object key against the S3 key restrictions.
+// Key must be a non-empty valid UTF-8 string up to MaxKeyLength bytes
+// without the control characters and the characters recommended to avoid
+// by S3. Key must not start or end with slash and must not have empty,
+// "." and ".." path elements since they are normalized by some clients
+// and can't be stored on the filesystem backends.
+func Validate(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidKey)
+	}
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("%w: %d bytes exceeds %d bytes", ErrInvalidKey, len(key), MaxKeyLength)
+	}
+	if err := validateChars(key); err != nil {
+		return err
+	}
+	if strings.HasPrefix(key, "/") {
+		return fmt.Errorf("%w: %q starts with slash", ErrInvalidKey, key)
+	}
+	for _, elem := range strings.Split(key, "/") {
+		switch elem {
+		case "":
+			return fmt.Errorf("%w: %q has empty path element", ErrInvalidKey, key)
+		case ".", "..":
+			return fmt.Errorf("%w: %q has relative path element", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
+
+func validateChars(s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("%w: %q is not valid UTF-8", ErrInvalidKey, s)
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(avoidChars, r) {
+			return fmt.Errorf("%w: %q has invalid character %q", ErrInvalidKey, s, r)
+		}
+	}
+	return nil
+}
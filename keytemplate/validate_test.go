@@ -0,0 +1,57 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keytemplate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := map[string]struct {
+		key   string
+		valid bool
+	}{
+		"Simple":        {"raw/device=abc/dt=2026-10-17/a.json.gz", true},
+		"Unicode":       {"ログ/データ.txt", true},
+		"Symbols":       {"a-b_c.d!e*f'g(h)i=j:k;l,m@n$o&p+q", true},
+		"MaxLength":     {strings.Repeat("a", MaxKeyLength), true},
+		"Empty":         {"", false},
+		"TooLong":       {strings.Repeat("a", MaxKeyLength+1), false},
+		"LeadingSlash":  {"/a", false},
+		"TrailingSlash": {"a/", false},
+		"EmptyElement":  {"a//b", false},
+		"Dot":           {"a/./b", false},
+		"DotDot":        {"a/../b", false},
+		"Control":       {"a\nb", false},
+		"Delete":        {"a\x7fb", false},
+		"Backslash":     {`a\b`, false},
+		"Avoided":       {"a^b", false},
+		"InvalidUTF8":   {"a\xffb", false},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			err := Validate(tt.key)
+			if tt.valid && err != nil {
+				t.Errorf("Expected valid, got %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Expected %v, got %v", ErrInvalidKey, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localfs
+
+import (
+	"github.com/at-wat/s3iot/internal/s3err"
+)
+
+// Error represents S3 compatible API error.
+type Error = s3err.Error
+
+// Errors returned by the API.
+// They have the same error codes and HTTP status codes as Amazon S3.
+var (
+	ErrNoSuchBucket       = s3err.ErrNoSuchBucket
+	ErrNoSuchKey          = s3err.ErrNoSuchKey
+	ErrNoSuchUpload       = s3err.ErrNoSuchUpload
+	ErrInvalidBucketName  = &Error{Code: "InvalidBucketName", Message: "the specified bucket is not valid", StatusCode: 400}
+	ErrInvalidKey         = &Error{Code: "InvalidArgument", Message: "the specified key is not storable on the filesystem", StatusCode: 400}
+	ErrInvalidArgument    = s3err.ErrInvalidArgument
+	ErrInvalidPart        = s3err.ErrInvalidPart
+	ErrInvalidPartOrder   = s3err.ErrInvalidPartOrder
+	ErrInvalidRange       = s3err.ErrInvalidRange
+	ErrPreconditionFailed = s3err.ErrPreconditionFailed
+)
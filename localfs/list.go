@@ -0,0 +1,128 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localfs
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// DefaultMaxKeys is the number of the keys listed at once if MaxKeys is not specified.
+const DefaultMaxKeys = 1000
+
+// ListObjectsV2 implements s3api.ListAPI.
+// Objects are listed in the lexicographical order of the keys.
+func (a *API) ListObjectsV2(ctx context.Context, input *s3api.ListObjectsV2Input) (*s3api.ListObjectsV2Output, error) {
+	bucket, err := validateBucket(input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	maxKeys := input.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	var prefix, after string
+	if input.Prefix != nil {
+		prefix = *input.Prefix
+	}
+	if input.ContinuationToken != nil {
+		b, err := base64.RawURLEncoding.DecodeString(*input.ContinuationToken)
+		if err != nil || len(b) == 0 {
+			return nil, ErrInvalidArgument
+		}
+		after = string(b)
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if err := a.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+	keys, err := a.keys(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if after != "" {
+		keys = keys[sort.SearchStrings(keys, after):]
+		if len(keys) > 0 && keys[0] == after {
+			keys = keys[1:]
+		}
+	}
+
+	out := &s3api.ListObjectsV2Output{}
+	for _, key := range keys {
+		if len(out.Contents) >= maxKeys {
+			token := base64.RawURLEncoding.EncodeToString(
+				[]byte(*out.Contents[len(out.Contents)-1].Key),
+			)
+			out.NextContinuationToken = &token
+			break
+		}
+		obj, err := a.stat(bucket, key)
+		if err != nil {
+			if err == ErrNoSuchKey {
+				continue
+			}
+			return nil, err
+		}
+		key := key
+		out.Contents = append(out.Contents, s3api.Object{
+			ETag:         &obj.meta.ETag,
+			Key:          &key,
+			LastModified: &obj.meta.LastModified,
+			Size:         obj.size,
+		})
+	}
+	out.KeyCount = len(out.Contents)
+	return out, nil
+}
+
+// keys returns sorted keys in the bucket with the prefix.
+func (a *API) keys(bucket, prefix string) ([]string, error) {
+	root := a.bucketPath(bucket)
+	var keys []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localfs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func TestListObjectsV2(t *testing.T) {
+	bucket := "bucket"
+	a := New(t.TempDir())
+	keys := []string{"a/b", "a-c", "a/a/a", "b", "a/c"}
+	for _, key := range keys {
+		putObject(t, a, bucket, key, []byte(key))
+	}
+
+	testCases := map[string]struct {
+		prefix  *string
+		maxKeys int
+		pages   [][]string
+	}{
+		"All": {
+			pages: [][]string{{"a-c", "a/a/a", "a/b", "a/c", "b"}},
+		},
+		"Prefix": {
+			prefix: strPtr("a/"),
+			pages:  [][]string{{"a/a/a", "a/b", "a/c"}},
+		},
+		"Paginated": {
+			maxKeys: 2,
+			pages:   [][]string{{"a-c", "a/a/a"}, {"a/b", "a/c"}, {"b"}},
+		},
+		"PaginatedPrefix": {
+			prefix:  strPtr("a/"),
+			maxKeys: 2,
+			pages:   [][]string{{"a/a/a", "a/b"}, {"a/c"}},
+		},
+		"NoMatch": {
+			prefix: strPtr("c"),
+			pages:  [][]string{nil},
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			var token *string
+			var pages [][]string
+			for {
+				out, err := a.ListObjectsV2(context.TODO(), &s3api.ListObjectsV2Input{
+					Bucket:            &bucket,
+					ContinuationToken: token,
+					MaxKeys:           tt.maxKeys,
+					Prefix:            tt.prefix,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var page []string
+				for _, c := range out.Contents {
+					page = append(page, *c.Key)
+					if c.Size != int64(len(*c.Key)) {
+						t.Errorf("Expected size of %s: %d, got: %d", *c.Key, len(*c.Key), c.Size)
+					}
+				}
+				if out.KeyCount != len(page) {
+					t.Errorf("Expected KeyCount: %d, got: %d", len(page), out.KeyCount)
+				}
+				pages = append(pages, page)
+				if out.NextContinuationToken == nil {
+					break
+				}
+				token = out.NextContinuationToken
+			}
+			if !reflect.DeepEqual(tt.pages, pages) {
+				t.Errorf("Expected pages: %v, got: %v", tt.pages, pages)
+			}
+		})
+	}
+	t.Run("NoSuchBucket", func(t *testing.T) {
+		if _, err := a.ListObjectsV2(context.TODO(), &s3api.ListObjectsV2Input{
+			Bucket: strPtr("unknown"),
+		}); err != ErrNoSuchBucket {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrNoSuchBucket, err)
+		}
+	})
+	t.Run("InvalidToken", func(t *testing.T) {
+		if _, err := a.ListObjectsV2(context.TODO(), &s3api.ListObjectsV2Input{
+			Bucket:            &bucket,
+			ContinuationToken: strPtr("!"),
+		}); err != ErrInvalidArgument {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrInvalidArgument, err)
+		}
+	})
+}
@@ -0,0 +1,408 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package localfs provides s3api.S3API backed by a local directory.
+//
+// Buckets are the directories directly under the root directory and objects
+// are stored as regular files at the path corresponding to the key.
+// Object metadata and multipart upload staging directories are stored
+// under the reserved ".s3iot" directory in the root directory.
+// Since keys are mapped to the filesystem paths, the key which is the
+// directory of the other key (e.g. "a" and "a/b") can't be stored at the same time.
+// Object versioning is not supported and VersionID of the input is ignored.
+package localfs
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/internal/etag"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+const (
+	reservedDir = ".s3iot"
+	metaDir     = "meta"
+	uploadsDir  = "uploads"
+	tmpDir      = "tmp"
+	metaSuffix  = ".json"
+	metaDirExt  = ".d"
+)
+
+// NewUploader creates s3iot.Uploader storing objects under the root directory.
+func NewUploader(root string, opts ...s3iot.UploaderOption) *s3iot.Uploader {
+	u := &s3iot.Uploader{
+		UpDownloaderBase: s3iot.UpDownloaderBase{
+			API: New(root),
+		},
+	}
+	for _, opt := range opts {
+		opt.ApplyToUploader(u)
+	}
+	return u
+}
+
+// NewDownloader creates s3iot.Downloader reading objects under the root directory.
+func NewDownloader(root string, opts ...s3iot.DownloaderOption) *s3iot.Downloader {
+	d := &s3iot.Downloader{
+		UpDownloaderBase: s3iot.UpDownloaderBase{
+			API: New(root),
+		},
+	}
+	for _, opt := range opts {
+		opt.ApplyToDownloader(d)
+	}
+	return d
+}
+
+// NewCopier creates s3iot.Copier copying objects under the root directory.
+func NewCopier(root string, opts ...s3iot.CopierOption) *s3iot.Copier {
+	c := &s3iot.Copier{
+		UpDownloaderBase: s3iot.UpDownloaderBase{
+			API: New(root),
+		},
+	}
+	for _, opt := range opts {
+		opt.ApplyToCopier(c)
+	}
+	return c
+}
+
+// API is s3api.S3API implementation backed by a local directory.
+type API struct {
+	root string
+	mu   sync.RWMutex
+}
+
+// New creates API storing objects under the root directory.
+// Bucket directories are created on the first write.
+func New(root string) *API {
+	return &API{root: root}
+}
+
+type objectMeta struct {
+	ETag         string            `json:"etag"`
+	ContentType  *string           `json:"contentType,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	PartsCount   int64             `json:"partsCount,omitempty"`
+	LastModified time.Time         `json:"lastModified"`
+}
+
+type object struct {
+	path string
+	size int64
+	meta objectMeta
+}
+
+func validateBucket(bucket *string) (string, error) {
+	if bucket == nil {
+		return "", ErrInvalidBucketName
+	}
+	b := *bucket
+	if b == "" || strings.HasPrefix(b, ".") || strings.ContainsAny(b, `/\`) {
+		return "", ErrInvalidBucketName
+	}
+	return b, nil
+}
+
+func validateKey(key *string) (string, error) {
+	if key == nil || *key == "" {
+		return "", ErrInvalidKey
+	}
+	for _, p := range strings.Split(*key, "/") {
+		switch {
+		case p == "", p == ".", p == "..", strings.ContainsAny(p, "\\\x00"):
+			return "", ErrInvalidKey
+		}
+	}
+	return *key, nil
+}
+
+func validateBucketKey(bucket, key *string) (string, string, error) {
+	b, err := validateBucket(bucket)
+	if err != nil {
+		return "", "", err
+	}
+	k, err := validateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	return b, k, nil
+}
+
+func (a *API) bucketPath(bucket string) string {
+	return filepath.Join(a.root, bucket)
+}
+
+func (a *API) objectPath(bucket, key string) string {
+	return filepath.Join(a.root, bucket, filepath.FromSlash(key))
+}
+
+// metaPath returns the path of the metadata of the object.
+// Directories and files have the different suffixes not to collide
+// the metadata of the keys like "a" and "a.json/b".
+func (a *API) metaPath(bucket, key string) string {
+	elems := strings.Split(key, "/")
+	for i := range elems[:len(elems)-1] {
+		elems[i] += metaDirExt
+	}
+	elems[len(elems)-1] += metaSuffix
+	return filepath.Join(append([]string{a.root, reservedDir, metaDir, bucket}, elems...)...)
+}
+
+func (a *API) uploadPath(uploadID string) string {
+	return filepath.Join(a.root, reservedDir, uploadsDir, uploadID)
+}
+
+func (a *API) location(bucket, key string) *string {
+	p, err := filepath.Abs(a.objectPath(bucket, key))
+	if err != nil {
+		p = a.objectPath(bucket, key)
+	}
+	u := &url.URL{Scheme: "file", Path: filepath.ToSlash(p)}
+	s := u.String()
+	return &s
+}
+
+func (a *API) checkBucket(bucket string) error {
+	fi, err := os.Stat(a.bucketPath(bucket))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNoSuchBucket
+		}
+		return err
+	}
+	if !fi.IsDir() {
+		return ErrNoSuchBucket
+	}
+	return nil
+}
+
+// stat returns the object information.
+// Caller must hold the lock.
+func (a *API) stat(bucket, key string) (*object, error) {
+	if err := a.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+	p := a.objectPath(bucket, key)
+	fi, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) || isNotDir(err) {
+			return nil, ErrNoSuchKey
+		}
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, ErrNoSuchKey
+	}
+	obj := &object{path: p, size: fi.Size()}
+
+	b, err := os.ReadFile(a.metaPath(bucket, key))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &obj.meta); err != nil {
+			return nil, err
+		}
+	case os.IsNotExist(err) || isNotDir(err):
+		// Object is directly placed on the filesystem.
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := etag.Sum(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		obj.meta.ETag = etag.Single(sum)
+		obj.meta.LastModified = fi.ModTime().UTC()
+	default:
+		return nil, err
+	}
+	return obj, nil
+}
+
+// open opens the object.
+func (a *API) open(bucket, key string) (*os.File, *object, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	obj, err := a.stat(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(obj.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, obj, nil
+}
+
+// writeTemp writes the data to a temporary file and returns its path, size and MD5 digest.
+func (a *API) writeTemp(ctx context.Context, r io.Reader) (string, int64, []byte, error) {
+	dir := filepath.Join(a.root, reservedDir, tmpDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, nil, err
+	}
+	f, err := os.CreateTemp(dir, "object-")
+	if err != nil {
+		return "", 0, nil, err
+	}
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, h), &ctxReader{ctx: ctx, r: r})
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", 0, nil, err
+	}
+	return f.Name(), n, h.Sum(nil), nil
+}
+
+// commit moves the temporary file to the object path and stores the metadata.
+func (a *API) commit(bucket, key, tmp string, meta *objectMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p := a.objectPath(bucket, key)
+	mp := a.metaPath(bucket, key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(mp), 0755); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := writeFileAtomic(mp, b); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		_ = os.Remove(tmp)
+		_ = os.Remove(mp)
+		return err
+	}
+	return nil
+}
+
+// remove deletes the object and its metadata.
+func (a *API) remove(bucket, key string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p := a.objectPath(bucket, key)
+	fi, err := os.Stat(p)
+	switch {
+	case err == nil:
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	case os.IsNotExist(err) || isNotDir(err):
+	default:
+		return err
+	}
+	mp := a.metaPath(bucket, key)
+	if err := os.Remove(mp); err != nil && !os.IsNotExist(err) && !isNotDir(err) {
+		return err
+	}
+	removeEmptyDirs(filepath.Dir(p), a.bucketPath(bucket))
+	removeEmptyDirs(filepath.Dir(mp), filepath.Join(a.root, reservedDir, metaDir, bucket))
+	return nil
+}
+
+func writeFileAtomic(p string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// removeEmptyDirs removes empty directories from dir up to (but not including) top.
+func removeEmptyDirs(dir, top string) {
+	for dir != top && strings.HasPrefix(dir, top) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func isNotDir(err error) bool {
+	return errors.Is(err, syscall.ENOTDIR)
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+var _ s3api.S3API = (*API)(nil)
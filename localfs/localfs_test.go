@@ -0,0 +1,136 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localfs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/internal/iotest"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	t.Run("NewUploader", func(t *testing.T) {
+		u := NewUploader(dir, s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 100}))
+		if a, ok := u.API.(*API); !ok || a.root != dir {
+			t.Errorf("API is expected to be *API with root %s, actually %T", dir, u.API)
+		}
+	})
+	t.Run("NewDownloader", func(t *testing.T) {
+		d := NewDownloader(dir, s3iot.WithDownloadSlicer(&s3iot.DefaultDownloadSlicerFactory{PartSize: 100}))
+		if a, ok := d.API.(*API); !ok || a.root != dir {
+			t.Errorf("API is expected to be *API with root %s, actually %T", dir, d.API)
+		}
+	})
+	t.Run("NewCopier", func(t *testing.T) {
+		c := NewCopier(dir, s3iot.WithCopyPartSize(s3iot.MinCopyPartSize))
+		if a, ok := c.API.(*API); !ok || a.root != dir {
+			t.Errorf("API is expected to be *API with root %s, actually %T", dir, c.API)
+		}
+	})
+}
+
+func TestUpDownloader(t *testing.T) {
+	bucket, key, dstKey := "bucket", "dir/key", "dir/copied"
+
+	data := make([]byte, s3iot.MinCopyPartSize+1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	testCases := map[string]struct {
+		partSize int64
+	}{
+		"SinglePart": {partSize: s3iot.MinCopyPartSize * 2},
+		"MultiPart":  {partSize: s3iot.MinCopyPartSize},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			u := NewUploader(dir, s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: tt.partSize}))
+			uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+				Bucket: &bucket,
+				Key:    &key,
+				Body:   bytes.NewReader(data),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-time.After(time.Second):
+				t.Fatal("Timeout")
+			case <-uc.Done():
+			}
+			if _, err := uc.Result(); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(filepath.Join(dir, bucket, "dir", "key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, b) {
+				t.Error("Stored data differs")
+			}
+
+			c := NewCopier(dir, s3iot.WithCopyPartSize(tt.partSize))
+			cc, err := c.Copy(context.TODO(), &s3iot.CopyInput{
+				Bucket:       &bucket,
+				Key:          &dstKey,
+				SourceBucket: &bucket,
+				SourceKey:    &key,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-time.After(time.Second):
+				t.Fatal("Timeout")
+			case <-cc.Done():
+			}
+			if _, err := cc.Result(); err != nil {
+				t.Fatal(err)
+			}
+
+			d := NewDownloader(dir, s3iot.WithDownloadSlicer(&s3iot.DefaultDownloadSlicerFactory{PartSize: 1024 * 1024}))
+			buf := make(iotest.BufferAt, len(data))
+			dc, err := d.Download(context.TODO(), buf, &s3iot.DownloadInput{
+				Bucket: &bucket,
+				Key:    &dstKey,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-time.After(time.Second):
+				t.Fatal("Timeout")
+			case <-dc.Done():
+			}
+			if _, err := dc.Result(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, buf) {
+				t.Error("Downloaded data differs")
+			}
+		})
+	}
+}
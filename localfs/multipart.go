@@ -0,0 +1,305 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localfs
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/at-wat/s3iot/contentrange"
+	"github.com/at-wat/s3iot/internal/etag"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+const (
+	uploadMetaFile = "upload.json"
+	maxPartNumber  = 10000
+)
+
+type uploadMeta struct {
+	Bucket      string            `json:"bucket"`
+	Key         string            `json:"key"`
+	ContentType *string           `json:"contentType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// CreateMultipartUpload implements s3api.UploadAPI.
+// Uploaded parts are staged in the directory per upload ID until completion.
+func (a *API) CreateMultipartUpload(ctx context.Context, input *s3api.CreateMultipartUploadInput) (*s3api.CreateMultipartUploadOutput, error) {
+	bucket, key, err := validateBucketKey(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(&uploadMeta{
+		Bucket:      bucket,
+		Key:         key,
+		ContentType: input.ContentType,
+		Metadata:    input.Metadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+	uploadID, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	dir := a.uploadPath(uploadID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, uploadMetaFile), b); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return &s3api.CreateMultipartUploadOutput{
+		UploadID: &uploadID,
+	}, nil
+}
+
+// UploadPart implements s3api.UploadAPI.
+func (a *API) UploadPart(ctx context.Context, input *s3api.UploadPartInput) (*s3api.UploadPartOutput, error) {
+	dir, _, err := a.openUpload(input.Bucket, input.Key, input.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	p, err := partPath(dir, input.PartNumber)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := writePart(ctx, p, input.Body)
+	if err != nil {
+		return nil, err
+	}
+	tag := etag.Single(sum)
+	return &s3api.UploadPartOutput{
+		ETag: &tag,
+	}, nil
+}
+
+// UploadPartCopy implements s3api.CopyAPI.
+func (a *API) UploadPartCopy(ctx context.Context, input *s3api.UploadPartCopyInput) (*s3api.UploadPartCopyOutput, error) {
+	dir, _, err := a.openUpload(input.Bucket, input.Key, input.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	p, err := partPath(dir, input.PartNumber)
+	if err != nil {
+		return nil, err
+	}
+	srcBucket, srcKey, err := validateBucketKey(input.SourceBucket, input.SourceKey)
+	if err != nil {
+		return nil, err
+	}
+	f, obj, err := a.openSource(srcBucket, srcKey, input.SourceIfMatch)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if input.SourceRange != nil {
+		sr, err := contentrange.Parse(*input.SourceRange)
+		if err != nil {
+			return nil, ErrInvalidRange
+		}
+		rn, err := sr.Resolve(obj.size)
+		if err != nil {
+			return nil, ErrInvalidRange
+		}
+		r = io.NewSectionReader(f, rn.Start, rn.Length())
+	}
+	sum, err := writePart(ctx, p, r)
+	if err != nil {
+		return nil, err
+	}
+	tag := etag.Single(sum)
+	return &s3api.UploadPartCopyOutput{
+		ETag: &tag,
+	}, nil
+}
+
+// AbortMultipartUpload implements s3api.UploadAPI.
+func (a *API) AbortMultipartUpload(ctx context.Context, input *s3api.AbortMultipartUploadInput) (*s3api.AbortMultipartUploadOutput, error) {
+	dir, _, err := a.openUpload(input.Bucket, input.Key, input.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	return &s3api.AbortMultipartUploadOutput{}, nil
+}
+
+// CompleteMultipartUpload implements s3api.UploadAPI.
+// Parts must be listed in ascending order and their ETags must match the uploaded parts.
+func (a *API) CompleteMultipartUpload(ctx context.Context, input *s3api.CompleteMultipartUploadInput) (*s3api.CompleteMultipartUploadOutput, error) {
+	dir, meta, err := a.openUpload(input.Bucket, input.Key, input.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if len(input.CompletedParts) == 0 {
+		return nil, ErrInvalidPart
+	}
+	var last int64
+	for _, part := range input.CompletedParts {
+		if part.PartNumber == nil || part.ETag == nil {
+			return nil, ErrInvalidPart
+		}
+		if *part.PartNumber <= last {
+			return nil, ErrInvalidPartOrder
+		}
+		last = *part.PartNumber
+	}
+
+	sums := make([][]byte, 0, len(input.CompletedParts))
+	files := make([]*os.File, 0, len(input.CompletedParts))
+	readers := make([]io.Reader, 0, len(input.CompletedParts))
+	for _, part := range input.CompletedParts {
+		p, err := partPath(dir, part.PartNumber)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			closeAll(files)
+			if os.IsNotExist(err) {
+				return nil, ErrInvalidPart
+			}
+			return nil, err
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+		sum, err := etag.Sum(f)
+		if err != nil {
+			closeAll(files)
+			return nil, err
+		}
+		if !etag.Equal(*part.ETag, etag.Single(sum)) {
+			closeAll(files)
+			return nil, ErrInvalidPart
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			closeAll(files)
+			return nil, err
+		}
+		sums = append(sums, sum)
+	}
+	tmp, _, _, err := a.writeTemp(ctx, io.MultiReader(readers...))
+	closeAll(files)
+	if err != nil {
+		return nil, err
+	}
+	om := &objectMeta{
+		ETag:         etag.Multipart(sums),
+		ContentType:  meta.ContentType,
+		Metadata:     meta.Metadata,
+		PartsCount:   int64(len(sums)),
+		LastModified: now(),
+	}
+	if err := a.commit(meta.Bucket, meta.Key, tmp, om); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	return &s3api.CompleteMultipartUploadOutput{
+		ETag:     &om.ETag,
+		Location: a.location(meta.Bucket, meta.Key),
+	}, nil
+}
+
+// openUpload returns the staging directory and the metadata of the upload.
+func (a *API) openUpload(bucket, key, uploadID *string) (string, *uploadMeta, error) {
+	b, k, err := validateBucketKey(bucket, key)
+	if err != nil {
+		return "", nil, err
+	}
+	if uploadID == nil || !isUploadID(*uploadID) {
+		return "", nil, ErrNoSuchUpload
+	}
+	dir := a.uploadPath(*uploadID)
+	data, err := os.ReadFile(filepath.Join(dir, uploadMetaFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, ErrNoSuchUpload
+		}
+		return "", nil, err
+	}
+	meta := &uploadMeta{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return "", nil, err
+	}
+	if meta.Bucket != b || meta.Key != k {
+		return "", nil, ErrNoSuchUpload
+	}
+	return dir, meta, nil
+}
+
+func isUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, c := range id {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func partPath(dir string, partNumber *int64) (string, error) {
+	if partNumber == nil || *partNumber < 1 || *partNumber > maxPartNumber {
+		return "", ErrInvalidArgument
+	}
+	return filepath.Join(dir, strconv.FormatInt(*partNumber, 10)), nil
+}
+
+func writePart(ctx context.Context, p string, r io.Reader) ([]byte, error) {
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Upload is aborted or completed.
+			return nil, ErrNoSuchUpload
+		}
+		return nil, err
+	}
+	h := md5.New()
+	_, err = io.Copy(io.MultiWriter(f, h), &ctxReader{ctx: ctx, r: r})
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func closeAll(fs []*os.File) {
+	for _, f := range fs {
+		_ = f.Close()
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func TestMultipart(t *testing.T) {
+	bucket, key := "bucket", "key"
+	parts := [][]byte{[]byte("part1-"), []byte("part2-"), []byte("part3")}
+
+	md5sum := func(b []byte) []byte {
+		s := md5.Sum(b)
+		return s[:]
+	}
+	expectedETag := fmt.Sprintf(`"%x-3"`, md5sum(bytes.Join(
+		[][]byte{md5sum(parts[0]), md5sum(parts[1]), md5sum(parts[2])}, nil,
+	)))
+
+	create := func(t *testing.T, a *API) *string {
+		t.Helper()
+		contentType := "text/plain"
+		out, err := a.CreateMultipartUpload(context.TODO(), &s3api.CreateMultipartUploadInput{
+			Bucket:      &bucket,
+			Key:         &key,
+			ContentType: &contentType,
+			Metadata:    map[string]string{"Key": "Value"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.UploadID
+	}
+	upload := func(t *testing.T, a *API, uploadID *string) []*s3api.CompletedPart {
+		t.Helper()
+		var completed []*s3api.CompletedPart
+		// Upload in reverse order to check parts are sorted by the part number.
+		for i := len(parts) - 1; i >= 0; i-- {
+			n := int64(i + 1)
+			out, err := a.UploadPart(context.TODO(), &s3api.UploadPartInput{
+				Body:       bytes.NewReader(parts[i]),
+				Bucket:     &bucket,
+				Key:        &key,
+				PartNumber: &n,
+				UploadID:   uploadID,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := fmt.Sprintf(`"%x"`, md5sum(parts[i])); *out.ETag != expected {
+				t.Errorf("Expected part ETag: %s, got: %s", expected, *out.ETag)
+			}
+			completed = append([]*s3api.CompletedPart{{ETag: out.ETag, PartNumber: &n}}, completed...)
+		}
+		return completed
+	}
+
+	t.Run("Complete", func(t *testing.T) {
+		a := New(t.TempDir())
+		uploadID := create(t, a)
+		completed := upload(t, a, uploadID)
+
+		out, err := a.CompleteMultipartUpload(context.TODO(), &s3api.CompleteMultipartUploadInput{
+			Bucket:         &bucket,
+			Key:            &key,
+			CompletedParts: completed,
+			UploadID:       uploadID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *out.ETag != expectedETag {
+			t.Errorf("Expected ETag: %s, got: %s", expectedETag, *out.ETag)
+		}
+
+		obj, err := a.GetObject(context.TODO(), &s3api.GetObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer obj.Body.Close()
+		b, err := io.ReadAll(obj.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := bytes.Join(parts, nil); !bytes.Equal(expected, b) {
+			t.Errorf("Expected body: %s, got: %s", expected, b)
+		}
+
+		head, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *head.PartsCount != 3 || *head.ContentType != "text/plain" || head.Metadata["Key"] != "Value" {
+			t.Errorf("Unexpected output: %+v", head)
+		}
+
+		if _, err := os.Stat(a.uploadPath(*uploadID)); !os.IsNotExist(err) {
+			t.Errorf("Staging directory must be removed: %v", err)
+		}
+		if _, err := a.UploadPart(context.TODO(), &s3api.UploadPartInput{
+			Body:       bytes.NewReader(parts[0]),
+			Bucket:     &bucket,
+			Key:        &key,
+			PartNumber: completed[0].PartNumber,
+			UploadID:   uploadID,
+		}); err != ErrNoSuchUpload {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrNoSuchUpload, err)
+		}
+	})
+	t.Run("InvalidComplete", func(t *testing.T) {
+		n1, n2, n4 := int64(1), int64(2), int64(4)
+		wrongETag := `"0123"`
+		testCases := map[string]struct {
+			parts func([]*s3api.CompletedPart) []*s3api.CompletedPart
+			err   error
+		}{
+			"NoParts": {
+				parts: func([]*s3api.CompletedPart) []*s3api.CompletedPart { return nil },
+				err:   ErrInvalidPart,
+			},
+			"WrongOrder": {
+				parts: func(p []*s3api.CompletedPart) []*s3api.CompletedPart {
+					return []*s3api.CompletedPart{p[1], p[0]}
+				},
+				err: ErrInvalidPartOrder,
+			},
+			"Duplicated": {
+				parts: func(p []*s3api.CompletedPart) []*s3api.CompletedPart {
+					return []*s3api.CompletedPart{p[0], p[0]}
+				},
+				err: ErrInvalidPartOrder,
+			},
+			"WrongETag": {
+				parts: func(p []*s3api.CompletedPart) []*s3api.CompletedPart {
+					return []*s3api.CompletedPart{p[0], {ETag: &wrongETag, PartNumber: &n2}}
+				},
+				err: ErrInvalidPart,
+			},
+			"MissingPart": {
+				parts: func(p []*s3api.CompletedPart) []*s3api.CompletedPart {
+					return []*s3api.CompletedPart{{ETag: p[0].ETag, PartNumber: &n1}, {ETag: p[0].ETag, PartNumber: &n4}}
+				},
+				err: ErrInvalidPart,
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				a := New(t.TempDir())
+				uploadID := create(t, a)
+				completed := upload(t, a, uploadID)
+				if _, err := a.CompleteMultipartUpload(context.TODO(), &s3api.CompleteMultipartUploadInput{
+					Bucket:         &bucket,
+					Key:            &key,
+					CompletedParts: tt.parts(completed),
+					UploadID:       uploadID,
+				}); err != tt.err {
+					t.Fatalf("Expected error: '%v', got: '%v'", tt.err, err)
+				}
+				// Upload can be completed after the failure.
+				if _, err := a.CompleteMultipartUpload(context.TODO(), &s3api.CompleteMultipartUploadInput{
+					Bucket:         &bucket,
+					Key:            &key,
+					CompletedParts: completed,
+					UploadID:       uploadID,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	})
+	t.Run("Abort", func(t *testing.T) {
+		a := New(t.TempDir())
+		uploadID := create(t, a)
+		completed := upload(t, a, uploadID)
+
+		if _, err := a.AbortMultipartUpload(context.TODO(), &s3api.AbortMultipartUploadInput{
+			Bucket:   &bucket,
+			Key:      &key,
+			UploadID: uploadID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.CompleteMultipartUpload(context.TODO(), &s3api.CompleteMultipartUploadInput{
+			Bucket:         &bucket,
+			Key:            &key,
+			CompletedParts: completed,
+			UploadID:       uploadID,
+		}); err != ErrNoSuchUpload {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrNoSuchUpload, err)
+		}
+		if _, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		}); err != ErrNoSuchBucket {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrNoSuchBucket, err)
+		}
+	})
+	t.Run("InvalidUpload", func(t *testing.T) {
+		a := New(t.TempDir())
+		uploadID := create(t, a)
+		otherKey := "other"
+		n0, n1 := int64(0), int64(1)
+		testCases := map[string]struct {
+			key        *string
+			uploadID   *string
+			partNumber *int64
+			err        error
+		}{
+			"WrongKey":        {key: &otherKey, uploadID: uploadID, partNumber: &n1, err: ErrNoSuchUpload},
+			"UnknownUploadID": {key: &key, uploadID: strPtr("0123456789abcdef0123456789abcdef"), partNumber: &n1, err: ErrNoSuchUpload},
+			"MalformedID":     {key: &key, uploadID: strPtr("../../bucket"), partNumber: &n1, err: ErrNoSuchUpload},
+			"InvalidPartNum":  {key: &key, uploadID: uploadID, partNumber: &n0, err: ErrInvalidArgument},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				if _, err := a.UploadPart(context.TODO(), &s3api.UploadPartInput{
+					Body:       bytes.NewReader(parts[0]),
+					Bucket:     &bucket,
+					Key:        tt.key,
+					PartNumber: tt.partNumber,
+					UploadID:   tt.uploadID,
+				}); err != tt.err {
+					t.Errorf("Expected error: '%v', got: '%v'", tt.err, err)
+				}
+			})
+		}
+	})
+	t.Run("UploadPartCopy", func(t *testing.T) {
+		a := New(t.TempDir())
+		srcKey := "src"
+		src := putObject(t, a, bucket, srcKey, []byte("0123456789"))
+		uploadID := create(t, a)
+
+		var completed []*s3api.CompletedPart
+		for i, r := range []string{"bytes=0-5", "bytes=6-9"} {
+			n := int64(i + 1)
+			r := r
+			out, err := a.UploadPartCopy(context.TODO(), &s3api.UploadPartCopyInput{
+				Bucket:        &bucket,
+				Key:           &key,
+				PartNumber:    &n,
+				UploadID:      uploadID,
+				SourceBucket:  &bucket,
+				SourceKey:     &srcKey,
+				SourceIfMatch: src.ETag,
+				SourceRange:   &r,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			completed = append(completed, &s3api.CompletedPart{ETag: out.ETag, PartNumber: &n})
+		}
+		if _, err := a.CompleteMultipartUpload(context.TODO(), &s3api.CompleteMultipartUploadInput{
+			Bucket:         &bucket,
+			Key:            &key,
+			CompletedParts: completed,
+			UploadID:       uploadID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		head, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *head.ContentLength != 10 {
+			t.Errorf("Expected ContentLength: 10, got: %d", *head.ContentLength)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localfs
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/at-wat/s3iot/contentrange"
+	"github.com/at-wat/s3iot/internal/etag"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// PutObject implements s3api.UploadAPI.
+func (a *API) PutObject(ctx context.Context, input *s3api.PutObjectInput) (*s3api.PutObjectOutput, error) {
+	bucket, key, err := validateBucketKey(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	tmp, _, sum, err := a.writeTemp(ctx, input.Body)
+	if err != nil {
+		return nil, err
+	}
+	meta := &objectMeta{
+		ETag:         etag.Single(sum),
+		ContentType:  input.ContentType,
+		LastModified: now(),
+	}
+	if err := a.commit(bucket, key, tmp, meta); err != nil {
+		return nil, err
+	}
+	return &s3api.PutObjectOutput{
+		ETag:     &meta.ETag,
+		Location: a.location(bucket, key),
+	}, nil
+}
+
+// GetObject implements s3api.DownloadAPI.
+func (a *API) GetObject(ctx context.Context, input *s3api.GetObjectInput) (*s3api.GetObjectOutput, error) {
+	bucket, key, err := validateBucketKey(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, obj, err := a.open(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	out := &s3api.GetObjectOutput{
+		ContentType:   obj.meta.ContentType,
+		ContentLength: &obj.size,
+		ETag:          &obj.meta.ETag,
+		LastModified:  &obj.meta.LastModified,
+	}
+	if input.Range == nil {
+		out.Body = f
+		return out, nil
+	}
+
+	r, err := contentrange.Parse(*input.Range)
+	if err != nil {
+		_ = f.Close()
+		return nil, ErrInvalidRange
+	}
+	rn, err := r.Resolve(obj.size)
+	if err != nil {
+		_ = f.Close()
+		return nil, ErrInvalidRange
+	}
+	length := rn.Length()
+	cr := rn.ContentRange()
+	out.Body = &readCloser{
+		Reader: io.NewSectionReader(f, rn.Start, length),
+		Closer: f,
+	}
+	out.ContentLength = &length
+	out.ContentRange = &cr
+	return out, nil
+}
+
+// HeadObject implements s3api.HeadAPI.
+func (a *API) HeadObject(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+	bucket, key, err := validateBucketKey(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	a.mu.RLock()
+	obj, err := a.stat(bucket, key)
+	a.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	out := &s3api.HeadObjectOutput{
+		ContentLength: &obj.size,
+		ContentType:   obj.meta.ContentType,
+		ETag:          &obj.meta.ETag,
+		LastModified:  &obj.meta.LastModified,
+		Metadata:      obj.meta.Metadata,
+	}
+	if obj.meta.PartsCount > 0 {
+		out.PartsCount = &obj.meta.PartsCount
+	}
+	return out, nil
+}
+
+// DeleteObject implements s3api.DeleteAPI.
+// Deleting the object which doesn't exist succeeds as Amazon S3 does.
+func (a *API) DeleteObject(ctx context.Context, input *s3api.DeleteObjectInput) (*s3api.DeleteObjectOutput, error) {
+	bucket, key, err := validateBucketKey(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := a.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+	if err := a.remove(bucket, key); err != nil {
+		return nil, err
+	}
+	return &s3api.DeleteObjectOutput{}, nil
+}
+
+// CopyObject implements s3api.CopyAPI.
+// Content type and metadata of the source object are copied.
+func (a *API) CopyObject(ctx context.Context, input *s3api.CopyObjectInput) (*s3api.CopyObjectOutput, error) {
+	bucket, key, err := validateBucketKey(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	srcBucket, srcKey, err := validateBucketKey(input.SourceBucket, input.SourceKey)
+	if err != nil {
+		return nil, err
+	}
+	f, obj, err := a.openSource(srcBucket, srcKey, input.SourceIfMatch)
+	if err != nil {
+		return nil, err
+	}
+	tmp, _, sum, err := a.writeTemp(ctx, f)
+	_ = f.Close()
+	if err != nil {
+		return nil, err
+	}
+	meta := &objectMeta{
+		ETag:         etag.Single(sum),
+		ContentType:  obj.meta.ContentType,
+		Metadata:     obj.meta.Metadata,
+		LastModified: now(),
+	}
+	if err := a.commit(bucket, key, tmp, meta); err != nil {
+		return nil, err
+	}
+	return &s3api.CopyObjectOutput{
+		ETag: &meta.ETag,
+	}, nil
+}
+
+func (a *API) openSource(bucket, key string, ifMatch *string) (*os.File, *object, error) {
+	f, obj, err := a.open(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ifMatch != nil && !etag.Equal(*ifMatch, obj.meta.ETag) {
+		_ = f.Close()
+		return nil, nil, ErrPreconditionFailed
+	}
+	return f, obj, nil
+}
@@ -0,0 +1,361 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func putObject(t *testing.T, a *API, bucket, key string, data []byte) *s3api.PutObjectOutput {
+	t.Helper()
+	contentType := "text/plain"
+	out, err := a.PutObject(context.TODO(), &s3api.PutObjectInput{
+		Bucket:      &bucket,
+		Key:         &key,
+		Body:        bytes.NewReader(data),
+		ContentType: &contentType,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestObject(t *testing.T) {
+	bucket, key := "bucket", "dir/key"
+	data := []byte("0123456789")
+	etag := fmt.Sprintf(`"%x"`, md5.Sum(data))
+
+	t.Run("PutGet", func(t *testing.T) {
+		a := New(t.TempDir())
+		out := putObject(t, a, bucket, key, data)
+		if *out.ETag != etag {
+			t.Errorf("Expected ETag: %s, got: %s", etag, *out.ETag)
+		}
+		expectedLocation := "file://" + filepath.ToSlash(filepath.Join(a.root, bucket, "dir", "key"))
+		if *out.Location != expectedLocation {
+			t.Errorf("Expected Location: %s, got: %s", expectedLocation, *out.Location)
+		}
+
+		testCases := map[string]struct {
+			rng          *string
+			body         []byte
+			contentRange *string
+			err          error
+		}{
+			"Whole": {
+				body: data,
+			},
+			"Range": {
+				rng:          strPtr("bytes=2-4"),
+				body:         []byte("234"),
+				contentRange: strPtr("bytes 2-4/10"),
+			},
+			"OpenEnded": {
+				rng:          strPtr("bytes=7-"),
+				body:         []byte("789"),
+				contentRange: strPtr("bytes 7-9/10"),
+			},
+			"Suffix": {
+				rng:          strPtr("bytes=-2"),
+				body:         []byte("89"),
+				contentRange: strPtr("bytes 8-9/10"),
+			},
+			"Exceeded": {
+				rng:          strPtr("bytes=8-20"),
+				body:         []byte("89"),
+				contentRange: strPtr("bytes 8-9/10"),
+			},
+			"Unsatisfiable": {
+				rng: strPtr("bytes=10-"),
+				err: ErrInvalidRange,
+			},
+			"InvalidFormat": {
+				rng: strPtr("bytes=a-"),
+				err: ErrInvalidRange,
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				out, err := a.GetObject(context.TODO(), &s3api.GetObjectInput{
+					Bucket: &bucket,
+					Key:    &key,
+					Range:  tt.rng,
+				})
+				if err != tt.err {
+					t.Fatalf("Expected error: '%v', got: '%v'", tt.err, err)
+				}
+				if err != nil {
+					return
+				}
+				defer out.Body.Close()
+				b, err := io.ReadAll(out.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(tt.body, b) {
+					t.Errorf("Expected body: %s, got: %s", tt.body, b)
+				}
+				if *out.ContentLength != int64(len(tt.body)) {
+					t.Errorf("Expected ContentLength: %d, got: %d", len(tt.body), *out.ContentLength)
+				}
+				if !reflect.DeepEqual(tt.contentRange, out.ContentRange) {
+					t.Errorf("Expected ContentRange: %v, got: %v", tt.contentRange, out.ContentRange)
+				}
+				if *out.ETag != etag || *out.ContentType != "text/plain" {
+					t.Errorf("Unexpected output: %+v", out)
+				}
+			})
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		a := New(t.TempDir())
+		putObject(t, a, bucket, key, nil)
+		out, err := a.GetObject(context.TODO(), &s3api.GetObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Body.Close()
+		if *out.ContentLength != 0 {
+			t.Errorf("Expected ContentLength: 0, got: %d", *out.ContentLength)
+		}
+		if _, err := a.GetObject(context.TODO(), &s3api.GetObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Range:  strPtr("bytes=0-"),
+		}); err != ErrInvalidRange {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrInvalidRange, err)
+		}
+	})
+	t.Run("Head", func(t *testing.T) {
+		a := New(t.TempDir())
+		putObject(t, a, bucket, key, data)
+		out, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *out.ContentLength != 10 || *out.ETag != etag || *out.ContentType != "text/plain" {
+			t.Errorf("Unexpected output: %+v", out)
+		}
+		if out.PartsCount != nil {
+			t.Errorf("PartsCount must be nil for single part object, got: %d", *out.PartsCount)
+		}
+		if out.LastModified.IsZero() {
+			t.Error("LastModified must be set")
+		}
+	})
+	t.Run("WithoutSidecar", func(t *testing.T) {
+		a := New(t.TempDir())
+		if err := os.MkdirAll(filepath.Join(a.root, bucket, "dir"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(a.root, bucket, "dir", "key"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *out.ContentLength != 10 || *out.ETag != etag || out.ContentType != nil {
+			t.Errorf("Unexpected output: %+v", out)
+		}
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		a := New(t.TempDir())
+		putObject(t, a, bucket, key, data)
+		testCases := map[string]struct {
+			bucket, key string
+			err         error
+		}{
+			"NoSuchBucket": {bucket: "unknown", key: key, err: ErrNoSuchBucket},
+			"NoSuchKey":    {bucket: bucket, key: "unknown", err: ErrNoSuchKey},
+			"Directory":    {bucket: bucket, key: "dir", err: ErrNoSuchKey},
+			"UnderFile":    {bucket: bucket, key: "dir/key/sub", err: ErrNoSuchKey},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				if _, err := a.GetObject(context.TODO(), &s3api.GetObjectInput{
+					Bucket: &tt.bucket,
+					Key:    &tt.key,
+				}); err != tt.err {
+					t.Errorf("Expected error: '%v', got: '%v'", tt.err, err)
+				}
+				if _, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+					Bucket: &tt.bucket,
+					Key:    &tt.key,
+				}); err != tt.err {
+					t.Errorf("Expected error: '%v', got: '%v'", tt.err, err)
+				}
+			})
+		}
+	})
+	t.Run("InvalidName", func(t *testing.T) {
+		a := New(t.TempDir())
+		testCases := map[string]struct {
+			bucket, key string
+			err         error
+		}{
+			"EmptyBucket":    {bucket: "", key: key, err: ErrInvalidBucketName},
+			"ReservedBucket": {bucket: ".s3iot", key: key, err: ErrInvalidBucketName},
+			"SlashBucket":    {bucket: "a/b", key: key, err: ErrInvalidBucketName},
+			"EmptyKey":       {bucket: bucket, key: "", err: ErrInvalidKey},
+			"ParentKey":      {bucket: bucket, key: "../key", err: ErrInvalidKey},
+			"DoubleSlashKey": {bucket: bucket, key: "a//b", err: ErrInvalidKey},
+			"TrailingSlash":  {bucket: bucket, key: "a/", err: ErrInvalidKey},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				if _, err := a.PutObject(context.TODO(), &s3api.PutObjectInput{
+					Bucket: &tt.bucket,
+					Key:    &tt.key,
+					Body:   bytes.NewReader(data),
+				}); err != tt.err {
+					t.Errorf("Expected error: '%v', got: '%v'", tt.err, err)
+				}
+			})
+		}
+	})
+	t.Run("Delete", func(t *testing.T) {
+		a := New(t.TempDir())
+		putObject(t, a, bucket, key, data)
+		for i := 0; i < 2; i++ {
+			if _, err := a.DeleteObject(context.TODO(), &s3api.DeleteObjectInput{
+				Bucket: &bucket,
+				Key:    &key,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		}); err != ErrNoSuchKey {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrNoSuchKey, err)
+		}
+		if _, err := os.Stat(filepath.Join(a.root, bucket, "dir")); !os.IsNotExist(err) {
+			t.Errorf("Empty directory must be removed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(a.root, bucket)); err != nil {
+			t.Errorf("Bucket directory must be kept: %v", err)
+		}
+	})
+	t.Run("Copy", func(t *testing.T) {
+		a := New(t.TempDir())
+		putObject(t, a, bucket, key, data)
+		dstKey := "copied"
+
+		out, err := a.CopyObject(context.TODO(), &s3api.CopyObjectInput{
+			Bucket:        &bucket,
+			Key:           &dstKey,
+			SourceBucket:  &bucket,
+			SourceKey:     &key,
+			SourceIfMatch: &etag,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *out.ETag != etag {
+			t.Errorf("Expected ETag: %s, got: %s", etag, *out.ETag)
+		}
+		head, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+			Bucket: &bucket,
+			Key:    &dstKey,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *head.ContentType != "text/plain" {
+			t.Errorf("ContentType must be copied, got: %s", *head.ContentType)
+		}
+
+		if _, err := a.CopyObject(context.TODO(), &s3api.CopyObjectInput{
+			Bucket:        &bucket,
+			Key:           &dstKey,
+			SourceBucket:  &bucket,
+			SourceKey:     &key,
+			SourceIfMatch: strPtr(`"0123"`),
+		}); err != ErrPreconditionFailed {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrPreconditionFailed, err)
+		}
+	})
+	t.Run("SidecarCollision", func(t *testing.T) {
+		a := New(t.TempDir())
+		keys := []string{"a", "a.json/b"}
+		for _, k := range keys {
+			putObject(t, a, bucket, k, []byte(k))
+		}
+		for _, k := range keys {
+			k := k
+			head, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+				Bucket: &bucket,
+				Key:    &k,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := fmt.Sprintf(`"%x"`, md5.Sum([]byte(k))); *head.ETag != expected {
+				t.Errorf("%s: expected ETag: %s, got: %s", k, expected, *head.ETag)
+			}
+			if head.ContentType == nil || *head.ContentType != "text/plain" {
+				t.Errorf("%s: metadata must be stored", k)
+			}
+		}
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		a := New(t.TempDir())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := a.PutObject(ctx, &s3api.PutObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Body:   bytes.NewReader(data),
+		}); err != context.Canceled {
+			t.Errorf("Expected error: '%v', got: '%v'", context.Canceled, err)
+		}
+		entries, err := os.ReadDir(filepath.Join(a.root, reservedDir, tmpDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Temporary file must be removed: %v", entries)
+		}
+	})
+}
+
+func strPtr(s string) *string {
+	return &s
+}
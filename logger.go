@@ -0,0 +1,122 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"context"
+)
+
+// Logger is the structured logger.
+// *slog.Logger implements it.
+// args are the alternating keys and values.
+// Methods are called from multiple goroutines.
+type Logger interface {
+	DebugContext(ctx context.Context, msg string, args ...interface{})
+	InfoContext(ctx context.Context, msg string, args ...interface{})
+	WarnContext(ctx context.Context, msg string, args ...interface{})
+	ErrorContext(ctx context.Context, msg string, args ...interface{})
+}
+
+// LogLevel is the verbosity of the logs.
+// The values are same as slog.Level.
+type LogLevel int
+
+// Log levels.
+const (
+	// LogLevelDebug logs the start and finish of each part in addition.
+	LogLevelDebug LogLevel = -4
+	// LogLevelInfo logs the lifecycle of the transfers.
+	LogLevelInfo LogLevel = 0
+	// LogLevelWarn logs the retries, throttles and failures.
+	LogLevelWarn LogLevel = 4
+	// LogLevelError logs the failed transfers only.
+	LogLevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Attribute keys of the logs.
+const (
+	LogKeyOperation    = "operation"
+	LogKeyBucket       = "bucket"
+	LogKeyKey          = "key"
+	LogKeySourceBucket = "source_bucket"
+	LogKeySourceKey    = "source_key"
+	LogKeyUploadID     = "upload_id"
+	LogKeyPart         = "part"
+	LogKeyAttempt      = "attempt"
+	LogKeyErrorClass   = "error_class"
+	LogKeyWait         = "wait"
+	LogKeyForce        = "force"
+	LogKeyDuration     = "duration"
+	LogKeyBytes        = "bytes"
+	LogKeyError        = "error"
+)
+
+// WithLogger sets Logger.
+// Records below the level are not logged.
+func WithLogger(l Logger, level LogLevel) UpDownloaderOption {
+	return UpDownloaderOptionFn(func(u *UpDownloaderBase) {
+		u.Logger = l
+		u.LogLevel = level
+	})
+}
+
+// logAbort logs the result of AbortMultipartUpload.
+func (c *upDownloadContext) logAbort(uploadID string, err error) {
+	if err != nil {
+		c.log(context.Background(), LogLevelWarn, "failed to abort multipart upload",
+			LogKeyUploadID, uploadID, LogKeyError, err,
+		)
+		return
+	}
+	c.log(context.Background(), LogLevelInfo, "multipart upload aborted", LogKeyUploadID, uploadID)
+}
+
+// log logs the record with the attributes of the transfer.
+func (c *upDownloadContext) log(ctx context.Context, level LogLevel, msg string, args ...interface{}) {
+	if c.logger == nil || level < c.logLevel {
+		return
+	}
+	c.mu.RLock()
+	attrs := make([]interface{}, 0, len(c.logAttrs)+len(args))
+	attrs = append(attrs, c.logAttrs...)
+	c.mu.RUnlock()
+	attrs = append(attrs, args...)
+
+	switch {
+	case level >= LogLevelError:
+		c.logger.ErrorContext(ctx, msg, attrs...)
+	case level >= LogLevelWarn:
+		c.logger.WarnContext(ctx, msg, attrs...)
+	case level >= LogLevelInfo:
+		c.logger.InfoContext(ctx, msg, attrs...)
+	default:
+		c.logger.DebugContext(ctx, msg, attrs...)
+	}
+}
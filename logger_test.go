@@ -0,0 +1,219 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func TestLogger(t *testing.T) {
+	var (
+		bucket = "Bucket"
+		key    = "Key"
+	)
+	data := make([]byte, 128)
+
+	testCases := map[string]struct {
+		num      map[string]int
+		level    s3iot.LogLevel
+		retryer  s3iot.RetryerFactory
+		fail     bool
+		expected []string
+	}{
+		"Debug": {
+			num:   map[string]int{"upload": 1},
+			level: s3iot.LogLevelDebug,
+			expected: []string{
+				"INFO transfer started",
+				"INFO multipart upload created upload_id=UPLOAD0",
+				"DEBUG part started part=1",
+				"WARN throttled part=1 wait=1ms",
+				"WARN retrying part=1 attempt=1 error_class=throttle wait=1ms",
+				"DEBUG part finished part=1",
+				"DEBUG part started part=2",
+				"INFO transfer paused force=false",
+				"INFO transfer resumed",
+				"DEBUG part finished part=2",
+				"DEBUG part started part=3",
+				"DEBUG part finished part=3",
+				"INFO transfer completed bytes=128",
+			},
+		},
+		"Info": {
+			num:   map[string]int{"upload": 1},
+			level: s3iot.LogLevelInfo,
+			expected: []string{
+				"INFO transfer started",
+				"INFO multipart upload created upload_id=UPLOAD0",
+				"WARN throttled part=1 wait=1ms",
+				"WARN retrying part=1 attempt=1 error_class=throttle wait=1ms",
+				"INFO transfer paused force=false",
+				"INFO transfer resumed",
+				"INFO transfer completed bytes=128",
+			},
+		},
+		"Fail": {
+			num:   map[string]int{"complete": 10},
+			level: s3iot.LogLevelWarn,
+			fail:  true,
+			expected: []string{
+				"WARN throttled part=-1 wait=1ms",
+				"WARN retrying part=-1 attempt=1 error_class=throttle wait=1ms",
+				"WARN throttled part=-1 wait=1ms",
+				"WARN retry exceeded limit part=-1 attempt=2 error_class=throttle",
+				"ERROR transfer failed bytes=128",
+			},
+		},
+		"PolicyClassify": {
+			num:   map[string]int{"upload": 1},
+			level: s3iot.LogLevelWarn,
+			retryer: &s3iot.PolicyRetryerFactory{
+				Default: &s3iot.ExponentialBackoffRetryerFactory{
+					WaitBase: 2 * time.Millisecond,
+					RetryMax: 1,
+				},
+				Classify: func(error) s3iot.ErrorClass { return s3iot.ErrorClassServer },
+			},
+			expected: []string{
+				"WARN throttled part=1 wait=1ms",
+				"WARN retrying part=1 attempt=1 error_class=server wait=2ms",
+			},
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			api := newUploadMockAPI(&bytes.Buffer{}, tt.num, nil)
+			logger := &recordLogger{}
+
+			u := &s3iot.Uploader{}
+			s3iot.WithAPI(api).ApplyToUploader(u)
+			s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 50}).ApplyToUploader(u)
+			var retryer s3iot.RetryerFactory = &s3iot.ExponentialBackoffRetryerFactory{
+				WaitBase: time.Millisecond,
+				RetryMax: 1,
+			}
+			if tt.retryer != nil {
+				retryer = tt.retryer
+			}
+			s3iot.WithRetryer(retryer).ApplyToUploader(u)
+			s3iot.WithErrorClassifier(&s3iot.RuleErrorClassifier{
+				Rules: []s3iot.ErrorRule{
+					{Match: s3iot.MatchError(errTemp), Retryable: true, ThrottleWait: time.Millisecond},
+				},
+			}).ApplyToUploader(u)
+			s3iot.WithLogger(logger, tt.level).ApplyToUploader(u)
+			var uc s3iot.UploadContext
+			ready := make(chan struct{})
+			uploadPart := api.UploadPartFunc
+			api.UploadPartFunc = func(ctx context.Context, input *s3api.UploadPartInput) (*s3api.UploadPartOutput, error) {
+				if *input.PartNumber == 2 {
+					<-ready
+					uc.Pause()
+					uc.Resume()
+				}
+				return uploadPart(ctx, input)
+			}
+
+			var err error
+			uc, err = u.Upload(context.TODO(), &s3iot.UploadInput{
+				Bucket: &bucket,
+				Key:    &key,
+				Body:   bytes.NewReader(data),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			close(ready)
+
+			select {
+			case <-time.After(time.Second):
+				t.Fatal("Timeout")
+			case <-uc.Done():
+			}
+			if _, err := uc.Result(); (err != nil) != tt.fail {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if records := logger.Records(); !reflect.DeepEqual(tt.expected, records) {
+				t.Errorf("Expected records:\n%v\ngot:\n%v", tt.expected, records)
+			}
+			for _, attrs := range logger.attrs {
+				if attrs["operation"] != s3iot.OperationUpload || attrs["bucket"] != bucket || attrs["key"] != key {
+					t.Errorf("Records must have the attributes of the transfer, got %v", attrs)
+				}
+			}
+		})
+	}
+}
+
+// recordLogger records the message and the attributes which don't depend
+// on the timing.
+type recordLogger struct {
+	mu      sync.Mutex
+	records []string
+	attrs   []map[string]interface{}
+}
+
+func (l *recordLogger) log(level, msg string, args ...interface{}) {
+	attrs := make(map[string]interface{})
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs[args[i].(string)] = args[i+1]
+	}
+	r := level + " " + msg
+	for _, k := range []string{
+		s3iot.LogKeyUploadID, s3iot.LogKeyPart, s3iot.LogKeyAttempt,
+		s3iot.LogKeyErrorClass, s3iot.LogKeyWait, s3iot.LogKeyForce, s3iot.LogKeyBytes,
+	} {
+		if v, ok := attrs[k]; ok {
+			r += fmt.Sprintf(" %s=%v", k, v)
+		}
+	}
+	l.mu.Lock()
+	l.records = append(l.records, r)
+	l.attrs = append(l.attrs, attrs)
+	l.mu.Unlock()
+}
+
+func (l *recordLogger) Records() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.records...)
+}
+
+func (l *recordLogger) DebugContext(_ context.Context, msg string, args ...interface{}) {
+	l.log("DEBUG", msg, args...)
+}
+
+func (l *recordLogger) InfoContext(_ context.Context, msg string, args ...interface{}) {
+	l.log("INFO", msg, args...)
+}
+
+func (l *recordLogger) WarnContext(_ context.Context, msg string, args ...interface{}) {
+	l.log("WARN", msg, args...)
+}
+
+func (l *recordLogger) ErrorContext(_ context.Context, msg string, args ...interface{}) {
+	l.log("ERROR", msg, args...)
+}
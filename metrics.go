@@ -0,0 +1,59 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"time"
+)
+
+// Metrics records the metrics of Uploader, Downloader and Copier.
+// op is the transfer operation: OperationUpload, OperationDownload or OperationCopy.
+// Methods are called from multiple goroutines.
+type Metrics interface {
+	// TransferStarted is called on the beginning of the transfer.
+	TransferStarted(op string)
+	// TransferFinished is called when the transfer is completed or failed.
+	TransferFinished(op string, err error)
+	// BytesTransferred is called when a part is transferred.
+	BytesTransferred(op string, n int64)
+	// APICall is called after each API call attempt with the name of the API
+	// like "UploadPart".
+	// The duration includes the transfer of the body.
+	APICall(op, api string, d time.Duration, err error)
+	// Retry is called when the failed API call is retried.
+	Retry(op string, class ErrorClass)
+	// Throttle is called when the API call is throttled by the server.
+	Throttle(op string, wait time.Duration)
+	// Paused is called with the paused duration when the transfer is resumed
+	// or finished while paused.
+	Paused(op string, d time.Duration)
+}
+
+// WithMetrics sets Metrics.
+func WithMetrics(m Metrics) UpDownloaderOption {
+	return UpDownloaderOptionFn(func(u *UpDownloaderBase) {
+		u.Metrics = m
+	})
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) TransferStarted(string)                       {}
+func (noopMetrics) TransferFinished(string, error)               {}
+func (noopMetrics) BytesTransferred(string, int64)               {}
+func (noopMetrics) APICall(string, string, time.Duration, error) {}
+func (noopMetrics) Retry(string, ErrorClass)                     {}
+func (noopMetrics) Throttle(string, time.Duration)               {}
+func (noopMetrics) Paused(string, time.Duration)                 {}
@@ -0,0 +1,149 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func TestMetrics(t *testing.T) {
+	var (
+		bucket = "Bucket"
+		key    = "Key"
+	)
+	data := make([]byte, 128)
+
+	buf := &bytes.Buffer{}
+	api := newUploadMockAPI(buf, map[string]int{"upload": 1}, nil)
+
+	var uc s3iot.UploadContext
+	ready := make(chan struct{})
+	uploadPart := api.UploadPartFunc
+	api.UploadPartFunc = func(ctx context.Context, input *s3api.UploadPartInput) (*s3api.UploadPartOutput, error) {
+		if *input.PartNumber == 2 {
+			<-ready
+			uc.Pause()
+			time.Sleep(10 * time.Millisecond)
+			uc.Resume()
+		}
+		return uploadPart(ctx, input)
+	}
+
+	metrics := &recordMetrics{}
+	u := &s3iot.Uploader{}
+	s3iot.WithAPI(api).ApplyToUploader(u)
+	s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 50}).ApplyToUploader(u)
+	s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{WaitBase: time.Millisecond}).ApplyToUploader(u)
+	s3iot.WithErrorClassifier(&s3iot.RuleErrorClassifier{
+		Rules: []s3iot.ErrorRule{
+			{Match: s3iot.MatchError(errTemp), Retryable: true, ThrottleWait: time.Millisecond},
+		},
+	}).ApplyToUploader(u)
+	s3iot.WithMetrics(metrics).ApplyToUploader(u)
+
+	var err error
+	uc, err = u.Upload(context.TODO(), &s3iot.UploadInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(ready)
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("Timeout")
+	case <-uc.Done():
+	}
+	if _, err := uc.Result(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"started Upload",
+		"api Upload CreateMultipartUpload <nil>",
+		"api Upload UploadPart dummy",
+		"throttle Upload 1ms",
+		"retry Upload throttle",
+		"api Upload UploadPart <nil>",
+		"bytes Upload 50",
+		"paused Upload",
+		"api Upload UploadPart <nil>",
+		"bytes Upload 50",
+		"api Upload UploadPart <nil>",
+		"bytes Upload 28",
+		"api Upload CompleteMultipartUpload <nil>",
+		"finished Upload <nil>",
+	}
+	if events := metrics.Events(); !reflect.DeepEqual(expected, events) {
+		t.Errorf("Expected events:\n%v\ngot:\n%v", expected, events)
+	}
+	if metrics.paused < 10*time.Millisecond {
+		t.Errorf("Paused duration must be longer than 10ms, got %v", metrics.paused)
+	}
+}
+
+type recordMetrics struct {
+	mu     sync.Mutex
+	events []string
+	paused time.Duration
+}
+
+func (m *recordMetrics) record(format string, args ...interface{}) {
+	m.mu.Lock()
+	m.events = append(m.events, fmt.Sprintf(format, args...))
+	m.mu.Unlock()
+}
+
+func (m *recordMetrics) Events() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.events...)
+}
+
+func (m *recordMetrics) TransferStarted(op string) { m.record("started %s", op) }
+
+func (m *recordMetrics) TransferFinished(op string, err error) {
+	m.record("finished %s %v", op, err)
+}
+
+func (m *recordMetrics) BytesTransferred(op string, n int64) { m.record("bytes %s %d", op, n) }
+
+func (m *recordMetrics) APICall(op, api string, _ time.Duration, err error) {
+	m.record("api %s %s %v", op, api, err)
+}
+
+func (m *recordMetrics) Retry(op string, class s3iot.ErrorClass) { m.record("retry %s %v", op, class) }
+
+func (m *recordMetrics) Throttle(op string, wait time.Duration) {
+	m.record("throttle %s %v", op, wait)
+}
+
+func (m *recordMetrics) Paused(op string, d time.Duration) {
+	m.mu.Lock()
+	m.paused += d
+	m.mu.Unlock()
+	m.record("paused %s", op)
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netsim
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Size of the data transferred at once.
+// Under the bandwidth limit, the chunk is shrunk to be transferred
+// chunksPerSecond times per second.
+const (
+	maxChunkSize      = 4 * 1024
+	chunksPerSecond   = 20
+	minBandwidthChunk = 1
+)
+
+type limiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until n bytes can be transferred under the bandwidth.
+func (l *limiter) wait(ctx context.Context, n int, bandwidth int64) error {
+	d := time.Duration(int64(n) * int64(time.Second) / bandwidth)
+	now := time.Now()
+	l.mu.Lock()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(d)
+	until := l.next
+	l.mu.Unlock()
+	return sleep(ctx, until.Sub(now))
+}
+
+type body struct {
+	io.ReadCloser
+
+	ctx       context.Context
+	transport *Transport
+	upload    bool
+	resetAt   int64
+	n         int64
+	reset     bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.reset {
+		return 0, ErrConnectionReset
+	}
+	t := b.transport
+	if (b.resetAt >= 0 && b.n >= b.resetAt) || t.Offline() {
+		b.reset = true
+		t.mu.Lock()
+		t.stats.Resets++
+		t.mu.Unlock()
+		return 0, ErrConnectionReset
+	}
+
+	cond := t.conditions()
+	bandwidth, lim := cond.DownloadBandwidth, &t.down
+	if b.upload {
+		bandwidth, lim = cond.UploadBandwidth, &t.up
+	}
+
+	chunk := int64(maxChunkSize)
+	if bandwidth > 0 && chunk > bandwidth/chunksPerSecond {
+		chunk = bandwidth / chunksPerSecond
+		if chunk < minBandwidthChunk {
+			chunk = minBandwidthChunk
+		}
+	}
+	if b.resetAt >= 0 && chunk > b.resetAt-b.n {
+		chunk = b.resetAt - b.n
+	}
+	if int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	t.mu.Lock()
+	if b.upload {
+		t.stats.BytesSent += int64(n)
+	} else {
+		t.stats.BytesReceived += int64(n)
+	}
+	t.mu.Unlock()
+
+	if n > 0 && bandwidth > 0 {
+		if errWait := lim.wait(b.ctx, n, bandwidth); errWait != nil {
+			return n, errWait
+		}
+	}
+	return n, err
+}
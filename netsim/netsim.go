@@ -0,0 +1,291 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netsim provides http.RoundTripper to simulate impaired network
+// links like bandwidth caps, latency, jitter, connection resets in the middle
+// of the body and scheduled outages.
+//
+// Random decisions are made by the seeded random source so that the simulated
+// link behaves deterministically with the same request sequence.
+// Transport can be plugged into the aws SDKs through HTTPClient field of
+// aws.Config:
+//
+//	tr := netsim.New(netsim.WithConditions(netsim.Conditions{
+//		UploadBandwidth: 64 * 1024,
+//		Latency:         100 * time.Millisecond,
+//		Outages:         []netsim.Outage{{Start: 10 * time.Second, End: 40 * time.Second}},
+//	}))
+//	cfg := aws.Config{HTTPClient: tr.Client()}
+package netsim
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultSeed is the default seed of the random source.
+const DefaultSeed = 1
+
+// Simulated network errors.
+var (
+	ErrOffline         = errors.New("netsim: network is offline")
+	ErrConnectionReset = errors.New("netsim: connection reset by peer")
+)
+
+// Outage represents the period of the network outage
+// relative to the creation of the Transport.
+// Zero End means that the outage continues forever.
+type Outage struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Conditions represents the simulated network conditions.
+// Zero value means no impairment.
+type Conditions struct {
+	// UploadBandwidth and DownloadBandwidth limit the transfer rate of
+	// request and response body in bytes per second.
+	// The bandwidth is shared by all requests through the Transport.
+	UploadBandwidth   int64
+	DownloadBandwidth int64
+	// Latency delays each request.
+	Latency time.Duration
+	// Jitter randomly adds or subtracts up to Jitter from Latency.
+	Jitter time.Duration
+	// ResetRate is the probability of resetting the connection in the middle
+	// of the request body, or the response body if the request has no body.
+	ResetRate float64
+	// Outages are the scheduled periods of the network outage.
+	// New requests fail with ErrOffline and transferring bodies fail with
+	// ErrConnectionReset during the outage.
+	Outages []Outage
+}
+
+// Stats represents the statistics of the Transport.
+type Stats struct {
+	Requests      int
+	Rejected      int
+	Resets        int
+	BytesSent     int64
+	BytesReceived int64
+}
+
+// Transport is http.RoundTripper to simulate impaired network link.
+type Transport struct {
+	base     http.RoundTripper
+	mu       sync.Mutex
+	cond     Conditions
+	rand     *rand.Rand
+	start    time.Time
+	offline  bool
+	stats    Stats
+	up, down limiter
+}
+
+// Option configures Transport.
+type Option func(*Transport)
+
+// WithBase sets the base http.RoundTripper.
+// http.DefaultTransport is used by default.
+func WithBase(rt http.RoundTripper) Option {
+	return func(t *Transport) {
+		t.base = rt
+	}
+}
+
+// WithConditions sets the initial network conditions.
+func WithConditions(c Conditions) Option {
+	return func(t *Transport) {
+		t.cond = c
+	}
+}
+
+// WithSeed sets the seed of the random source.
+func WithSeed(seed int64) Option {
+	return func(t *Transport) {
+		t.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// New creates Transport.
+// Outage schedule starts from the creation of the Transport.
+func New(opts ...Option) *Transport {
+	t := &Transport{
+		base:  http.DefaultTransport,
+		rand:  rand.New(rand.NewSource(DefaultSeed)),
+		start: time.Now(),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Client returns http.Client using the Transport.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// SetConditions changes the network conditions.
+// It can be changed during the transfer.
+func (t *Transport) SetConditions(c Conditions) {
+	t.mu.Lock()
+	t.cond = c
+	t.mu.Unlock()
+}
+
+// SetOffline manually brings the network offline or back online.
+func (t *Transport) SetOffline(offline bool) {
+	t.mu.Lock()
+	t.offline = offline
+	t.mu.Unlock()
+}
+
+// Offline returns true if the network is offline.
+func (t *Transport) Offline() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.offlineLocked()
+}
+
+// Elapsed returns the elapsed time from the creation of the Transport.
+func (t *Transport) Elapsed() time.Duration {
+	return time.Since(t.start)
+}
+
+// Stats returns the statistics.
+func (t *Transport) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
+
+func (t *Transport) offlineLocked() bool {
+	if t.offline {
+		return true
+	}
+	elapsed := time.Since(t.start)
+	for _, o := range t.cond.Outages {
+		if o.Start <= elapsed && (o.End == 0 || elapsed < o.End) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Transport) conditions() Conditions {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cond
+}
+
+func (t *Transport) reject() {
+	t.mu.Lock()
+	t.stats.Rejected++
+	t.mu.Unlock()
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	t.mu.Lock()
+	t.stats.Requests++
+	offline := t.offlineLocked()
+	delay := t.cond.Latency
+	if t.cond.Jitter > 0 {
+		delay += time.Duration(t.rand.Int63n(int64(2*t.cond.Jitter+1))) - t.cond.Jitter
+	}
+	var reset bool
+	var resetPos float64
+	if t.cond.ResetRate > 0 && t.rand.Float64() < t.cond.ResetRate {
+		reset = true
+		resetPos = t.rand.Float64()
+	}
+	t.mu.Unlock()
+
+	if !offline && delay > 0 {
+		if err := sleep(ctx, delay); err != nil {
+			closeBody(req)
+			return nil, err
+		}
+		offline = t.Offline()
+	}
+	if offline {
+		t.reject()
+		closeBody(req)
+		return nil, ErrOffline
+	}
+
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	req = req.Clone(ctx)
+	if hasBody {
+		b := &body{
+			ReadCloser: req.Body,
+			ctx:        ctx,
+			transport:  t,
+			upload:     true,
+			resetAt:    -1,
+		}
+		if reset && req.ContentLength > 0 {
+			b.resetAt = int64(resetPos * float64(req.ContentLength))
+			reset = false
+		}
+		req.Body = b
+		req.GetBody = nil
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b := &body{
+		ReadCloser: res.Body,
+		ctx:        ctx,
+		transport:  t,
+		resetAt:    -1,
+	}
+	if reset {
+		b.resetAt = 0
+		if res.ContentLength > 0 {
+			b.resetAt = int64(resetPos * float64(res.ContentLength))
+		}
+	}
+	res.Body = b
+	return res, nil
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netsim
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(b) == 0 {
+			b = bytes.Repeat([]byte{0xAA}, 1000)
+		}
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func roundTrip(t *testing.T, tr *Transport, url string, data []byte) ([]byte, error) {
+	t.Helper()
+	method := http.MethodGet
+	var body io.Reader
+	if data != nil {
+		method, body = http.MethodPut, bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tr.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return io.ReadAll(res.Body)
+}
+
+func TestTransport(t *testing.T) {
+	data := bytes.Repeat([]byte{0x55}, 1000)
+
+	t.Run("NoImpairment", func(t *testing.T) {
+		srv := newEchoServer(t)
+		tr := New()
+		b, err := roundTrip(t, tr, srv.URL, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, b) {
+			t.Error("Data differs")
+		}
+		if expected := (Stats{Requests: 1, BytesSent: 1000, BytesReceived: 1000}); tr.Stats() != expected {
+			t.Errorf("Expected stats: %+v, got: %+v", expected, tr.Stats())
+		}
+	})
+	t.Run("Latency", func(t *testing.T) {
+		srv := newEchoServer(t)
+		tr := New(WithConditions(Conditions{
+			Latency: 100 * time.Millisecond,
+			Jitter:  50 * time.Millisecond,
+		}))
+		for i := 0; i < 3; i++ {
+			ts := time.Now()
+			if _, err := roundTrip(t, tr, srv.URL, nil); err != nil {
+				t.Fatal(err)
+			}
+			if d := time.Since(ts); d < 50*time.Millisecond || d > time.Second {
+				t.Errorf("Unexpected latency: %v", d)
+			}
+		}
+	})
+	t.Run("Bandwidth", func(t *testing.T) {
+		testCases := map[string]struct {
+			cond Conditions
+			data []byte
+		}{
+			"Upload": {
+				cond: Conditions{UploadBandwidth: 5000},
+				data: data,
+			},
+			"Download": {
+				cond: Conditions{DownloadBandwidth: 5000},
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				srv := newEchoServer(t)
+				tr := New(WithConditions(tt.cond))
+				ts := time.Now()
+				if _, err := roundTrip(t, tr, srv.URL, tt.data); err != nil {
+					t.Fatal(err)
+				}
+				if d := time.Since(ts); d < 150*time.Millisecond || d > time.Second {
+					t.Errorf("1000 bytes at 5000 bytes/s is expected to take 200ms, took %v", d)
+				}
+			})
+		}
+	})
+	t.Run("Reset", func(t *testing.T) {
+		testCases := map[string]struct {
+			data []byte
+		}{
+			"Upload":   {data: data},
+			"Download": {},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				srv := newEchoServer(t)
+				tr := New(WithConditions(Conditions{ResetRate: 1}))
+				_, err := roundTrip(t, tr, srv.URL, tt.data)
+				if !errors.Is(err, ErrConnectionReset) {
+					t.Fatalf("Expected error: '%v', got: '%v'", ErrConnectionReset, err)
+				}
+				stats := tr.Stats()
+				if stats.Resets != 1 {
+					t.Errorf("Expected 1 reset, got %d", stats.Resets)
+				}
+				if stats.BytesSent+stats.BytesReceived >= 1000 {
+					t.Errorf("Body must be reset in the middle: %+v", stats)
+				}
+			})
+		}
+	})
+	t.Run("ResetDeterministic", func(t *testing.T) {
+		srv := newEchoServer(t)
+		results := func() []bool {
+			tr := New(WithSeed(42), WithConditions(Conditions{ResetRate: 0.5}))
+			var ret []bool
+			for i := 0; i < 10; i++ {
+				_, err := roundTrip(t, tr, srv.URL, data)
+				ret = append(ret, err != nil)
+			}
+			return ret
+		}
+		r1, r2 := results(), results()
+		var n int
+		for i := range r1 {
+			if r1[i] != r2[i] {
+				t.Fatalf("Results differ: %v, %v", r1, r2)
+			}
+			if r1[i] {
+				n++
+			}
+		}
+		if n == 0 || n == len(r1) {
+			t.Errorf("Expected partial failures, got: %v", r1)
+		}
+	})
+	t.Run("Outage", func(t *testing.T) {
+		srv := newEchoServer(t)
+		tr := New(WithConditions(Conditions{
+			Outages: []Outage{{Start: 0, End: 100 * time.Millisecond}},
+		}))
+		if _, err := roundTrip(t, tr, srv.URL, data); !errors.Is(err, ErrOffline) {
+			t.Fatalf("Expected error: '%v', got: '%v'", ErrOffline, err)
+		}
+		time.Sleep(100*time.Millisecond - tr.Elapsed())
+		if tr.Offline() {
+			t.Fatal("Outage must be ended")
+		}
+		if _, err := roundTrip(t, tr, srv.URL, data); err != nil {
+			t.Fatal(err)
+		}
+		if stats := tr.Stats(); stats.Requests != 2 || stats.Rejected != 1 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+	})
+	t.Run("OutageDuringTransfer", func(t *testing.T) {
+		srv := newEchoServer(t)
+		tr := New(WithConditions(Conditions{DownloadBandwidth: 2000}))
+		res, err := tr.Client().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			tr.SetOffline(true)
+		}()
+		b, err := io.ReadAll(res.Body)
+		if !errors.Is(err, ErrConnectionReset) {
+			t.Fatalf("Expected error: '%v', got: '%v'", ErrConnectionReset, err)
+		}
+		if len(b) == 0 || len(b) >= 1000 {
+			t.Errorf("Body must be reset in the middle, got %d bytes", len(b))
+		}
+
+		tr.SetOffline(false)
+		if _, err := roundTrip(t, tr, srv.URL, data); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		srv := newEchoServer(t)
+		tr := New(WithConditions(Conditions{Latency: time.Minute}))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tr.Client().Do(req); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected error: '%v', got: '%v'", context.DeadlineExceeded, err)
+		}
+	})
+}
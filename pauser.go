@@ -0,0 +1,40 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+// PauseBy pauses the Pauser on behalf of the owner.
+// If the Pauser doesn't implement SharedPauser, Pause, or ForcePause
+// if force is true, is called instead.
+func PauseBy(p Pauser, owner interface{}, force bool) {
+	if sp, ok := p.(SharedPauser); ok {
+		sp.PauseBy(owner, force)
+		return
+	}
+	if fp, ok := p.(ForcePauser); ok && force {
+		fp.ForcePause()
+		return
+	}
+	p.Pause()
+}
+
+// ResumeBy resumes the Pauser on behalf of the owner.
+// If the Pauser doesn't implement SharedPauser, Resume is called instead.
+func ResumeBy(p Pauser, owner interface{}) {
+	if sp, ok := p.(SharedPauser); ok {
+		sp.ResumeBy(owner)
+		return
+	}
+	p.Resume()
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	mock_s3api "github.com/at-wat/s3iot/internal/moq/s3api"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func TestSharedPauser(t *testing.T) {
+	t.Run("UploadContext", func(t *testing.T) {
+		release := make(chan struct{})
+		api := &mock_s3api.MockS3API{
+			PutObjectFunc: func(ctx context.Context, input *s3api.PutObjectInput) (*s3api.PutObjectOutput, error) {
+				<-release
+				return &s3api.PutObjectOutput{}, nil
+			},
+		}
+		u := &Uploader{}
+		WithAPI(api).ApplyToUploader(u)
+		bucket, key := "bucket", "key"
+		uc, err := u.Upload(context.TODO(), &UploadInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Body:   bytes.NewReader([]byte{0}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sp, ok := uc.(SharedPauser)
+		if !ok {
+			t.Fatal("UploadContext must implement SharedPauser")
+		}
+		checkPaused := func(t *testing.T, expected bool) {
+			t.Helper()
+			if s, _ := uc.Status(); s.Paused != expected {
+				t.Fatalf("Expected paused: %v, got: %v", expected, s.Paused)
+			}
+		}
+
+		sp.PauseBy("a", false)
+		sp.PauseBy("b", false)
+		checkPaused(t, true)
+		sp.ResumeBy("a")
+		checkPaused(t, true)
+		sp.ResumeBy("b")
+		checkPaused(t, false)
+
+		// Pause by the user is kept until the user resumes.
+		uc.Pause()
+		sp.PauseBy("a", false)
+		sp.ResumeBy("a")
+		checkPaused(t, true)
+		uc.Resume()
+		checkPaused(t, false)
+
+		close(release)
+		select {
+		case <-uc.Done():
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		}
+		if _, err := uc.Result(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("Fallback", func(t *testing.T) {
+		p := newTestPauser()
+		PauseBy(p, "a", false)
+		if !p.isPaused() {
+			t.Fatal("Pauser must be paused")
+		}
+		ResumeBy(p, "a")
+		if p.isPaused() {
+			t.Fatal("Pauser must be resumed")
+		}
+	})
+}
@@ -74,19 +74,26 @@ func (f *WaitReadInterceptorFactory) SetMaxChunkSize(s int) {
 
 type waitReadInterceptor struct {
 	factory *WaitReadInterceptorFactory
+	clock   Clock
 }
 
 // New creates WaitReadInterceptor.
 func (f *WaitReadInterceptorFactory) New() ReadInterceptor {
 	return &waitReadInterceptor{
 		factory: f,
+		clock:   DefaultClock,
 	}
 }
 
+func (i *waitReadInterceptor) setClock(c Clock) {
+	i.clock = c
+}
+
 func (i *waitReadInterceptor) Reader(r io.ReadSeeker) io.ReadSeeker {
 	return &waitReader{
 		ReadSeeker: r,
 		factory:    i.factory,
+		clock:      i.clock,
 	}
 }
 
@@ -94,6 +101,7 @@ type waitReader struct {
 	io.ReadSeeker
 
 	factory *WaitReadInterceptorFactory
+	clock   Clock
 }
 
 func (r *waitReader) Read(b []byte) (int, error) {
@@ -107,6 +115,6 @@ func (r *waitReader) Read(b []byte) (int, error) {
 	}
 
 	n, err := r.ReadSeeker.Read(b)
-	time.Sleep(waitPerByte * time.Duration(n))
+	r.clock.Sleep(waitPerByte * time.Duration(n))
 	return n, err
 }
@@ -20,6 +20,8 @@ import (
 	"io"
 	"testing"
 	"time"
+
+	"github.com/at-wat/s3iot/clocktest"
 )
 
 func TestWaitReadInterceptor(t *testing.T) {
@@ -84,3 +86,38 @@ func TestWaitReadInterceptor(t *testing.T) {
 		})
 	}
 }
+
+func TestWaitReadInterceptor_Clock(t *testing.T) {
+	f := NewWaitReadInterceptorFactory(
+		time.Second,
+		WaitReadInterceptorMaxChunkSize(8),
+	)
+	clock := clocktest.New(time.Now())
+	ri := f.New()
+	cs, ok := ri.(clockSetter)
+	if !ok {
+		t.Fatal("WaitReadInterceptor must accept Clock")
+	}
+	cs.setClock(clock)
+
+	r := ri.Reader(bytes.NewReader(make([]byte, 16)))
+	done := make(chan struct{})
+	go func() {
+		if _, err := io.ReadAll(r); err != nil {
+			t.Error(err)
+		}
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		if wait, _ := clock.Next(); wait != 8*time.Second {
+			t.Errorf("Expected wait: %v, actual: %v", 8*time.Second, wait)
+		}
+		clock.Advance(8 * time.Second)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout")
+	}
+}
@@ -16,6 +16,9 @@ package s3iot
 
 import (
 	"context"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
 	"sync"
 	"time"
 )
@@ -46,18 +49,87 @@ func (noRetryer) OnFail(context.Context, int64, error) bool {
 
 func (noRetryer) OnSuccess(int64) {}
 
+// Jitter represents the randomization mode of the backoff wait.
+type Jitter int
+
+// Jitter modes.
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+// for the details.
+const (
+	// NoJitter waits exactly the exponential backoff duration.
+	NoJitter Jitter = iota
+	// FullJitter waits random duration between zero and the backoff duration.
+	FullJitter
+	// EqualJitter waits the half of the backoff duration plus random duration
+	// up to the other half.
+	EqualJitter
+	// DecorrelatedJitter waits random duration between WaitBase and
+	// three times of the previous wait, capped by WaitMax.
+	DecorrelatedJitter
+)
+
+// Rand is the random source used to calculate the jitter.
+// *rand.Rand of math/rand satisfies the interface,
+// but it must be guarded by a lock if the RetryerFactory is shared
+// by concurrent uploads or downloads.
+type Rand interface {
+	Int63n(n int64) int64
+}
+
+// DefaultRand is the default random source safe for concurrent use.
+// It is seeded by crypto/rand to randomize the jitter across the devices,
+// since the global random source of math/rand is deterministic on
+// old Go versions.
+var DefaultRand Rand = newLockedRand()
+
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand() *lockedRand {
+	var b [8]byte
+	seed := time.Now().UnixNano()
+	if _, err := cryptorand.Read(b[:]); err == nil {
+		seed = int64(binary.LittleEndian.Uint64(b[:]))
+	}
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+func (r *lockedRand) Int63n(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Int63n(n)
+}
+
+type retryWaitKey struct{}
+
+// notifyRetryWait notifies the wait before the retry to observedRetryer.
+func notifyRetryWait(ctx context.Context, wait time.Duration) {
+	if fn, ok := ctx.Value(retryWaitKey{}).(func(time.Duration)); ok {
+		fn(wait)
+	}
+}
+
 // ExponentialBackoffRetryerFactory creates ExponentialBackoffRetryer.
 // When raw s3 upload API call is failed, the API call will be retried
 // after WaitBase. Wait duration is multiplied by 2 if it continuously
 // failed up to WaitMax.
+// The wait duration is randomized according to Jitter using Rand.
+// If MaxElapsedTime is set, retry is given up when the time elapsed
+// from the first failure reaches MaxElapsedTime, in addition to RetryMax.
 type ExponentialBackoffRetryerFactory struct {
-	WaitBase time.Duration
-	WaitMax  time.Duration
-	RetryMax int
+	WaitBase       time.Duration
+	WaitMax        time.Duration
+	RetryMax       int
+	Jitter         Jitter
+	Rand           Rand
+	MaxElapsedTime time.Duration
 }
 
 // New creates ExponentialBackoffRetryer.
-func (f ExponentialBackoffRetryerFactory) New(Pauser) Retryer {
+// Retry interval is waited using Clock provided by the Pauser.
+func (f ExponentialBackoffRetryerFactory) New(p Pauser) Retryer {
 	if f.WaitBase == 0 {
 		f.WaitBase = DefaultExponentialBackoffWaitBase
 	}
@@ -67,54 +139,109 @@ func (f ExponentialBackoffRetryerFactory) New(Pauser) Retryer {
 	if f.RetryMax == 0 {
 		f.RetryMax = DefaultRetryMax
 	}
+	if f.Rand == nil {
+		f.Rand = DefaultRand
+	}
 	return &exponentialBackoffRetryer{
 		factory: f,
+		clock:   clockOf(p),
 		wait:    make(map[int64]time.Duration),
+		prev:    make(map[int64]time.Duration),
 		fails:   make(map[int64]int),
+		start:   make(map[int64]time.Time),
 	}
 }
 
 type exponentialBackoffRetryer struct {
 	factory ExponentialBackoffRetryerFactory
+	clock   Clock
 	mu      sync.Mutex
 	wait    map[int64]time.Duration
+	prev    map[int64]time.Duration
 	fails   map[int64]int
+	start   map[int64]time.Time
 }
 
 func (r *exponentialBackoffRetryer) OnFail(ctx context.Context, id int64, err error) bool {
-	var wait time.Duration
+	now := r.clock.Now()
+
 	r.mu.Lock()
+	var backoff time.Duration
 	if _, ok := r.wait[id]; !ok {
-		r.wait[id] = r.factory.WaitBase
-		wait = r.factory.WaitBase
+		backoff = r.factory.WaitBase
+		r.start[id] = now
 	} else {
-		wait = r.wait[id] * 2
-		if wait > r.factory.WaitMax {
-			wait = r.factory.WaitMax
+		backoff = r.wait[id] * 2
+		if backoff > r.factory.WaitMax {
+			backoff = r.factory.WaitMax
 		}
-		r.wait[id] = wait
 	}
+	r.wait[id] = backoff
+	wait := r.jitter(id, backoff)
 	r.fails[id]++
 	cnt := r.fails[id]
+	elapsed := now.Sub(r.start[id])
 	r.mu.Unlock()
 
 	if cnt > r.factory.RetryMax {
 		return false
 	}
+	if limit := r.factory.MaxElapsedTime; limit > 0 {
+		if elapsed >= limit {
+			return false
+		}
+		if elapsed+wait > limit {
+			wait = limit - elapsed
+		}
+	}
 
+	notifyRetryWait(ctx, wait)
 	select {
-	case <-time.After(wait):
+	case <-r.clock.After(wait):
 		return true
 	case <-ctx.Done():
 		return false
 	}
 }
 
+// jitter must be called under the lock.
+func (r *exponentialBackoffRetryer) jitter(id int64, backoff time.Duration) time.Duration {
+	switch r.factory.Jitter {
+	case FullJitter:
+		return r.random(0, backoff)
+	case EqualJitter:
+		return backoff/2 + r.random(0, backoff-backoff/2)
+	case DecorrelatedJitter:
+		prev, ok := r.prev[id]
+		if !ok {
+			prev = r.factory.WaitBase
+		}
+		wait := r.random(r.factory.WaitBase, prev*3)
+		if wait > r.factory.WaitMax {
+			wait = r.factory.WaitMax
+		}
+		r.prev[id] = wait
+		return wait
+	default:
+		return backoff
+	}
+}
+
+// random returns random duration in [lo, hi].
+func (r *exponentialBackoffRetryer) random(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	return lo + time.Duration(r.factory.Rand.Int63n(int64(hi-lo)+1))
+}
+
 func (r *exponentialBackoffRetryer) OnSuccess(id int64) {
 	r.mu.Lock()
 	if _, ok := r.wait[id]; ok {
 		delete(r.wait, id)
+		delete(r.prev, id)
 		delete(r.fails, id)
+		delete(r.start, id)
 	}
 	r.mu.Unlock()
 }
@@ -151,6 +278,12 @@ func (r *pauseOnFailRetryer) OnSuccess(id int64) {
 	r.base.OnSuccess(id)
 }
 
+func (r *pauseOnFailRetryer) OnThrottle(id int64, wait time.Duration) {
+	if to, ok := r.base.(ThrottleObserver); ok {
+		to.OnThrottle(id, wait)
+	}
+}
+
 // RetryerHookFactory adds hook callback to the base retryer.
 // Base and OnError must be set, or cause panic.
 type RetryerHookFactory struct {
@@ -188,3 +321,16 @@ func (r *retryerHook) OnFail(ctx context.Context, id int64, err error) bool {
 func (r *retryerHook) OnSuccess(id int64) {
 	r.base.OnSuccess(id)
 }
+
+func (r *retryerHook) OnThrottle(id int64, wait time.Duration) {
+	if to, ok := r.base.(ThrottleObserver); ok {
+		to.OnThrottle(id, wait)
+	}
+}
+
+func (r *retryerHook) classifyError(err error) (ErrorClass, bool) {
+	if ec, ok := r.base.(errorClassProvider); ok {
+		return ec.classifyError(err)
+	}
+	return 0, false
+}
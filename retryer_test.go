@@ -17,8 +17,11 @@ package s3iot
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/at-wat/s3iot/clocktest"
 )
 
 var _ RetryerFactory = &NoRetryerFactory{}
@@ -73,6 +76,166 @@ func TestExponentialBackoffRetryer(t *testing.T) {
 			t.Error("Unexpected failure after resetting failure")
 		}
 	})
+	t.Run("Clock", func(t *testing.T) {
+		f := &ExponentialBackoffRetryerFactory{
+			WaitBase: time.Second,
+			WaitMax:  5 * time.Second,
+			RetryMax: 4,
+		}
+		clock := clocktest.New(time.Now())
+		r := f.New(&clockPauser{clock: clock})
+
+		for i, expected := range []time.Duration{
+			time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second,
+		} {
+			done := make(chan bool)
+			go func() {
+				done <- r.OnFail(context.TODO(), 0, errDummy)
+			}()
+			clock.BlockUntil(1)
+			if wait, _ := clock.Next(); wait != expected {
+				t.Errorf("Expected wait of %d-th retry: %v, actual: %v", i, expected, wait)
+			}
+			clock.Advance(expected - time.Millisecond)
+			select {
+			case <-done:
+				t.Fatal("OnFail must wait until the clock advances")
+			case <-time.After(10 * time.Millisecond):
+			}
+			clock.Advance(time.Millisecond)
+			if cont := <-done; !cont {
+				t.Error("Unexpected failure before reaching RetryMax")
+			}
+		}
+	})
+	t.Run("Jitter", func(t *testing.T) {
+		testCases := map[string]struct {
+			jitter   Jitter
+			ratio    float64
+			expected []time.Duration
+		}{
+			"NoJitter": {
+				jitter:   NoJitter,
+				expected: []time.Duration{1000, 2000, 4000, 8000, 10000},
+			},
+			"FullJitterMin": {
+				jitter:   FullJitter,
+				ratio:    0,
+				expected: []time.Duration{0, 0, 0, 0, 0},
+			},
+			"FullJitterHalf": {
+				jitter:   FullJitter,
+				ratio:    0.5,
+				expected: []time.Duration{500, 1000, 2000, 4000, 5000},
+			},
+			"FullJitterMax": {
+				jitter:   FullJitter,
+				ratio:    1,
+				expected: []time.Duration{1000, 2000, 4000, 8000, 10000},
+			},
+			"EqualJitterMin": {
+				jitter:   EqualJitter,
+				ratio:    0,
+				expected: []time.Duration{500, 1000, 2000, 4000, 5000},
+			},
+			"EqualJitterMax": {
+				jitter:   EqualJitter,
+				ratio:    1,
+				expected: []time.Duration{1000, 2000, 4000, 8000, 10000},
+			},
+			"DecorrelatedJitterMin": {
+				jitter:   DecorrelatedJitter,
+				ratio:    0,
+				expected: []time.Duration{1000, 1000, 1000, 1000, 1000},
+			},
+			"DecorrelatedJitterMax": {
+				jitter:   DecorrelatedJitter,
+				ratio:    1,
+				expected: []time.Duration{3000, 9000, 10000, 10000, 10000},
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				f := &ExponentialBackoffRetryerFactory{
+					WaitBase: time.Second,
+					WaitMax:  10 * time.Second,
+					Jitter:   tt.jitter,
+					Rand:     &ratioRand{ratio: tt.ratio},
+				}
+				clock := clocktest.New(time.Now())
+				r := f.New(&clockPauser{clock: clock})
+
+				for i, expected := range tt.expected {
+					expected *= time.Millisecond
+					if wait := waitOnFail(t, clock, r, 0); wait != expected {
+						t.Errorf("Expected wait of %d-th retry: %v, actual: %v", i, expected, wait)
+					}
+				}
+			})
+		}
+	})
+	t.Run("DefaultRand", func(t *testing.T) {
+		f := &ExponentialBackoffRetryerFactory{
+			WaitBase: time.Second,
+			Jitter:   FullJitter,
+		}
+		clock := clocktest.New(time.Now())
+		r := f.New(&clockPauser{clock: clock})
+		for i := 0; i < 4; i++ {
+			if wait := waitOnFail(t, clock, r, 0); wait < 0 || wait > time.Second<<i {
+				t.Errorf("Wait of %d-th retry %v is out of range", i, wait)
+			}
+		}
+	})
+	t.Run("DefaultRandSeed", func(t *testing.T) {
+		r1, r2 := newLockedRand(), newLockedRand()
+		var same int
+		for i := 0; i < 8; i++ {
+			if r1.Int63n(1<<62) == r2.Int63n(1<<62) {
+				same++
+			}
+		}
+		if same == 8 {
+			t.Error("Random sources must be seeded differently")
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					DefaultRand.Int63n(100)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+	t.Run("MaxElapsedTime", func(t *testing.T) {
+		f := &ExponentialBackoffRetryerFactory{
+			WaitBase:       time.Second,
+			RetryMax:       10,
+			MaxElapsedTime: 5 * time.Second,
+		}
+		clock := clocktest.New(time.Now())
+		r := f.New(&clockPauser{clock: clock})
+
+		// Last wait is shortened to fit in MaxElapsedTime.
+		for i, expected := range []time.Duration{time.Second, 2 * time.Second, 2 * time.Second} {
+			if wait := waitOnFail(t, clock, r, 0); wait != expected {
+				t.Errorf("Expected wait of %d-th retry: %v, actual: %v", i, expected, wait)
+			}
+		}
+		if cont := r.OnFail(context.TODO(), 0, errDummy); cont {
+			t.Error("Unexpected retry after reaching MaxElapsedTime")
+		}
+
+		r.OnSuccess(0)
+		if wait := waitOnFail(t, clock, r, 0); wait != time.Second {
+			t.Errorf("Elapsed time must be reset on success, waited: %v", wait)
+		}
+	})
 	t.Run("CancelDuringWait", func(t *testing.T) {
 		f := &ExponentialBackoffRetryerFactory{
 			WaitBase: time.Second,
@@ -255,3 +418,45 @@ type dummyPauser struct {
 func (uc *dummyPauser) Pause() {
 	uc.chPause <- struct{}{}
 }
+
+type clockPauser struct {
+	UploadContext
+	clock Clock
+}
+
+func (p *clockPauser) Clock() Clock {
+	return p.clock
+}
+
+// ratioRand returns the value at the ratio of the range.
+type ratioRand struct {
+	ratio float64
+}
+
+func (r *ratioRand) Int63n(n int64) int64 {
+	return int64(float64(n-1) * r.ratio)
+}
+
+// waitOnFail calls OnFail and returns the duration waited on the clock.
+func waitOnFail(t *testing.T, clock *clocktest.Clock, r Retryer, id int64) time.Duration {
+	t.Helper()
+	done := make(chan bool, 1)
+	go func() {
+		done <- r.OnFail(context.TODO(), id, errDummy)
+	}()
+	var wait time.Duration
+	for {
+		select {
+		case cont := <-done:
+			if !cont {
+				t.Fatal("Unexpected failure")
+			}
+			return wait
+		case <-time.After(time.Millisecond):
+		}
+		if d, ok := clock.Next(); ok {
+			clock.Advance(d)
+			wait += d
+		}
+	}
+}
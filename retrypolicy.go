@@ -0,0 +1,241 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrorClass represents the class of the error to select the retry policy.
+type ErrorClass int
+
+// Error classes.
+const (
+	// ErrorClassOther is the class of the errors not classified to the others.
+	ErrorClassOther ErrorClass = iota
+	// ErrorClassThrottle is the class of the throttle responses.
+	ErrorClassThrottle
+	// ErrorClassNetwork is the class of the transient network errors like
+	// connection reset, timeout and name resolution failure.
+	// ErrCallTimeout and ErrStalled are also classified to it.
+	ErrorClassNetwork
+	// ErrorClassServer is the class of the 5xx server errors.
+	ErrorClassServer
+	// ErrorClassChecksum is the class of the checksum mismatch of the
+	// uploaded data.
+	ErrorClassChecksum
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassOther:
+		return "other"
+	case ErrorClassThrottle:
+		return "throttle"
+	case ErrorClassNetwork:
+		return "network"
+	case ErrorClassServer:
+		return "server"
+	case ErrorClassChecksum:
+		return "checksum"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	matchThrottle = MatchAny(
+		MatchErrorCode(
+			"SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded",
+			"RequestThrottled", "RequestThrottledException", "TooManyRequestsException",
+		),
+		MatchHTTPStatus(http.StatusTooManyRequests),
+	)
+	matchChecksum = MatchErrorCode(
+		"BadDigest", "InvalidDigest", "XAmzContentSHA256Mismatch",
+	)
+	matchNetwork = MatchAny(
+		MatchNetError(),
+		MatchDNSError(),
+		MatchTimeout(),
+		MatchConnectionReset(),
+		MatchUnexpectedEOF(),
+		MatchError(ErrCallTimeout, ErrStalled),
+	)
+)
+
+// DefaultClassifyError classifies the error by the API error code,
+// the HTTP status code and the type of the network error.
+func DefaultClassifyError(err error) ErrorClass {
+	return classifyError(nil, err)
+}
+
+// classifyError classifies the error like DefaultClassifyError
+// respecting the throttle and the HTTP status code determined
+// by the ErrorClassifier.
+func classifyError(ec ErrorClassifier, err error) ErrorClass {
+	if ec != nil {
+		if _, ok := ec.IsThrottle(err); ok {
+			return ErrorClassThrottle
+		}
+	}
+	switch {
+	case matchThrottle(err):
+		return ErrorClassThrottle
+	case matchChecksum(err):
+		return ErrorClassChecksum
+	}
+	if status, ok := HTTPStatus(ec, err); ok && status >= 500 {
+		return ErrorClassServer
+	}
+	if matchNetwork(err) {
+		return ErrorClassNetwork
+	}
+	return ErrorClassOther
+}
+
+// errorClassProvider is implemented by Retryer classifying the errors
+// by its own rule.
+type errorClassProvider interface {
+	classifyError(err error) (ErrorClass, bool)
+}
+
+// PolicyRetryerFactory creates Retryer applying the retry policy
+// selected by the class of the error.
+// Each policy is a RetryerFactory having its own backoff curve and
+// attempt limit, and it tracks only the failures of the class.
+//
+// OperationRetryMax limits the total number of retries of each
+// operation on the whole object like CreateMultipartUpload,
+// CompleteMultipartUpload and single part upload regardless of the class,
+// and PartRetryMax limits the total number of retries of each part.
+// Operations are distinguished by the API name of CallInfo.
+// Zero means no additional limit.
+//
+// Note that the throttle wait requested by the ErrorClassifier is waited
+// before calling the policy.
+type PolicyRetryerFactory struct {
+	// Policies maps the error class to the RetryerFactory.
+	Policies map[ErrorClass]RetryerFactory
+	// Default is used for the error classes without the policy.
+	// If nil, DefaultRetryer is used.
+	Default RetryerFactory
+	// Classify classifies the error.
+	// If nil, DefaultClassifyError is used.
+	Classify func(error) ErrorClass
+
+	OperationRetryMax int
+	PartRetryMax      int
+}
+
+// New creates PolicyRetryer.
+func (f PolicyRetryerFactory) New(p Pauser) Retryer {
+	if f.Default == nil {
+		f.Default = DefaultRetryer
+	}
+	if f.Classify == nil {
+		f.Classify = DefaultClassifyError
+	}
+	return &policyRetryer{
+		factory:  f,
+		pauser:   p,
+		retryers: make(map[ErrorClass]Retryer),
+		fails:    make(map[retryKey]int),
+	}
+}
+
+type policyRetryer struct {
+	factory PolicyRetryerFactory
+	pauser  Pauser
+
+	mu       sync.Mutex
+	retryers map[ErrorClass]Retryer
+	fails    map[retryKey]int
+}
+
+// retryKey identifies the part or the operation counting the failures.
+type retryKey struct {
+	api string
+	id  int64
+}
+
+// retryer returns the Retryer of the class.
+// Classes without the policy share the Retryer of the default policy.
+func (r *policyRetryer) retryer(class ErrorClass) Retryer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.factory.Policies[class]
+	if !ok {
+		class = ErrorClassOther
+		if f, ok = r.factory.Policies[class]; !ok {
+			f = r.factory.Default
+		}
+	}
+	rt, ok := r.retryers[class]
+	if !ok {
+		rt = f.New(r.pauser)
+		r.retryers[class] = rt
+	}
+	return rt
+}
+
+func (r *policyRetryer) OnFail(ctx context.Context, id int64, err error) bool {
+	limit := r.factory.PartRetryMax
+	key := retryKey{id: id}
+	if id <= 0 {
+		limit = r.factory.OperationRetryMax
+		if ci, ok := CallInfoFromContext(ctx); ok {
+			key.api = ci.API
+		}
+	}
+	r.mu.Lock()
+	r.fails[key]++
+	exceeded := limit > 0 && r.fails[key] > limit
+	r.mu.Unlock()
+	if exceeded {
+		return false
+	}
+	return r.retryer(r.factory.Classify(err)).OnFail(ctx, id, err)
+}
+
+func (r *policyRetryer) classifyError(err error) (ErrorClass, bool) {
+	return r.factory.Classify(err), true
+}
+
+func (r *policyRetryer) OnSuccess(id int64) {
+	r.mu.Lock()
+	for key := range r.fails {
+		if key.id == id {
+			delete(r.fails, key)
+		}
+	}
+	retryers := make([]Retryer, 0, len(r.retryers))
+	for _, rt := range r.retryers {
+		retryers = append(retryers, rt)
+	}
+	r.mu.Unlock()
+	for _, rt := range retryers {
+		rt.OnSuccess(id)
+	}
+}
+
+func (r *policyRetryer) OnThrottle(id int64, wait time.Duration) {
+	if to, ok := r.retryer(ErrorClassThrottle).(ThrottleObserver); ok {
+		to.OnThrottle(id, wait)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+var _ ThrottleObserver = &policyRetryer{}
+
+func TestDefaultClassifyError(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected ErrorClass
+	}{
+		"SlowDown":      {codeStatusError{"SlowDown", 503}, ErrorClassThrottle},
+		"Throttling":    {codeError("Throttling"), ErrorClassThrottle},
+		"TooMany":       {statusCodeError(429), ErrorClassThrottle},
+		"BadDigest":     {codeStatusError{"BadDigest", 400}, ErrorClassChecksum},
+		"SHA256":        {codeError("XAmzContentSHA256Mismatch"), ErrorClassChecksum},
+		"InternalError": {codeStatusError{"InternalError", 500}, ErrorClassServer},
+		"Unavailable":   {httpStatusCodeError(503), ErrorClassServer},
+		"DNS":           {&net.DNSError{}, ErrorClassNetwork},
+		"Reset":         {errors.New("read: connection reset by peer"), ErrorClassNetwork},
+		"EOF":           {io.ErrUnexpectedEOF, ErrorClassNetwork},
+		"Timeout":       {context.DeadlineExceeded, ErrorClassNetwork},
+		"NotFound":      {codeStatusError{"NoSuchKey", 404}, ErrorClassOther},
+		"Unknown":       {errDummy, ErrorClassOther},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			if class := DefaultClassifyError(tt.err); class != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, class)
+			}
+		})
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	for c, expected := range map[ErrorClass]string{
+		ErrorClassOther:    "other",
+		ErrorClassThrottle: "throttle",
+		ErrorClassNetwork:  "network",
+		ErrorClassServer:   "server",
+		ErrorClassChecksum: "checksum",
+		ErrorClass(-1):     "unknown",
+	} {
+		if s := c.String(); s != expected {
+			t.Errorf("Expected %s, got %s", expected, s)
+		}
+	}
+}
+
+func TestPolicyRetryerFactory(t *testing.T) {
+	errThrottle := codeError("SlowDown")
+	errNetwork := &net.DNSError{}
+	errServer := statusCodeError(500)
+
+	t.Run("PerClass", func(t *testing.T) {
+		throttle := &limitRetryerFactory{max: 3}
+		network := &limitRetryerFactory{max: 1}
+		def := &limitRetryerFactory{max: 2}
+		r := PolicyRetryerFactory{
+			Policies: map[ErrorClass]RetryerFactory{
+				ErrorClassThrottle: throttle,
+				ErrorClassNetwork:  network,
+			},
+			Default: def,
+		}.New(nil)
+
+		for i, tt := range []struct {
+			err      error
+			expected bool
+		}{
+			{errThrottle, true},
+			{errNetwork, true},
+			{errThrottle, true},
+			{errThrottle, true},
+			{errThrottle, false},
+			{errNetwork, false},
+			{errServer, true},
+			{errDummy, true},
+			{errDummy, false},
+		} {
+			if retry := r.OnFail(context.TODO(), 1, tt.err); retry != tt.expected {
+				t.Fatalf("%d: Expected retry for '%v': %v, got: %v", i, tt.err, tt.expected, retry)
+			}
+		}
+
+		// Success resets the failures of all classes.
+		r.OnSuccess(1)
+		for _, err := range []error{errThrottle, errNetwork, errServer} {
+			if !r.OnFail(context.TODO(), 1, err) {
+				t.Errorf("Retry for '%v' must be allowed after success", err)
+			}
+		}
+		if throttle.created != 1 || network.created != 1 || def.created != 1 {
+			t.Errorf("Retryer must be created once for each policy: %d, %d, %d",
+				throttle.created, network.created, def.created)
+		}
+	})
+	t.Run("OtherPolicy", func(t *testing.T) {
+		other := &limitRetryerFactory{max: 1}
+		r := PolicyRetryerFactory{
+			Policies: map[ErrorClass]RetryerFactory{ErrorClassOther: other},
+			Default:  &limitRetryerFactory{max: 10},
+		}.New(nil)
+		if !r.OnFail(context.TODO(), 1, errServer) || r.OnFail(context.TODO(), 1, errDummy) {
+			t.Error("Classes without the policy must share ErrorClassOther policy")
+		}
+	})
+	t.Run("Classify", func(t *testing.T) {
+		checksum := &limitRetryerFactory{max: 1}
+		r := PolicyRetryerFactory{
+			Policies: map[ErrorClass]RetryerFactory{ErrorClassChecksum: checksum},
+			Default:  &NoRetryerFactory{},
+			Classify: func(err error) ErrorClass {
+				if err == errDummy {
+					return ErrorClassChecksum
+				}
+				return ErrorClassOther
+			},
+		}.New(nil)
+		if !r.OnFail(context.TODO(), 1, errDummy) || r.OnFail(context.TODO(), 1, errServer) {
+			t.Error("Custom Classify must be used")
+		}
+	})
+	t.Run("Limits", func(t *testing.T) {
+		r := PolicyRetryerFactory{
+			Default:           &limitRetryerFactory{max: 100},
+			OperationRetryMax: 1,
+			PartRetryMax:      2,
+		}.New(nil)
+		for i, tt := range []struct {
+			api      string
+			id       int64
+			expected bool
+		}{
+			{"CreateMultipartUpload", 0, true},
+			{"CreateMultipartUpload", 0, false},
+			{"HeadObject", 0, true},
+			{"CompleteMultipartUpload", -1, true},
+			{"CompleteMultipartUpload", -1, false},
+			{"UploadPart", 1, true},
+			{"UploadPart", 1, true},
+			{"UploadPart", 1, false},
+			{"UploadPart", 2, true},
+		} {
+			ctx := context.WithValue(context.TODO(), callInfoKey{}, CallInfo{API: tt.api, ID: tt.id})
+			if retry := r.OnFail(ctx, tt.id, errThrottle); retry != tt.expected {
+				t.Fatalf("%d: Expected retry of %s %d: %v, got: %v", i, tt.api, tt.id, tt.expected, retry)
+			}
+		}
+		r.OnSuccess(0)
+		ctx := context.WithValue(context.TODO(), callInfoKey{}, CallInfo{API: "CreateMultipartUpload"})
+		if !r.OnFail(ctx, 0, errThrottle) {
+			t.Error("Failures must be reset on success")
+		}
+	})
+	t.Run("ThrottleObserver", func(t *testing.T) {
+		r := PolicyRetryerFactory{
+			Policies: map[ErrorClass]RetryerFactory{
+				ErrorClassThrottle: &throttleObserverRetryerFactory{},
+			},
+		}.New(nil)
+		r.(ThrottleObserver).OnThrottle(3, time.Second)
+		rt := r.(*policyRetryer).retryer(ErrorClassThrottle).(*throttleObserverRetryer)
+		if len(rt.throttles) != 1 || rt.throttles[0] != (throttle{3, time.Second}) {
+			t.Errorf("OnThrottle must be forwarded to the throttle policy, got: %v", rt.throttles)
+		}
+	})
+	t.Run("WithRetry", func(t *testing.T) {
+		r := PolicyRetryerFactory{
+			Policies: map[ErrorClass]RetryerFactory{
+				ErrorClassServer: &limitRetryerFactory{max: 2},
+			},
+			Default: &NoRetryerFactory{},
+		}.New(nil)
+		var n int
+		err := withRetry(context.TODO(), DefaultClock, -1, r, DefaultErrorClassifier, func() error {
+			n++
+			if n < 3 {
+				return errServer
+			}
+			return errDummy
+		})
+		var re *RetryError
+		if !errors.As(err, &re) || !errors.Is(err, errDummy) {
+			t.Errorf("Expected RetryError of '%v', got: '%v'", errDummy, err)
+		}
+		if n != 3 {
+			t.Errorf("Expected 3 calls, got %d", n)
+		}
+	})
+}
+
+type limitRetryerFactory struct {
+	max     int
+	created int
+}
+
+func (f *limitRetryerFactory) New(Pauser) Retryer {
+	f.created++
+	return &limitRetryer{max: f.max, fails: make(map[int64]int)}
+}
+
+type limitRetryer struct {
+	max   int
+	fails map[int64]int
+}
+
+func (r *limitRetryer) OnFail(_ context.Context, id int64, _ error) bool {
+	r.fails[id]++
+	return r.fails[id] <= r.max
+}
+
+func (r *limitRetryer) OnSuccess(id int64) {
+	delete(r.fails, id)
+}
+
+type throttleObserverRetryerFactory struct{}
+
+func (throttleObserverRetryerFactory) New(Pauser) Retryer {
+	return &throttleObserverRetryer{}
+}
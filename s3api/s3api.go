@@ -18,6 +18,8 @@ package s3api
 import (
 	"context"
 	"io"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -32,10 +34,12 @@ type UploadAPI interface {
 
 // CreateMultipartUploadInput represents input of CreateMultipartUpload API.
 type CreateMultipartUploadInput struct {
-	Bucket      *string
-	Key         *string
-	ACL         *string
-	ContentType *string
+	Bucket       *string
+	Key          *string
+	ACL          *string
+	ContentType  *string
+	Metadata     map[string]string
+	StorageClass *string
 }
 
 // CreateMultipartUploadOutput represents output of CreateMultipartUpload API.
@@ -128,6 +132,101 @@ type GetObjectOutput struct {
 	VersionID     *string
 }
 
+// HeadAPI interface.
+type HeadAPI interface {
+	HeadObject(ctx context.Context, input *HeadObjectInput) (*HeadObjectOutput, error)
+}
+
+// ChecksumModeEnabled is the value of ChecksumMode to retrieve checksums.
+const ChecksumModeEnabled = "ENABLED"
+
+// HeadObjectInput represents input of HeadObject API.
+type HeadObjectInput struct {
+	Bucket       *string
+	Key          *string
+	VersionID    *string
+	ChecksumMode *string
+}
+
+// HeadObjectOutput represents output of HeadObject API.
+// Checksums are provided only if ChecksumMode is enabled.
+type HeadObjectOutput struct {
+	ContentLength  *int64
+	ContentType    *string
+	ETag           *string
+	LastModified   *time.Time
+	VersionID      *string
+	Metadata       map[string]string
+	PartsCount     *int64
+	StorageClass   *string
+	ChecksumCRC32  *string
+	ChecksumCRC32C *string
+	ChecksumSHA1   *string
+	ChecksumSHA256 *string
+	Restore        *string
+}
+
+// CopyAPI interface.
+type CopyAPI interface {
+	CopyObject(ctx context.Context, input *CopyObjectInput) (*CopyObjectOutput, error)
+	UploadPartCopy(ctx context.Context, input *UploadPartCopyInput) (*UploadPartCopyOutput, error)
+}
+
+// CopyObjectInput represents input of CopyObject API.
+type CopyObjectInput struct {
+	Bucket          *string
+	Key             *string
+	ACL             *string
+	SourceBucket    *string
+	SourceKey       *string
+	SourceVersionID *string
+	SourceIfMatch   *string
+	StorageClass    *string
+}
+
+// CopyObjectOutput represents output of CopyObject API.
+type CopyObjectOutput struct {
+	VersionID *string
+	ETag      *string
+}
+
+// UploadPartCopyInput represents input of UploadPartCopy API.
+type UploadPartCopyInput struct {
+	Bucket          *string
+	Key             *string
+	PartNumber      *int64
+	UploadID        *string
+	SourceBucket    *string
+	SourceKey       *string
+	SourceVersionID *string
+	SourceIfMatch   *string
+	SourceRange     *string
+}
+
+// UploadPartCopyOutput represents output of UploadPartCopy API.
+type UploadPartCopyOutput struct {
+	ETag *string
+}
+
+// CopySource returns URL-encoded copy source string in bucket/key?versionId=version format.
+func CopySource(bucket, key, versionID *string) string {
+	var s strings.Builder
+	if bucket != nil {
+		s.WriteString(url.PathEscape(*bucket))
+	}
+	if key != nil {
+		for _, p := range strings.Split(*key, "/") {
+			s.WriteByte('/')
+			s.WriteString(url.PathEscape(p))
+		}
+	}
+	if versionID != nil {
+		s.WriteString("?versionId=")
+		s.WriteString(url.QueryEscape(*versionID))
+	}
+	return s.String()
+}
+
 // DeleteAPI interface.
 type DeleteAPI interface {
 	DeleteObject(ctx context.Context, input *DeleteObjectInput) (*DeleteObjectOutput, error)
@@ -151,6 +250,7 @@ type ListAPI interface {
 }
 
 // ListObjectsV2Input represents input of List API.
+// Zero MaxKeys lists up to the server default number of the keys.
 type ListObjectsV2Input struct {
 	Bucket            *string
 	ContinuationToken *string
@@ -182,6 +282,8 @@ type UpDownloadAPI interface {
 // S3API is the interface that groups all S3 APIs.
 type S3API interface {
 	UpDownloadAPI
+	HeadAPI
+	CopyAPI
 	DeleteAPI
 	ListAPI
 }
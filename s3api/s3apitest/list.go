@@ -0,0 +1,113 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3apitest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func (s *suite) testListPagination(t *testing.T) {
+	const num = 5
+	prefix := s.key("list/")
+	etags := make(map[string]string)
+	for i := 0; i < num; i++ {
+		key := fmt.Sprintf("%sobj%d", *prefix, i)
+		b := data(i * 10)
+		s.put(t, &key, b)
+		defer s.delete(t, &key)
+		etags[key] = singleETag(b)
+	}
+
+	list := func(t *testing.T, prefix *string, maxKeys int) ([]s3api.Object, int) {
+		t.Helper()
+		var objs []s3api.Object
+		var pages int
+		var token *string
+		for {
+			out, err := s.api.ListObjectsV2(context.TODO(), &s3api.ListObjectsV2Input{
+				Bucket:            &s.cfg.Bucket,
+				Prefix:            prefix,
+				MaxKeys:           maxKeys,
+				ContinuationToken: token,
+			})
+			if err != nil {
+				t.Fatalf("ListObjectsV2: %v", err)
+			}
+			pages++
+			if out.KeyCount != len(out.Contents) {
+				t.Errorf("ListObjectsV2: KeyCount %d differs from the number of the contents %d", out.KeyCount, len(out.Contents))
+			}
+			if maxKeys > 0 && len(out.Contents) > maxKeys {
+				t.Errorf("ListObjectsV2: expected up to %d keys, got %d", maxKeys, len(out.Contents))
+			}
+			objs = append(objs, out.Contents...)
+			if out.NextContinuationToken == nil {
+				return objs, pages
+			}
+			if pages > num {
+				t.Fatal("ListObjectsV2: too many pages")
+			}
+			token = out.NextContinuationToken
+		}
+	}
+
+	testCases := map[string]struct {
+		maxKeys int
+		pages   int
+	}{
+		"Default":    {maxKeys: 0, pages: 1},
+		"Paginated":  {maxKeys: 2, pages: 3},
+		"SingleKey":  {maxKeys: 1, pages: num},
+		"ExactlyAll": {maxKeys: num, pages: 1},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			objs, pages := list(t, prefix, tt.maxKeys)
+			if pages != tt.pages {
+				t.Errorf("ListObjectsV2: expected %d pages, got %d", tt.pages, pages)
+			}
+			if len(objs) != num {
+				t.Fatalf("ListObjectsV2: expected %d keys, got %d", num, len(objs))
+			}
+			for i, obj := range objs {
+				key := fmt.Sprintf("%sobj%d", *prefix, i)
+				if obj.Key == nil || *obj.Key != key {
+					t.Errorf("ListObjectsV2: expected key %s at %d, got %v", key, i, stringValue(obj.Key))
+					continue
+				}
+				if obj.Size != int64(i*10) {
+					t.Errorf("ListObjectsV2: expected size %d, got %d", i*10, obj.Size)
+				}
+				if obj.ETag == nil || *obj.ETag != etags[key] {
+					t.Errorf("ListObjectsV2: expected ETag %s, got %v", etags[key], stringValue(obj.ETag))
+				}
+				if obj.LastModified == nil {
+					t.Error("ListObjectsV2: LastModified must be set")
+				}
+			}
+		})
+	}
+	t.Run("NoMatch", func(t *testing.T) {
+		objs, _ := list(t, s.key("list-no-match/"), 0)
+		if len(objs) != 0 {
+			t.Errorf("ListObjectsV2: expected no keys, got %d", len(objs))
+		}
+	})
+}
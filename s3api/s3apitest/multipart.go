@@ -0,0 +1,249 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3apitest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"testing"
+
+	"github.com/at-wat/s3iot/internal/etag"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func (s *suite) create(t *testing.T, key *string) *string {
+	t.Helper()
+	out, err := s.api.CreateMultipartUpload(context.TODO(), &s3api.CreateMultipartUploadInput{
+		Bucket:      &s.cfg.Bucket,
+		Key:         key,
+		ContentType: str("application/octet-stream"),
+	})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	if out.UploadID == nil || *out.UploadID == "" {
+		t.Fatal("CreateMultipartUpload: UploadID must be set")
+	}
+	return out.UploadID
+}
+
+func (s *suite) uploadPart(t *testing.T, key, uploadID *string, num int64, b []byte) *string {
+	t.Helper()
+	out, err := s.api.UploadPart(context.TODO(), &s3api.UploadPartInput{
+		Bucket:     &s.cfg.Bucket,
+		Key:        key,
+		UploadID:   uploadID,
+		PartNumber: &num,
+		Body:       bytes.NewReader(b),
+	})
+	if err != nil {
+		t.Fatalf("UploadPart: %v", err)
+	}
+	if expected := singleETag(b); out.ETag == nil || *out.ETag != expected {
+		t.Errorf("UploadPart: expected ETag %s, got %v", expected, stringValue(out.ETag))
+	}
+	return out.ETag
+}
+
+func (s *suite) abort(t *testing.T, key, uploadID *string) {
+	t.Helper()
+	if _, err := s.api.AbortMultipartUpload(context.TODO(), &s3api.AbortMultipartUploadInput{
+		Bucket:   &s.cfg.Bucket,
+		Key:      key,
+		UploadID: uploadID,
+	}); err != nil {
+		t.Errorf("AbortMultipartUpload: %v", err)
+	}
+}
+
+func (s *suite) complete(key, uploadID *string, parts ...*s3api.CompletedPart) (*s3api.CompleteMultipartUploadOutput, error) {
+	return s.api.CompleteMultipartUpload(context.TODO(), &s3api.CompleteMultipartUploadInput{
+		Bucket:         &s.cfg.Bucket,
+		Key:            key,
+		UploadID:       uploadID,
+		CompletedParts: parts,
+	})
+}
+
+func (s *suite) multipartData() ([]byte, [][]byte, string) {
+	b := data(int(s.cfg.PartSize) + 100)
+	parts := [][]byte{b[:s.cfg.PartSize], b[s.cfg.PartSize:]}
+	var sums [][]byte
+	for _, p := range parts {
+		sum := md5.Sum(p)
+		sums = append(sums, sum[:])
+	}
+	return b, parts, etag.Multipart(sums)
+}
+
+func (s *suite) testMultipart(t *testing.T) {
+	key := s.key("dir/multipart key")
+	b, parts, expected := s.multipartData()
+
+	uploadID := s.create(t, key)
+	// Parts can be uploaded in any order.
+	etag2 := s.uploadPart(t, key, uploadID, 2, parts[1])
+	etag1 := s.uploadPart(t, key, uploadID, 1, parts[0])
+
+	out, err := s.complete(key, uploadID,
+		&s3api.CompletedPart{ETag: etag1, PartNumber: int64Ptr(1)},
+		&s3api.CompletedPart{ETag: etag2, PartNumber: int64Ptr(2)},
+	)
+	if err != nil {
+		s.abort(t, key, uploadID)
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	defer s.delete(t, key)
+	if out.ETag == nil || *out.ETag != expected {
+		t.Errorf("CompleteMultipartUpload: expected ETag %s, got %v", expected, stringValue(out.ETag))
+	}
+	s.checkLocation(t, "CompleteMultipartUpload", out.Location, *key)
+
+	gout, body := s.get(t, key, nil)
+	if !bytes.Equal(b, body) {
+		t.Error("GetObject: body differs")
+	}
+	if gout.ETag == nil || *gout.ETag != expected {
+		t.Errorf("GetObject: expected ETag %s, got %v", expected, stringValue(gout.ETag))
+	}
+	if gout.ContentType == nil || *gout.ContentType != "application/octet-stream" {
+		t.Errorf("GetObject: unexpected ContentType %v", stringValue(gout.ContentType))
+	}
+
+	rn := fmt.Sprintf("bytes=%d-", s.cfg.PartSize-10)
+	gout, body = s.get(t, key, &rn)
+	if !bytes.Equal(b[s.cfg.PartSize-10:], body) {
+		t.Error("GetObject: body of the range across the parts differs")
+	}
+	if expected := fmt.Sprintf("bytes %d-%d/%d", s.cfg.PartSize-10, len(b)-1, len(b)); gout.ContentRange == nil || *gout.ContentRange != expected {
+		t.Errorf("GetObject: expected ContentRange %s, got %v", expected, stringValue(gout.ContentRange))
+	}
+}
+
+func (s *suite) testMultipartOrder(t *testing.T) {
+	key := s.key("multipart-order")
+	_, parts, _ := s.multipartData()
+
+	uploadID := s.create(t, key)
+	defer s.abort(t, key, uploadID)
+	etag1 := s.uploadPart(t, key, uploadID, 1, parts[0])
+	etag2 := s.uploadPart(t, key, uploadID, 2, parts[1])
+
+	testCases := map[string]struct {
+		parts []*s3api.CompletedPart
+		code  string
+	}{
+		"Descending": {
+			parts: []*s3api.CompletedPart{
+				{ETag: etag2, PartNumber: int64Ptr(2)},
+				{ETag: etag1, PartNumber: int64Ptr(1)},
+			},
+			code: ErrCodeInvalidPartOrder,
+		},
+		"WrongETag": {
+			parts: []*s3api.CompletedPart{
+				{ETag: etag2, PartNumber: int64Ptr(1)},
+				{ETag: etag2, PartNumber: int64Ptr(2)},
+			},
+			code: ErrCodeInvalidPart,
+		},
+		"MissingPart": {
+			parts: []*s3api.CompletedPart{
+				{ETag: etag1, PartNumber: int64Ptr(1)},
+				{ETag: etag2, PartNumber: int64Ptr(3)},
+			},
+			code: ErrCodeInvalidPart,
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			_, err := s.complete(key, uploadID, tt.parts...)
+			s.expectErrorCode(t, "CompleteMultipartUpload", err, tt.code)
+		})
+	}
+}
+
+func (s *suite) testAbortMultipart(t *testing.T) {
+	key := s.key("multipart-abort")
+	_, parts, _ := s.multipartData()
+
+	uploadID := s.create(t, key)
+	etag1 := s.uploadPart(t, key, uploadID, 1, parts[0])
+	s.abort(t, key, uploadID)
+
+	_, err := s.api.UploadPart(context.TODO(), &s3api.UploadPartInput{
+		Bucket:     &s.cfg.Bucket,
+		Key:        key,
+		UploadID:   uploadID,
+		PartNumber: int64Ptr(2),
+		Body:       bytes.NewReader(parts[1]),
+	})
+	s.expectErrorCode(t, "UploadPart", err, ErrCodeNoSuchUpload)
+
+	_, err = s.complete(key, uploadID, &s3api.CompletedPart{ETag: etag1, PartNumber: int64Ptr(1)})
+	s.expectErrorCode(t, "CompleteMultipartUpload", err, ErrCodeNoSuchUpload)
+
+	_, err = s.api.GetObject(context.TODO(), &s3api.GetObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    key,
+	})
+	s.expectErrorCode(t, "GetObject", err, ErrCodeNoSuchKey)
+}
+
+func (s *suite) testUploadPartCopy(t *testing.T) {
+	src, dst := s.key("copy-part/src"), s.key("copy-part/dst")
+	b, _, expected := s.multipartData()
+	s.put(t, src, b)
+	defer s.delete(t, src)
+
+	uploadID := s.create(t, dst)
+	var completed []*s3api.CompletedPart
+	for i, rn := range []string{
+		fmt.Sprintf("bytes=0-%d", s.cfg.PartSize-1),
+		fmt.Sprintf("bytes=%d-%d", s.cfg.PartSize, len(b)-1),
+	} {
+		rn := rn
+		num := int64(i + 1)
+		out, err := s.api.UploadPartCopy(context.TODO(), &s3api.UploadPartCopyInput{
+			Bucket:       &s.cfg.Bucket,
+			Key:          dst,
+			UploadID:     uploadID,
+			PartNumber:   &num,
+			SourceBucket: &s.cfg.Bucket,
+			SourceKey:    src,
+			SourceRange:  &rn,
+		})
+		if err != nil {
+			s.abort(t, dst, uploadID)
+			t.Fatalf("UploadPartCopy: %v", err)
+		}
+		completed = append(completed, &s3api.CompletedPart{ETag: out.ETag, PartNumber: &num})
+	}
+	out, err := s.complete(dst, uploadID, completed...)
+	if err != nil {
+		s.abort(t, dst, uploadID)
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	defer s.delete(t, dst)
+	if out.ETag == nil || *out.ETag != expected {
+		t.Errorf("CompleteMultipartUpload: expected ETag %s, got %v", expected, stringValue(out.ETag))
+	}
+	if _, body := s.get(t, dst, nil); !bytes.Equal(b, body) {
+		t.Error("GetObject: copied body differs")
+	}
+}
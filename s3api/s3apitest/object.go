@@ -0,0 +1,241 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3apitest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func (s *suite) testPutGet(t *testing.T) {
+	key := s.key("dir/put+get key")
+	b := data(1000)
+	expected := singleETag(b)
+
+	out := s.put(t, key, b)
+	defer s.delete(t, key)
+	if out.ETag == nil || *out.ETag != expected {
+		t.Errorf("PutObject: expected ETag %s, got %v", expected, stringValue(out.ETag))
+	}
+	s.checkLocation(t, "PutObject", out.Location, *key)
+
+	gout, body := s.get(t, key, nil)
+	if !bytes.Equal(b, body) {
+		t.Error("GetObject: body differs")
+	}
+	if gout.ETag == nil || *gout.ETag != expected {
+		t.Errorf("GetObject: expected ETag %s, got %v", expected, stringValue(gout.ETag))
+	}
+	if gout.ContentLength == nil || *gout.ContentLength != int64(len(b)) {
+		t.Errorf("GetObject: expected ContentLength %d, got %v", len(b), int64Value(gout.ContentLength))
+	}
+	if gout.ContentType == nil || *gout.ContentType != "application/octet-stream" {
+		t.Errorf("GetObject: unexpected ContentType %v", stringValue(gout.ContentType))
+	}
+	if gout.LastModified == nil {
+		t.Error("GetObject: LastModified must be set")
+	}
+
+	hout, err := s.api.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject: %v", err)
+	}
+	if hout.ETag == nil || *hout.ETag != expected {
+		t.Errorf("HeadObject: expected ETag %s, got %v", expected, stringValue(hout.ETag))
+	}
+	if hout.ContentLength == nil || *hout.ContentLength != int64(len(b)) {
+		t.Errorf("HeadObject: expected ContentLength %d, got %v", len(b), int64Value(hout.ContentLength))
+	}
+	if hout.ContentType == nil || *hout.ContentType != "application/octet-stream" {
+		t.Errorf("HeadObject: unexpected ContentType %v", stringValue(hout.ContentType))
+	}
+	if hout.LastModified == nil || !hout.LastModified.Equal(*gout.LastModified) {
+		t.Errorf("HeadObject: LastModified must be same as GetObject")
+	}
+}
+
+func (s *suite) testEmptyObject(t *testing.T) {
+	key := s.key("empty")
+	expected := `"d41d8cd98f00b204e9800998ecf8427e"`
+
+	out := s.put(t, key, nil)
+	defer s.delete(t, key)
+	if out.ETag == nil || *out.ETag != expected {
+		t.Errorf("PutObject: expected ETag %s, got %v", expected, stringValue(out.ETag))
+	}
+
+	gout, body := s.get(t, key, nil)
+	if len(body) != 0 {
+		t.Errorf("GetObject: expected empty body, got %d bytes", len(body))
+	}
+	if gout.ContentLength == nil || *gout.ContentLength != 0 {
+		t.Errorf("GetObject: expected ContentLength 0, got %v", int64Value(gout.ContentLength))
+	}
+
+	hout, err := s.api.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    key,
+	})
+	if err != nil {
+		t.Fatalf("HeadObject: %v", err)
+	}
+	if hout.ContentLength == nil || *hout.ContentLength != 0 {
+		t.Errorf("HeadObject: expected ContentLength 0, got %v", int64Value(hout.ContentLength))
+	}
+	if hout.ETag == nil || *hout.ETag != expected {
+		t.Errorf("HeadObject: expected ETag %s, got %v", expected, stringValue(hout.ETag))
+	}
+}
+
+func (s *suite) testRange(t *testing.T) {
+	key := s.key("range")
+	b := data(100)
+	expected := singleETag(b)
+	s.put(t, key, b)
+	defer s.delete(t, key)
+
+	testCases := map[string]struct {
+		rn           string
+		start, end   int
+		contentRange string
+	}{
+		"FirstBytes": {rn: "bytes=0-9", start: 0, end: 10, contentRange: "bytes 0-9/100"},
+		"OpenEnd":    {rn: "bytes=90-", start: 90, end: 100, contentRange: "bytes 90-99/100"},
+		"Suffix":     {rn: "bytes=-10", start: 90, end: 100, contentRange: "bytes 90-99/100"},
+		"Exceeding":  {rn: "bytes=95-200", start: 95, end: 100, contentRange: "bytes 95-99/100"},
+		"Whole":      {rn: "bytes=0-99", start: 0, end: 100, contentRange: "bytes 0-99/100"},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			out, body := s.get(t, key, &tt.rn)
+			if !bytes.Equal(b[tt.start:tt.end], body) {
+				t.Errorf("Expected body of %d-%d, got %d bytes", tt.start, tt.end, len(body))
+			}
+			if out.ContentRange == nil || *out.ContentRange != tt.contentRange {
+				t.Errorf("Expected ContentRange %s, got %v", tt.contentRange, stringValue(out.ContentRange))
+			}
+			if out.ContentLength == nil || *out.ContentLength != int64(tt.end-tt.start) {
+				t.Errorf("Expected ContentLength %d, got %v", tt.end-tt.start, int64Value(out.ContentLength))
+			}
+			if out.ETag == nil || *out.ETag != expected {
+				t.Errorf("Expected ETag %s, got %v", expected, stringValue(out.ETag))
+			}
+		})
+	}
+	t.Run("Unsatisfiable", func(t *testing.T) {
+		_, err := s.api.GetObject(context.TODO(), &s3api.GetObjectInput{
+			Bucket: &s.cfg.Bucket,
+			Key:    key,
+			Range:  str("bytes=100-"),
+		})
+		s.expectErrorCode(t, "GetObject", err, ErrCodeInvalidRange)
+	})
+}
+
+func (s *suite) testCopy(t *testing.T) {
+	src, dst := s.key("copy/src"), s.key("copy/dst key")
+	b := data(1000)
+	expected := singleETag(b)
+	s.put(t, src, b)
+	defer s.delete(t, src)
+
+	_, err := s.api.CopyObject(context.TODO(), &s3api.CopyObjectInput{
+		Bucket:        &s.cfg.Bucket,
+		Key:           dst,
+		SourceBucket:  &s.cfg.Bucket,
+		SourceKey:     src,
+		SourceIfMatch: str(singleETag(nil)),
+	})
+	s.expectErrorCode(t, "CopyObject", err, ErrCodePreconditionFailed)
+
+	out, err := s.api.CopyObject(context.TODO(), &s3api.CopyObjectInput{
+		Bucket:        &s.cfg.Bucket,
+		Key:           dst,
+		SourceBucket:  &s.cfg.Bucket,
+		SourceKey:     src,
+		SourceIfMatch: &expected,
+	})
+	if err != nil {
+		t.Fatalf("CopyObject: %v", err)
+	}
+	defer s.delete(t, dst)
+	if out.ETag == nil || *out.ETag != expected {
+		t.Errorf("CopyObject: expected ETag %s, got %v", expected, stringValue(out.ETag))
+	}
+	if _, body := s.get(t, dst, nil); !bytes.Equal(b, body) {
+		t.Error("GetObject: copied body differs")
+	}
+}
+
+func (s *suite) testNotFound(t *testing.T) {
+	key := s.key("not-found")
+
+	_, err := s.api.GetObject(context.TODO(), &s3api.GetObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    key,
+	})
+	s.expectErrorCode(t, "GetObject", err, ErrCodeNoSuchKey)
+
+	// Response of HEAD request has no body to contain the error code.
+	_, err = s.api.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    key,
+	})
+	s.expectErrorCode(t, "HeadObject", err, ErrCodeNotFound, ErrCodeNoSuchKey)
+
+	_, err = s.api.CopyObject(context.TODO(), &s3api.CopyObjectInput{
+		Bucket:       &s.cfg.Bucket,
+		Key:          s.key("not-found-dst"),
+		SourceBucket: &s.cfg.Bucket,
+		SourceKey:    key,
+	})
+	s.expectErrorCode(t, "CopyObject", err, ErrCodeNoSuchKey)
+}
+
+func (s *suite) testDelete(t *testing.T) {
+	key := s.key("delete")
+	s.put(t, key, data(10))
+
+	s.delete(t, key)
+	_, err := s.api.GetObject(context.TODO(), &s3api.GetObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    key,
+	})
+	s.expectErrorCode(t, "GetObject", err, ErrCodeNoSuchKey)
+
+	// Deleting non-existent object succeeds.
+	s.delete(t, key)
+}
+
+func stringValue(s *string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+func int64Value(i *int64) interface{} {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
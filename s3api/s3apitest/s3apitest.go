@@ -0,0 +1,218 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3apitest provides the conformance test suite of s3api.S3API
+// implementations.
+//
+// The suite checks the behaviors which the uploader, downloader and copier
+// depend on: ranges, ETags, multipart upload ordering, error codes, empty
+// objects and listing pagination.
+// Run it against each adapter connected to the real S3 or S3 compatible server:
+//
+//	func TestConformance(t *testing.T) {
+//		srv := httptest.NewServer(s3server.New(s3fake.New()))
+//		defer srv.Close()
+//		s3apitest.Run(t, NewAPI(newClient(srv.URL)), s3apitest.Config{Bucket: "bucket"})
+//	}
+package s3apitest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/at-wat/s3iot/internal/etag"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// Default conformance test parameters.
+const (
+	DefaultPrefix   = "s3apitest/"
+	DefaultPartSize = 5 * 1024 * 1024
+)
+
+// S3 error codes checked by the conformance test.
+const (
+	ErrCodeNoSuchKey          = "NoSuchKey"
+	ErrCodeNotFound           = "NotFound"
+	ErrCodeNoSuchUpload       = "NoSuchUpload"
+	ErrCodeInvalidRange       = "InvalidRange"
+	ErrCodeInvalidPart        = "InvalidPart"
+	ErrCodeInvalidPartOrder   = "InvalidPartOrder"
+	ErrCodePreconditionFailed = "PreconditionFailed"
+)
+
+// Config configures the conformance test.
+type Config struct {
+	// Bucket is the existing bucket to run the test.
+	Bucket string
+	// Prefix is prepended to the object keys created by the test.
+	// Objects under the prefix must not exist before the test.
+	Prefix string
+	// PartSize is the size of the non-last parts of the multipart uploads.
+	// It must be equal or larger than the minimum part size of the server.
+	PartSize int64
+	// ErrorCode extracts S3 error code from the error returned by the API.
+	// By default, ErrorCode() or Code() method of the error is used.
+	ErrorCode func(error) string
+}
+
+// Run runs the conformance test suite against the API.
+func Run(t *testing.T, api s3api.S3API, cfg Config) {
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultPrefix
+	}
+	if cfg.PartSize == 0 {
+		cfg.PartSize = DefaultPartSize
+	}
+	if cfg.ErrorCode == nil {
+		cfg.ErrorCode = ErrorCode
+	}
+	s := &suite{api: api, cfg: cfg}
+
+	t.Run("PutGet", s.testPutGet)
+	t.Run("EmptyObject", s.testEmptyObject)
+	t.Run("Range", s.testRange)
+	t.Run("Multipart", s.testMultipart)
+	t.Run("MultipartOrder", s.testMultipartOrder)
+	t.Run("AbortMultipart", s.testAbortMultipart)
+	t.Run("UploadPartCopy", s.testUploadPartCopy)
+	t.Run("Copy", s.testCopy)
+	t.Run("NotFound", s.testNotFound)
+	t.Run("Delete", s.testDelete)
+	t.Run("ListPagination", s.testListPagination)
+}
+
+// ErrorCode returns S3 error code of the error
+// provided by ErrorCode() or Code() method.
+func ErrorCode(err error) string {
+	var ec interface{ ErrorCode() string }
+	if errors.As(err, &ec) {
+		return ec.ErrorCode()
+	}
+	var c interface{ Code() string }
+	if errors.As(err, &c) {
+		return c.Code()
+	}
+	return ""
+}
+
+type suite struct {
+	api s3api.S3API
+	cfg Config
+}
+
+func (s *suite) key(name string) *string {
+	k := s.cfg.Prefix + name
+	return &k
+}
+
+func (s *suite) put(t *testing.T, key *string, data []byte) *s3api.PutObjectOutput {
+	t.Helper()
+	out, err := s.api.PutObject(context.TODO(), &s3api.PutObjectInput{
+		Bucket:      &s.cfg.Bucket,
+		Key:         key,
+		Body:        bytes.NewReader(data),
+		ContentType: str("application/octet-stream"),
+	})
+	if err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	return out
+}
+
+func (s *suite) get(t *testing.T, key *string, rn *string) (*s3api.GetObjectOutput, []byte) {
+	t.Helper()
+	out, err := s.api.GetObject(context.TODO(), &s3api.GetObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    key,
+		Range:  rn,
+	})
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	defer out.Body.Close()
+	b, err := io.ReadAll(out.Body)
+	if err != nil {
+		t.Fatalf("GetObject: reading body: %v", err)
+	}
+	return out, b
+}
+
+func (s *suite) delete(t *testing.T, key *string) {
+	t.Helper()
+	if _, err := s.api.DeleteObject(context.TODO(), &s3api.DeleteObjectInput{
+		Bucket: &s.cfg.Bucket,
+		Key:    key,
+	}); err != nil {
+		t.Errorf("DeleteObject: %v", err)
+	}
+}
+
+func (s *suite) expectErrorCode(t *testing.T, op string, err error, codes ...string) {
+	t.Helper()
+	if err == nil {
+		t.Errorf("%s: expected %s error, got nil", op, strings.Join(codes, " or "))
+		return
+	}
+	code := s.cfg.ErrorCode(err)
+	for _, c := range codes {
+		if code == c {
+			return
+		}
+	}
+	t.Errorf("%s: expected %s error, got %q: %v", op, strings.Join(codes, " or "), code, err)
+}
+
+func (s *suite) checkLocation(t *testing.T, op string, location *string, key string) {
+	t.Helper()
+	if location == nil {
+		t.Errorf("%s: Location must be set", op)
+		return
+	}
+	u, err := url.Parse(*location)
+	if err != nil {
+		t.Errorf("%s: Location must be valid URL: %v", op, err)
+		return
+	}
+	if !strings.HasSuffix(u.Path, "/"+key) {
+		t.Errorf("%s: Location must point the key %q, got %q", op, key, *location)
+	}
+}
+
+func data(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
+
+func singleETag(b []byte) string {
+	sum := md5.Sum(b)
+	return etag.Single(sum[:])
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3apitest_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/at-wat/s3iot/localfs"
+	"github.com/at-wat/s3iot/s3api/s3apitest"
+	"github.com/at-wat/s3iot/s3fake"
+)
+
+func TestRun(t *testing.T) {
+	cfg := s3apitest.Config{
+		Bucket:   "bucket",
+		PartSize: 1024,
+	}
+	t.Run("LocalFS", func(t *testing.T) {
+		s3apitest.Run(t, localfs.New(t.TempDir()), cfg)
+	})
+	t.Run("Fake", func(t *testing.T) {
+		api := s3fake.New()
+		api.MinPartSize = cfg.PartSize
+		s3apitest.Run(t, api, cfg)
+	})
+}
+
+type codeError string
+
+func (e codeError) Error() string { return string(e) }
+func (e codeError) Code() string  { return string(e) }
+
+type errorCodeError string
+
+func (e errorCodeError) Error() string     { return string(e) }
+func (e errorCodeError) ErrorCode() string { return string(e) }
+
+func TestErrorCode(t *testing.T) {
+	testCases := map[string]struct {
+		err  error
+		code string
+	}{
+		"ErrorCode": {err: errorCodeError("NoSuchKey"), code: "NoSuchKey"},
+		"Code":      {err: codeError("NoSuchKey"), code: "NoSuchKey"},
+		"Wrapped":   {err: &wrapError{codeError("NoSuchUpload")}, code: "NoSuchUpload"},
+		"NoCode":    {err: errors.New("error"), code: ""},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			if code := s3apitest.ErrorCode(tt.err); code != tt.code {
+				t.Errorf("Expected code: %q, got: %q", tt.code, code)
+			}
+		})
+	}
+}
+
+type wrapError struct {
+	err error
+}
+
+func (e *wrapError) Error() string { return "wrapped: " + e.err.Error() }
+func (e *wrapError) Unwrap() error { return e.err }
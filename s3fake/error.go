@@ -0,0 +1,79 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fake
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/at-wat/s3iot/internal/s3err"
+)
+
+// Error represents S3 compatible API error.
+type Error = s3err.Error
+
+// Errors returned by the API.
+// They have the same error codes and HTTP status codes as Amazon S3.
+var (
+	ErrNoSuchBucket       = s3err.ErrNoSuchBucket
+	ErrNoSuchKey          = s3err.ErrNoSuchKey
+	ErrNoSuchUpload       = s3err.ErrNoSuchUpload
+	ErrInvalidArgument    = s3err.ErrInvalidArgument
+	ErrInvalidPart        = s3err.ErrInvalidPart
+	ErrInvalidPartOrder   = s3err.ErrInvalidPartOrder
+	ErrEntityTooSmall     = &Error{Code: "EntityTooSmall", Message: "your proposed upload is smaller than the minimum allowed object size", StatusCode: 400}
+	ErrInvalidRange       = s3err.ErrInvalidRange
+	ErrPreconditionFailed = s3err.ErrPreconditionFailed
+)
+
+// Errors to be injected as faults.
+var (
+	ErrSlowDown           = &Error{Code: "SlowDown", Message: "please reduce your request rate", StatusCode: 503}
+	ErrInternalError      = &Error{Code: "InternalError", Message: "we encountered an internal error, please try again", StatusCode: 500}
+	ErrServiceUnavailable = &Error{Code: "ServiceUnavailable", Message: "service is unable to handle request", StatusCode: 503}
+	ErrRequestTimeout     = &Error{Code: "RequestTimeout", Message: "your socket connection to the server was not read from or written to within the timeout period", StatusCode: 400}
+)
+
+// DefaultThrottleWait is a default wait duration on throttle.
+var DefaultThrottleWait = 5 * time.Second
+
+// ErrorClassifier classifies errors returned by the fake API
+// in the same manner as the errors of aws-sdk-go.
+type ErrorClassifier struct {
+	ThrottleWait time.Duration
+}
+
+// IsRetryable implements s3iot.ErrorClassifier.
+func (ErrorClassifier) IsRetryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode >= 500 || e.Code == ErrRequestTimeout.Code
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// IsThrottle implements s3iot.ErrorClassifier.
+func (c ErrorClassifier) IsThrottle(err error) (time.Duration, bool) {
+	var e *Error
+	if !errors.As(err, &e) || e.Code != ErrSlowDown.Code {
+		return 0, false
+	}
+	wait := c.ThrottleWait
+	if wait == 0 {
+		wait = DefaultThrottleWait
+	}
+	return wait, true
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fake
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestErrorClassifier(t *testing.T) {
+	testCases := map[string]struct {
+		err       error
+		retryable bool
+		throttle  bool
+	}{
+		"SlowDown":       {err: ErrSlowDown, retryable: true, throttle: true},
+		"InternalError":  {err: ErrInternalError, retryable: true},
+		"Unavailable":    {err: ErrServiceUnavailable, retryable: true},
+		"RequestTimeout": {err: ErrRequestTimeout, retryable: true},
+		"Wrapped":        {err: fmt.Errorf("wrapped: %w", ErrSlowDown), retryable: true, throttle: true},
+		"UnexpectedEOF":  {err: io.ErrUnexpectedEOF, retryable: true},
+		"NoSuchKey":      {err: ErrNoSuchKey},
+		"InvalidPart":    {err: ErrInvalidPart},
+		"UnknownError":   {err: errors.New("unknown")},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			c := &ErrorClassifier{}
+			if r := c.IsRetryable(tt.err); r != tt.retryable {
+				t.Errorf("Expected retryable: %v, got: %v", tt.retryable, r)
+			}
+			wait, throttle := c.IsThrottle(tt.err)
+			if throttle != tt.throttle {
+				t.Errorf("Expected throttle: %v, got: %v", tt.throttle, throttle)
+			}
+			if throttle && wait != DefaultThrottleWait {
+				t.Errorf("Expected wait: %v, got: %v", DefaultThrottleWait, wait)
+			}
+		})
+	}
+	t.Run("ThrottleWait", func(t *testing.T) {
+		c := &ErrorClassifier{ThrottleWait: time.Millisecond}
+		if wait, _ := c.IsThrottle(ErrSlowDown); wait != time.Millisecond {
+			t.Errorf("Expected wait: %v, got: %v", time.Millisecond, wait)
+		}
+	})
+}
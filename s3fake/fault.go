@@ -0,0 +1,178 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fake
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Op represents the API operation.
+type Op string
+
+// Operations of s3api.S3API.
+const (
+	OpPutObject               Op = "PutObject"
+	OpGetObject               Op = "GetObject"
+	OpHeadObject              Op = "HeadObject"
+	OpDeleteObject            Op = "DeleteObject"
+	OpCopyObject              Op = "CopyObject"
+	OpCreateMultipartUpload   Op = "CreateMultipartUpload"
+	OpUploadPart              Op = "UploadPart"
+	OpUploadPartCopy          Op = "UploadPartCopy"
+	OpCompleteMultipartUpload Op = "CompleteMultipartUpload"
+	OpAbortMultipartUpload    Op = "AbortMultipartUpload"
+	OpListObjectsV2           Op = "ListObjectsV2"
+)
+
+// Fault describes a failure injected to the API calls.
+// Zero value of the condition fields matches any call.
+type Fault struct {
+	// Op is the target operation.
+	Op Op
+	// Key is the target object key.
+	Key string
+	// PartNumber is the target part number of UploadPart and UploadPartCopy.
+	PartNumber int64
+	// Range is the target Range of GetObject like "bytes=0-99".
+	Range string
+	// Call is the target n-th (1-origin) call of the operation.
+	Call int
+	// Times is the number of times the fault is triggered.
+	// Zero means unlimited.
+	Times int
+
+	// Latency delays the call.
+	Latency time.Duration
+	// Err is returned by the call.
+	Err error
+	// TruncateBody truncates GetObject body to the given length.
+	// Reading the truncated body returns io.ErrUnexpectedEOF.
+	TruncateBody *int64
+	// ContentRange overrides Content-Range of GetObject output.
+	ContentRange *string
+	// ChangeETag changes the object ETag before processing GetObject
+	// as if the object is overwritten by another client.
+	ChangeETag bool
+}
+
+type faultState struct {
+	Fault
+	triggered int
+}
+
+type call struct {
+	op         Op
+	key        string
+	partNumber int64
+	rng        string
+}
+
+// Inject adds faults.
+// If multiple faults match the call, the first one is triggered.
+func (a *API) Inject(faults ...Fault) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, f := range faults {
+		a.faults = append(a.faults, &faultState{Fault: f})
+	}
+}
+
+// ClearFaults removes all injected faults.
+func (a *API) ClearFaults() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.faults = nil
+}
+
+// Calls returns the number of the calls of the operation.
+func (a *API) Calls(op Op) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls[op]
+}
+
+// begin counts the call and returns the triggered fault.
+// Latency of the fault is applied and Err of the fault is returned.
+func (a *API) begin(ctx context.Context, c call) (*Fault, error) {
+	a.mu.Lock()
+	a.calls[c.op]++
+	n := a.calls[c.op]
+	var fault *Fault
+	for _, f := range a.faults {
+		if f.match(c, n) {
+			f.triggered++
+			fault = &f.Fault
+			break
+		}
+	}
+	a.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if fault == nil {
+		return nil, nil
+	}
+	if fault.Latency > 0 {
+		timer := time.NewTimer(fault.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	if fault.Err != nil {
+		return nil, fault.Err
+	}
+	return fault, nil
+}
+
+func (f *faultState) match(c call, n int) bool {
+	switch {
+	case f.Times > 0 && f.triggered >= f.Times:
+		return false
+	case f.Op != "" && f.Op != c.op:
+		return false
+	case f.Key != "" && f.Key != c.key:
+		return false
+	case f.PartNumber != 0 && f.PartNumber != c.partNumber:
+		return false
+	case f.Range != "" && f.Range != c.rng:
+		return false
+	case f.Call != 0 && f.Call != n:
+		return false
+	}
+	return true
+}
+
+type truncatedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *truncatedReader) Read(b []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(b)) > r.n {
+		b = b[:r.n]
+	}
+	n, err := r.r.Read(b)
+	r.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,297 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/internal/iotest"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func TestFault(t *testing.T) {
+	bucket, key := "bucket", "key"
+	data := []byte("0123456789")
+
+	t.Run("Match", func(t *testing.T) {
+		testCases := map[string]struct {
+			fault  Fault
+			errors []error
+		}{
+			"Any": {
+				fault:  Fault{Err: ErrInternalError},
+				errors: []error{ErrInternalError, ErrInternalError, ErrInternalError},
+			},
+			"Times": {
+				fault:  Fault{Err: ErrInternalError, Times: 2},
+				errors: []error{ErrInternalError, ErrInternalError, nil},
+			},
+			"Call": {
+				fault:  Fault{Op: OpHeadObject, Err: ErrSlowDown, Call: 2},
+				errors: []error{nil, ErrSlowDown, nil},
+			},
+			"OtherOp": {
+				fault:  Fault{Op: OpGetObject, Err: ErrSlowDown},
+				errors: []error{nil, nil, nil},
+			},
+			"OtherKey": {
+				fault:  Fault{Key: "other", Err: ErrSlowDown},
+				errors: []error{nil, nil, nil},
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				a := New()
+				putObject(t, a, bucket, key, data)
+				a.Inject(tt.fault)
+				for i, expected := range tt.errors {
+					if _, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+						Bucket: &bucket,
+						Key:    &key,
+					}); err != expected {
+						t.Errorf("Call %d: expected error: '%v', got: '%v'", i+1, expected, err)
+					}
+				}
+				if n := a.Calls(OpHeadObject); n != len(tt.errors) {
+					t.Errorf("Expected %d calls, got %d", len(tt.errors), n)
+				}
+				a.ClearFaults()
+				if _, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{
+					Bucket: &bucket,
+					Key:    &key,
+				}); err != nil {
+					t.Errorf("Faults must be cleared: %v", err)
+				}
+			})
+		}
+	})
+	t.Run("PartNumber", func(t *testing.T) {
+		a := New()
+		a.Inject(Fault{Op: OpUploadPart, PartNumber: 2, Err: ErrSlowDown})
+		out, err := a.CreateMultipartUpload(context.TODO(), &s3api.CreateMultipartUploadInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n, expected := range map[int64]error{1: nil, 2: ErrSlowDown, 3: nil} {
+			n := n
+			if _, err := a.UploadPart(context.TODO(), &s3api.UploadPartInput{
+				Body:       bytes.NewReader(data),
+				Bucket:     &bucket,
+				Key:        &key,
+				PartNumber: &n,
+				UploadID:   out.UploadID,
+			}); err != expected {
+				t.Errorf("Part %d: expected error: '%v', got: '%v'", n, expected, err)
+			}
+		}
+	})
+	t.Run("Latency", func(t *testing.T) {
+		a := New()
+		putObject(t, a, bucket, key, data)
+		a.Inject(Fault{Op: OpGetObject, Latency: 50 * time.Millisecond})
+
+		ts := time.Now()
+		if _, _, err := getObject(t, a, bucket, key, nil); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(ts); d < 50*time.Millisecond {
+			t.Errorf("Call must be delayed, took %v", d)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := a.GetObject(ctx, &s3api.GetObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+		}); err != context.DeadlineExceeded {
+			t.Errorf("Expected error: '%v', got: '%v'", context.DeadlineExceeded, err)
+		}
+	})
+	t.Run("Body", func(t *testing.T) {
+		a := New()
+		putObject(t, a, bucket, key, data)
+		a.Inject(
+			Fault{Range: "bytes=0-4", TruncateBody: int64Ptr(3), Times: 1},
+			Fault{Range: "bytes=5-9", ContentRange: strPtr("bytes 4-8/10"), Times: 1},
+		)
+
+		_, b, err := getObject(t, a, bucket, key, strPtr("bytes=0-4"))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("Expected error: '%v', got: '%v'", io.ErrUnexpectedEOF, err)
+		}
+		if string(b) != "012" {
+			t.Errorf("Expected truncated body: 012, got: %s", b)
+		}
+		out, _, err := getObject(t, a, bucket, key, strPtr("bytes=5-9"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *out.ContentRange != "bytes 4-8/10" {
+			t.Errorf("Expected ContentRange: bytes 4-8/10, got: %s", *out.ContentRange)
+		}
+	})
+	t.Run("ChangeETag", func(t *testing.T) {
+		a := New()
+		orig := putObject(t, a, bucket, key, data)
+		a.Inject(Fault{Op: OpGetObject, ChangeETag: true, Times: 1})
+
+		out, b, err := getObject(t, a, bucket, key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *out.ETag == *orig.ETag {
+			t.Error("ETag must be changed")
+		}
+		if !bytes.Equal(data, b) {
+			t.Errorf("Body must not be changed: %s", b)
+		}
+	})
+}
+
+func TestFault_UpDownloader(t *testing.T) {
+	bucket, key := "bucket", "key"
+	data := make([]byte, 250)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	retryer := &s3iot.ExponentialBackoffRetryerFactory{
+		WaitBase: time.Millisecond,
+		RetryMax: 2,
+	}
+	classifier := &ErrorClassifier{ThrottleWait: time.Millisecond}
+
+	upload := func(t *testing.T, a *API) (s3iot.UploadContext, error) {
+		t.Helper()
+		u := &s3iot.Uploader{}
+		s3iot.WithAPI(a).ApplyToUploader(u)
+		s3iot.WithRetryer(retryer).ApplyToUploader(u)
+		s3iot.WithErrorClassifier(classifier).ApplyToUploader(u)
+		s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 100}).ApplyToUploader(u)
+		uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Body:   bytes.NewReader(data),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		case <-uc.Done():
+		}
+		_, err = uc.Result()
+		return uc, err
+	}
+	download := func(t *testing.T, a *API) (s3iot.DownloadContext, []byte, error) {
+		t.Helper()
+		d := &s3iot.Downloader{}
+		s3iot.WithAPI(a).ApplyToDownloader(d)
+		s3iot.WithRetryer(retryer).ApplyToDownloader(d)
+		s3iot.WithErrorClassifier(classifier).ApplyToDownloader(d)
+		s3iot.WithDownloadSlicer(&s3iot.DefaultDownloadSlicerFactory{PartSize: 100}).ApplyToDownloader(d)
+		buf := make(iotest.BufferAt, len(data))
+		dc, err := d.Download(context.TODO(), buf, &s3iot.DownloadInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		case <-dc.Done():
+		}
+		_, err = dc.Result()
+		return dc, buf, err
+	}
+
+	t.Run("UploadThrottled", func(t *testing.T) {
+		a := New()
+		a.Inject(Fault{Op: OpUploadPart, PartNumber: 2, Err: ErrSlowDown, Times: 2})
+		uc, err := upload(t, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := a.Object(bucket, key); !bytes.Equal(data, b) {
+			t.Error("Uploaded data differs")
+		}
+		status, _ := uc.Status()
+		if status.NumRetries != 2 {
+			t.Errorf("Expected NumRetries: 2, got: %d", status.NumRetries)
+		}
+		if n := a.Calls(OpUploadPart); n != 5 {
+			t.Errorf("Expected UploadPart calls: 5, got: %d", n)
+		}
+	})
+	t.Run("UploadRetryExceeded", func(t *testing.T) {
+		a := New()
+		a.Inject(Fault{Op: OpUploadPart, PartNumber: 3, Err: ErrInternalError})
+		_, err := upload(t, a)
+		var retryErr *s3iot.RetryError
+		if !errors.As(err, &retryErr) || !errors.Is(err, ErrInternalError) {
+			t.Fatalf("Expected RetryError of '%v', got: '%v'", ErrInternalError, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if ids := a.Uploads(); len(ids) != 0 {
+			t.Errorf("Upload must be aborted: %v", ids)
+		}
+	})
+	t.Run("UploadNonRetryable", func(t *testing.T) {
+		a := New()
+		a.Inject(Fault{Op: OpCompleteMultipartUpload, Err: ErrInvalidPart})
+		if _, err := upload(t, a); !errors.Is(err, ErrInvalidPart) {
+			t.Fatalf("Expected error: '%v', got: '%v'", ErrInvalidPart, err)
+		}
+		if n := a.Calls(OpCompleteMultipartUpload); n != 1 {
+			t.Errorf("Non-retryable error must not be retried, called %d times", n)
+		}
+	})
+	t.Run("DownloadWrongContentRange", func(t *testing.T) {
+		a := New()
+		putObject(t, a, bucket, key, data)
+		a.Inject(Fault{Range: "bytes=100-199", ContentRange: strPtr("bytes 0-99/250"), Times: 1})
+		dc, b, err := download(t, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, b) {
+			t.Error("Downloaded data differs")
+		}
+		status, _ := dc.Status()
+		if status.NumRetries != 1 {
+			t.Errorf("Expected NumRetries: 1, got: %d", status.NumRetries)
+		}
+	})
+	t.Run("DownloadChangedETag", func(t *testing.T) {
+		a := New()
+		putObject(t, a, bucket, key, data)
+		a.Inject(Fault{Op: OpGetObject, Call: 2, ChangeETag: true})
+		if _, _, err := download(t, a); !errors.Is(err, s3iot.ErrChangedDuringDownload) {
+			t.Fatalf("Expected error: '%v', got: '%v'", s3iot.ErrChangedDuringDownload, err)
+		}
+	})
+}
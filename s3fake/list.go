@@ -0,0 +1,87 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fake
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// DefaultMaxKeys is the number of the keys listed at once if MaxKeys is not specified.
+const DefaultMaxKeys = 1000
+
+// ListObjectsV2 implements s3api.ListAPI.
+// Objects are listed in the lexicographical order of the keys.
+func (a *API) ListObjectsV2(ctx context.Context, input *s3api.ListObjectsV2Input) (*s3api.ListObjectsV2Output, error) {
+	if _, err := a.begin(ctx, call{op: OpListObjectsV2}); err != nil {
+		return nil, err
+	}
+	if input.Bucket == nil {
+		return nil, ErrInvalidArgument
+	}
+	maxKeys := input.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	var prefix, after string
+	if input.Prefix != nil {
+		prefix = *input.Prefix
+	}
+	if input.ContinuationToken != nil {
+		b, err := base64.RawURLEncoding.DecodeString(*input.ContinuationToken)
+		if err != nil || len(b) == 0 {
+			return nil, ErrInvalidArgument
+		}
+		after = string(b)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.buckets[*input.Bucket]
+	if !ok {
+		return nil, ErrNoSuchBucket
+	}
+	keys := make([]string, 0, len(b))
+	for key := range b {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	out := &s3api.ListObjectsV2Output{}
+	for i, key := range keys {
+		if i >= maxKeys {
+			token := base64.RawURLEncoding.EncodeToString([]byte(keys[i-1]))
+			out.NextContinuationToken = &token
+			break
+		}
+		key := key
+		obj := b[key]
+		tag, lastModified := obj.etag, obj.lastModified
+		out.Contents = append(out.Contents, s3api.Object{
+			ETag:         &tag,
+			Key:          &key,
+			LastModified: &lastModified,
+			Size:         int64(len(obj.data)),
+		})
+	}
+	out.KeyCount = len(out.Contents)
+	return out, nil
+}
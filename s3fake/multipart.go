@@ -0,0 +1,237 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fake
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"io"
+
+	"github.com/at-wat/s3iot/contentrange"
+	"github.com/at-wat/s3iot/internal/etag"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+const maxPartNumber = 10000
+
+type upload struct {
+	bucket      string
+	key         string
+	contentType *string
+	metadata    map[string]string
+	parts       map[int64]*part
+}
+
+type part struct {
+	data []byte
+	sum  []byte
+}
+
+// CreateMultipartUpload implements s3api.UploadAPI.
+func (a *API) CreateMultipartUpload(ctx context.Context, input *s3api.CreateMultipartUploadInput) (*s3api.CreateMultipartUploadOutput, error) {
+	if _, err := a.begin(ctx, call{op: OpCreateMultipartUpload, key: keyOf(input.Key)}); err != nil {
+		return nil, err
+	}
+	bucket, key, err := validateBucketKey(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	uploadID := randomHex(16)
+
+	a.mu.Lock()
+	a.uploads[uploadID] = &upload{
+		bucket:      bucket,
+		key:         key,
+		contentType: input.ContentType,
+		metadata:    input.Metadata,
+		parts:       make(map[int64]*part),
+	}
+	a.mu.Unlock()
+
+	return &s3api.CreateMultipartUploadOutput{
+		UploadID: &uploadID,
+	}, nil
+}
+
+// UploadPart implements s3api.UploadAPI.
+func (a *API) UploadPart(ctx context.Context, input *s3api.UploadPartInput) (*s3api.UploadPartOutput, error) {
+	if _, err := a.begin(ctx, call{
+		op:         OpUploadPart,
+		key:        keyOf(input.Key),
+		partNumber: partNumberOf(input.PartNumber),
+	}); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := a.putPart(input.Bucket, input.Key, input.UploadID, input.PartNumber, data)
+	if err != nil {
+		return nil, err
+	}
+	return &s3api.UploadPartOutput{
+		ETag: &tag,
+	}, nil
+}
+
+// UploadPartCopy implements s3api.CopyAPI.
+func (a *API) UploadPartCopy(ctx context.Context, input *s3api.UploadPartCopyInput) (*s3api.UploadPartCopyOutput, error) {
+	if _, err := a.begin(ctx, call{
+		op:         OpUploadPartCopy,
+		key:        keyOf(input.Key),
+		partNumber: partNumberOf(input.PartNumber),
+	}); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	src, err := a.getSource(input.SourceBucket, input.SourceKey, input.SourceIfMatch)
+	a.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	data := src.data
+	if input.SourceRange != nil {
+		r, err := contentrange.Parse(*input.SourceRange)
+		if err != nil {
+			return nil, ErrInvalidRange
+		}
+		rn, err := r.Resolve(int64(len(data)))
+		if err != nil {
+			return nil, ErrInvalidRange
+		}
+		data = data[rn.Start : rn.End+1]
+	}
+	tag, err := a.putPart(input.Bucket, input.Key, input.UploadID, input.PartNumber, data)
+	if err != nil {
+		return nil, err
+	}
+	return &s3api.UploadPartCopyOutput{
+		ETag: &tag,
+	}, nil
+}
+
+// AbortMultipartUpload implements s3api.UploadAPI.
+func (a *API) AbortMultipartUpload(ctx context.Context, input *s3api.AbortMultipartUploadInput) (*s3api.AbortMultipartUploadOutput, error) {
+	if _, err := a.begin(ctx, call{op: OpAbortMultipartUpload, key: keyOf(input.Key)}); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.getUpload(input.Bucket, input.Key, input.UploadID); err != nil {
+		return nil, err
+	}
+	delete(a.uploads, *input.UploadID)
+	return &s3api.AbortMultipartUploadOutput{}, nil
+}
+
+// CompleteMultipartUpload implements s3api.UploadAPI.
+// Parts must be listed in ascending order and their ETags must match the uploaded parts.
+func (a *API) CompleteMultipartUpload(ctx context.Context, input *s3api.CompleteMultipartUploadInput) (*s3api.CompleteMultipartUploadOutput, error) {
+	if _, err := a.begin(ctx, call{op: OpCompleteMultipartUpload, key: keyOf(input.Key)}); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u, err := a.getUpload(input.Bucket, input.Key, input.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if len(input.CompletedParts) == 0 {
+		return nil, ErrInvalidPart
+	}
+
+	var last int64
+	for _, cp := range input.CompletedParts {
+		if cp.PartNumber == nil || cp.ETag == nil {
+			return nil, ErrInvalidPart
+		}
+		if *cp.PartNumber <= last {
+			return nil, ErrInvalidPartOrder
+		}
+		last = *cp.PartNumber
+	}
+
+	var buf bytes.Buffer
+	sums := make([][]byte, 0, len(input.CompletedParts))
+	for i, cp := range input.CompletedParts {
+		p, ok := u.parts[*cp.PartNumber]
+		if !ok || !etag.Equal(*cp.ETag, etag.Single(p.sum)) {
+			return nil, ErrInvalidPart
+		}
+		if i < len(input.CompletedParts)-1 && int64(len(p.data)) < a.MinPartSize {
+			return nil, ErrEntityTooSmall
+		}
+		buf.Write(p.data)
+		sums = append(sums, p.sum)
+	}
+
+	obj := &object{
+		data:        buf.Bytes(),
+		etag:        etag.Multipart(sums),
+		contentType: u.contentType,
+		metadata:    u.metadata,
+		partsCount:  int64(len(sums)),
+	}
+	a.putObject(u.bucket, u.key, obj)
+	delete(a.uploads, *input.UploadID)
+
+	tag := obj.etag
+	location := location(u.bucket, u.key)
+	return &s3api.CompleteMultipartUploadOutput{
+		ETag:     &tag,
+		Location: &location,
+	}, nil
+}
+
+func (a *API) putPart(bucket, key, uploadID *string, partNumber *int64, data []byte) (string, error) {
+	if partNumber == nil || *partNumber < 1 || *partNumber > maxPartNumber {
+		return "", ErrInvalidArgument
+	}
+	sum := md5.Sum(data)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u, err := a.getUpload(bucket, key, uploadID)
+	if err != nil {
+		return "", err
+	}
+	u.parts[*partNumber] = &part{data: data, sum: sum[:]}
+	return etag.Single(sum[:]), nil
+}
+
+// getUpload returns the multipart upload.
+// Caller must hold the lock.
+func (a *API) getUpload(bucket, key, uploadID *string) (*upload, error) {
+	if uploadID == nil {
+		return nil, ErrNoSuchUpload
+	}
+	u, ok := a.uploads[*uploadID]
+	if !ok || bucket == nil || key == nil || u.bucket != *bucket || u.key != *key {
+		return nil, ErrNoSuchUpload
+	}
+	return u, nil
+}
+
+func partNumberOf(partNumber *int64) int64 {
+	if partNumber == nil {
+		return 0
+	}
+	return *partNumber
+}
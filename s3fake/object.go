@@ -0,0 +1,213 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fake
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"io"
+	"net/url"
+
+	"github.com/at-wat/s3iot/contentrange"
+	"github.com/at-wat/s3iot/internal/etag"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// PutObject implements s3api.UploadAPI.
+func (a *API) PutObject(ctx context.Context, input *s3api.PutObjectInput) (*s3api.PutObjectOutput, error) {
+	if _, err := a.begin(ctx, call{op: OpPutObject, key: keyOf(input.Key)}); err != nil {
+		return nil, err
+	}
+	bucket, key, err := validateBucketKey(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	sum := md5.Sum(data)
+	tag := etag.Single(sum[:])
+
+	a.mu.Lock()
+	a.putObject(bucket, key, &object{
+		data:        data,
+		etag:        tag,
+		contentType: input.ContentType,
+	})
+	a.mu.Unlock()
+
+	location := location(bucket, key)
+	return &s3api.PutObjectOutput{
+		ETag:     &tag,
+		Location: &location,
+	}, nil
+}
+
+// GetObject implements s3api.DownloadAPI.
+func (a *API) GetObject(ctx context.Context, input *s3api.GetObjectInput) (*s3api.GetObjectOutput, error) {
+	var rng string
+	if input.Range != nil {
+		rng = *input.Range
+	}
+	fault, err := a.begin(ctx, call{op: OpGetObject, key: keyOf(input.Key), rng: rng})
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	obj, err := a.getObject(input.Bucket, input.Key)
+	if err != nil {
+		a.mu.Unlock()
+		return nil, err
+	}
+	if fault != nil && fault.ChangeETag {
+		obj.etag = `"` + randomHex(16) + `"`
+	}
+	data, tag, lastModified := obj.data, obj.etag, obj.lastModified
+	out := &s3api.GetObjectOutput{
+		ContentType:  obj.contentType,
+		ETag:         &tag,
+		LastModified: &lastModified,
+	}
+	a.mu.Unlock()
+
+	if input.Range != nil {
+		r, err := contentrange.Parse(*input.Range)
+		if err != nil {
+			return nil, ErrInvalidRange
+		}
+		rn, err := r.Resolve(int64(len(data)))
+		if err != nil {
+			return nil, ErrInvalidRange
+		}
+		data = data[rn.Start : rn.End+1]
+		cr := rn.ContentRange()
+		out.ContentRange = &cr
+	}
+	size := int64(len(data))
+	out.ContentLength = &size
+
+	var body io.Reader = bytes.NewReader(data)
+	if fault != nil {
+		if fault.TruncateBody != nil && *fault.TruncateBody < size {
+			body = &truncatedReader{r: body, n: *fault.TruncateBody}
+		}
+		if fault.ContentRange != nil {
+			out.ContentRange = fault.ContentRange
+		}
+	}
+	out.Body = io.NopCloser(body)
+	return out, nil
+}
+
+// HeadObject implements s3api.HeadAPI.
+func (a *API) HeadObject(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+	if _, err := a.begin(ctx, call{op: OpHeadObject, key: keyOf(input.Key)}); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	obj, err := a.getObject(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(obj.data))
+	tag, lastModified := obj.etag, obj.lastModified
+	out := &s3api.HeadObjectOutput{
+		ContentLength: &size,
+		ContentType:   obj.contentType,
+		ETag:          &tag,
+		LastModified:  &lastModified,
+		Metadata:      obj.metadata,
+	}
+	if obj.partsCount > 0 {
+		partsCount := obj.partsCount
+		out.PartsCount = &partsCount
+	}
+	return out, nil
+}
+
+// DeleteObject implements s3api.DeleteAPI.
+// Deleting the object which doesn't exist succeeds as Amazon S3 does.
+func (a *API) DeleteObject(ctx context.Context, input *s3api.DeleteObjectInput) (*s3api.DeleteObjectOutput, error) {
+	if _, err := a.begin(ctx, call{op: OpDeleteObject, key: keyOf(input.Key)}); err != nil {
+		return nil, err
+	}
+	bucket, key, err := validateBucketKey(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.buckets[bucket]
+	if !ok {
+		return nil, ErrNoSuchBucket
+	}
+	delete(b, key)
+	return &s3api.DeleteObjectOutput{}, nil
+}
+
+// CopyObject implements s3api.CopyAPI.
+// Content type and metadata of the source object are copied.
+func (a *API) CopyObject(ctx context.Context, input *s3api.CopyObjectInput) (*s3api.CopyObjectOutput, error) {
+	if _, err := a.begin(ctx, call{op: OpCopyObject, key: keyOf(input.Key)}); err != nil {
+		return nil, err
+	}
+	bucket, key, err := validateBucketKey(input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	src, err := a.getSource(input.SourceBucket, input.SourceKey, input.SourceIfMatch)
+	if err != nil {
+		return nil, err
+	}
+	sum := md5.Sum(src.data)
+	obj := &object{
+		data:        src.data,
+		etag:        etag.Single(sum[:]),
+		contentType: src.contentType,
+		metadata:    src.metadata,
+	}
+	a.putObject(bucket, key, obj)
+	tag := obj.etag
+	return &s3api.CopyObjectOutput{
+		ETag: &tag,
+	}, nil
+}
+
+// getSource returns the copy source object.
+// Caller must hold the lock.
+func (a *API) getSource(bucket, key, ifMatch *string) (*object, error) {
+	obj, err := a.getObject(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if ifMatch != nil && !etag.Equal(*ifMatch, obj.etag) {
+		return nil, ErrPreconditionFailed
+	}
+	return obj, nil
+}
+
+func location(bucket, key string) string {
+	u := &url.URL{Scheme: "https", Host: bucket + ".s3.fake", Path: "/" + key}
+	return u.String()
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3fake provides in-memory s3api.S3API with fault injection for testing.
+//
+// The fake implements the multipart upload semantics of Amazon S3 including
+// part ETag validation and multipart ETag calculation.
+// Failures like errors, throttling, latency, truncated bodies,
+// wrong Content-Range and ETag change during download can be injected
+// per call and per part by Inject.
+package s3fake
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// API is in-memory s3api.S3API implementation.
+// Buckets are created on the first write.
+type API struct {
+	// MinPartSize is the minimum size of the parts except the last part.
+	// Amazon S3 requires 5MiB. Zero disables the check.
+	MinPartSize int64
+
+	mu      sync.Mutex
+	buckets map[string]map[string]*object
+	uploads map[string]*upload
+	faults  []*faultState
+	calls   map[Op]int
+}
+
+// New creates in-memory API.
+func New() *API {
+	return &API{
+		buckets: make(map[string]map[string]*object),
+		uploads: make(map[string]*upload),
+		calls:   make(map[Op]int),
+	}
+}
+
+type object struct {
+	data         []byte
+	etag         string
+	contentType  *string
+	metadata     map[string]string
+	partsCount   int64
+	lastModified time.Time
+}
+
+// Object returns the data of the object.
+func (a *API) Object(bucket, key string) ([]byte, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	obj, ok := a.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{}, obj.data...), true
+}
+
+// Uploads returns the IDs of the multipart uploads in progress.
+func (a *API) Uploads() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ids := make([]string, 0, len(a.uploads))
+	for id := range a.uploads {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// getObject returns the object.
+// Caller must hold the lock.
+func (a *API) getObject(bucket, key *string) (*object, error) {
+	if bucket == nil || key == nil {
+		return nil, ErrInvalidArgument
+	}
+	b, ok := a.buckets[*bucket]
+	if !ok {
+		return nil, ErrNoSuchBucket
+	}
+	obj, ok := b[*key]
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+	return obj, nil
+}
+
+// putObject stores the object.
+// Caller must hold the lock.
+func (a *API) putObject(bucket, key string, obj *object) {
+	b, ok := a.buckets[bucket]
+	if !ok {
+		b = make(map[string]*object)
+		a.buckets[bucket] = b
+	}
+	obj.lastModified = time.Now().UTC().Truncate(time.Second)
+	b[key] = obj
+}
+
+func validateBucketKey(bucket, key *string) (string, string, error) {
+	if bucket == nil || *bucket == "" || key == nil || *key == "" {
+		return "", "", ErrInvalidArgument
+	}
+	return *bucket, *key, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func keyOf(key *string) string {
+	if key == nil {
+		return ""
+	}
+	return *key
+}
+
+var _ s3api.S3API = (*API)(nil)
@@ -0,0 +1,246 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3fake
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func putObject(t *testing.T, a *API, bucket, key string, data []byte) *s3api.PutObjectOutput {
+	t.Helper()
+	out, err := a.PutObject(context.TODO(), &s3api.PutObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func getObject(t *testing.T, a *API, bucket, key string, rng *string) (*s3api.GetObjectOutput, []byte, error) {
+	t.Helper()
+	out, err := a.GetObject(context.TODO(), &s3api.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Range:  rng,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer out.Body.Close()
+	b, err := io.ReadAll(out.Body)
+	return out, b, err
+}
+
+func TestAPI(t *testing.T) {
+	bucket, key := "bucket", "key"
+	data := []byte("0123456789")
+	etag := fmt.Sprintf(`"%x"`, md5.Sum(data))
+
+	t.Run("Object", func(t *testing.T) {
+		a := New()
+		if out := putObject(t, a, bucket, key, data); *out.ETag != etag {
+			t.Errorf("Expected ETag: %s, got: %s", etag, *out.ETag)
+		}
+
+		out, b, err := getObject(t, a, bucket, key, strPtr("bytes=-3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "789" || *out.ContentRange != "bytes 7-9/10" || *out.ContentLength != 3 {
+			t.Errorf("Unexpected output: %s, %+v", b, out)
+		}
+		if _, _, err := getObject(t, a, bucket, key, strPtr("bytes=10-")); err != ErrInvalidRange {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrInvalidRange, err)
+		}
+
+		head, err := a.HeadObject(context.TODO(), &s3api.HeadObjectInput{Bucket: &bucket, Key: &key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *head.ContentLength != 10 || *head.ETag != etag {
+			t.Errorf("Unexpected output: %+v", head)
+		}
+
+		dstKey := "copied"
+		if _, err := a.CopyObject(context.TODO(), &s3api.CopyObjectInput{
+			Bucket:        &bucket,
+			Key:           &dstKey,
+			SourceBucket:  &bucket,
+			SourceKey:     &key,
+			SourceIfMatch: strPtr(`"0123"`),
+		}); err != ErrPreconditionFailed {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrPreconditionFailed, err)
+		}
+		if _, err := a.CopyObject(context.TODO(), &s3api.CopyObjectInput{
+			Bucket:        &bucket,
+			Key:           &dstKey,
+			SourceBucket:  &bucket,
+			SourceKey:     &key,
+			SourceIfMatch: &etag,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if b, ok := a.Object(bucket, dstKey); !ok || !bytes.Equal(data, b) {
+			t.Errorf("Copied object differs: %s", b)
+		}
+
+		if _, err := a.DeleteObject(context.TODO(), &s3api.DeleteObjectInput{Bucket: &bucket, Key: &key}); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := getObject(t, a, bucket, key, nil); err != ErrNoSuchKey {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrNoSuchKey, err)
+		}
+		if _, _, err := getObject(t, a, "unknown", key, nil); err != ErrNoSuchBucket {
+			t.Errorf("Expected error: '%v', got: '%v'", ErrNoSuchBucket, err)
+		}
+	})
+	t.Run("Multipart", func(t *testing.T) {
+		parts := [][]byte{[]byte("part1-"), []byte("part2")}
+		testCases := map[string]struct {
+			minPartSize int64
+			order       []int
+			wrongETag   bool
+			err         error
+		}{
+			"Complete":       {order: []int{0, 1}},
+			"WrongOrder":     {order: []int{1, 0}, err: ErrInvalidPartOrder},
+			"WrongETag":      {order: []int{0, 1}, wrongETag: true, err: ErrInvalidPart},
+			"EntityTooSmall": {order: []int{0, 1}, minPartSize: 7, err: ErrEntityTooSmall},
+			"LastPartSmall":  {order: []int{0, 1}, minPartSize: 6},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				a := New()
+				a.MinPartSize = tt.minPartSize
+				contentType := "text/plain"
+				cout, err := a.CreateMultipartUpload(context.TODO(), &s3api.CreateMultipartUploadInput{
+					Bucket:      &bucket,
+					Key:         &key,
+					ContentType: &contentType,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var completed []*s3api.CompletedPart
+				var sums []byte
+				for i, p := range parts {
+					n := int64(i + 1)
+					out, err := a.UploadPart(context.TODO(), &s3api.UploadPartInput{
+						Body:       bytes.NewReader(p),
+						Bucket:     &bucket,
+						Key:        &key,
+						PartNumber: &n,
+						UploadID:   cout.UploadID,
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+					sum := md5.Sum(p)
+					sums = append(sums, sum[:]...)
+					completed = append(completed, &s3api.CompletedPart{ETag: out.ETag, PartNumber: &n})
+				}
+				if tt.wrongETag {
+					completed[1].ETag = strPtr(`"0123"`)
+				}
+				ordered := make([]*s3api.CompletedPart, 0, len(completed))
+				for _, i := range tt.order {
+					ordered = append(ordered, completed[i])
+				}
+				out, err := a.CompleteMultipartUpload(context.TODO(), &s3api.CompleteMultipartUploadInput{
+					Bucket:         &bucket,
+					Key:            &key,
+					CompletedParts: ordered,
+					UploadID:       cout.UploadID,
+				})
+				if err != tt.err {
+					t.Fatalf("Expected error: '%v', got: '%v'", tt.err, err)
+				}
+				if err != nil {
+					if ids := a.Uploads(); len(ids) != 1 {
+						t.Errorf("Upload must be kept on failure: %v", ids)
+					}
+					return
+				}
+				if expected := fmt.Sprintf(`"%x-2"`, md5.Sum(sums)); *out.ETag != expected {
+					t.Errorf("Expected ETag: %s, got: %s", expected, *out.ETag)
+				}
+				if b, ok := a.Object(bucket, key); !ok || string(b) != "part1-part2" {
+					t.Errorf("Unexpected object: %s", b)
+				}
+				if ids := a.Uploads(); len(ids) != 0 {
+					t.Errorf("Upload must be removed: %v", ids)
+				}
+				if _, err := a.AbortMultipartUpload(context.TODO(), &s3api.AbortMultipartUploadInput{
+					Bucket:   &bucket,
+					Key:      &key,
+					UploadID: cout.UploadID,
+				}); err != ErrNoSuchUpload {
+					t.Errorf("Expected error: '%v', got: '%v'", ErrNoSuchUpload, err)
+				}
+			})
+		}
+	})
+	t.Run("ListObjectsV2", func(t *testing.T) {
+		a := New()
+		for _, k := range []string{"a/b", "a-c", "a/a", "b"} {
+			putObject(t, a, bucket, k, data)
+		}
+		var token *string
+		var pages [][]string
+		for {
+			out, err := a.ListObjectsV2(context.TODO(), &s3api.ListObjectsV2Input{
+				Bucket:            &bucket,
+				ContinuationToken: token,
+				MaxKeys:           2,
+				Prefix:            strPtr("a"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var page []string
+			for _, c := range out.Contents {
+				page = append(page, *c.Key)
+			}
+			pages = append(pages, page)
+			if out.NextContinuationToken == nil {
+				break
+			}
+			token = out.NextContinuationToken
+		}
+		if expected := [][]string{{"a-c", "a/a"}, {"a/b"}}; !reflect.DeepEqual(expected, pages) {
+			t.Errorf("Expected pages: %v, got: %v", expected, pages)
+		}
+	})
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
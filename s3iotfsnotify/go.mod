@@ -0,0 +1,12 @@
+module github.com/at-wat/s3iot/s3iotfsnotify
+
+go 1.18
+
+replace github.com/at-wat/s3iot => ../
+
+require (
+	github.com/at-wat/s3iot v0.0.10
+	github.com/fsnotify/fsnotify v1.9.0
+)
+
+require golang.org/x/sys v0.13.0 // indirect
@@ -0,0 +1,107 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3iotfsnotify provides watcher.Notifier based on fsnotify,
+// which uses inotify on Linux, kqueue on BSD and macOS, and
+// ReadDirectoryChangesW on Windows.
+//
+//	w := watcher.New(uploader, "/var/outbox", "bucket",
+//		watcher.WithNotifier(s3iotfsnotify.New()),
+//	)
+package s3iotfsnotify
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ErrClosed indicates the underlying fsnotify watcher is unexpectedly closed.
+var ErrClosed = errors.New("fsnotify watcher closed")
+
+// Notifier implements watcher.Notifier.
+type Notifier struct{}
+
+// New creates Notifier.
+func New() *Notifier {
+	return &Notifier{}
+}
+
+// Watch implements watcher.Notifier.
+// Subdirectories created during the watch are added to the watch list.
+// Overflow of the event queue is ignored since the missed changes are
+// caught up by the periodic scan of the watcher.
+func (n *Notifier) Watch(ctx context.Context, dir string, fn func(path string)) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	if err := addRecursive(fw, dir); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return ErrClosed
+			}
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if st, err := os.Lstat(ev.Name); err == nil && st.IsDir() {
+					if err := addRecursive(fw, ev.Name); err != nil {
+						return err
+					}
+				}
+			}
+			fn(ev.Name)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return ErrClosed
+			}
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				return err
+			}
+		}
+	}
+}
+
+// addRecursive watches the directory and its subdirectories.
+// Directories removed during the walk are ignored.
+func addRecursive(fw *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p != dir && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := fw.Add(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+}
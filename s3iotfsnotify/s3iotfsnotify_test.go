@@ -0,0 +1,136 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iotfsnotify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/s3fake"
+	"github.com/at-wat/s3iot/watcher"
+)
+
+func TestNotifier(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan string, 64)
+	done := make(chan error)
+	go func() {
+		done <- New().Watch(ctx, dir, func(p string) {
+			events <- p
+		})
+	}()
+
+	// Retry writing until the watch is started.
+	expect := func(t *testing.T, p string, write func()) {
+		t.Helper()
+		tick := time.NewTicker(50 * time.Millisecond)
+		defer tick.Stop()
+		timeout := time.After(2 * time.Second)
+		write()
+		for {
+			select {
+			case ev := <-events:
+				if ev == p {
+					return
+				}
+			case <-tick.C:
+				write()
+			case <-timeout:
+				t.Fatalf("Timeout waiting event of %s", p)
+			}
+		}
+	}
+
+	a := filepath.Join(dir, "a.txt")
+	expect(t, a, func() {
+		if err := os.WriteFile(a, []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	b := filepath.Join(sub, "b.txt")
+	expect(t, b, func() {
+		if err := os.WriteFile(b, []byte("b"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	api := s3fake.New()
+	u := &s3iot.Uploader{}
+	s3iot.WithAPI(api).ApplyToUploader(u)
+
+	uploaded := make(chan string, 1)
+	w := watcher.New(u, dir, "bucket",
+		watcher.WithNotifier(New()),
+		watcher.WithPollInterval(time.Hour),
+		// Non-zero stable duration is needed not to upload and delete
+		// the file between the creation and the write.
+		watcher.WithStableDuration(100*time.Millisecond),
+		watcher.WithDelete(true),
+		watcher.WithOnUpload(func(f watcher.File, key string, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			uploaded <- key
+		}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = w.Run(ctx)
+	}()
+
+	// Wait the watch is started since the Watcher doesn't scan the directory
+	// until the poll interval.
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case key := <-uploaded:
+		if key != "a.txt" {
+			t.Errorf("Expected key a.txt, got %s", key)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout")
+	}
+	if data, ok := api.Object("bucket", "a.txt"); !ok || string(data) != "a" {
+		t.Errorf("Unexpected object %q", data)
+	}
+}
@@ -35,3 +35,8 @@ type upDownloader struct {
 	Uploader
 	Downloader
 }
+
+// Copier interface of s3iot.
+type Copier interface {
+	Copy(ctx context.Context, input *s3iot.CopyInput) (s3iot.CopyContext, error)
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iototel
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+type api struct {
+	api    s3api.S3API
+	tracer trace.Tracer
+}
+
+// NewAPI wraps s3api.S3API to create a span for each API call.
+// The span is named like "S3.PutObject" and has the attributes of
+// the bucket, key, part number, range, bytes and retry attempt.
+// The part and the attempt are taken from s3iot.CallInfo
+// if the call is made by s3iot.Uploader, s3iot.Downloader or s3iot.Copier.
+func NewAPI(a s3api.S3API, opts ...Option) s3api.S3API {
+	return &api{
+		api:    a,
+		tracer: newTracer(opts),
+	}
+}
+
+func (a *api) start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("rpc.system", "aws-api"),
+		attribute.String("rpc.service", "S3"),
+		attribute.String("rpc.method", op),
+	)
+	if ci, ok := s3iot.CallInfoFromContext(ctx); ok {
+		attrs = append(attrs,
+			PartKey.Int64(ci.ID),
+			AttemptKey.Int(ci.Attempt),
+		)
+	}
+	return a.tracer.Start(ctx, "S3."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+func (a *api) CreateMultipartUpload(ctx context.Context, input *s3api.CreateMultipartUploadInput) (*s3api.CreateMultipartUploadOutput, error) {
+	ctx, span := a.start(ctx, "CreateMultipartUpload", objectAttrs(input.Bucket, input.Key)...)
+	out, err := a.api.CreateMultipartUpload(ctx, input)
+	if err == nil && out.UploadID != nil {
+		span.SetAttributes(UploadIDKey.String(*out.UploadID))
+	}
+	endSpan(span, err)
+	return out, err
+}
+
+func (a *api) UploadPart(ctx context.Context, input *s3api.UploadPartInput) (*s3api.UploadPartOutput, error) {
+	attrs := objectAttrs(input.Bucket, input.Key)
+	attrs = appendString(attrs, UploadIDKey, input.UploadID)
+	if input.PartNumber != nil {
+		attrs = append(attrs, PartNumberKey.Int64(*input.PartNumber))
+	}
+	if n, ok := bodySize(input.Body); ok {
+		attrs = append(attrs, BytesKey.Int64(n))
+	}
+	ctx, span := a.start(ctx, "UploadPart", attrs...)
+	out, err := a.api.UploadPart(ctx, input)
+	endSpan(span, err)
+	return out, err
+}
+
+func (a *api) AbortMultipartUpload(ctx context.Context, input *s3api.AbortMultipartUploadInput) (*s3api.AbortMultipartUploadOutput, error) {
+	attrs := objectAttrs(input.Bucket, input.Key)
+	attrs = appendString(attrs, UploadIDKey, input.UploadID)
+	ctx, span := a.start(ctx, "AbortMultipartUpload", attrs...)
+	out, err := a.api.AbortMultipartUpload(ctx, input)
+	endSpan(span, err)
+	return out, err
+}
+
+func (a *api) CompleteMultipartUpload(ctx context.Context, input *s3api.CompleteMultipartUploadInput) (*s3api.CompleteMultipartUploadOutput, error) {
+	attrs := objectAttrs(input.Bucket, input.Key)
+	attrs = appendString(attrs, UploadIDKey, input.UploadID)
+	ctx, span := a.start(ctx, "CompleteMultipartUpload", attrs...)
+	out, err := a.api.CompleteMultipartUpload(ctx, input)
+	endSpan(span, err)
+	return out, err
+}
+
+func (a *api) PutObject(ctx context.Context, input *s3api.PutObjectInput) (*s3api.PutObjectOutput, error) {
+	attrs := objectAttrs(input.Bucket, input.Key)
+	if n, ok := bodySize(input.Body); ok {
+		attrs = append(attrs, BytesKey.Int64(n))
+	}
+	ctx, span := a.start(ctx, "PutObject", attrs...)
+	out, err := a.api.PutObject(ctx, input)
+	endSpan(span, err)
+	return out, err
+}
+
+func (a *api) GetObject(ctx context.Context, input *s3api.GetObjectInput) (*s3api.GetObjectOutput, error) {
+	attrs := objectAttrs(input.Bucket, input.Key)
+	attrs = appendString(attrs, RangeKey, input.Range)
+	ctx, span := a.start(ctx, "GetObject", attrs...)
+	out, err := a.api.GetObject(ctx, input)
+	if err == nil && out.ContentLength != nil {
+		span.SetAttributes(BytesKey.Int64(*out.ContentLength))
+	}
+	endSpan(span, err)
+	return out, err
+}
+
+func (a *api) HeadObject(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+	ctx, span := a.start(ctx, "HeadObject", objectAttrs(input.Bucket, input.Key)...)
+	out, err := a.api.HeadObject(ctx, input)
+	endSpan(span, err)
+	return out, err
+}
+
+func (a *api) CopyObject(ctx context.Context, input *s3api.CopyObjectInput) (*s3api.CopyObjectOutput, error) {
+	attrs := objectAttrs(input.Bucket, input.Key)
+	attrs = append(attrs, copySourceAttr(input.SourceBucket, input.SourceKey))
+	ctx, span := a.start(ctx, "CopyObject", attrs...)
+	out, err := a.api.CopyObject(ctx, input)
+	endSpan(span, err)
+	return out, err
+}
+
+func (a *api) UploadPartCopy(ctx context.Context, input *s3api.UploadPartCopyInput) (*s3api.UploadPartCopyOutput, error) {
+	attrs := objectAttrs(input.Bucket, input.Key)
+	attrs = append(attrs, copySourceAttr(input.SourceBucket, input.SourceKey))
+	attrs = appendString(attrs, UploadIDKey, input.UploadID)
+	attrs = appendString(attrs, RangeKey, input.SourceRange)
+	if input.PartNumber != nil {
+		attrs = append(attrs, PartNumberKey.Int64(*input.PartNumber))
+	}
+	ctx, span := a.start(ctx, "UploadPartCopy", attrs...)
+	out, err := a.api.UploadPartCopy(ctx, input)
+	endSpan(span, err)
+	return out, err
+}
+
+func (a *api) DeleteObject(ctx context.Context, input *s3api.DeleteObjectInput) (*s3api.DeleteObjectOutput, error) {
+	ctx, span := a.start(ctx, "DeleteObject", objectAttrs(input.Bucket, input.Key)...)
+	out, err := a.api.DeleteObject(ctx, input)
+	endSpan(span, err)
+	return out, err
+}
+
+func (a *api) ListObjectsV2(ctx context.Context, input *s3api.ListObjectsV2Input) (*s3api.ListObjectsV2Output, error) {
+	attrs := appendString(nil, BucketKey, input.Bucket)
+	attrs = appendString(attrs, PrefixKey, input.Prefix)
+	ctx, span := a.start(ctx, "ListObjectsV2", attrs...)
+	out, err := a.api.ListObjectsV2(ctx, input)
+	if err == nil {
+		span.SetAttributes(KeyCountKey.Int(out.KeyCount))
+	}
+	endSpan(span, err)
+	return out, err
+}
+
+func objectAttrs(bucket, key *string) []attribute.KeyValue {
+	attrs := appendString(nil, BucketKey, bucket)
+	return appendString(attrs, KeyKey, key)
+}
+
+func appendString(attrs []attribute.KeyValue, k attribute.Key, v *string) []attribute.KeyValue {
+	if v == nil {
+		return attrs
+	}
+	return append(attrs, k.String(*v))
+}
+
+func copySourceAttr(bucket, key *string) attribute.KeyValue {
+	var b, k string
+	if bucket != nil {
+		b = *bucket
+	}
+	if key != nil {
+		k = *key
+	}
+	return CopySourceKey.String(b + "/" + k)
+}
+
+// bodySize returns the remaining size of the body without moving the offset.
+func bodySize(r io.ReadSeeker) (int64, bool) {
+	if r == nil {
+		return 0, false
+	}
+	cur, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false
+	}
+	if _, err := r.Seek(cur, io.SeekStart); err != nil {
+		return 0, false
+	}
+	return end - cur, true
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iototel_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/at-wat/s3iot/s3api"
+	"github.com/at-wat/s3iot/s3api/s3apitest"
+	"github.com/at-wat/s3iot/s3fake"
+	"github.com/at-wat/s3iot/s3iototel"
+)
+
+func TestAPI(t *testing.T) {
+	bucket, key, key2, prefix := "bucket", "key", "key2", "ke"
+	data := []byte("0123456789")
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	fake := s3fake.New()
+	api := s3iototel.NewAPI(fake, s3iototel.WithTracerProvider(tp))
+	ctx := context.TODO()
+
+	r := bytes.NewReader(data)
+	if _, err := r.Seek(2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.PutObject(ctx, &s3api.PutObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   r,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := fake.Object(bucket, key); !bytes.Equal(data[2:], b) {
+		t.Fatalf("Body must be read from the original offset, got %q", b)
+	}
+	rn := "bytes=0-3"
+	if _, err := api.GetObject(ctx, &s3api.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Range:  &rn,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.CopyObject(ctx, &s3api.CopyObjectInput{
+		Bucket:       &bucket,
+		Key:          &key2,
+		SourceBucket: &bucket,
+		SourceKey:    &key,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.ListObjectsV2(ctx, &s3api.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.DeleteObject(ctx, &s3api.DeleteObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.HeadObject(ctx, &s3api.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}); err == nil {
+		t.Fatal("Expected error")
+	}
+
+	spans := exporter.GetSpans()
+	expected := []struct {
+		name  string
+		attrs map[attribute.Key]attribute.Value
+		err   bool
+	}{
+		{
+			name: "S3.PutObject",
+			attrs: map[attribute.Key]attribute.Value{
+				s3iototel.BucketKey: attribute.StringValue(bucket),
+				s3iototel.KeyKey:    attribute.StringValue(key),
+				s3iototel.BytesKey:  attribute.Int64Value(8),
+				"rpc.method":        attribute.StringValue("PutObject"),
+			},
+		},
+		{
+			name: "S3.GetObject",
+			attrs: map[attribute.Key]attribute.Value{
+				s3iototel.RangeKey: attribute.StringValue(rn),
+				s3iototel.BytesKey: attribute.Int64Value(4),
+			},
+		},
+		{
+			name: "S3.CopyObject",
+			attrs: map[attribute.Key]attribute.Value{
+				s3iototel.KeyKey:        attribute.StringValue(key2),
+				s3iototel.CopySourceKey: attribute.StringValue(bucket + "/" + key),
+			},
+		},
+		{
+			name: "S3.ListObjectsV2",
+			attrs: map[attribute.Key]attribute.Value{
+				s3iototel.PrefixKey:   attribute.StringValue(prefix),
+				s3iototel.KeyCountKey: attribute.IntValue(2),
+			},
+		},
+		{
+			name: "S3.DeleteObject",
+		},
+		{
+			name: "S3.HeadObject",
+			attrs: map[attribute.Key]attribute.Value{
+				s3iototel.StatusCodeKey: attribute.IntValue(404),
+			},
+			err: true,
+		},
+	}
+	if len(spans) != len(expected) {
+		t.Fatalf("Expected %d spans, got %d", len(expected), len(spans))
+	}
+	for i, e := range expected {
+		s := spans[i]
+		if s.Name != e.name {
+			t.Errorf("Expected span %s, got %s", e.name, s.Name)
+			continue
+		}
+		if s.SpanKind != trace.SpanKindClient {
+			t.Errorf("%s: expected client span, got %v", s.Name, s.SpanKind)
+		}
+		if _, ok := attrsOf(s)[s3iototel.AttemptKey]; ok {
+			t.Errorf("%s: attempt must not be set outside of the transfer", s.Name)
+		}
+		assertAttrs(t, s, e.attrs)
+		if (s.Status.Code == codes.Error) != e.err {
+			t.Errorf("%s: expected error %v, got status %v", s.Name, e.err, s.Status)
+		}
+	}
+}
+
+func TestAPI_Conformance(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	fake := s3fake.New()
+	fake.MinPartSize = 1024
+	s3apitest.Run(t, s3iototel.NewAPI(fake, s3iototel.WithTracerProvider(tp)), s3apitest.Config{
+		Bucket:   "bucket",
+		PartSize: 1024,
+	})
+}
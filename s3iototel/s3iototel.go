@@ -0,0 +1,92 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3iototel provides OpenTelemetry tracing for s3iot.
+//
+// NewAPI decorates s3api.S3API to create a span for each API call,
+// and NewTracer creates s3iot.Tracer to create a span for each transfer
+// and its parts. API call spans are nested under the part spans
+// if both are used:
+//
+//	api := s3iototel.NewAPI(awss3v2.NewAPI(s3.NewFromConfig(cfg)))
+//	u := &s3iot.Uploader{}
+//	s3iot.WithAPI(api).ApplyToUploader(u)
+//	s3iot.WithTracer(s3iototel.NewTracer()).ApplyToUploader(u)
+package s3iototel
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/at-wat/s3iot"
+)
+
+// ScopeName is the instrumentation scope name.
+const ScopeName = "github.com/at-wat/s3iot/s3iototel"
+
+// Attribute keys.
+const (
+	BucketKey       = attribute.Key("aws.s3.bucket")
+	KeyKey          = attribute.Key("aws.s3.key")
+	PartNumberKey   = attribute.Key("aws.s3.part_number")
+	UploadIDKey     = attribute.Key("aws.s3.upload_id")
+	CopySourceKey   = attribute.Key("aws.s3.copy_source")
+	PrefixKey       = attribute.Key("s3iot.prefix")
+	KeyCountKey     = attribute.Key("s3iot.key_count")
+	RangeKey        = attribute.Key("s3iot.range")
+	BytesKey        = attribute.Key("s3iot.bytes")
+	PartKey         = attribute.Key("s3iot.part")
+	AttemptKey      = attribute.Key("s3iot.attempt")
+	ThrottleWaitKey = attribute.Key("s3iot.throttle_wait")
+	StatusCodeKey   = attribute.Key("http.response.status_code")
+)
+
+// Option configures the tracing.
+type Option func(*config)
+
+type config struct {
+	provider trace.TracerProvider
+}
+
+// WithTracerProvider sets TracerProvider.
+// Global TracerProvider is used by default.
+func WithTracerProvider(p trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = p
+	}
+}
+
+func newTracer(opts []Option) trace.Tracer {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.provider == nil {
+		c.provider = otel.GetTracerProvider()
+	}
+	return c.provider.Tracer(ScopeName)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		if status, ok := s3iot.HTTPStatus(nil, err); ok {
+			span.SetAttributes(StatusCodeKey.Int(status))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
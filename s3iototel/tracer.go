@@ -0,0 +1,99 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iototel
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/at-wat/s3iot"
+)
+
+// Event names of the transfer span.
+const (
+	EventPause    = "pause"
+	EventResume   = "resume"
+	EventThrottle = "throttle"
+)
+
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates s3iot.Tracer.
+// The transfer span is named like "s3iot.Upload" and has child spans
+// named "s3iot.Part" for each part.
+// Pause, resume and throttle are recorded as the events of the transfer span.
+func NewTracer(opts ...Option) s3iot.Tracer {
+	return &tracer{tracer: newTracer(opts)}
+}
+
+func (t *tracer) StartTransfer(ctx context.Context, info s3iot.TransferInfo) (context.Context, s3iot.TransferSpan) {
+	attrs := []attribute.KeyValue{
+		BucketKey.String(info.Bucket),
+		KeyKey.String(info.Key),
+	}
+	if info.SourceBucket != "" {
+		attrs = append(attrs, CopySourceKey.String(info.SourceBucket+"/"+info.SourceKey))
+	}
+	ctx, span := t.tracer.Start(ctx, "s3iot."+info.Operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx, &transferSpan{tracer: t.tracer, span: span}
+}
+
+type transferSpan struct {
+	tracer trace.Tracer
+	span   trace.Span
+}
+
+func (s *transferSpan) StartPart(ctx context.Context, id int64) (context.Context, s3iot.PartSpan) {
+	ctx, span := s.tracer.Start(ctx, "s3iot.Part",
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(PartKey.Int64(id)),
+	)
+	return ctx, &partSpan{span: span}
+}
+
+func (s *transferSpan) Pause() {
+	s.span.AddEvent(EventPause)
+}
+
+func (s *transferSpan) Resume() {
+	s.span.AddEvent(EventResume)
+}
+
+func (s *transferSpan) Throttle(id int64, wait time.Duration) {
+	s.span.AddEvent(EventThrottle, trace.WithAttributes(
+		PartKey.Int64(id),
+		ThrottleWaitKey.Float64(wait.Seconds()),
+	))
+}
+
+func (s *transferSpan) End(err error) {
+	endSpan(s.span, err)
+}
+
+type partSpan struct {
+	span trace.Span
+}
+
+func (s *partSpan) End(err error) {
+	endSpan(s.span, err)
+}
@@ -0,0 +1,255 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iototel_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/internal/iotest"
+	"github.com/at-wat/s3iot/s3api"
+	"github.com/at-wat/s3iot/s3fake"
+	"github.com/at-wat/s3iot/s3iototel"
+)
+
+func TestTracer(t *testing.T) {
+	bucket, key := "bucket", "key"
+	data := make([]byte, 128)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	t.Run("Upload", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		fake := s3fake.New()
+		fake.Inject(
+			s3fake.Fault{Op: s3fake.OpCreateMultipartUpload, Latency: 50 * time.Millisecond},
+			s3fake.Fault{Op: s3fake.OpUploadPart, PartNumber: 2, Times: 1, Err: s3fake.ErrSlowDown},
+		)
+		u := &s3iot.Uploader{}
+		s3iot.WithAPI(s3iototel.NewAPI(fake, s3iototel.WithTracerProvider(tp))).ApplyToUploader(u)
+		s3iot.WithTracer(s3iototel.NewTracer(s3iototel.WithTracerProvider(tp))).ApplyToUploader(u)
+		s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 50}).ApplyToUploader(u)
+		s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{WaitBase: time.Millisecond}).ApplyToUploader(u)
+		s3iot.WithErrorClassifier(s3fake.ErrorClassifier{ThrottleWait: time.Millisecond}).ApplyToUploader(u)
+
+		uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Body:   bytes.NewReader(data),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		uc.Pause()
+		uc.Resume()
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		case <-uc.Done():
+		}
+		if _, err := uc.Result(); err != nil {
+			t.Fatal(err)
+		}
+
+		spans := exporter.GetSpans()
+		transfer := findSpans(spans, "s3iot.Upload")
+		if len(transfer) != 1 {
+			t.Fatalf("Expected one transfer span, got %d", len(transfer))
+		}
+		root := transfer[0]
+		if root.Parent.IsValid() {
+			t.Error("Transfer span must be the root")
+		}
+		assertAttrs(t, root, map[attribute.Key]attribute.Value{
+			s3iototel.BucketKey: attribute.StringValue(bucket),
+			s3iototel.KeyKey:    attribute.StringValue(key),
+		})
+		var events []string
+		for _, e := range root.Events {
+			events = append(events, e.Name)
+		}
+		expectedEvents := []string{s3iototel.EventPause, s3iototel.EventResume, s3iototel.EventThrottle}
+		if !equalStrings(expectedEvents, events) {
+			t.Errorf("Expected events: %v, got: %v", expectedEvents, events)
+		}
+
+		parts := findSpans(spans, "s3iot.Part")
+		if len(parts) != 3 {
+			t.Fatalf("Expected 3 part spans, got %d", len(parts))
+		}
+		partSpans := make(map[int64]trace.SpanID)
+		for _, p := range parts {
+			if p.Parent.SpanID() != root.SpanContext.SpanID() {
+				t.Error("Part span must be a child of the transfer span")
+			}
+			partSpans[attrsOf(p)[s3iototel.PartKey].AsInt64()] = p.SpanContext.SpanID()
+		}
+
+		for _, op := range []string{"S3.CreateMultipartUpload", "S3.CompleteMultipartUpload"} {
+			s := findSpans(spans, op)
+			if len(s) != 1 {
+				t.Fatalf("Expected one %s span, got %d", op, len(s))
+			}
+			if s[0].Parent.SpanID() != root.SpanContext.SpanID() {
+				t.Errorf("%s span must be a child of the transfer span", op)
+			}
+		}
+
+		uploads := findSpans(spans, "S3.UploadPart")
+		if len(uploads) != 4 {
+			t.Fatalf("Expected 4 UploadPart spans, got %d", len(uploads))
+		}
+		var failed int
+		for _, s := range uploads {
+			a := attrsOf(s)
+			n := a[s3iototel.PartNumberKey].AsInt64()
+			if s.Parent.SpanID() != partSpans[n] {
+				t.Errorf("UploadPart %d span must be a child of the part span", n)
+			}
+			expectedBytes := int64(50)
+			if n == 3 {
+				expectedBytes = 28
+			}
+			if b := a[s3iototel.BytesKey].AsInt64(); b != expectedBytes {
+				t.Errorf("Expected bytes of part %d: %d, got: %d", n, expectedBytes, b)
+			}
+			if s.Status.Code == codes.Error {
+				failed++
+				assertAttrs(t, s, map[attribute.Key]attribute.Value{
+					s3iototel.PartNumberKey: attribute.Int64Value(2),
+					s3iototel.AttemptKey:    attribute.IntValue(1),
+					s3iototel.StatusCodeKey: attribute.IntValue(503),
+				})
+			} else if n == 2 {
+				assertAttrs(t, s, map[attribute.Key]attribute.Value{
+					s3iototel.AttemptKey: attribute.IntValue(2),
+				})
+			}
+		}
+		if failed != 1 {
+			t.Errorf("Expected one failed UploadPart span, got %d", failed)
+		}
+	})
+	t.Run("Download", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		fake := s3fake.New()
+		if _, err := fake.PutObject(context.TODO(), &s3api.PutObjectInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Body:   bytes.NewReader(data),
+		}); err != nil {
+			t.Fatal(err)
+		}
+		d := &s3iot.Downloader{}
+		s3iot.WithAPI(s3iototel.NewAPI(fake, s3iototel.WithTracerProvider(tp))).ApplyToDownloader(d)
+		s3iot.WithTracer(s3iototel.NewTracer(s3iototel.WithTracerProvider(tp))).ApplyToDownloader(d)
+		s3iot.WithDownloadSlicer(&s3iot.DefaultDownloadSlicerFactory{PartSize: 100}).ApplyToDownloader(d)
+
+		buf := iotest.BufferAt(make([]byte, len(data)))
+		dc, err := d.Download(context.TODO(), buf, &s3iot.DownloadInput{
+			Bucket: &bucket,
+			Key:    &key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		case <-dc.Done():
+		}
+		if _, err := dc.Result(); err != nil {
+			t.Fatal(err)
+		}
+
+		spans := exporter.GetSpans()
+		if n := len(findSpans(spans, "s3iot.Download")); n != 1 {
+			t.Fatalf("Expected one transfer span, got %d", n)
+		}
+		gets := findSpans(spans, "S3.GetObject")
+		if len(gets) != 2 {
+			t.Fatalf("Expected 2 GetObject spans, got %d", len(gets))
+		}
+		expected := []map[attribute.Key]attribute.Value{
+			{
+				s3iototel.RangeKey: attribute.StringValue("bytes=0-99"),
+				s3iototel.BytesKey: attribute.Int64Value(100),
+				s3iototel.PartKey:  attribute.Int64Value(1),
+			},
+			{
+				s3iototel.RangeKey: attribute.StringValue("bytes=100-199"),
+				s3iototel.BytesKey: attribute.Int64Value(28),
+				s3iototel.PartKey:  attribute.Int64Value(2),
+			},
+		}
+		for i, s := range gets {
+			assertAttrs(t, s, expected[i])
+		}
+	})
+}
+
+func findSpans(spans tracetest.SpanStubs, name string) tracetest.SpanStubs {
+	var ret tracetest.SpanStubs
+	for _, s := range spans {
+		if s.Name == name {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func attrsOf(s tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func assertAttrs(t *testing.T, s tracetest.SpanStub, expected map[attribute.Key]attribute.Value) {
+	t.Helper()
+	a := attrsOf(s)
+	for k, v := range expected {
+		if a[k] != v {
+			t.Errorf("%s: expected %s=%v, got %v", s.Name, k, v.Emit(), a[k].Emit())
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3iotprom provides s3iot.Metrics exporting the metrics of
+// the transfers as prometheus.Collector.
+//
+//	c := s3iotprom.New()
+//	prometheus.MustRegister(c)
+//	u := &s3iot.Uploader{}
+//	s3iot.WithMetrics(c).ApplyToUploader(u)
+package s3iotprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/at-wat/s3iot"
+)
+
+// DefaultNamespace is the default namespace of the metrics.
+const DefaultNamespace = "s3iot"
+
+// Label names.
+const (
+	OperationLabel = "operation"
+	APILabel       = "api"
+	ResultLabel    = "result"
+	ClassLabel     = "class"
+)
+
+// Values of ResultLabel.
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Option configures the Collector.
+type Option func(*config)
+
+type config struct {
+	namespace       string
+	constLabels     prometheus.Labels
+	durationBuckets []float64
+}
+
+// WithNamespace sets the namespace of the metrics.
+// DefaultNamespace is used by default.
+func WithNamespace(ns string) Option {
+	return func(c *config) {
+		c.namespace = ns
+	}
+}
+
+// WithConstLabels sets the labels added to all metrics like the device ID.
+func WithConstLabels(l prometheus.Labels) Option {
+	return func(c *config) {
+		c.constLabels = l
+	}
+}
+
+// WithDurationBuckets sets the buckets of the API call duration and
+// the throttle wait histograms.
+// prometheus.DefBuckets is used by default.
+func WithDurationBuckets(b []float64) Option {
+	return func(c *config) {
+		c.durationBuckets = b
+	}
+}
+
+// Collector implements s3iot.Metrics and prometheus.Collector.
+type Collector struct {
+	active      *prometheus.GaugeVec
+	transfers   *prometheus.CounterVec
+	bytes       *prometheus.CounterVec
+	apiCalls    *prometheus.HistogramVec
+	retries     *prometheus.CounterVec
+	throttles   *prometheus.HistogramVec
+	pausedTotal *prometheus.CounterVec
+}
+
+// New creates Collector.
+func New(opts ...Option) *Collector {
+	c := &config{
+		namespace:       DefaultNamespace,
+		durationBuckets: prometheus.DefBuckets,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return &Collector{
+		active: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   c.namespace,
+			Name:        "active_transfers",
+			Help:        "Number of the transfers in progress.",
+			ConstLabels: c.constLabels,
+		}, []string{OperationLabel}),
+		transfers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Name:        "transfers_total",
+			Help:        "Total number of the finished transfers.",
+			ConstLabels: c.constLabels,
+		}, []string{OperationLabel, ResultLabel}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Name:        "transferred_bytes_total",
+			Help:        "Total bytes of the transferred parts.",
+			ConstLabels: c.constLabels,
+		}, []string{OperationLabel}),
+		apiCalls: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   c.namespace,
+			Name:        "api_call_duration_seconds",
+			Help:        "Duration of the API call attempts.",
+			ConstLabels: c.constLabels,
+			Buckets:     c.durationBuckets,
+		}, []string{OperationLabel, APILabel, ResultLabel}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Name:        "retries_total",
+			Help:        "Total number of the retries by the error class.",
+			ConstLabels: c.constLabels,
+		}, []string{OperationLabel, ClassLabel}),
+		throttles: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   c.namespace,
+			Name:        "throttle_wait_seconds",
+			Help:        "Wait duration requested by the throttle responses.",
+			ConstLabels: c.constLabels,
+			Buckets:     c.durationBuckets,
+		}, []string{OperationLabel}),
+		pausedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Name:        "paused_seconds_total",
+			Help:        "Total time spent paused.",
+			ConstLabels: c.constLabels,
+		}, []string{OperationLabel}),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.active, c.transfers, c.bytes, c.apiCalls,
+		c.retries, c.throttles, c.pausedTotal,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.collectors() {
+		m.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.collectors() {
+		m.Collect(ch)
+	}
+}
+
+// TransferStarted implements s3iot.Metrics.
+func (c *Collector) TransferStarted(op string) {
+	c.active.WithLabelValues(op).Inc()
+}
+
+// TransferFinished implements s3iot.Metrics.
+func (c *Collector) TransferFinished(op string, err error) {
+	c.active.WithLabelValues(op).Dec()
+	c.transfers.WithLabelValues(op, result(err)).Inc()
+}
+
+// BytesTransferred implements s3iot.Metrics.
+func (c *Collector) BytesTransferred(op string, n int64) {
+	c.bytes.WithLabelValues(op).Add(float64(n))
+}
+
+// APICall implements s3iot.Metrics.
+func (c *Collector) APICall(op, api string, d time.Duration, err error) {
+	c.apiCalls.WithLabelValues(op, api, result(err)).Observe(d.Seconds())
+}
+
+// Retry implements s3iot.Metrics.
+func (c *Collector) Retry(op string, class s3iot.ErrorClass) {
+	c.retries.WithLabelValues(op, class.String()).Inc()
+}
+
+// Throttle implements s3iot.Metrics.
+func (c *Collector) Throttle(op string, wait time.Duration) {
+	c.throttles.WithLabelValues(op).Observe(wait.Seconds())
+}
+
+// Paused implements s3iot.Metrics.
+func (c *Collector) Paused(op string, d time.Duration) {
+	c.pausedTotal.WithLabelValues(op).Add(d.Seconds())
+}
+
+func result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
+
+var (
+	_ s3iot.Metrics        = &Collector{}
+	_ prometheus.Collector = &Collector{}
+)
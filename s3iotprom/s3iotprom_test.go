@@ -0,0 +1,130 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iotprom_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/s3fake"
+	"github.com/at-wat/s3iot/s3iotprom"
+)
+
+func TestCollector(t *testing.T) {
+	bucket, key := "bucket", "key"
+	data := make([]byte, 128)
+
+	fake := s3fake.New()
+	fake.Inject(
+		s3fake.Fault{Op: s3fake.OpUploadPart, PartNumber: 2, Times: 1, Err: s3fake.ErrSlowDown},
+	)
+	c := s3iotprom.New(s3iotprom.WithConstLabels(prometheus.Labels{"device": "dev0"}))
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	u := &s3iot.Uploader{}
+	s3iot.WithAPI(fake).ApplyToUploader(u)
+	s3iot.WithMetrics(c).ApplyToUploader(u)
+	s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 50}).ApplyToUploader(u)
+	s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{WaitBase: time.Millisecond}).ApplyToUploader(u)
+	s3iot.WithErrorClassifier(s3fake.ErrorClassifier{ThrottleWait: time.Millisecond}).ApplyToUploader(u)
+
+	uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc.Pause()
+	uc.Resume()
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("Timeout")
+	case <-uc.Done():
+	}
+	if _, err := uc.Result(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP s3iot_active_transfers Number of the transfers in progress.
+# TYPE s3iot_active_transfers gauge
+s3iot_active_transfers{device="dev0",operation="Upload"} 0
+# HELP s3iot_retries_total Total number of the retries by the error class.
+# TYPE s3iot_retries_total counter
+s3iot_retries_total{class="throttle",device="dev0",operation="Upload"} 1
+# HELP s3iot_transferred_bytes_total Total bytes of the transferred parts.
+# TYPE s3iot_transferred_bytes_total counter
+s3iot_transferred_bytes_total{device="dev0",operation="Upload"} 128
+# HELP s3iot_transfers_total Total number of the finished transfers.
+# TYPE s3iot_transfers_total counter
+s3iot_transfers_total{device="dev0",operation="Upload",result="success"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"s3iot_active_transfers",
+		"s3iot_retries_total",
+		"s3iot_transferred_bytes_total",
+		"s3iot_transfers_total",
+	); err != nil {
+		t.Error(err)
+	}
+
+	apiCalls := map[string]int{
+		"CreateMultipartUpload":   1,
+		"UploadPart":              4,
+		"CompleteMultipartUpload": 1,
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, f := range families {
+		switch f.GetName() {
+		case "s3iot_api_call_duration_seconds":
+			for _, m := range f.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == s3iotprom.APILabel {
+						counts[l.GetValue()] += int(m.GetHistogram().GetSampleCount())
+					}
+				}
+			}
+		case "s3iot_throttle_wait_seconds":
+			if n := f.GetMetric()[0].GetHistogram().GetSampleCount(); n != 1 {
+				t.Errorf("Expected 1 throttle, got %d", n)
+			}
+		case "s3iot_paused_seconds_total":
+			if n := len(f.GetMetric()); n != 1 {
+				t.Errorf("Expected paused time of 1 operation, got %d", n)
+			}
+		}
+	}
+	for api, n := range apiCalls {
+		if counts[api] != n {
+			t.Errorf("Expected %d %s calls, got %d", n, api, counts[api])
+		}
+	}
+}
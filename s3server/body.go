@@ -0,0 +1,155 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var errInvalidChunk = errors.New("invalid aws-chunked encoding")
+
+// readBody reads the request body.
+// Body in aws-chunked encoding is decoded. Chunk signatures and trailing checksums are not verified.
+func readBody(r *request) ([]byte, error) {
+	var body io.Reader = r.Body
+	if isChunked(r) {
+		body = &chunkedReader{r: bufio.NewReader(r.Body)}
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		if errors.Is(err, errInvalidChunk) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errIncompleteBody
+		}
+		return nil, err
+	}
+	if l := r.Header.Get("X-Amz-Decoded-Content-Length"); l != "" {
+		n, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || n != int64(len(b)) {
+			return nil, errIncompleteBody
+		}
+	}
+	return b, nil
+}
+
+func isChunked(r *request) bool {
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return true
+	}
+	for _, e := range strings.Split(r.Header.Get("Content-Encoding"), ",") {
+		if strings.TrimSpace(e) == "aws-chunked" {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkedReader decodes aws-chunked encoding:
+//
+//	hex-size[;chunk-signature=sig]\r\n
+//	data\r\n
+//	...
+//	0[;chunk-signature=sig]\r\n
+//	[trailer-name:value\r\n]...
+//	\r\n
+type chunkedReader struct {
+	r       *bufio.Reader
+	remain  int64
+	started bool
+	done    bool
+}
+
+func (r *chunkedReader) Read(b []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+	if r.remain == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+	}
+	if int64(len(b)) > r.remain {
+		b = b[:r.remain]
+	}
+	n, err := r.r.Read(b)
+	r.remain -= int64(n)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *chunkedReader) next() error {
+	if r.started {
+		// Trailing CRLF of the previous chunk data.
+		line, err := r.readLine()
+		if err != nil {
+			return err
+		}
+		if line != "" {
+			return errInvalidChunk
+		}
+	}
+	r.started = true
+
+	line, err := r.readLine()
+	if err != nil {
+		return err
+	}
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+	if err != nil || size < 0 {
+		return errInvalidChunk
+	}
+	if size > 0 {
+		r.remain = size
+		return nil
+	}
+	// Skip trailers.
+	for {
+		line, err := r.readLine()
+		if err == io.ErrUnexpectedEOF {
+			// Some clients omit the final CRLF.
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			break
+		}
+	}
+	r.done = true
+	return nil
+}
+
+func (r *chunkedReader) readLine() (string, error) {
+	line, err := r.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3server
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestChunkedReader(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		expected string
+		err      error
+	}{
+		"Signed": {
+			input: "5;chunk-signature=0123\r\nHello\r\n" +
+				"6;chunk-signature=4567\r\n World\r\n" +
+				"0;chunk-signature=89ab\r\n\r\n",
+			expected: "Hello World",
+		},
+		"Trailer": {
+			input: "5\r\nHello\r\n" +
+				"0\r\nx-amz-checksum-crc32:AAAAAA==\r\n\r\n",
+			expected: "Hello",
+		},
+		"NoFinalCRLF": {
+			input:    "5\r\nHello\r\n0\r\n",
+			expected: "Hello",
+		},
+		"Empty": {
+			input: "0\r\n\r\n",
+		},
+		"Truncated": {
+			input: "a\r\nHello",
+			err:   io.ErrUnexpectedEOF,
+		},
+		"InvalidSize": {
+			input: "x\r\nHello\r\n",
+			err:   errInvalidChunk,
+		},
+		"NoDataCRLF": {
+			input: "5\r\nHelloWorld\r\n0\r\n\r\n",
+			err:   errInvalidChunk,
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			b, err := io.ReadAll(&chunkedReader{r: bufio.NewReader(strings.NewReader(tt.input))})
+			if err != tt.err {
+				t.Fatalf("Expected error: '%v', got: '%v'", tt.err, err)
+			}
+			if err == nil && string(b) != tt.expected {
+				t.Errorf("Expected: '%s', got: '%s'", tt.expected, b)
+			}
+		})
+	}
+}
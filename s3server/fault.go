@@ -0,0 +1,162 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Op represents the API operation.
+type Op string
+
+// Operations served by Server.
+const (
+	OpPutObject               Op = "PutObject"
+	OpGetObject               Op = "GetObject"
+	OpHeadObject              Op = "HeadObject"
+	OpDeleteObject            Op = "DeleteObject"
+	OpCopyObject              Op = "CopyObject"
+	OpCreateMultipartUpload   Op = "CreateMultipartUpload"
+	OpUploadPart              Op = "UploadPart"
+	OpUploadPartCopy          Op = "UploadPartCopy"
+	OpCompleteMultipartUpload Op = "CompleteMultipartUpload"
+	OpAbortMultipartUpload    Op = "AbortMultipartUpload"
+	OpListObjectsV2           Op = "ListObjectsV2"
+)
+
+// Fault describes a failure injected to the HTTP requests.
+// Zero value of the condition fields matches any request.
+type Fault struct {
+	// Op is the target operation.
+	Op Op
+	// Key is the target object key.
+	Key string
+	// PartNumber is the target part number of UploadPart and UploadPartCopy.
+	PartNumber int64
+	// Call is the target n-th (1-origin) request of the operation.
+	Call int
+	// Times is the number of times the fault is triggered.
+	// Zero means unlimited.
+	Times int
+
+	// Latency delays the response.
+	Latency time.Duration
+	// StatusCode and Code specify the error response like 503 SlowDown.
+	// If Code is empty, status text without spaces like ServiceUnavailable is used.
+	StatusCode int
+	Code       string
+	// RetryAfter is sent as Retry-After header of the error response.
+	RetryAfter time.Duration
+	// ResetConnection closes the connection without response.
+	ResetConnection bool
+	// PartialBody closes the connection after sending the given length
+	// of GetObject response body.
+	PartialBody *int64
+}
+
+type faultState struct {
+	Fault
+	triggered int
+}
+
+// Inject adds faults.
+// If multiple faults match the request, the first one is triggered.
+func (s *Server) Inject(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range faults {
+		s.faults = append(s.faults, &faultState{Fault: f})
+	}
+}
+
+// ClearFaults removes all injected faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Calls returns the number of the requests of the operation.
+func (s *Server) Calls(op Op) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[op]
+}
+
+// begin counts the request and returns the triggered fault.
+// Latency, error response and connection reset of the fault are applied here.
+// The fault is also returned with the error response.
+func (s *Server) begin(r *request) (*Fault, error) {
+	var partNumber int64
+	if pn := r.URL.Query().Get("partNumber"); pn != "" {
+		partNumber, _ = strconv.ParseInt(pn, 10, 64)
+	}
+
+	s.mu.Lock()
+	s.calls[r.op]++
+	n := s.calls[r.op]
+	var fault *Fault
+	for _, f := range s.faults {
+		if f.match(r.op, r.key, partNumber, n) {
+			f.triggered++
+			fault = &f.Fault
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if fault == nil {
+		return nil, nil
+	}
+	if fault.Latency > 0 {
+		timer := time.NewTimer(fault.Latency)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if fault.ResetConnection {
+		panic(http.ErrAbortHandler)
+	}
+	if fault.StatusCode != 0 {
+		code := fault.Code
+		if code == "" {
+			code = strings.ReplaceAll(http.StatusText(fault.StatusCode), " ", "")
+		}
+		return fault, &serverError{code, "injected fault", fault.StatusCode}
+	}
+	return fault, nil
+}
+
+func (f *faultState) match(op Op, key string, partNumber int64, n int) bool {
+	switch {
+	case f.Times > 0 && f.triggered >= f.Times:
+		return false
+	case f.Op != "" && f.Op != op:
+		return false
+	case f.Key != "" && f.Key != key:
+		return false
+	case f.PartNumber != 0 && f.PartNumber != partNumber:
+		return false
+	case f.Call != 0 && f.Call != n:
+		return false
+	}
+	return true
+}
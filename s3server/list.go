@@ -0,0 +1,99 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3server
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+type listBucketResult struct {
+	XMLName               xml.Name      `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string        `xml:"Name"`
+	Prefix                string        `xml:"Prefix"`
+	KeyCount              int           `xml:"KeyCount"`
+	MaxKeys               int           `xml:"MaxKeys"`
+	IsTruncated           bool          `xml:"IsTruncated"`
+	Contents              []listContent `xml:"Contents"`
+	ContinuationToken     string        `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string        `xml:"NextContinuationToken,omitempty"`
+}
+
+type listContent struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// defaultMaxKeys is the number of the keys listed at once if max-keys is not specified.
+const defaultMaxKeys = 1000
+
+func (s *Server) listObjectsV2(w http.ResponseWriter, r *request) error {
+	q := r.URL.Query()
+	if q.Get("delimiter") != "" || q.Get("start-after") != "" {
+		return errNotImplemented
+	}
+	maxKeys := defaultMaxKeys
+	if mk := q.Get("max-keys"); mk != "" {
+		n, err := strconv.Atoi(mk)
+		if err != nil || n < 0 {
+			return errInvalidArgument
+		}
+		maxKeys = n
+	}
+	res := &listBucketResult{
+		Name:              r.bucket,
+		Prefix:            q.Get("prefix"),
+		MaxKeys:           maxKeys,
+		ContinuationToken: q.Get("continuation-token"),
+	}
+	if maxKeys == 0 {
+		s.writeXML(w, http.StatusOK, res)
+		return nil
+	}
+	out, err := s.Store.ListObjectsV2(r.Context(), &s3api.ListObjectsV2Input{
+		Bucket:            &r.bucket,
+		ContinuationToken: query(r, "continuation-token"),
+		MaxKeys:           maxKeys,
+		Prefix:            query(r, "prefix"),
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range out.Contents {
+		lc := listContent{
+			Key:          stringValue(c.Key),
+			ETag:         stringValue(c.ETag),
+			Size:         c.Size,
+			StorageClass: "STANDARD",
+		}
+		if c.LastModified != nil {
+			lc.LastModified = c.LastModified.UTC().Format(timeFormatXML)
+		}
+		res.Contents = append(res.Contents, lc)
+	}
+	res.KeyCount = len(res.Contents)
+	if out.NextContinuationToken != nil {
+		res.IsTruncated = true
+		res.NextContinuationToken = *out.NextContinuationToken
+	}
+	s.writeXML(w, http.StatusOK, res)
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type copyPartResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyPartResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		ETag       string `xml:"ETag"`
+		PartNumber int64  `xml:"PartNumber"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *request) error {
+	out, err := s.Store.CreateMultipartUpload(r.Context(), &s3api.CreateMultipartUploadInput{
+		Bucket:      &r.bucket,
+		Key:         &r.key,
+		ACL:         header(r, "X-Amz-Acl"),
+		ContentType: header(r, "Content-Type"),
+		Metadata:    metadata(r),
+	})
+	if err != nil {
+		return err
+	}
+	s.writeXML(w, http.StatusOK, &initiateMultipartUploadResult{
+		Bucket:   r.bucket,
+		Key:      r.key,
+		UploadID: stringValue(out.UploadID),
+	})
+	return nil
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *request) error {
+	partNumber, err := partNumber(r)
+	if err != nil {
+		return err
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	out, err := s.Store.UploadPart(r.Context(), &s3api.UploadPartInput{
+		Body:       bytes.NewReader(body),
+		Bucket:     &r.bucket,
+		Key:        &r.key,
+		PartNumber: &partNumber,
+		UploadID:   query(r, "uploadId"),
+	})
+	if err != nil {
+		return err
+	}
+	setHeader(w, "ETag", out.ETag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) uploadPartCopy(w http.ResponseWriter, r *request) error {
+	partNumber, err := partNumber(r)
+	if err != nil {
+		return err
+	}
+	bucket, key, versionID, err := parseCopySource(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return err
+	}
+	out, err := s.Store.UploadPartCopy(r.Context(), &s3api.UploadPartCopyInput{
+		Bucket:          &r.bucket,
+		Key:             &r.key,
+		PartNumber:      &partNumber,
+		UploadID:        query(r, "uploadId"),
+		SourceBucket:    &bucket,
+		SourceKey:       &key,
+		SourceVersionID: versionID,
+		SourceIfMatch:   header(r, "X-Amz-Copy-Source-If-Match"),
+		SourceRange:     header(r, "X-Amz-Copy-Source-Range"),
+	})
+	if err != nil {
+		return err
+	}
+	s.writeXML(w, http.StatusOK, &copyPartResult{
+		ETag:         stringValue(out.ETag),
+		LastModified: time.Now().UTC().Format(timeFormatXML),
+	})
+	return nil
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *request) error {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	var in completeMultipartUpload
+	if err := xml.Unmarshal(b, &in); err != nil {
+		return errMalformedXML
+	}
+	parts := make([]*s3api.CompletedPart, len(in.Parts))
+	for i, p := range in.Parts {
+		p := p
+		parts[i] = &s3api.CompletedPart{
+			ETag:       &p.ETag,
+			PartNumber: &p.PartNumber,
+		}
+	}
+	out, err := s.Store.CompleteMultipartUpload(r.Context(), &s3api.CompleteMultipartUploadInput{
+		Bucket:         &r.bucket,
+		Key:            &r.key,
+		CompletedParts: parts,
+		UploadID:       query(r, "uploadId"),
+	})
+	if err != nil {
+		return err
+	}
+	setHeader(w, "X-Amz-Version-Id", out.VersionID)
+	s.writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Location: location(r),
+		Bucket:   r.bucket,
+		Key:      r.key,
+		ETag:     stringValue(out.ETag),
+	})
+	return nil
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *request) error {
+	if _, err := s.Store.AbortMultipartUpload(r.Context(), &s3api.AbortMultipartUploadInput{
+		Bucket:   &r.bucket,
+		Key:      &r.key,
+		UploadID: query(r, "uploadId"),
+	}); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func partNumber(r *request) (int64, error) {
+	n, err := strconv.ParseInt(r.URL.Query().Get("partNumber"), 10, 64)
+	if err != nil {
+		return 0, errInvalidArgument
+	}
+	return n, nil
+}
+
+func location(r *request) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   r.Host,
+		Path:   "/" + r.bucket + "/" + r.key,
+	}
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
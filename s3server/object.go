@@ -0,0 +1,246 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+const (
+	xmlns         = "http://s3.amazonaws.com/doc/2006-03-01/"
+	timeFormatXML = "2006-01-02T15:04:05.000Z"
+	metaPrefix    = "X-Amz-Meta-"
+)
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *request) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	out, err := s.Store.PutObject(r.Context(), &s3api.PutObjectInput{
+		Bucket:      &r.bucket,
+		Key:         &r.key,
+		ACL:         header(r, "X-Amz-Acl"),
+		Body:        bytes.NewReader(body),
+		ContentType: header(r, "Content-Type"),
+	})
+	if err != nil {
+		return err
+	}
+	setHeader(w, "ETag", out.ETag)
+	setHeader(w, "X-Amz-Version-Id", out.VersionID)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *request, fault *Fault) error {
+	out, err := s.Store.GetObject(r.Context(), &s3api.GetObjectInput{
+		Bucket:    &r.bucket,
+		Key:       &r.key,
+		Range:     header(r, "Range"),
+		VersionID: query(r, "versionId"),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	setHeader(w, "Content-Type", out.ContentType)
+	setHeader(w, "ETag", out.ETag)
+	setHeader(w, "X-Amz-Version-Id", out.VersionID)
+	setTimeHeader(w, "Last-Modified", out.LastModified)
+	setIntHeader(w, "Content-Length", out.ContentLength)
+	setHeader(w, "Content-Range", out.ContentRange)
+	w.Header().Set("Accept-Ranges", "bytes")
+	status := http.StatusOK
+	if out.ContentRange != nil {
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+
+	if fault != nil && fault.PartialBody != nil {
+		_, _ = io.CopyN(w, out.Body, *fault.PartialBody)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		panic(http.ErrAbortHandler)
+	}
+	if _, err := io.Copy(w, out.Body); err != nil {
+		// Status code is already sent. Notify the error by closing the connection.
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
+func (s *Server) headObject(w http.ResponseWriter, r *request) error {
+	out, err := s.Store.HeadObject(r.Context(), &s3api.HeadObjectInput{
+		Bucket:       &r.bucket,
+		Key:          &r.key,
+		VersionID:    query(r, "versionId"),
+		ChecksumMode: header(r, "X-Amz-Checksum-Mode"),
+	})
+	if err != nil {
+		return err
+	}
+	setHeader(w, "Content-Type", out.ContentType)
+	setHeader(w, "ETag", out.ETag)
+	setHeader(w, "X-Amz-Version-Id", out.VersionID)
+	setTimeHeader(w, "Last-Modified", out.LastModified)
+	setIntHeader(w, "Content-Length", out.ContentLength)
+	setIntHeader(w, "X-Amz-Mp-Parts-Count", out.PartsCount)
+	setHeader(w, "X-Amz-Storage-Class", out.StorageClass)
+	setHeader(w, "X-Amz-Restore", out.Restore)
+	setHeader(w, "X-Amz-Checksum-Crc32", out.ChecksumCRC32)
+	setHeader(w, "X-Amz-Checksum-Crc32c", out.ChecksumCRC32C)
+	setHeader(w, "X-Amz-Checksum-Sha1", out.ChecksumSHA1)
+	setHeader(w, "X-Amz-Checksum-Sha256", out.ChecksumSHA256)
+	for k, v := range out.Metadata {
+		w.Header().Set(metaPrefix+k, v)
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *request) error {
+	out, err := s.Store.DeleteObject(r.Context(), &s3api.DeleteObjectInput{
+		Bucket:    &r.bucket,
+		Key:       &r.key,
+		VersionID: query(r, "versionId"),
+	})
+	if err != nil {
+		return err
+	}
+	setHeader(w, "X-Amz-Version-Id", out.VersionID)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *request) error {
+	bucket, key, versionID, err := parseCopySource(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return err
+	}
+	out, err := s.Store.CopyObject(r.Context(), &s3api.CopyObjectInput{
+		Bucket:          &r.bucket,
+		Key:             &r.key,
+		ACL:             header(r, "X-Amz-Acl"),
+		SourceBucket:    &bucket,
+		SourceKey:       &key,
+		SourceVersionID: versionID,
+		SourceIfMatch:   header(r, "X-Amz-Copy-Source-If-Match"),
+	})
+	if err != nil {
+		return err
+	}
+	setHeader(w, "X-Amz-Version-Id", out.VersionID)
+	s.writeXML(w, http.StatusOK, &copyObjectResult{
+		ETag:         stringValue(out.ETag),
+		LastModified: time.Now().UTC().Format(timeFormatXML),
+	})
+	return nil
+}
+
+// parseCopySource parses x-amz-copy-source header formatted by s3api.CopySource.
+func parseCopySource(src string) (bucket, key string, versionID *string, err error) {
+	src = strings.TrimPrefix(src, "/")
+	if i := strings.IndexByte(src, '?'); i >= 0 {
+		q, err := url.ParseQuery(src[i+1:])
+		if err != nil {
+			return "", "", nil, errInvalidArgument
+		}
+		if v, ok := q["versionId"]; ok {
+			versionID = &v[0]
+		}
+		src = src[:i]
+	}
+	src, err = url.PathUnescape(src)
+	if err != nil {
+		return "", "", nil, errInvalidArgument
+	}
+	i := strings.IndexByte(src, '/')
+	if i <= 0 || i == len(src)-1 {
+		return "", "", nil, errInvalidArgument
+	}
+	return src[:i], src[i+1:], versionID, nil
+}
+
+func header(r *request, key string) *string {
+	if v := r.Header.Get(key); v != "" {
+		return &v
+	}
+	return nil
+}
+
+func query(r *request, key string) *string {
+	if v, ok := r.URL.Query()[key]; ok {
+		return &v[0]
+	}
+	return nil
+}
+
+func metadata(r *request) map[string]string {
+	var m map[string]string
+	for k, v := range r.Header {
+		if !strings.HasPrefix(k, metaPrefix) || len(v) == 0 {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[strings.ToLower(k[len(metaPrefix):])] = v[0]
+	}
+	return m
+}
+
+func setHeader(w http.ResponseWriter, key string, v *string) {
+	if v != nil {
+		w.Header().Set(key, *v)
+	}
+}
+
+func setIntHeader(w http.ResponseWriter, key string, v *int64) {
+	if v != nil {
+		w.Header().Set(key, strconv.FormatInt(*v, 10))
+	}
+}
+
+func setTimeHeader(w http.ResponseWriter, key string, v *time.Time) {
+	if v != nil {
+		w.Header().Set(key, v.UTC().Format(http.TimeFormat))
+	}
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,258 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3server provides S3 compatible HTTP server for testing.
+//
+// Server serves the subset of Amazon S3 REST API used by s3iot:
+// PutObject, GetObject, HeadObject, DeleteObject, CopyObject, multipart upload
+// and ListObjectsV2 in path-style addressing.
+// Objects are stored in the pluggable s3api.S3API like localfs.API or s3fake.API.
+// Server can be run by httptest.NewServer:
+//
+//	srv := httptest.NewServer(s3server.New(s3fake.New()))
+//	defer srv.Close()
+//
+// SDK clients must be configured to use path-style addressing with
+// the endpoint of the server.
+package s3server
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/at-wat/s3iot/s3api"
+)
+
+// Server is S3 compatible HTTP server.
+type Server struct {
+	// Store is the backend storage of the objects.
+	Store s3api.S3API
+	// Credentials maps access key ID to secret access key.
+	// If set, AWS Signature Version 4 of the request is verified.
+	Credentials map[string]string
+
+	mu     sync.Mutex
+	faults []*faultState
+	calls  map[Op]int
+	reqID  uint64
+}
+
+// New creates Server backed by the store.
+func New(store s3api.S3API) *Server {
+	return &Server{
+		Store: store,
+		calls: make(map[Op]int),
+	}
+}
+
+// Error is the interface of the errors carrying S3 error code and HTTP status code.
+// Errors returned by Store should implement it to be translated to the S3 error response.
+// Other errors are responded as InternalError.
+type Error interface {
+	error
+	ErrorCode() string
+	HTTPStatusCode() int
+}
+
+type serverError struct {
+	code    string
+	message string
+	status  int
+}
+
+func (e *serverError) Error() string       { return e.code + ": " + e.message }
+func (e *serverError) ErrorCode() string   { return e.code }
+func (e *serverError) HTTPStatusCode() int { return e.status }
+
+var (
+	errNotImplemented        = &serverError{"NotImplemented", "a header or query you provided implies functionality that is not implemented", http.StatusNotImplemented}
+	errMethodNotAllowed      = &serverError{"MethodNotAllowed", "the specified method is not allowed against this resource", http.StatusMethodNotAllowed}
+	errMalformedXML          = &serverError{"MalformedXML", "the XML you provided was not well-formed", http.StatusBadRequest}
+	errInvalidArgument       = &serverError{"InvalidArgument", "invalid argument", http.StatusBadRequest}
+	errAccessDenied          = &serverError{"AccessDenied", "access denied", http.StatusForbidden}
+	errInvalidAccessKeyID    = &serverError{"InvalidAccessKeyId", "the access key ID you provided does not exist", http.StatusForbidden}
+	errSignatureDoesNotMatch = &serverError{"SignatureDoesNotMatch", "the request signature we calculated does not match the signature you provided", http.StatusForbidden}
+	errIncompleteBody        = &serverError{"IncompleteBody", "you did not provide the number of bytes specified by the Content-Length HTTP header", http.StatusBadRequest}
+	errInternalError         = &serverError{"InternalError", "we encountered an internal error, please try again", http.StatusInternalServerError}
+)
+
+type request struct {
+	*http.Request
+	op        Op
+	bucket    string
+	key       string
+	requestID string
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &request{
+		Request:   r,
+		requestID: fmt.Sprintf("%016X", atomic.AddUint64(&s.reqID, 1)),
+	}
+	w.Header().Set("X-Amz-Request-Id", req.requestID)
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		req.bucket, req.key = path[:i], path[i+1:]
+	} else {
+		req.bucket = path
+	}
+
+	op, err := operation(req)
+	if err != nil {
+		s.writeError(w, req, err)
+		return
+	}
+	req.op = op
+
+	if s.Credentials != nil {
+		if err := verifySignature(r, s.Credentials); err != nil {
+			s.writeError(w, req, err)
+			return
+		}
+	}
+
+	fault, err := s.begin(req)
+	if err != nil {
+		if fault != nil && fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((fault.RetryAfter+time.Second-1)/time.Second)))
+		}
+		s.writeError(w, req, err)
+		return
+	}
+
+	switch op {
+	case OpPutObject:
+		err = s.putObject(w, req)
+	case OpGetObject:
+		err = s.getObject(w, req, fault)
+	case OpHeadObject:
+		err = s.headObject(w, req)
+	case OpDeleteObject:
+		err = s.deleteObject(w, req)
+	case OpCopyObject:
+		err = s.copyObject(w, req)
+	case OpCreateMultipartUpload:
+		err = s.createMultipartUpload(w, req)
+	case OpUploadPart:
+		err = s.uploadPart(w, req)
+	case OpUploadPartCopy:
+		err = s.uploadPartCopy(w, req)
+	case OpCompleteMultipartUpload:
+		err = s.completeMultipartUpload(w, req)
+	case OpAbortMultipartUpload:
+		err = s.abortMultipartUpload(w, req)
+	case OpListObjectsV2:
+		err = s.listObjectsV2(w, req)
+	}
+	if err != nil {
+		s.writeError(w, req, err)
+	}
+}
+
+func operation(r *request) (Op, error) {
+	q := r.URL.Query()
+	if r.bucket == "" {
+		return "", errNotImplemented
+	}
+	if r.key == "" {
+		if r.Method == http.MethodGet && q.Get("list-type") == "2" {
+			return OpListObjectsV2, nil
+		}
+		return "", errNotImplemented
+	}
+	_, hasUploads := q["uploads"]
+	_, hasUploadID := q["uploadId"]
+	copySource := r.Header.Get("X-Amz-Copy-Source") != ""
+
+	switch r.Method {
+	case http.MethodPut:
+		switch {
+		case hasUploadID && copySource:
+			return OpUploadPartCopy, nil
+		case hasUploadID:
+			return OpUploadPart, nil
+		case copySource:
+			return OpCopyObject, nil
+		}
+		return OpPutObject, nil
+	case http.MethodGet:
+		if hasUploadID {
+			// ListParts
+			return "", errNotImplemented
+		}
+		return OpGetObject, nil
+	case http.MethodHead:
+		return OpHeadObject, nil
+	case http.MethodPost:
+		switch {
+		case hasUploads:
+			return OpCreateMultipartUpload, nil
+		case hasUploadID:
+			return OpCompleteMultipartUpload, nil
+		}
+		return "", errNotImplemented
+	case http.MethodDelete:
+		if hasUploadID {
+			return OpAbortMultipartUpload, nil
+		}
+		return OpDeleteObject, nil
+	}
+	return "", errMethodNotAllowed
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId"`
+}
+
+func (s *Server) writeError(w http.ResponseWriter, r *request, err error) {
+	var e Error
+	if !errors.As(err, &e) {
+		e = errInternalError
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(e.HTTPStatusCode())
+		return
+	}
+	s.writeXML(w, e.HTTPStatusCode(), &errorResponse{
+		Code:      e.ErrorCode(),
+		Message:   strings.TrimPrefix(e.Error(), e.ErrorCode()+": "),
+		Resource:  r.URL.Path,
+		RequestID: r.requestID,
+	})
+}
+
+func (s *Server) writeXML(w http.ResponseWriter, status int, v interface{}) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,295 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot/localfs"
+	"github.com/at-wat/s3iot/s3api"
+	"github.com/at-wat/s3iot/s3fake"
+)
+
+type client struct {
+	t   *testing.T
+	url string
+}
+
+func (c *client) do(method, path string, header map[string]string, body string) (*http.Response, []byte, error) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.url+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	return res, b, err
+}
+
+func (c *client) mustDo(method, path string, header map[string]string, body string, status int) (*http.Response, []byte) {
+	c.t.Helper()
+	res, b, err := c.do(method, path, header, body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if res.StatusCode != status {
+		c.t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, status, res.StatusCode, b)
+	}
+	return res, b
+}
+
+func TestServer(t *testing.T) {
+	stores := map[string]func(t *testing.T) s3api.S3API{
+		"LocalFS": func(t *testing.T) s3api.S3API { return localfs.New(t.TempDir()) },
+		"Fake":    func(t *testing.T) s3api.S3API { return s3fake.New() },
+	}
+	for name, store := range stores {
+		store := store
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(New(store(t)))
+			defer srv.Close()
+			c := &client{t: t, url: srv.URL}
+
+			t.Run("Object", func(t *testing.T) {
+				res, _ := c.mustDo(http.MethodPut, "/bucket/dir/key", map[string]string{"Content-Type": "text/plain"}, "0123456789", http.StatusOK)
+				etag := res.Header.Get("ETag")
+				if etag != `"781e5e245d69b566979b86e28d23f2c7"` {
+					t.Errorf("Unexpected ETag: %s", etag)
+				}
+
+				res, b := c.mustDo(http.MethodGet, "/bucket/dir/key", map[string]string{"Range": "bytes=2-4"}, "", http.StatusPartialContent)
+				if string(b) != "234" || res.Header.Get("Content-Range") != "bytes 2-4/10" || res.Header.Get("ETag") != etag {
+					t.Errorf("Unexpected response: %s, %v", b, res.Header)
+				}
+
+				res, _ = c.mustDo(http.MethodHead, "/bucket/dir/key", nil, "", http.StatusOK)
+				if res.ContentLength != 10 || res.Header.Get("Content-Type") != "text/plain" || res.Header.Get("Last-Modified") == "" {
+					t.Errorf("Unexpected response header: %v", res.Header)
+				}
+
+				res, b = c.mustDo(http.MethodPut, "/bucket/copied", map[string]string{
+					"X-Amz-Copy-Source":          s3api.CopySource(strPtr("bucket"), strPtr("dir/key"), nil),
+					"X-Amz-Copy-Source-If-Match": etag,
+				}, "", http.StatusOK)
+				var copyRes copyObjectResult
+				if err := xml.Unmarshal(b, &copyRes); err != nil {
+					t.Fatal(err)
+				}
+				if copyRes.ETag != etag {
+					t.Errorf("Expected ETag: %s, got: %s", etag, copyRes.ETag)
+				}
+
+				c.mustDo(http.MethodDelete, "/bucket/copied", nil, "", http.StatusNoContent)
+				_, b = c.mustDo(http.MethodGet, "/bucket/copied", nil, "", http.StatusNotFound)
+				var errRes errorResponse
+				if err := xml.Unmarshal(b, &errRes); err != nil {
+					t.Fatal(err)
+				}
+				if errRes.Code != "NoSuchKey" || errRes.Resource != "/bucket/copied" {
+					t.Errorf("Unexpected error response: %+v", errRes)
+				}
+				if _, b := c.mustDo(http.MethodHead, "/bucket/copied", nil, "", http.StatusNotFound); len(b) != 0 {
+					t.Errorf("HEAD error response must not have body: %s", b)
+				}
+				c.mustDo(http.MethodGet, "/bucket/dir/key", map[string]string{"Range": "bytes=10-"}, "", http.StatusRequestedRangeNotSatisfiable)
+			})
+			t.Run("Multipart", func(t *testing.T) {
+				_, b := c.mustDo(http.MethodPost, "/bucket/mp?uploads", map[string]string{"X-Amz-Meta-Key": "Value"}, "", http.StatusOK)
+				var initRes initiateMultipartUploadResult
+				if err := xml.Unmarshal(b, &initRes); err != nil {
+					t.Fatal(err)
+				}
+				q := "uploadId=" + initRes.UploadID
+
+				res, _ := c.mustDo(http.MethodPut, "/bucket/mp?partNumber=1&"+q, nil, "part1-", http.StatusOK)
+				etag1 := res.Header.Get("ETag")
+				res, _ = c.mustDo(http.MethodPut, "/bucket/mp?partNumber=2&"+q, map[string]string{
+					"Content-Encoding":             "aws-chunked",
+					"X-Amz-Content-Sha256":         "STREAMING-UNSIGNED-PAYLOAD-TRAILER",
+					"X-Amz-Decoded-Content-Length": "5",
+				}, "5\r\npart2\r\n0\r\nx-amz-checksum-crc32:AAAAAA==\r\n\r\n", http.StatusOK)
+				etag2 := res.Header.Get("ETag")
+
+				complete := `<CompleteMultipartUpload xmlns="http://s3.amazonaws.com/doc/2006-03-01/">` +
+					`<Part><ETag>` + etag1 + `</ETag><PartNumber>1</PartNumber></Part>` +
+					`<Part><ETag>` + etag2 + `</ETag><PartNumber>2</PartNumber></Part>` +
+					`</CompleteMultipartUpload>`
+				_, b = c.mustDo(http.MethodPost, "/bucket/mp?"+q, nil, complete, http.StatusOK)
+				var completeRes completeMultipartUploadResult
+				if err := xml.Unmarshal(b, &completeRes); err != nil {
+					t.Fatal(err)
+				}
+				if completeRes.Location != srv.URL+"/bucket/mp" || !strings.HasSuffix(completeRes.ETag, `-2"`) {
+					t.Errorf("Unexpected response: %+v", completeRes)
+				}
+
+				_, b = c.mustDo(http.MethodGet, "/bucket/mp", nil, "", http.StatusOK)
+				if string(b) != "part1-part2" {
+					t.Errorf("Unexpected object: %s", b)
+				}
+				res, _ = c.mustDo(http.MethodHead, "/bucket/mp", nil, "", http.StatusOK)
+				if res.Header.Get("X-Amz-Meta-Key") != "Value" || res.Header.Get("X-Amz-Mp-Parts-Count") != "2" {
+					t.Errorf("Unexpected response header: %v", res.Header)
+				}
+
+				_, b = c.mustDo(http.MethodPost, "/bucket/mp2?uploads", nil, "", http.StatusOK)
+				if err := xml.Unmarshal(b, &initRes); err != nil {
+					t.Fatal(err)
+				}
+				c.mustDo(http.MethodDelete, "/bucket/mp2?uploadId="+initRes.UploadID, nil, "", http.StatusNoContent)
+				c.mustDo(http.MethodPut, "/bucket/mp2?partNumber=1&uploadId="+initRes.UploadID, nil, "part1", http.StatusNotFound)
+			})
+			t.Run("ListObjectsV2", func(t *testing.T) {
+				var keys []string
+				var token string
+				for {
+					path := "/bucket?list-type=2&max-keys=1"
+					if token != "" {
+						path += "&continuation-token=" + token
+					}
+					_, b := c.mustDo(http.MethodGet, path, nil, "", http.StatusOK)
+					var res listBucketResult
+					if err := xml.Unmarshal(b, &res); err != nil {
+						t.Fatal(err)
+					}
+					for _, c := range res.Contents {
+						keys = append(keys, c.Key)
+					}
+					if !res.IsTruncated {
+						break
+					}
+					token = res.NextContinuationToken
+				}
+				if expected := []string{"dir/key", "mp"}; !reflect.DeepEqual(expected, keys) {
+					t.Errorf("Expected keys: %v, got: %v", expected, keys)
+				}
+				c.mustDo(http.MethodGet, "/bucket?list-type=2&delimiter=%2F", nil, "", http.StatusNotImplemented)
+				c.mustDo(http.MethodGet, "/", nil, "", http.StatusNotImplemented)
+			})
+		})
+	}
+}
+
+func TestServer_Fault(t *testing.T) {
+	s := New(s3fake.New())
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := &client{t: t, url: srv.URL}
+	c.mustDo(http.MethodPut, "/bucket/key", nil, "0123456789", http.StatusOK)
+
+	t.Run("ErrorResponse", func(t *testing.T) {
+		s.Inject(Fault{Op: OpGetObject, StatusCode: http.StatusServiceUnavailable, Code: "SlowDown", Times: 1})
+		defer s.ClearFaults()
+		_, b := c.mustDo(http.MethodGet, "/bucket/key", nil, "", http.StatusServiceUnavailable)
+		var errRes errorResponse
+		if err := xml.Unmarshal(b, &errRes); err != nil {
+			t.Fatal(err)
+		}
+		if errRes.Code != "SlowDown" {
+			t.Errorf("Expected error code: SlowDown, got: %s", errRes.Code)
+		}
+		c.mustDo(http.MethodGet, "/bucket/key", nil, "", http.StatusOK)
+	})
+	t.Run("RetryAfter", func(t *testing.T) {
+		s.Inject(Fault{Op: OpGetObject, StatusCode: http.StatusServiceUnavailable, RetryAfter: 1500 * time.Millisecond})
+		defer s.ClearFaults()
+		res, _ := c.mustDo(http.MethodGet, "/bucket/key", nil, "", http.StatusServiceUnavailable)
+		if ra := res.Header.Get("Retry-After"); ra != "2" {
+			t.Errorf("Expected Retry-After: 2, got: '%s'", ra)
+		}
+	})
+	t.Run("DefaultCode", func(t *testing.T) {
+		s.Inject(Fault{Op: OpGetObject, StatusCode: http.StatusServiceUnavailable})
+		defer s.ClearFaults()
+		_, b := c.mustDo(http.MethodGet, "/bucket/key", nil, "", http.StatusServiceUnavailable)
+		if !bytes.Contains(b, []byte("<Code>ServiceUnavailable</Code>")) {
+			t.Errorf("Unexpected response: %s", b)
+		}
+	})
+	t.Run("ResetConnection", func(t *testing.T) {
+		s.Inject(Fault{Op: OpPutObject, ResetConnection: true})
+		defer s.ClearFaults()
+		if _, _, err := c.do(http.MethodPut, "/bucket/key", nil, "data"); err == nil {
+			t.Error("Request must fail")
+		}
+	})
+	t.Run("PartialBody", func(t *testing.T) {
+		partial := int64(3)
+		s.Inject(Fault{Op: OpGetObject, PartialBody: &partial})
+		defer s.ClearFaults()
+		_, b, err := c.do(http.MethodGet, "/bucket/key", nil, "")
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("Expected error: '%v', got: '%v'", io.ErrUnexpectedEOF, err)
+		}
+		if string(b) != "012" {
+			t.Errorf("Expected partial body: 012, got: %s", b)
+		}
+	})
+	t.Run("Calls", func(t *testing.T) {
+		n := s.Calls(OpHeadObject)
+		c.mustDo(http.MethodHead, "/bucket/key", nil, "", http.StatusOK)
+		if n2 := s.Calls(OpHeadObject); n2 != n+1 {
+			t.Errorf("Expected calls: %d, got: %d", n+1, n2)
+		}
+	})
+}
+
+func TestParseCopySource(t *testing.T) {
+	testCases := map[string]struct {
+		src       string
+		bucket    string
+		key       string
+		versionID *string
+		err       error
+	}{
+		"Simple":    {src: "bucket/key", bucket: "bucket", key: "key"},
+		"Slash":     {src: "/bucket/dir/key", bucket: "bucket", key: "dir/key"},
+		"Escaped":   {src: "bucket/dir/a%20b%2Bc", bucket: "bucket", key: "dir/a b+c"},
+		"VersionID": {src: "bucket/key?versionId=v%2B1", bucket: "bucket", key: "key", versionID: strPtr("v+1")},
+		"NoKey":     {src: "bucket", err: errInvalidArgument},
+		"EmptyKey":  {src: "bucket/", err: errInvalidArgument},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			bucket, key, versionID, err := parseCopySource(tt.src)
+			if err != tt.err {
+				t.Fatalf("Expected error: '%v', got: '%v'", tt.err, err)
+			}
+			if bucket != tt.bucket || key != tt.key || !reflect.DeepEqual(tt.versionID, versionID) {
+				t.Errorf("Expected: %s, %s, %v, got: %s, %s, %v", tt.bucket, tt.key, tt.versionID, bucket, key, versionID)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
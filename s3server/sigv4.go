@@ -0,0 +1,167 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	sigV4Algorithm      = "AWS4-HMAC-SHA256"
+	emptyPayloadSHA256  = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	sigV4Terminator     = "aws4_request"
+	headerContentSHA256 = "X-Amz-Content-Sha256"
+)
+
+// verifySignature verifies AWS Signature Version 4 in Authorization header.
+// Payload hash is taken from x-amz-content-sha256 header and
+// the payload itself and chunk signatures are not verified.
+func verifySignature(r *http.Request, credentials map[string]string) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, sigV4Algorithm+" ") {
+		return errAccessDenied
+	}
+	var credential, signedHeaders, signature string
+	for _, kv := range strings.Split(auth[len(sigV4Algorithm)+1:], ",") {
+		kv = strings.TrimSpace(kv)
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return errAccessDenied
+		}
+		switch kv[:i] {
+		case "Credential":
+			credential = kv[i+1:]
+		case "SignedHeaders":
+			signedHeaders = kv[i+1:]
+		case "Signature":
+			signature = kv[i+1:]
+		}
+	}
+	// Credential is AccessKeyID/Date/Region/Service/aws4_request.
+	cred := strings.Split(credential, "/")
+	if len(cred) != 5 || cred[4] != sigV4Terminator || signedHeaders == "" || signature == "" {
+		return errAccessDenied
+	}
+	secret, ok := credentials[cred[0]]
+	if !ok {
+		return errInvalidAccessKeyID
+	}
+	date := r.Header.Get("X-Amz-Date")
+	if date == "" {
+		return errAccessDenied
+	}
+	payloadHash := r.Header.Get(headerContentSHA256)
+	if payloadHash == "" {
+		payloadHash = emptyPayloadSHA256
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders(r, strings.Split(signedHeaders, ";")),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join(cred[1:], "/")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		date,
+		scope,
+		hexSHA256(canonicalRequest),
+	}, "\n")
+
+	key := []byte("AWS4" + secret)
+	for _, s := range cred[1:] {
+		key = hmacSHA256(key, s)
+	}
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errSignatureDoesNotMatch
+	}
+	return nil
+}
+
+func canonicalQuery(q url.Values) string {
+	params := make([]string, 0, len(q))
+	for k, vs := range q {
+		for _, v := range vs {
+			params = append(params, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func canonicalHeaders(r *http.Request, names []string) string {
+	var s strings.Builder
+	for _, name := range names {
+		var value string
+		switch name {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = r.Header.Get("Content-Length")
+			if value == "" {
+				value = strconv.FormatInt(r.ContentLength, 10)
+			}
+		default:
+			var vs []string
+			for _, v := range r.Header.Values(name) {
+				vs = append(vs, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(vs, ",")
+		}
+		s.WriteString(name)
+		s.WriteByte(':')
+		s.WriteString(value)
+		s.WriteByte('\n')
+	}
+	return s.String()
+}
+
+// uriEncode encodes the string as specified by AWS Signature Version 4.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteString(strings.ToUpper(hex.EncodeToString([]byte{c})))
+	}
+	return b.String()
+}
+
+func hexSHA256(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
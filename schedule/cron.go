@@ -0,0 +1,179 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSpec is returned if the cron spec is invalid.
+var ErrInvalidSpec = errors.New("invalid cron spec")
+
+// maxSearchIterations limits the iterations to search the next match
+// to avoid infinite loop on the spec never matches like "0 0 30 2 *".
+const maxSearchIterations = 100000
+
+type cronField struct {
+	bits uint64
+	all  bool
+}
+
+func (f cronField) match(v int) bool {
+	return f.bits&(1<<uint(v)) != 0
+}
+
+// cronSpec represents standard 5-field cron spec:
+// minute, hour, day of month, month and day of week.
+type cronSpec struct {
+	minute, hour, dom, month, dow cronField
+}
+
+func parseCron(spec string) (*cronSpec, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q: expected 5 fields", ErrInvalidSpec, spec)
+	}
+	var s cronSpec
+	for i, f := range []struct {
+		dst    *cronField
+		lo, hi int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	} {
+		v, err := parseCronField(fields[i], f.lo, f.hi)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidSpec, spec, err)
+		}
+		*f.dst = v
+	}
+	// Both 0 and 7 represent Sunday.
+	if s.dow.match(7) {
+		s.dow.bits |= 1
+	}
+	return &s, nil
+}
+
+func parseCronField(field string, lo, hi int) (cronField, error) {
+	var f cronField
+	for _, expr := range strings.Split(field, ",") {
+		rng, step := expr, 1
+		if i := strings.IndexByte(expr, '/'); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(expr[i+1:]); err != nil || step <= 0 {
+				return f, fmt.Errorf("invalid step %q", expr)
+			}
+			rng = expr[:i]
+		}
+		first, last := lo, hi
+		switch {
+		case rng == "*":
+			// Stepped wildcard is also treated as unrestricted in day matching
+			// like Vixie cron.
+			f.all = true
+		case strings.IndexByte(rng, '-') >= 0:
+			i := strings.IndexByte(rng, '-')
+			var err1, err2 error
+			first, err1 = strconv.Atoi(rng[:i])
+			last, err2 = strconv.Atoi(rng[i+1:])
+			if err1 != nil || err2 != nil {
+				return f, fmt.Errorf("invalid range %q", expr)
+			}
+		default:
+			var err error
+			if first, err = strconv.Atoi(rng); err != nil {
+				return f, fmt.Errorf("invalid value %q", expr)
+			}
+			last = first
+			if step != 1 {
+				last = hi
+			}
+		}
+		if first < lo || last > hi || first > last {
+			return f, fmt.Errorf("%q out of range [%d, %d]", expr, lo, hi)
+		}
+		for v := first; v <= last; v += step {
+			f.bits |= 1 << uint(v)
+		}
+	}
+	return f, nil
+}
+
+// match returns true if the wall clock of t matches the spec.
+func (s *cronSpec) match(t time.Time) bool {
+	return s.minute.match(t.Minute()) &&
+		s.hour.match(t.Hour()) &&
+		s.month.match(int(t.Month())) &&
+		s.dayMatch(t)
+}
+
+// dayMatch follows the cron convention that the day is matched
+// by either of day of month or day of week if both are restricted.
+func (s *cronSpec) dayMatch(t time.Time) bool {
+	dom := s.dom.match(t.Day())
+	dow := s.dow.match(int(t.Weekday()))
+	if s.dom.all || s.dow.all {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first matching time after t in the location.
+// Zero time is returned if no match is found.
+func (s *cronSpec) next(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	n := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	for i := 0; i < maxSearchIterations; i++ {
+		var nn time.Time
+		switch {
+		case !s.month.match(int(n.Month())):
+			nn = time.Date(n.Year(), n.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatch(n):
+			nn = time.Date(n.Year(), n.Month(), n.Day()+1, 0, 0, 0, 0, loc)
+		case !s.hour.match(n.Hour()):
+			nn = time.Date(n.Year(), n.Month(), n.Day(), n.Hour()+1, 0, 0, 0, loc)
+		case !s.minute.match(n.Minute()):
+			nn = n.Add(time.Minute)
+		default:
+			return n
+		}
+		// Wall clock may go back on the end of daylight saving time.
+		if !nn.After(n) {
+			nn = n.Add(time.Minute)
+		}
+		n = nn
+	}
+	return time.Time{}
+}
+
+// prev returns the last matching time at or before t in the location
+// within the given duration.
+func (s *cronSpec) prev(t time.Time, loc *time.Location, within time.Duration) (time.Time, bool) {
+	t = t.In(loc)
+	p := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	for ; t.Sub(p) < within; p = p.Add(-time.Minute) {
+		if s.match(p) {
+			return p, true
+		}
+	}
+	return time.Time{}, false
+}
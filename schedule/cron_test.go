@@ -0,0 +1,160 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata" // for the time zone tests
+)
+
+func TestParseCron(t *testing.T) {
+	for _, spec := range []string{
+		"* * * * *",
+		"0 22 * * *",
+		"*/15 0-6,22-23 1 */2 1-5",
+		"30 12 * * 7",
+		"5/10 * * * *",
+	} {
+		if _, err := parseCron(spec); err != nil {
+			t.Errorf("Failed to parse %q: %v", spec, err)
+		}
+	}
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+	} {
+		if _, err := parseCron(spec); !errors.Is(err, ErrInvalidSpec) {
+			t.Errorf("Expected error %v for %q, got: %v", ErrInvalidSpec, spec, err)
+		}
+	}
+}
+
+func TestCronSpec(t *testing.T) {
+	nyc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jst := time.FixedZone("JST", 9*60*60)
+
+	testCases := map[string]struct {
+		spec     string
+		loc      *time.Location
+		t        time.Time
+		expected time.Time
+	}{
+		"EveryMinute": {
+			spec:     "* * * * *",
+			loc:      time.UTC,
+			t:        time.Date(2021, 1, 1, 0, 0, 30, 0, time.UTC),
+			expected: time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC),
+		},
+		"Daily": {
+			spec:     "0 22 * * *",
+			loc:      time.UTC,
+			t:        time.Date(2021, 1, 1, 22, 0, 0, 0, time.UTC),
+			expected: time.Date(2021, 1, 2, 22, 0, 0, 0, time.UTC),
+		},
+		"TimeZone": {
+			spec:     "0 22 * * *",
+			loc:      jst,
+			t:        time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC),
+			expected: time.Date(2021, 1, 1, 13, 0, 0, 0, time.UTC),
+		},
+		"DayOfWeek": {
+			// 2021-01-01 is Friday.
+			spec:     "0 9 * * 1",
+			loc:      time.UTC,
+			t:        time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC),
+		},
+		"Sunday7": {
+			spec:     "0 0 * * 7",
+			loc:      time.UTC,
+			t:        time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC),
+		},
+		"DayOfMonthOrWeek": {
+			spec:     "0 0 15 * 1",
+			loc:      time.UTC,
+			t:        time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC),
+		},
+		"Month": {
+			spec:     "0 0 1 3 *",
+			loc:      time.UTC,
+			t:        time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"LeapDay": {
+			spec:     "0 0 29 2 *",
+			loc:      time.UTC,
+			t:        time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		"Never": {
+			spec: "0 0 30 2 *",
+			loc:  time.UTC,
+			t:    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"DSTStart": {
+			// 02:30 doesn't exist on 2021-03-14 in New York.
+			spec:     "30 2 * * *",
+			loc:      nyc,
+			t:        time.Date(2021, 3, 14, 0, 0, 0, 0, nyc),
+			expected: time.Date(2021, 3, 15, 2, 30, 0, 0, nyc),
+		},
+		"DSTEnd": {
+			spec:     "0 3 * * *",
+			loc:      nyc,
+			t:        time.Date(2021, 11, 7, 0, 0, 0, 0, nyc),
+			expected: time.Date(2021, 11, 7, 3, 0, 0, 0, nyc),
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			s, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := s.next(tt.t, tt.loc)
+			if !next.Equal(tt.expected) {
+				t.Fatalf("Expected next: %v, got: %v", tt.expected, next)
+			}
+			if next.IsZero() {
+				return
+			}
+			prev, ok := s.prev(next.Add(time.Minute-time.Nanosecond), tt.loc, time.Minute)
+			if !ok || !prev.Equal(next) {
+				t.Errorf("Expected prev: %v, got: %v (%v)", next, prev, ok)
+			}
+			if _, ok := s.prev(next.Add(-time.Nanosecond), tt.loc, next.Sub(tt.t)-time.Nanosecond); ok {
+				t.Error("Unexpected match before next")
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schedule provides a scheduler to control transfers and bandwidth
+// by time windows.
+//
+// Each Window starts at the time matching the cron spec and lasts for the
+// duration. While the window is active, its Action is applied:
+// registered transfers are paused or the bandwidth is limited.
+//
+//	limiter := s3iot.NewWaitReadInterceptorFactory(0)
+//	s, err := schedule.New(
+//		[]schedule.Window{
+//			// Full speed at night.
+//			{Spec: "0 22 * * *", Duration: 8 * time.Hour},
+//			// Pause during the peak hours on weekdays.
+//			{Spec: "0 17 * * 1-5", Duration: 5 * time.Hour, Action: schedule.Action{Paused: true}},
+//		},
+//		schedule.WithDefault(schedule.Action{Bandwidth: 16 * 1024}),
+//		schedule.WithLimiter(limiter),
+//		schedule.WithLocation(loc),
+//	)
+//	go s.Run(ctx)
+//	uc, err := uploader.Upload(ctx, input) // uploader has WithReadInterceptor(limiter)
+//	s.Add(uc)
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/at-wat/s3iot"
+)
+
+// ErrInvalidDuration is returned if the duration of the window is not positive.
+var ErrInvalidDuration = errors.New("window duration must be positive")
+
+// Action represents the transfer control applied during the window.
+type Action struct {
+	// Paused pauses the registered transfers.
+	Paused bool
+	// Bandwidth limits the bandwidth in bytes per second.
+	// Zero means unlimited.
+	Bandwidth int64
+}
+
+// WaitPerByte returns the wait/byte value corresponding to the Bandwidth.
+func (a Action) WaitPerByte() time.Duration {
+	if a.Bandwidth <= 0 {
+		return 0
+	}
+	return time.Second / time.Duration(a.Bandwidth)
+}
+
+// Window represents time window with the action.
+type Window struct {
+	// Spec is the standard 5-field cron spec of the window start:
+	// minute, hour, day of month, month and day of week.
+	Spec string
+	// Duration is the length of the window.
+	Duration time.Duration
+	// Action is applied while the window is active.
+	Action Action
+}
+
+// Limiter limits the bandwidth.
+// s3iot.WaitReadInterceptorFactory implements Limiter.
+type Limiter interface {
+	SetWaitPerByte(time.Duration)
+}
+
+// Scheduler applies the Action of the active Window.
+// If multiple windows are active, the first one in the list takes precedence.
+// Pausers implementing s3iot.SharedPauser are kept paused while they are
+// paused by the others like connectivity.Controller.
+type Scheduler struct {
+	windows []window
+
+	defaultAction Action
+	limiter       Limiter
+	loc           *time.Location
+	clock         s3iot.Clock
+	onChange      func(Action)
+
+	mu       sync.Mutex
+	current  Action
+	applied  bool
+	pausers  []s3iot.Pauser
+	pausedBy map[s3iot.Pauser]bool
+}
+
+type window struct {
+	Window
+	spec *cronSpec
+}
+
+// Option configures Scheduler.
+type Option func(*Scheduler)
+
+// WithDefault sets the Action applied outside of the windows.
+func WithDefault(a Action) Option {
+	return func(s *Scheduler) {
+		s.defaultAction = a
+	}
+}
+
+// WithLimiter sets the Limiter controlled by the Scheduler.
+func WithLimiter(l Limiter) Option {
+	return func(s *Scheduler) {
+		s.limiter = l
+	}
+}
+
+// WithLocation sets the time zone of the cron specs.
+// Local time zone is used by default.
+func WithLocation(loc *time.Location) Option {
+	return func(s *Scheduler) {
+		s.loc = loc
+	}
+}
+
+// WithClock sets Clock.
+func WithClock(c s3iot.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// WithOnChange sets the callback called when the applied Action is changed.
+func WithOnChange(fn func(Action)) Option {
+	return func(s *Scheduler) {
+		s.onChange = fn
+	}
+}
+
+// New creates Scheduler.
+func New(windows []Window, opts ...Option) (*Scheduler, error) {
+	s := &Scheduler{
+		loc:      time.Local,
+		clock:    s3iot.DefaultClock,
+		pausedBy: make(map[s3iot.Pauser]bool),
+	}
+	for _, w := range windows {
+		spec, err := parseCron(w.Spec)
+		if err != nil {
+			return nil, err
+		}
+		if w.Duration <= 0 {
+			return nil, ErrInvalidDuration
+		}
+		s.windows = append(s.windows, window{Window: w, spec: spec})
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// At returns the Action at the given time and the time of the next
+// possible change.
+// Zero next time means that the Action never changes.
+func (s *Scheduler) At(t time.Time) (Action, time.Time) {
+	action := s.defaultAction
+	var found bool
+	var next time.Time
+	earlier := func(n time.Time) {
+		if !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	for _, w := range s.windows {
+		if start, ok := w.spec.prev(t, s.loc, w.Duration); ok {
+			if !found {
+				action = w.Action
+				found = true
+			}
+			earlier(start.Add(w.Duration))
+		}
+		earlier(w.spec.next(t, s.loc))
+	}
+	return action, next
+}
+
+// Current returns the currently applied Action.
+func (s *Scheduler) Current() Action {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// Add registers the Pauser.
+// The Pauser is paused immediately if the current Action is paused.
+// If the Pauser implements s3iot.DoneNotifier, it is removed after
+// the completion.
+func (s *Scheduler) Add(p s3iot.Pauser) {
+	s.mu.Lock()
+	s.pausers = append(s.pausers, p)
+	if s.current.Paused {
+		s.pauseLocked(p)
+	}
+	s.mu.Unlock()
+
+	if dn, ok := p.(s3iot.DoneNotifier); ok {
+		go func() {
+			<-dn.Done()
+			s.Remove(p)
+		}()
+	}
+}
+
+// Remove unregisters the Pauser.
+// The Pauser paused by the Scheduler is resumed.
+func (s *Scheduler) Remove(p s3iot.Pauser) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, pp := range s.pausers {
+		if pp == p {
+			s.pausers = append(s.pausers[:i], s.pausers[i+1:]...)
+			break
+		}
+	}
+	if s.pausedBy[p] {
+		delete(s.pausedBy, p)
+		s3iot.ResumeBy(p, s)
+	}
+}
+
+// Apply applies the Action at the current time and returns the time of
+// the next possible change.
+func (s *Scheduler) Apply() time.Time {
+	action, next := s.At(s.clock.Now())
+
+	s.mu.Lock()
+	if s.applied && action == s.current {
+		s.mu.Unlock()
+		return next
+	}
+	s.applied = true
+	s.current = action
+	if s.limiter != nil {
+		s.limiter.SetWaitPerByte(action.WaitPerByte())
+	}
+	// Pause and resume are called under the lock to keep their order.
+	if action.Paused {
+		for _, p := range s.pausers {
+			s.pauseLocked(p)
+		}
+	} else {
+		for _, p := range s.pausers {
+			if s.pausedBy[p] {
+				s3iot.ResumeBy(p, s)
+			}
+		}
+		s.pausedBy = make(map[s3iot.Pauser]bool)
+	}
+	onChange := s.onChange
+	s.mu.Unlock()
+
+	if onChange != nil {
+		onChange(action)
+	}
+	return next
+}
+
+func (s *Scheduler) pauseLocked(p s3iot.Pauser) {
+	if s.pausedBy[p] {
+		return
+	}
+	s.pausedBy[p] = true
+	s3iot.PauseBy(p, s, false)
+}
+
+// Run applies the Actions on schedule until ctx is canceled.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		next := s.Apply()
+		var wait <-chan time.Time
+		if !next.IsZero() {
+			wait = s.clock.After(next.Sub(s.clock.Now()))
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
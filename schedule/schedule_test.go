@@ -0,0 +1,292 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/clocktest"
+)
+
+var _ Limiter = &s3iot.WaitReadInterceptorFactory{}
+
+func TestNew(t *testing.T) {
+	if _, err := New([]Window{{Spec: "0 0 * *", Duration: time.Hour}}); !errors.Is(err, ErrInvalidSpec) {
+		t.Errorf("Expected error: %v, got: %v", ErrInvalidSpec, err)
+	}
+	if _, err := New([]Window{{Spec: "0 0 * * *"}}); !errors.Is(err, ErrInvalidDuration) {
+		t.Errorf("Expected error: %v, got: %v", ErrInvalidDuration, err)
+	}
+}
+
+func TestAction_WaitPerByte(t *testing.T) {
+	if w := (Action{}).WaitPerByte(); w != 0 {
+		t.Errorf("Unlimited bandwidth must not wait, got %v", w)
+	}
+	if w := (Action{Bandwidth: 1000}).WaitPerByte(); w != time.Millisecond {
+		t.Errorf("Expected %v, got %v", time.Millisecond, w)
+	}
+}
+
+func TestScheduler_At(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	night := Action{Bandwidth: 1 << 20}
+	peak := Action{Paused: true}
+	def := Action{Bandwidth: 1024}
+
+	s, err := New(
+		[]Window{
+			{Spec: "0 17 * * 1-5", Duration: 5 * time.Hour, Action: peak},
+			{Spec: "0 21 * * *", Duration: 9 * time.Hour, Action: night},
+		},
+		WithDefault(def),
+		WithLocation(jst),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2021-01-01 is Friday.
+	testCases := map[string]struct {
+		t              time.Time
+		expectedAction Action
+		expectedNext   time.Time
+	}{
+		"Default": {
+			t:              time.Date(2021, 1, 1, 12, 0, 0, 0, jst),
+			expectedAction: def,
+			expectedNext:   time.Date(2021, 1, 1, 17, 0, 0, 0, jst),
+		},
+		"Peak": {
+			t:              time.Date(2021, 1, 1, 17, 0, 0, 0, jst),
+			expectedAction: peak,
+			expectedNext:   time.Date(2021, 1, 1, 21, 0, 0, 0, jst),
+		},
+		"PeakOverlapsNight": {
+			t:              time.Date(2021, 1, 1, 21, 30, 0, 0, jst),
+			expectedAction: peak,
+			expectedNext:   time.Date(2021, 1, 1, 22, 0, 0, 0, jst),
+		},
+		"Night": {
+			t:              time.Date(2021, 1, 1, 22, 0, 0, 0, jst),
+			expectedAction: night,
+			expectedNext:   time.Date(2021, 1, 2, 6, 0, 0, 0, jst),
+		},
+		"NightInUTC": {
+			t:              time.Date(2021, 1, 1, 20, 0, 0, 0, time.UTC),
+			expectedAction: night,
+			expectedNext:   time.Date(2021, 1, 2, 6, 0, 0, 0, jst),
+		},
+		"Weekend": {
+			t:              time.Date(2021, 1, 2, 18, 0, 0, 0, jst),
+			expectedAction: def,
+			expectedNext:   time.Date(2021, 1, 2, 21, 0, 0, 0, jst),
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			action, next := s.At(tt.t)
+			if action != tt.expectedAction {
+				t.Errorf("Expected action: %+v, got: %+v", tt.expectedAction, action)
+			}
+			if !next.Equal(tt.expectedNext) {
+				t.Errorf("Expected next: %v, got: %v", tt.expectedNext, next)
+			}
+		})
+	}
+
+	t.Run("NoWindow", func(t *testing.T) {
+		s, err := New(nil, WithDefault(def))
+		if err != nil {
+			t.Fatal(err)
+		}
+		action, next := s.At(time.Now())
+		if action != def || !next.IsZero() {
+			t.Errorf("Unexpected action %+v, next %v", action, next)
+		}
+	})
+}
+
+func TestScheduler_Run(t *testing.T) {
+	clock := clocktest.New(time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC))
+	limiter := &limiter{}
+	var changes []Action
+	s, err := New(
+		[]Window{
+			{Spec: "0 1 * * *", Duration: time.Hour, Action: Action{Paused: true}},
+			{Spec: "0 3 * * *", Duration: time.Hour, Action: Action{Bandwidth: 100}},
+		},
+		WithLimiter(limiter),
+		WithLocation(time.UTC),
+		WithClock(clock),
+		WithOnChange(func(a Action) {
+			changes = append(changes, a)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newPauser()
+	s.Add(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chErr := make(chan error)
+	go func() {
+		chErr <- s.Run(ctx)
+	}()
+
+	for i, tt := range []struct {
+		expectedWait        time.Duration
+		expectedPaused      bool
+		expectedWaitPerByte time.Duration
+	}{
+		{30 * time.Minute, false, 0},
+		{time.Hour, true, 0},
+		{time.Hour, false, 0},
+		{time.Hour, false, 10 * time.Millisecond},
+		{21 * time.Hour, false, 0},
+		{time.Hour, true, 0},
+	} {
+		clock.BlockUntil(1)
+		if wait, _ := clock.Next(); wait != tt.expectedWait {
+			t.Fatalf("%d: Expected wait: %v, got: %v", i, tt.expectedWait, wait)
+		}
+		if paused := p.isPaused(); paused != tt.expectedPaused {
+			t.Fatalf("%d: Expected paused: %v", i, tt.expectedPaused)
+		}
+		if w := limiter.get(); w != tt.expectedWaitPerByte {
+			t.Fatalf("%d: Expected wait/byte: %v, got: %v", i, tt.expectedWaitPerByte, w)
+		}
+		clock.Advance(tt.expectedWait)
+	}
+	clock.BlockUntil(1)
+
+	cancel()
+	select {
+	case err := <-chErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected error: %v, got: %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout")
+	}
+	if len(changes) != 7 {
+		t.Errorf("Expected 7 changes, got %d", len(changes))
+	}
+	if p.pauses != 2 || p.resumes != 2 {
+		t.Errorf("Expected to be paused and resumed twice, paused %d times, resumed %d times", p.pauses, p.resumes)
+	}
+}
+
+func TestScheduler_AddRemove(t *testing.T) {
+	clock := clocktest.New(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	s, err := New(
+		[]Window{{Spec: "0 0 * * *", Duration: time.Hour, Action: Action{Paused: true}}},
+		WithLocation(time.UTC),
+		WithClock(clock),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Apply()
+	if !s.Current().Paused {
+		t.Fatal("Current action must be paused")
+	}
+
+	p1, p2 := newPauser(), newPauser()
+	s.Add(p1)
+	s.Add(p2)
+	if !p1.isPaused() || !p2.isPaused() {
+		t.Fatal("Pauser added during paused window must be paused")
+	}
+	s.Remove(p1)
+	if p1.isPaused() {
+		t.Fatal("Removed Pauser must be resumed")
+	}
+	close(p2.done)
+	timeout := time.After(time.Second)
+	for p2.isPaused() {
+		select {
+		case <-timeout:
+			t.Fatal("Timeout")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	clock.Advance(time.Hour)
+	s.Apply()
+	if p1.resumes != 1 || p2.resumes != 1 {
+		t.Errorf("Removed Pauser must not be resumed again")
+	}
+}
+
+type limiter struct {
+	mu          sync.Mutex
+	waitPerByte time.Duration
+}
+
+func (l *limiter) SetWaitPerByte(w time.Duration) {
+	l.mu.Lock()
+	l.waitPerByte = w
+	l.mu.Unlock()
+}
+
+func (l *limiter) get() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.waitPerByte
+}
+
+type pauser struct {
+	mu      sync.Mutex
+	paused  bool
+	pauses  int
+	resumes int
+	done    chan struct{}
+}
+
+func newPauser() *pauser {
+	return &pauser{done: make(chan struct{})}
+}
+
+func (p *pauser) Pause() {
+	p.mu.Lock()
+	p.paused = true
+	p.pauses++
+	p.mu.Unlock()
+}
+
+func (p *pauser) Resume() {
+	p.mu.Lock()
+	p.paused = false
+	p.resumes++
+	p.mu.Unlock()
+}
+
+func (p *pauser) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *pauser) isPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot
+
+import (
+	"context"
+	"time"
+)
+
+// Transfer operations.
+const (
+	OperationUpload   = "Upload"
+	OperationDownload = "Download"
+	OperationCopy     = "Copy"
+)
+
+// TransferInfo describes the transfer traced by Tracer.
+type TransferInfo struct {
+	Operation    string
+	Bucket       string
+	Key          string
+	SourceBucket string // Copy only
+	SourceKey    string // Copy only
+}
+
+// Tracer traces the transfers of Uploader, Downloader and Copier.
+type Tracer interface {
+	// StartTransfer is called on the beginning of the transfer.
+	// Returned context is passed to the API calls of the transfer.
+	StartTransfer(ctx context.Context, info TransferInfo) (context.Context, TransferSpan)
+}
+
+// TransferSpan traces a transfer.
+// Methods may be called from multiple goroutines.
+type TransferSpan interface {
+	// StartPart is called on the beginning of the part transfer.
+	// id is the part number, or 0 if the object is transferred by a single call.
+	// Returned context is passed to the API calls of the part.
+	StartPart(ctx context.Context, id int64) (context.Context, PartSpan)
+	// Pause is called when the transfer is paused.
+	Pause()
+	// Resume is called when the transfer is resumed.
+	Resume()
+	// Throttle is called when the API call is throttled by the server.
+	Throttle(id int64, wait time.Duration)
+	// End is called when the transfer is completed or failed.
+	End(err error)
+}
+
+// PartSpan traces a part of the transfer.
+type PartSpan interface {
+	// End is called when the part is transferred or failed.
+	End(err error)
+}
+
+// WithTracer sets Tracer.
+func WithTracer(t Tracer) UpDownloaderOption {
+	return UpDownloaderOptionFn(func(u *UpDownloaderBase) {
+		u.Tracer = t
+	})
+}
+
+// CallInfo describes the API call attempt made by Uploader, Downloader or Copier.
+type CallInfo struct {
+	// API is the name of the API operation like "UploadPart".
+	API string
+	// ID is the part number, 0 for the operations on the whole object,
+	// or -1 for completing the multipart upload.
+	ID int64
+	// Attempt is the number of the attempts starting from 1.
+	Attempt int
+}
+
+type callInfoKey struct{}
+
+// CallInfoFromContext returns CallInfo of the API call attempt.
+// It can be used by s3api.S3API implementations to annotate the calls.
+func CallInfoFromContext(ctx context.Context) (CallInfo, bool) {
+	ci, ok := ctx.Value(callInfoKey{}).(CallInfo)
+	return ci, ok
+}
+
+type noopTransferSpan struct{}
+
+func (noopTransferSpan) StartPart(ctx context.Context, _ int64) (context.Context, PartSpan) {
+	return ctx, noopPartSpan{}
+}
+
+func (noopTransferSpan) Pause()                        {}
+func (noopTransferSpan) Resume()                       {}
+func (noopTransferSpan) Throttle(int64, time.Duration) {}
+func (noopTransferSpan) End(error)                     {}
+
+type noopPartSpan struct{}
+
+func (noopPartSpan) End(error) {}
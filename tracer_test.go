@@ -0,0 +1,190 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3iot_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/s3api"
+)
+
+func TestTracer(t *testing.T) {
+	var (
+		bucket = "Bucket"
+		key    = "Key"
+	)
+	data := make([]byte, 128)
+
+	buf := &bytes.Buffer{}
+	ch := make(chan interface{})
+	api := newUploadMockAPI(buf, map[string]int{"upload": 1}, map[string]chan interface{}{"upload": ch})
+
+	var mu sync.Mutex
+	var calls []string
+	record := func(ctx context.Context, op string) {
+		ci, ok := s3iot.CallInfoFromContext(ctx)
+		if !ok {
+			t.Errorf("%s: CallInfo must be set", op)
+		}
+		mu.Lock()
+		calls = append(calls, fmt.Sprintf("%s %s id=%d attempt=%d", tracePath(ctx), op, ci.ID, ci.Attempt))
+		mu.Unlock()
+	}
+	createMultipartUpload := api.CreateMultipartUploadFunc
+	api.CreateMultipartUploadFunc = func(ctx context.Context, input *s3api.CreateMultipartUploadInput) (*s3api.CreateMultipartUploadOutput, error) {
+		record(ctx, "create")
+		return createMultipartUpload(ctx, input)
+	}
+	var uc s3iot.UploadContext
+	uploadPart := api.UploadPartFunc
+	api.UploadPartFunc = func(ctx context.Context, input *s3api.UploadPartInput) (*s3api.UploadPartOutput, error) {
+		record(ctx, "upload")
+		if *input.PartNumber == 2 {
+			uc.Pause()
+			uc.Pause()
+			uc.Resume()
+		}
+		return uploadPart(ctx, input)
+	}
+	completeMultipartUpload := api.CompleteMultipartUploadFunc
+	api.CompleteMultipartUploadFunc = func(ctx context.Context, input *s3api.CompleteMultipartUploadInput) (*s3api.CompleteMultipartUploadOutput, error) {
+		record(ctx, "complete")
+		return completeMultipartUpload(ctx, input)
+	}
+
+	var err error
+	tracer := &recordTracer{}
+	u := &s3iot.Uploader{}
+	s3iot.WithAPI(api).ApplyToUploader(u)
+	s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 50}).ApplyToUploader(u)
+	s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{WaitBase: time.Millisecond}).ApplyToUploader(u)
+	s3iot.WithErrorClassifier(&s3iot.RuleErrorClassifier{
+		Rules: []s3iot.ErrorRule{
+			{Match: s3iot.MatchError(errTemp), Retryable: true, ThrottleWait: time.Millisecond},
+		},
+	}).ApplyToUploader(u)
+	s3iot.WithTracer(tracer).ApplyToUploader(u)
+
+	uc, err = u.Upload(context.TODO(), &s3iot.UploadInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		<-ch
+	}
+
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("Timeout")
+	case <-uc.Done():
+	}
+	if _, err := uc.Result(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCalls := []string{
+		"Upload create id=0 attempt=1",
+		"Upload/1 upload id=1 attempt=1",
+		"Upload/1 upload id=1 attempt=2",
+		"Upload/2 upload id=2 attempt=1",
+		"Upload/3 upload id=3 attempt=1",
+		"Upload complete id=-1 attempt=1",
+	}
+	if !reflect.DeepEqual(expectedCalls, calls) {
+		t.Errorf("Expected calls:\n%v\ngot:\n%v", expectedCalls, calls)
+	}
+	expectedEvents := []string{
+		"start Upload Bucket/Key",
+		"start part 1",
+		"throttle 1 1ms",
+		"end part 1 <nil>",
+		"start part 2",
+		"pause",
+		"resume",
+		"end part 2 <nil>",
+		"start part 3",
+		"end part 3 <nil>",
+		"end <nil>",
+	}
+	if events := tracer.Events(); !reflect.DeepEqual(expectedEvents, events) {
+		t.Errorf("Expected events:\n%v\ngot:\n%v", expectedEvents, events)
+	}
+}
+
+type tracePathKey struct{}
+
+func tracePath(ctx context.Context) string {
+	p, _ := ctx.Value(tracePathKey{}).(string)
+	return p
+}
+
+type recordTracer struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recordTracer) record(format string, args ...interface{}) {
+	r.mu.Lock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+	r.mu.Unlock()
+}
+
+func (r *recordTracer) Events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func (r *recordTracer) StartTransfer(ctx context.Context, info s3iot.TransferInfo) (context.Context, s3iot.TransferSpan) {
+	r.record("start %s %s/%s", info.Operation, info.Bucket, info.Key)
+	return context.WithValue(ctx, tracePathKey{}, info.Operation), &recordTransferSpan{r}
+}
+
+type recordTransferSpan struct {
+	*recordTracer
+}
+
+func (s *recordTransferSpan) StartPart(ctx context.Context, id int64) (context.Context, s3iot.PartSpan) {
+	s.record("start part %d", id)
+	return context.WithValue(ctx, tracePathKey{}, fmt.Sprintf("%s/%d", tracePath(ctx), id)),
+		&recordPartSpan{s.recordTracer, id}
+}
+
+func (s *recordTransferSpan) Pause()  { s.record("pause") }
+func (s *recordTransferSpan) Resume() { s.record("resume") }
+
+func (s *recordTransferSpan) Throttle(id int64, wait time.Duration) {
+	s.record("throttle %d %v", id, wait)
+}
+
+func (s *recordTransferSpan) End(err error) { s.record("end %v", err) }
+
+type recordPartSpan struct {
+	*recordTracer
+	id int64
+}
+
+func (s *recordPartSpan) End(err error) { s.record("end part %d %v", s.id, err) }
@@ -17,16 +17,29 @@ package s3iot
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/at-wat/s3iot/s3api"
 )
 
+// abortTimeout is the timeout of AbortMultipartUpload called on failure.
+// Abort is not retried and bounded to finish the failed transfer
+// in the network outage.
+const abortTimeout = 30 * time.Second
+
 // UpDownloaderBase stores downloader/uploader base objects.
 type UpDownloaderBase struct {
 	API             s3api.UpDownloadAPI
 	RetryerFactory  RetryerFactory
 	ErrorClassifier ErrorClassifier
 	ForcePause      bool
+	Clock           Clock
+	CallTimeout     CallTimeout
+	StallTimeout    time.Duration
+	Tracer          Tracer
+	Metrics         Metrics
+	Logger          Logger
+	LogLevel        LogLevel
 }
 
 // Uploader implements S3 uploader with configurable retry and bandwidth limit.
@@ -35,6 +48,7 @@ type Uploader struct {
 
 	UploadSlicerFactory    UploadSlicerFactory
 	ReadInterceptorFactory ReadInterceptorFactory
+	SkipUnchanged          bool
 }
 
 // Downloader implements S3 downloader with configurable retry and bandwidth limit.
@@ -42,6 +56,15 @@ type Downloader struct {
 	UpDownloaderBase
 
 	DownloadSlicerFactory DownloadSlicerFactory
+	HeadFirst             bool
+	Concurrency           int
+}
+
+// Copier implements S3 server-side copier with configurable retry.
+type Copier struct {
+	UpDownloaderBase
+
+	PartSize int64
 }
 
 // UploaderOption sets optional parameter to the Uploader.
@@ -54,10 +77,16 @@ type DownloaderOption interface {
 	ApplyToDownloader(*Downloader)
 }
 
-// UpDownloaderOption sets optional parameter to the Uploader or Downloader.
+// CopierOption sets optional parameter to the Copier.
+type CopierOption interface {
+	ApplyToCopier(*Copier)
+}
+
+// UpDownloaderOption sets optional parameter to the Uploader, Downloader or Copier.
 type UpDownloaderOption interface {
 	UploaderOption
 	DownloaderOption
+	CopierOption
 }
 
 // UploaderOptionFn is functional option for Uploader.
@@ -76,7 +105,15 @@ func (f DownloaderOptionFn) ApplyToDownloader(d *Downloader) {
 	f(d)
 }
 
-// UpDownloaderOptionFn is functional option for Uploader/Downloader.
+// CopierOptionFn is functional option for Copier.
+type CopierOptionFn func(*Copier)
+
+// ApplyToCopier apply the option to the Copier.
+func (f CopierOptionFn) ApplyToCopier(c *Copier) {
+	f(c)
+}
+
+// UpDownloaderOptionFn is functional option for Uploader/Downloader/Copier.
 type UpDownloaderOptionFn func(*UpDownloaderBase)
 
 // ApplyToUploader apply the option to the Uploader.
@@ -89,6 +126,11 @@ func (f UpDownloaderOptionFn) ApplyToDownloader(d *Downloader) {
 	f(&d.UpDownloaderBase)
 }
 
+// ApplyToCopier apply the option to the Copier.
+func (f UpDownloaderOptionFn) ApplyToCopier(c *Copier) {
+	f(&c.UpDownloaderBase)
+}
+
 // WithAPI sets S3 API.
 func WithAPI(a s3api.UpDownloadAPI) UpDownloaderOption {
 	return UpDownloaderOptionFn(func(u *UpDownloaderBase) {
@@ -118,6 +160,31 @@ func WithErrorClassifier(ec ErrorClassifier) UpDownloaderOption {
 	})
 }
 
+// WithClock sets Clock used by the built-in Retryers and ReadInterceptors.
+func WithClock(c Clock) UpDownloaderOption {
+	return UpDownloaderOptionFn(func(u *UpDownloaderBase) {
+		u.Clock = c
+	})
+}
+
+// WithCallTimeout sets the timeout of each API call attempt.
+// API calls canceled by the timeout are retried with ErrCallTimeout.
+// The timeout is applied to the calls which can be canceled by ForcePause.
+func WithCallTimeout(t CallTimeout) UpDownloaderOption {
+	return UpDownloaderOptionFn(func(u *UpDownloaderBase) {
+		u.CallTimeout = t
+	})
+}
+
+// WithStallTimeout sets the duration to detect the stall of the body transfer.
+// If no body bytes are transferred for the duration, the API call is
+// canceled and retried with ErrStalled.
+func WithStallTimeout(d time.Duration) UpDownloaderOption {
+	return UpDownloaderOptionFn(func(u *UpDownloaderBase) {
+		u.StallTimeout = d
+	})
+}
+
 // WithUploadSlicer sets UploadSlicerFactory to Uploader.
 func WithUploadSlicer(s UploadSlicerFactory) UploaderOption {
 	return UploaderOptionFn(func(u *Uploader) {
@@ -132,6 +199,22 @@ func WithReadInterceptor(i ReadInterceptorFactory) UploaderOption {
 	})
 }
 
+// WithSkipUnchanged enables to skip uploading unchanged object.
+// Upload is skipped if the size and the ETag of the remote object
+// are same as the local data.
+// Local ETag is calculated using UploadSlicer to have the same part size
+// before starting the upload in background.
+// The calculation waits during pause and is aborted by the context.
+// HeadObject is retried by the Retryer, and the upload fails if it
+// finally failed with errors other than NotFound.
+// Skip check is available only if the input body implements io.ReadSeeker,
+// and API implements s3api.HeadAPI.
+func WithSkipUnchanged(s bool) UploaderOption {
+	return UploaderOptionFn(func(u *Uploader) {
+		u.SkipUnchanged = s
+	})
+}
+
 // WithDownloadSlicer sets DownloadSlicerFactory to Downloader.
 func WithDownloadSlicer(s DownloadSlicerFactory) DownloaderOption {
 	return DownloaderOptionFn(func(u *Downloader) {
@@ -139,67 +222,184 @@ func WithDownloadSlicer(s DownloadSlicerFactory) DownloaderOption {
 	})
 }
 
+// WithHeadFirst enables to call HeadObject API before downloading.
+// Object size and metadata are available from the beginning of the download,
+// and io.WriterAt having Truncate(int64) error method (like os.File) is preallocated.
+// Parts are downloaded in parallel if WithDownloadConcurrency is set.
+// If the size is not provided by HeadObject, the download falls back to
+// sequential download learning the size from the first part.
+// API must implement s3api.HeadAPI.
+func WithHeadFirst(h bool) DownloaderOption {
+	return DownloaderOptionFn(func(u *Downloader) {
+		u.HeadFirst = h
+	})
+}
+
+// WithDownloadConcurrency sets the number of the parts downloaded in parallel.
+// Parallel download is available only if the object size is known
+// by WithHeadFirst. Otherwise, parts are downloaded sequentially.
+func WithDownloadConcurrency(n int) DownloaderOption {
+	return DownloaderOptionFn(func(u *Downloader) {
+		u.Concurrency = n
+	})
+}
+
+// WithCopyPartSize sets part size of multipart copy to Copier.
+// Objects smaller than the part size are copied by single CopyObject call.
+func WithCopyPartSize(s int64) CopierOption {
+	return CopierOptionFn(func(c *Copier) {
+		c.PartSize = s
+	})
+}
+
 type upDownloadContext struct {
 	api           s3api.UpDownloadAPI
 	retryer       Retryer
 	errClassifier ErrorClassifier
 	forcePause    bool
+	clock         Clock
+	callTimeout   CallTimeout
+	stallTimeout  time.Duration
 
 	err error
 
 	paused     chan struct{}
 	resumeOnce sync.Once
+	pausedBy   map[interface{}]bool
 
 	mu   sync.RWMutex
 	done chan struct{}
 
-	statusPaused      *bool
-	statusNumRetries  *int
-	cancelCurrentCall func()
-	forcePaused       bool
+	statusPaused     *bool
+	statusNumRetries *int
+	calls            map[*apiCall]struct{}
+	throughput       float64
+	tracer           Tracer
+	span             TransferSpan
+	metrics          Metrics
+	op               string
+	pausedAt         time.Time
+	logger           Logger
+	logLevel         LogLevel
+	logAttrs         []interface{}
+	startedAt        time.Time
+	transferredBytes int64
 }
 
-func newUpDownloadContext(api s3api.UpDownloadAPI, retryerFactory RetryerFactory, errClassifier ErrorClassifier, forcePause bool) *upDownloadContext {
+// newUpDownloadContext creates upDownloadContext storing the paused state
+// and the number of retries to the given pointers.
+// The pointers are set before creating the Retryer since RetryerFactory
+// may pause or resume the transfer immediately.
+func newUpDownloadContext(b UpDownloaderBase, paused *bool, numRetries *int) *upDownloadContext {
+	clock := b.Clock
+	if clock == nil {
+		clock = DefaultClock
+	}
 	c := &upDownloadContext{
-		api:           api,
-		errClassifier: errClassifier,
+		api:           b.API,
+		errClassifier: b.ErrorClassifier,
 		done:          make(chan struct{}),
 		paused:        make(chan struct{}),
-		forcePause:    forcePause,
+		forcePause:    b.ForcePause,
+		clock:         clock,
+		callTimeout:   b.CallTimeout,
+		stallTimeout:  b.StallTimeout,
+		tracer:        b.Tracer,
+		span:          noopTransferSpan{},
+		metrics:       b.Metrics,
+		logger:        b.Logger,
+		logLevel:      b.LogLevel,
+
+		statusPaused:     paused,
+		statusNumRetries: numRetries,
+		pausedBy:         make(map[interface{}]bool),
+		calls:            make(map[*apiCall]struct{}),
+	}
+	if c.metrics == nil {
+		c.metrics = noopMetrics{}
 	}
-	c.retryer = retryerFactory.New(c)
+	c.retryer = b.RetryerFactory.New(c)
 	close(c.paused)
 	c.resumeOnce.Do(func() {})
 	return c
 }
 
-func (c *upDownloadContext) setStatePtr(paused *bool, numRetries *int) {
-	c.statusPaused = paused
-	c.statusNumRetries = numRetries
+// Clock implements ClockProvider.
+func (c *upDownloadContext) Clock() Clock {
+	return c.clock
 }
 
 func (c *upDownloadContext) Done() <-chan struct{} {
 	return c.done
 }
+
 func (c *upDownloadContext) Pause() {
+	c.PauseBy(userPauseOwner{}, c.forcePause)
+}
+
+// ForcePause implements ForcePauser.
+func (c *upDownloadContext) ForcePause() {
+	c.PauseBy(userPauseOwner{}, true)
+}
+
+func (c *upDownloadContext) Resume() {
+	c.ResumeBy(userPauseOwner{})
+}
+
+// PauseBy implements SharedPauser.
+func (c *upDownloadContext) PauseBy(owner interface{}, force bool) {
 	c.mu.Lock()
-	c.paused = make(chan struct{})
-	c.resumeOnce = sync.Once{}
-	*c.statusPaused = true
-	if c.cancelCurrentCall != nil && c.forcePause {
-		c.cancelCurrentCall()
-		c.forcePaused = true
+	// Keep the channel if already paused since it is waited by pauseCheck.
+	paused := !*c.statusPaused
+	if paused {
+		c.paused = make(chan struct{})
+		c.resumeOnce = sync.Once{}
+		*c.statusPaused = true
+		c.pausedAt = c.clock.Now()
+		c.span.Pause()
+	}
+	c.pausedBy[owner] = true
+	aborted := len(c.calls) > 0 && force
+	if aborted {
+		for call := range c.calls {
+			call.abort(ErrForcePaused)
+		}
 	}
 	c.mu.Unlock()
+
+	switch {
+	case paused:
+		c.log(context.Background(), LogLevelInfo, "transfer paused", LogKeyForce, force)
+	case aborted:
+		c.log(context.Background(), LogLevelInfo, "transfer force paused")
+	}
 }
 
-func (c *upDownloadContext) Resume() {
+// ResumeBy implements SharedPauser.
+func (c *upDownloadContext) ResumeBy(owner interface{}) {
 	c.mu.Lock()
+	delete(c.pausedBy, owner)
+	if len(c.pausedBy) > 0 {
+		// Still paused by the other owners.
+		c.mu.Unlock()
+		return
+	}
 	c.resumeOnce.Do(func() {
 		close(c.paused)
 	})
+	resumed := *c.statusPaused
+	var d time.Duration
+	if resumed {
+		d = c.clock.Now().Sub(c.pausedAt)
+		c.span.Resume()
+		c.metrics.Paused(c.op, d)
+	}
 	*c.statusPaused = false
 	c.mu.Unlock()
+
+	if resumed {
+		c.log(context.Background(), LogLevelInfo, "transfer resumed", LogKeyDuration, d)
+	}
 }
 
 func (c *upDownloadContext) pauseCheck(ctx context.Context) {
@@ -213,22 +413,153 @@ func (c *upDownloadContext) pauseCheck(ctx context.Context) {
 	}
 }
 
-func (c *upDownloadContext) currentCallContext(ctx context.Context) (context.Context, func() bool) {
-	ctx2, cancel := context.WithCancel(ctx)
+func (c *upDownloadContext) countRetry() {
 	c.mu.Lock()
-	c.cancelCurrentCall = cancel
-	c.forcePaused = false
+	*c.statusNumRetries++
 	c.mu.Unlock()
-	return ctx2, func() bool {
-		cancel()
-		c.mu.RLock()
-		defer c.mu.RUnlock()
-		return c.forcePaused
+}
+
+// startTransfer starts tracing, recording metrics and logging of the transfer.
+func (c *upDownloadContext) startTransfer(ctx context.Context, info TransferInfo) context.Context {
+	c.mu.Lock()
+	c.op = info.Operation
+	c.startedAt = c.clock.Now()
+	c.logAttrs = []interface{}{
+		LogKeyOperation, info.Operation,
+		LogKeyBucket, info.Bucket,
+		LogKeyKey, info.Key,
 	}
+	if info.SourceBucket != "" {
+		c.logAttrs = append(c.logAttrs,
+			LogKeySourceBucket, info.SourceBucket,
+			LogKeySourceKey, info.SourceKey,
+		)
+	}
+	if c.tracer != nil {
+		ctx, c.span = c.tracer.StartTransfer(ctx, info)
+		if *c.statusPaused {
+			// Paused by RetryerFactory before starting.
+			c.span.Pause()
+		}
+	}
+	c.mu.Unlock()
+	c.metrics.TransferStarted(info.Operation)
+	c.retryer = &observedRetryer{Retryer: c.retryer, c: c}
+	c.log(ctx, LogLevelInfo, "transfer started")
+	return ctx
 }
 
-func (c *upDownloadContext) countRetry() {
+// retry calls fn with retry after waiting resume.
+func (c *upDownloadContext) retry(ctx context.Context, api string, id int64, fn func(context.Context) error) error {
+	return withRetryContext(ctx, c.clock, api, id, c.retryer, c.errClassifier, func(ctx context.Context) error {
+		c.pauseCheck(ctx)
+		start := c.clock.Now()
+		err := fn(ctx)
+		c.metrics.APICall(c.op, api, c.clock.Now().Sub(start), err)
+		return err
+	})
+}
+
+// retryPart calls fn with retry in the span of the part.
+func (c *upDownloadContext) retryPart(ctx context.Context, api string, id int64, fn func(context.Context) error) error {
+	ctx, part := c.span.StartPart(ctx, id)
+	c.log(ctx, LogLevelDebug, "part started", LogKeyPart, id)
+	start := c.clock.Now()
+	err := c.retry(ctx, api, id, fn)
+	d := c.clock.Now().Sub(start)
+	part.End(err)
+	if err != nil {
+		c.log(ctx, LogLevelWarn, "part failed", LogKeyPart, id, LogKeyDuration, d, LogKeyError, err)
+	} else {
+		c.log(ctx, LogLevelDebug, "part finished", LogKeyPart, id, LogKeyDuration, d)
+	}
+	return err
+}
+
+func (c *upDownloadContext) transferred(n int64) {
 	c.mu.Lock()
-	*c.statusNumRetries++
+	c.transferredBytes += n
+	c.mu.Unlock()
+	c.metrics.BytesTransferred(c.op, n)
+}
+
+// finish ends the transfer.
+func (c *upDownloadContext) finish(err error) {
+	c.mu.Lock()
+	if *c.statusPaused {
+		c.metrics.Paused(c.op, c.clock.Now().Sub(c.pausedAt))
+	}
+	n, d := c.transferredBytes, c.clock.Now().Sub(c.startedAt)
 	c.mu.Unlock()
+	c.span.End(err)
+	c.metrics.TransferFinished(c.op, err)
+	if err != nil {
+		c.log(context.Background(), LogLevelError, "transfer failed",
+			LogKeyBytes, n, LogKeyDuration, d, LogKeyError, err,
+		)
+	} else {
+		c.log(context.Background(), LogLevelInfo, "transfer completed",
+			LogKeyBytes, n, LogKeyDuration, d,
+		)
+	}
+	close(c.done)
+}
+
+// userPauseOwner is the owner of the pause requested through Pauser
+// and ForcePauser interfaces.
+type userPauseOwner struct{}
+
+// observedRetryer reports retries and throttles to Tracer, Metrics and Logger.
+type observedRetryer struct {
+	Retryer
+	c *upDownloadContext
+}
+
+func (r *observedRetryer) OnFail(ctx context.Context, id int64, err error) bool {
+	class := r.classify(err)
+	info, _ := CallInfoFromContext(ctx)
+	start := r.c.clock.Now()
+	var wait time.Duration
+	var notified bool
+	ctx = context.WithValue(ctx, retryWaitKey{}, func(d time.Duration) {
+		wait, notified = d, true
+	})
+	if !r.Retryer.OnFail(ctx, id, err) {
+		r.c.log(ctx, LogLevelWarn, "retry exceeded limit",
+			LogKeyPart, id, LogKeyAttempt, info.Attempt,
+			LogKeyErrorClass, class.String(), LogKeyError, err,
+		)
+		return false
+	}
+	if !notified {
+		// Retryer doesn't notify the wait.
+		wait = r.c.clock.Now().Sub(start)
+	}
+	r.c.metrics.Retry(r.c.op, class)
+	r.c.log(ctx, LogLevelWarn, "retrying",
+		LogKeyPart, id, LogKeyAttempt, info.Attempt,
+		LogKeyErrorClass, class.String(), LogKeyWait, wait,
+		LogKeyError, err,
+	)
+	return true
+}
+
+// classify classifies the error by the Retryer if it has own classification
+// like PolicyRetryerFactory, or by the ErrorClassifier.
+func (r *observedRetryer) classify(err error) ErrorClass {
+	if ec, ok := r.Retryer.(errorClassProvider); ok {
+		if class, ok := ec.classifyError(err); ok {
+			return class
+		}
+	}
+	return classifyError(r.c.errClassifier, err)
+}
+
+func (r *observedRetryer) OnThrottle(id int64, wait time.Duration) {
+	r.c.span.Throttle(id, wait)
+	r.c.metrics.Throttle(r.c.op, wait)
+	r.c.log(context.Background(), LogLevelWarn, "throttled", LogKeyPart, id, LogKeyWait, wait)
+	if to, ok := r.Retryer.(ThrottleObserver); ok {
+		to.OnThrottle(id, wait)
+	}
 }
@@ -19,8 +19,10 @@ package s3iot
 import (
 	"context"
 	"io"
+	"net/http"
 	"sort"
 
+	"github.com/at-wat/s3iot/internal/etag"
 	"github.com/at-wat/s3iot/s3api"
 )
 
@@ -35,49 +37,75 @@ func (u Uploader) Upload(ctx context.Context, input *UploadInput) (UploadContext
 	if u.ErrorClassifier == nil {
 		u.ErrorClassifier = DefaultErrorClassifier
 	}
+	var headAPI s3api.HeadAPI
+	rs, ok := input.Body.(io.ReadSeeker)
+	if ok && u.SkipUnchanged {
+		if headAPI, ok = u.API.(s3api.HeadAPI); !ok {
+			return nil, ErrUnsupportedAPI
+		}
+	}
 	slicer, err := u.UploadSlicerFactory.New(input.Body)
 	if err != nil {
 		return nil, err
 	}
-	var readInterceptor ReadInterceptor
-	if u.ReadInterceptorFactory != nil {
-		readInterceptor = u.ReadInterceptorFactory.New()
-	}
 	uc := &uploadContext{
-		upDownloadContext: newUpDownloadContext(
-			u.API,
-			u.RetryerFactory,
-			u.ErrorClassifier,
-			u.ForcePause,
-		),
-		slicer:          slicer,
-		readInterceptor: readInterceptor,
-		input:           input,
+		slicerFactory: u.UploadSlicerFactory,
+		slicer:        slicer,
+		input:         input,
+		headAPI:       headAPI,
 		status: UploadStatus{
 			Status: Status{
 				Size: slicer.Len(),
 			},
 		},
 	}
-	uc.setStatePtr(&uc.status.Paused, &uc.status.NumRetries)
-	r, cleanup, err := uc.slicer.NextReader()
-	switch {
-	case err == io.EOF:
-		go uc.single(ctx, r, cleanup)
+	uc.upDownloadContext = newUpDownloadContext(
+		u.UpDownloaderBase, &uc.status.Paused, &uc.status.NumRetries,
+	)
+	if u.ReadInterceptorFactory != nil {
+		uc.readInterceptor = u.ReadInterceptorFactory.New()
+		if cs, ok := uc.readInterceptor.(clockSetter); ok {
+			cs.setClock(uc.clock)
+		}
+	}
+	info := TransferInfo{
+		Operation: OperationUpload,
+		Bucket:    *input.Bucket,
+		Key:       *input.Key,
+	}
+	if headAPI != nil {
+		// Body must not be read before calculating the local ETag.
+		go uc.skipOrUpload(uc.startTransfer(ctx, info), rs)
 		return uc, nil
-	case err != nil:
+	}
+	r, cleanup, err := uc.slicer.NextReader()
+	if err != nil && err != io.EOF {
 		return nil, err
 	}
-	go uc.multi(ctx, r, cleanup)
+	go uc.upload(uc.startTransfer(ctx, info), r, cleanup, err == io.EOF)
 	return uc, nil
 }
 
+// ETag calculates the ETag of the object uploaded from the io.ReadSeeker.
+// It can be compared with the ETag of the remote object to check whether
+// the data is unchanged.
+// Data is read to the end and the io.ReadSeeker is rewound to the beginning.
+func (u Uploader) ETag(r io.ReadSeeker) (string, error) {
+	if u.UploadSlicerFactory == nil {
+		u.UploadSlicerFactory = &DefaultUploadSlicerFactory{}
+	}
+	return calcETag(u.UploadSlicerFactory, r, func() error { return nil })
+}
+
 type uploadContext struct {
 	*upDownloadContext
 
+	slicerFactory   UploadSlicerFactory
 	slicer          UploadSlicer
 	readInterceptor ReadInterceptor
 	input           *UploadInput
+	headAPI         s3api.HeadAPI
+	localETag       string
 
 	status UploadStatus
 	output UploadOutput
@@ -99,6 +127,148 @@ func (uc *uploadContext) Result() (UploadOutput, error) {
 	return uc.output, uc.err
 }
 
+// calcETag calculates the ETag of the data.
+// beforePart is called before reading each part to abort the calculation.
+func calcETag(f UploadSlicerFactory, r io.ReadSeeker, beforePart func() error) (string, error) {
+	slicer, err := f.New(r)
+	if err != nil {
+		return "", err
+	}
+	var sums [][]byte
+	var multi bool
+	for {
+		if err := beforePart(); err != nil {
+			return "", err
+		}
+		part, cleanup, err := slicer.NextReader()
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		last := err == io.EOF
+		if !last {
+			multi = true
+		}
+		size, err := part.Seek(0, io.SeekEnd)
+		if err != nil {
+			cleanup()
+			return "", err
+		}
+		if _, err := part.Seek(0, io.SeekStart); err != nil {
+			cleanup()
+			return "", err
+		}
+		sum, err := etag.Sum(part)
+		cleanup()
+		if err != nil {
+			return "", err
+		}
+		// Empty part is not uploaded on multipart upload.
+		if size > 0 || !multi {
+			sums = append(sums, sum)
+		}
+		if last {
+			break
+		}
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if !multi {
+		return etag.Single(sums[0]), nil
+	}
+	return etag.Multipart(sums), nil
+}
+
+// skipOrUpload calculates the local ETag and uploads the data
+// unless the remote object is unchanged.
+// Calculation waits during pause and is aborted by ctx.
+func (uc *uploadContext) skipOrUpload(ctx context.Context, rs io.ReadSeeker) {
+	localETag, err := calcETag(uc.slicerFactory, rs, func() error {
+		uc.pauseCheck(ctx)
+		return ctx.Err()
+	})
+	if err != nil {
+		uc.fail(err)
+		return
+	}
+	uc.localETag = localETag
+	skipped, err := uc.skipIfUnchanged(ctx)
+	if err != nil {
+		uc.fail(err)
+		return
+	}
+	if skipped {
+		return
+	}
+	r, cleanup, err := uc.slicer.NextReader()
+	if err != nil && err != io.EOF {
+		uc.fail(err)
+		return
+	}
+	uc.upload(ctx, r, cleanup, err == io.EOF)
+}
+
+// skipIfUnchanged checks the remote object and completes the upload if it's unchanged.
+// HeadObject is retried unless the object doesn't exist.
+func (uc *uploadContext) skipIfUnchanged(ctx context.Context) (bool, error) {
+	var out *s3api.HeadObjectOutput
+	err := uc.retry(ctx, "HeadObject", 0, func(ctx context.Context) error {
+		ctx2, call := uc.currentCallContext(ctx, 0, false)
+		o, err := uc.headAPI.HeadObject(ctx2, &s3api.HeadObjectInput{
+			Bucket: uc.input.Bucket,
+			Key:    uc.input.Key,
+		})
+		if err := call.end(); err != nil {
+			return err
+		}
+		if err != nil {
+			if isNotFound(uc.errClassifier, err) {
+				return &fatalError{err}
+			}
+			uc.countRetry()
+			return err
+		}
+		out = o
+		return nil
+	})
+	if err != nil {
+		if isNotFound(uc.errClassifier, err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if out.ContentLength == nil || *out.ContentLength != uc.status.Size ||
+		out.ETag == nil || !etag.Equal(*out.ETag, uc.localETag) {
+		return false, nil
+	}
+	uc.mu.Lock()
+	uc.status.SkippedSize = uc.status.Size
+	uc.mu.Unlock()
+	uc.success(UploadOutput{
+		VersionID: out.VersionID,
+		ETag:      out.ETag,
+		Skipped:   true,
+	})
+	return true, nil
+}
+
+// isNotFound returns true if the error means that the object doesn't exist.
+func isNotFound(ec ErrorClassifier, err error) bool {
+	if status, ok := HTTPStatus(ec, err); ok && status == http.StatusNotFound {
+		return true
+	}
+	return MatchErrorCode("NoSuchKey", "NotFound")(err)
+}
+
+// upload uploads the data starting from the first part.
+func (uc *uploadContext) upload(ctx context.Context, r io.ReadSeeker, cleanup func(), last bool) {
+	if last {
+		uc.single(ctx, r, cleanup)
+		return
+	}
+	uc.multi(ctx, r, cleanup)
+}
+
 func (uc *uploadContext) single(ctx context.Context, r io.ReadSeeker, cleanup func()) {
 	defer cleanup()
 
@@ -106,40 +276,46 @@ func (uc *uploadContext) single(ctx context.Context, r io.ReadSeeker, cleanup fu
 		r = uc.readInterceptor.Reader(r)
 	}
 
-	if err := withRetry(ctx, 0, uc.retryer, uc.errClassifier, func() error {
-		uc.pauseCheck(ctx)
+	var output UploadOutput
+	if err := uc.retryPart(ctx, "PutObject", 0, func(ctx context.Context) error {
+		size, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return &fatalError{err}
+		}
 		if _, err := r.Seek(0, io.SeekStart); err != nil {
 			return &fatalError{err}
 		}
-		ctx2, isForcePaused := uc.currentCallContext(ctx)
+		ctx2, call := uc.currentCallContext(ctx, size, true)
 		out, err := uc.api.PutObject(ctx2, &s3api.PutObjectInput{
 			Bucket:      uc.input.Bucket,
 			Key:         uc.input.Key,
 			ACL:         uc.input.ACL,
-			Body:        r,
+			Body:        call.bodyReadSeeker(r),
 			ContentType: uc.input.ContentType,
 		})
-		if isForcePaused() {
-			return ErrForcePaused
+		if err := call.end(); err != nil {
+			return err
 		}
 		if err != nil {
 			uc.countRetry()
 			return err
 		}
-		uc.success(UploadOutput{
+		uc.transferred(size)
+		output = UploadOutput{
 			VersionID: out.VersionID,
 			ETag:      out.ETag,
 			Location:  out.Location,
-		})
+		}
 		return nil
 	}); err != nil {
 		uc.fail(err)
+		return
 	}
+	uc.success(output)
 }
 
 func (uc *uploadContext) multi(ctx context.Context, r io.ReadSeeker, cleanup func()) {
-	if err := withRetry(ctx, 0, uc.retryer, uc.errClassifier, func() error {
-		uc.pauseCheck(ctx)
+	if err := uc.retry(ctx, "CreateMultipartUpload", 0, func(ctx context.Context) error {
 		out, err := uc.api.CreateMultipartUpload(ctx, &s3api.CreateMultipartUploadInput{
 			Bucket:      uc.input.Bucket,
 			Key:         uc.input.Key,
@@ -153,6 +329,7 @@ func (uc *uploadContext) multi(ctx context.Context, r io.ReadSeeker, cleanup fun
 		uc.mu.Lock()
 		uc.status.UploadID = *out.UploadID
 		uc.mu.Unlock()
+		uc.log(ctx, LogLevelInfo, "multipart upload created", LogKeyUploadID, *out.UploadID)
 		return nil
 	}); err != nil {
 		cleanup()
@@ -176,21 +353,20 @@ func (uc *uploadContext) multi(ctx context.Context, r io.ReadSeeker, cleanup fun
 		if uc.readInterceptor != nil {
 			r = uc.readInterceptor.Reader(r)
 		}
-		if err := withRetry(ctx, i, uc.retryer, uc.errClassifier, func() error {
-			uc.pauseCheck(ctx)
+		if err := uc.retryPart(ctx, "UploadPart", i, func(ctx context.Context) error {
 			if _, err := r.Seek(0, io.SeekStart); err != nil {
 				return &fatalError{err}
 			}
-			ctx2, isForcePaused := uc.currentCallContext(ctx)
+			ctx2, call := uc.currentCallContext(ctx, size, true)
 			out, err := uc.api.UploadPart(ctx2, &s3api.UploadPartInput{
-				Body:       r,
+				Body:       call.bodyReadSeeker(r),
 				Bucket:     uc.input.Bucket,
 				Key:        uc.input.Key,
 				PartNumber: &i,
 				UploadID:   &uc.status.UploadID,
 			})
-			if isForcePaused() {
-				return ErrForcePaused
+			if err := call.end(); err != nil {
+				return err
 			}
 			if err != nil {
 				uc.countRetry()
@@ -210,6 +386,7 @@ func (uc *uploadContext) multi(ctx context.Context, r io.ReadSeeker, cleanup fun
 		uc.mu.Lock()
 		uc.status.CompletedSize += size
 		uc.mu.Unlock()
+		uc.transferred(size)
 
 		if last {
 			break
@@ -226,8 +403,8 @@ func (uc *uploadContext) multi(ctx context.Context, r io.ReadSeeker, cleanup fun
 	}
 	sort.Sort(parts)
 
-	if err := withRetry(ctx, -1, uc.retryer, uc.errClassifier, func() error {
-		uc.pauseCheck(ctx)
+	var output UploadOutput
+	if err := uc.retry(ctx, "CompleteMultipartUpload", -1, func(ctx context.Context) error {
 		out, err := uc.api.CompleteMultipartUpload(ctx, &s3api.CompleteMultipartUploadInput{
 			Bucket:         uc.input.Bucket,
 			Key:            uc.input.Key,
@@ -238,33 +415,41 @@ func (uc *uploadContext) multi(ctx context.Context, r io.ReadSeeker, cleanup fun
 			uc.countRetry()
 			return err
 		}
-		uc.success(UploadOutput{
+		output = UploadOutput{
 			VersionID: out.VersionID,
 			ETag:      out.ETag,
 			Location:  out.Location,
-		})
+		}
 		return nil
 	}); err != nil {
 		uc.fail(err)
+		return
 	}
+	uc.success(output)
 }
 
 func (uc *uploadContext) fail(err error) {
 	uc.mu.Lock()
 	uc.err = err
+	uploadID := uc.status.UploadID
 	uc.mu.Unlock()
-	close(uc.done)
 
-	_, _ = uc.api.AbortMultipartUpload(context.Background(), &s3api.AbortMultipartUploadInput{
-		Bucket:   uc.input.Bucket,
-		Key:      uc.input.Key,
-		UploadID: &uc.status.UploadID,
-	})
+	if uploadID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+		_, errAbort := uc.api.AbortMultipartUpload(ctx, &s3api.AbortMultipartUploadInput{
+			Bucket:   uc.input.Bucket,
+			Key:      uc.input.Key,
+			UploadID: &uploadID,
+		})
+		cancel()
+		uc.logAbort(uploadID, errAbort)
+	}
+	uc.finish(err)
 }
 
 func (uc *uploadContext) success(out UploadOutput) {
 	uc.mu.Lock()
 	uc.output = out
 	uc.mu.Unlock()
-	close(uc.done)
+	uc.finish(nil)
 }
@@ -17,6 +17,7 @@ package s3iot_test
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"errors"
 	"fmt"
 	"io"
@@ -27,6 +28,7 @@ import (
 	"time"
 
 	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/clocktest"
 	"github.com/at-wat/s3iot/internal/iotest"
 	mock_s3api "github.com/at-wat/s3iot/internal/moq/s3api"
 	mock_s3iot "github.com/at-wat/s3iot/internal/moq/s3iot"
@@ -35,6 +37,15 @@ import (
 
 var errTemp = errors.New("dummy")
 
+type apiError struct {
+	code   string
+	status int
+}
+
+func (e *apiError) Error() string       { return e.code }
+func (e *apiError) ErrorCode() string   { return e.code }
+func (e *apiError) HTTPStatusCode() int { return e.status }
+
 func TestUploader(t *testing.T) {
 	var (
 		bucket = "Bucket"
@@ -100,8 +111,8 @@ func TestUploader(t *testing.T) {
 					if !errors.Is(err, errTemp) {
 						t.Fatalf("Expected error: '%v', got: '%v'", errTemp, err)
 					}
-					if n := len(api.AbortMultipartUploadCalls()); n != 1 {
-						t.Fatalf("AbortMultipartUpload must be called once, but called %d times", n)
+					if n := len(api.AbortMultipartUploadCalls()); n != 0 {
+						t.Fatalf("AbortMultipartUpload must not be called without UploadID, but called %d times", n)
 					}
 					return
 				}
@@ -153,6 +164,7 @@ func TestUploader(t *testing.T) {
 			err           error
 			calls         int
 			parts         int
+			aborts        int
 			readerWrapper func(io.Reader) io.Reader
 		}{
 			"NoAPIError": {
@@ -207,6 +219,7 @@ func TestUploader(t *testing.T) {
 				partSize: 50,
 				num:      map[string]int{"complete": 2},
 				err:      errTemp,
+				aborts:   1,
 			},
 			"TwoCreateAPIError": {
 				partSize: 50,
@@ -217,6 +230,7 @@ func TestUploader(t *testing.T) {
 				partSize: 50,
 				num:      map[string]int{"upload": 2},
 				err:      errTemp,
+				aborts:   1,
 			},
 		}
 		for name, tt := range testCases {
@@ -261,8 +275,8 @@ func TestUploader(t *testing.T) {
 					if !errors.Is(err, errTemp) {
 						t.Fatalf("Expected error: '%v', got: '%v'", errTemp, err)
 					}
-					if n := len(api.AbortMultipartUploadCalls()); n != 1 {
-						t.Fatalf("AbortMultipartUpload must be called once, but called %d times", n)
+					if n := len(api.AbortMultipartUploadCalls()); n != tt.aborts {
+						t.Fatalf("AbortMultipartUpload must be called %d times, but called %d times", tt.aborts, n)
 					}
 					return
 				}
@@ -332,6 +346,7 @@ func TestUploader(t *testing.T) {
 		t.Run("Multi", func(t *testing.T) {
 			for name, tt := range map[string]struct {
 				forcePause    bool
+				pause         func(s3iot.UploadContext)
 				expectedCalls int
 			}{
 				"NoForcePause": {
@@ -342,6 +357,21 @@ func TestUploader(t *testing.T) {
 					forcePause:    true,
 					expectedCalls: 4,
 				},
+				"ForcePauser": {
+					forcePause: false,
+					pause: func(uc s3iot.UploadContext) {
+						uc.(s3iot.ForcePauser).ForcePause()
+					},
+					expectedCalls: 4,
+				},
+				"DoublePause": {
+					forcePause: false,
+					pause: func(uc s3iot.UploadContext) {
+						uc.Pause()
+						uc.Pause()
+					},
+					expectedCalls: 3,
+				},
 			} {
 				tt := tt
 				t.Run(name, func(t *testing.T) {
@@ -377,7 +407,11 @@ func TestUploader(t *testing.T) {
 					}
 
 					time.Sleep(50 * time.Millisecond)
-					uc.Pause()
+					if tt.pause != nil {
+						tt.pause(uc)
+					} else {
+						uc.Pause()
+					}
 					go func() {
 						<-chUpload
 						<-chUpload
@@ -865,6 +899,385 @@ func TestUploader(t *testing.T) {
 			})
 		}
 	})
+	t.Run("WithClock", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		api := newUploadMockAPI(buf, map[string]int{"upload": 1}, nil)
+		t0 := time.Now()
+		clock := clocktest.New(t0)
+		u := &s3iot.Uploader{}
+		s3iot.WithAPI(api).ApplyToUploader(u)
+		s3iot.WithUploadSlicer(&s3iot.DefaultUploadSlicerFactory{PartSize: 50}).ApplyToUploader(u)
+		s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{
+			WaitBase: time.Hour,
+		}).ApplyToUploader(u)
+		s3iot.WithReadInterceptor(
+			s3iot.NewWaitReadInterceptorFactory(time.Second),
+		).ApplyToUploader(u)
+		s3iot.WithClock(clock).ApplyToUploader(u)
+
+		uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+			Bucket: &bucket,
+			Key:    &key,
+			Body:   bytes.NewReader(data),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		timeout := time.After(5 * time.Second)
+		func() {
+			for {
+				select {
+				case <-timeout:
+					t.Fatal("Timeout")
+				case <-uc.Done():
+					return
+				default:
+				}
+				if d, ok := clock.Next(); ok {
+					clock.Advance(d)
+				} else {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}()
+		if _, err := uc.Result(); err != nil {
+			t.Fatal(err)
+		}
+		status, err := uc.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.NumRetries != 1 {
+			t.Errorf("Expected NumRetries: 1, got: %d", status.NumRetries)
+		}
+		// Retry wait of 1 hour and bandwidth limit of 1 second per byte.
+		if elapsed := clock.Now().Sub(t0); elapsed < time.Hour+time.Duration(len(data))*time.Second {
+			t.Errorf("Retry and read wait must be done by the clock, elapsed: %v", elapsed)
+		}
+		if !bytes.Equal(data, buf.Bytes()) {
+			t.Error("Uploaded data differs")
+		}
+	})
+	t.Run("SkipUnchanged", func(t *testing.T) {
+		data := make([]byte, 128)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		sum := func(b []byte) []byte {
+			s := md5.Sum(b)
+			return s[:]
+		}
+		singleETag := fmt.Sprintf(`"%x"`, sum(data))
+		multiETag := fmt.Sprintf(`"%x-3"`, sum(bytes.Join([][]byte{
+			sum(data[:50]), sum(data[50:100]), sum(data[100:]),
+		}, nil)))
+		multiExactETag := fmt.Sprintf(`"%x-2"`, sum(bytes.Join([][]byte{
+			sum(data[:64]), sum(data[64:]),
+		}, nil)))
+		errNotFound := &apiError{code: "NotFound", status: 404}
+		errNoSuchKey := &apiError{code: "NoSuchKey"}
+		errForbidden := &apiError{code: "Forbidden", status: 403}
+
+		testCases := map[string]struct {
+			partSize int64
+			body     func() io.Reader
+			etag     string
+			size     int64
+			headErrs []error
+			heads    int
+			skipped  bool
+			err      error
+		}{
+			"SingleUnchanged": {
+				partSize: 200,
+				body:     func() io.Reader { return bytes.NewReader(data) },
+				etag:     singleETag,
+				size:     128,
+				heads:    1,
+				skipped:  true,
+			},
+			"SingleETagChanged": {
+				partSize: 200,
+				body:     func() io.Reader { return bytes.NewReader(data) },
+				etag:     `"0123"`,
+				size:     128,
+				heads:    1,
+			},
+			"SingleSizeChanged": {
+				partSize: 200,
+				body:     func() io.Reader { return bytes.NewReader(data) },
+				etag:     singleETag,
+				size:     127,
+				heads:    1,
+			},
+			"MultiUnchanged": {
+				partSize: 50,
+				body:     func() io.Reader { return bytes.NewReader(data) },
+				etag:     multiETag,
+				size:     128,
+				heads:    1,
+				skipped:  true,
+			},
+			"MultiUnchangedReadSeeker": {
+				partSize: 64,
+				body:     func() io.Reader { return struct{ io.ReadSeeker }{bytes.NewReader(data)} },
+				etag:     multiExactETag,
+				size:     128,
+				heads:    1,
+				skipped:  true,
+			},
+			"NotFound": {
+				partSize: 200,
+				body:     func() io.Reader { return bytes.NewReader(data) },
+				headErrs: []error{errNotFound},
+				heads:    1,
+			},
+			"NoSuchKey": {
+				partSize: 200,
+				body:     func() io.Reader { return bytes.NewReader(data) },
+				headErrs: []error{errNoSuchKey},
+				heads:    1,
+			},
+			"HeadRetried": {
+				partSize: 200,
+				body:     func() io.Reader { return bytes.NewReader(data) },
+				etag:     singleETag,
+				size:     128,
+				headErrs: []error{errTemp},
+				heads:    2,
+				skipped:  true,
+			},
+			"HeadFailed": {
+				partSize: 200,
+				body:     func() io.Reader { return bytes.NewReader(data) },
+				headErrs: []error{errForbidden, errForbidden},
+				heads:    2,
+				err:      errForbidden,
+			},
+			"Unseekable": {
+				partSize: 200,
+				body:     func() io.Reader { return bytes.NewBuffer(data) },
+				etag:     singleETag,
+				size:     128,
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				var buf bytes.Buffer
+				api := newUploadMockAPI(&buf, nil, nil)
+				api.HeadObjectFunc = func(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+					if n := len(api.HeadObjectCalls()) - 1; n < len(tt.headErrs) {
+						return nil, tt.headErrs[n]
+					}
+					versionID := "VERSION"
+					return &s3api.HeadObjectOutput{
+						ContentLength: &tt.size,
+						ETag:          &tt.etag,
+						VersionID:     &versionID,
+					}, nil
+				}
+				u := &s3iot.Uploader{}
+				s3iot.WithAPI(api).ApplyToUploader(u)
+				s3iot.WithUploadSlicer(
+					&s3iot.DefaultUploadSlicerFactory{PartSize: tt.partSize},
+				).ApplyToUploader(u)
+				s3iot.WithSkipUnchanged(true).ApplyToUploader(u)
+				s3iot.WithRetryer(&s3iot.ExponentialBackoffRetryerFactory{
+					WaitBase: time.Millisecond,
+					RetryMax: 1,
+				}).ApplyToUploader(u)
+
+				uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+					Bucket: &bucket,
+					Key:    &key,
+					Body:   tt.body(),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case <-time.After(time.Second):
+					t.Fatal("Timeout")
+				case <-uc.Done():
+				}
+				out, err := uc.Result()
+				if tt.err != nil {
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("Expected error: %v, got: %v", tt.err, err)
+					}
+					if n := len(api.PutObjectCalls()); n != 0 {
+						t.Errorf("PutObject must not be called, but called %d times", n)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := len(api.HeadObjectCalls()); n != tt.heads {
+					t.Fatalf("HeadObject must be called %d times, but called %d times", tt.heads, n)
+				}
+				if out.Skipped != tt.skipped {
+					t.Fatalf("Expected Skipped: %v, got: %v", tt.skipped, out.Skipped)
+				}
+				status, err := uc.Status()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !tt.skipped {
+					if status.SkippedSize != 0 {
+						t.Errorf("Expected SkippedSize: 0, got: %d", status.SkippedSize)
+					}
+					if !bytes.Equal(data, buf.Bytes()) {
+						t.Error("Uploaded data differs")
+					}
+					return
+				}
+				if status.SkippedSize != 128 {
+					t.Errorf("Expected SkippedSize: 128, got: %d", status.SkippedSize)
+				}
+				if *out.ETag != tt.etag || *out.VersionID != "VERSION" {
+					t.Errorf("Unexpected output: %+v", out)
+				}
+				calls := len(api.PutObjectCalls()) + len(api.CreateMultipartUploadCalls()) + len(api.UploadPartCalls())
+				if calls != 0 {
+					t.Errorf("Upload API must not be called, but called %d times", calls)
+				}
+				if n := len(api.AbortMultipartUploadCalls()); n != 0 {
+					t.Errorf("AbortMultipartUpload must not be called, but called %d times", n)
+				}
+			})
+		}
+		t.Run("ETag", func(t *testing.T) {
+			for partSize, expected := range map[int64]string{
+				200: singleETag,
+				50:  multiETag,
+				64:  multiExactETag,
+			} {
+				u := &s3iot.Uploader{}
+				s3iot.WithUploadSlicer(
+					&s3iot.DefaultUploadSlicerFactory{PartSize: partSize},
+				).ApplyToUploader(u)
+				r := bytes.NewReader(data)
+				tag, err := u.ETag(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tag != expected {
+					t.Errorf("Part size %d: expected ETag %s, got %s", partSize, expected, tag)
+				}
+				if n, _ := r.Seek(0, io.SeekCurrent); n != 0 {
+					t.Errorf("Reader must be rewound, but at %d", n)
+				}
+			}
+		})
+		t.Run("ETagInBackground", func(t *testing.T) {
+			var buf bytes.Buffer
+			api := newUploadMockAPI(&buf, nil, nil)
+			api.HeadObjectFunc = func(ctx context.Context, input *s3api.HeadObjectInput) (*s3api.HeadObjectOutput, error) {
+				return nil, errNotFound
+			}
+			u := &s3iot.Uploader{}
+			s3iot.WithAPI(api).ApplyToUploader(u)
+			s3iot.WithUploadSlicer(
+				&s3iot.DefaultUploadSlicerFactory{PartSize: 50},
+			).ApplyToUploader(u)
+			s3iot.WithSkipUnchanged(true).ApplyToUploader(u)
+
+			body := &blockingReadSeeker{
+				ReadSeeker: bytes.NewReader(data),
+				ch:         make(chan struct{}),
+			}
+			returned := make(chan s3iot.UploadContext)
+			go func() {
+				uc, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+					Bucket: &bucket,
+					Key:    &key,
+					Body:   body,
+				})
+				if err != nil {
+					t.Error(err)
+				}
+				returned <- uc
+			}()
+			var uc s3iot.UploadContext
+			select {
+			case <-time.After(time.Second):
+				t.Fatal("Upload() must not be blocked by the ETag calculation")
+			case uc = <-returned:
+			}
+
+			// Calculation waits during pause.
+			uc.Pause()
+			close(body.ch)
+			select {
+			case <-time.After(50 * time.Millisecond):
+			case <-uc.Done():
+				t.Fatal("Upload should be paused")
+			}
+			if n := len(api.HeadObjectCalls()); n != 0 {
+				t.Fatalf("HeadObject must not be called during pause, but called %d times", n)
+			}
+
+			uc.Resume()
+			select {
+			case <-time.After(time.Second):
+				t.Fatal("Timeout")
+			case <-uc.Done():
+			}
+			if _, err := uc.Result(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, buf.Bytes()) {
+				t.Error("Uploaded data differs")
+			}
+		})
+		t.Run("ETagCanceled", func(t *testing.T) {
+			var buf bytes.Buffer
+			api := newUploadMockAPI(&buf, nil, nil)
+			u := &s3iot.Uploader{}
+			s3iot.WithAPI(api).ApplyToUploader(u)
+			s3iot.WithSkipUnchanged(true).ApplyToUploader(u)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			uc, err := u.Upload(ctx, &s3iot.UploadInput{
+				Bucket: &bucket,
+				Key:    &key,
+				Body:   bytes.NewReader(data),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-time.After(time.Second):
+				t.Fatal("Timeout")
+			case <-uc.Done():
+			}
+			if _, err := uc.Result(); !errors.Is(err, context.Canceled) {
+				t.Fatalf("Expected error: '%v', got: '%v'", context.Canceled, err)
+			}
+			if n := len(api.HeadObjectCalls()); n != 0 {
+				t.Errorf("HeadObject must not be called, but called %d times", n)
+			}
+		})
+		t.Run("UnsupportedAPI", func(t *testing.T) {
+			var buf bytes.Buffer
+			api := newUploadMockAPI(&buf, nil, nil)
+			u := &s3iot.Uploader{}
+			s3iot.WithAPI(struct{ s3api.UpDownloadAPI }{api}).ApplyToUploader(u)
+			s3iot.WithSkipUnchanged(true).ApplyToUploader(u)
+
+			_, err := u.Upload(context.TODO(), &s3iot.UploadInput{
+				Bucket: &bucket,
+				Key:    &key,
+				Body:   bytes.NewReader(data),
+			})
+			if err != s3iot.ErrUnsupportedAPI {
+				t.Fatalf("Expected error: '%v', got: '%v'", s3iot.ErrUnsupportedAPI, err)
+			}
+		})
+	})
 }
 
 func newUploadMockAPI(buf *bytes.Buffer, num map[string]int, ch map[string]chan interface{}) *mock_s3api.MockS3API {
@@ -980,6 +1393,20 @@ func newUploadMockAPI(buf *bytes.Buffer, num map[string]int, ch map[string]chan
 	}
 }
 
+// blockingReadSeeker blocks the first Read until ch is closed.
+type blockingReadSeeker struct {
+	io.ReadSeeker
+	ch   chan struct{}
+	once sync.Once
+}
+
+func (r *blockingReadSeeker) Read(b []byte) (int, error) {
+	r.once.Do(func() {
+		<-r.ch
+	})
+	return r.ReadSeeker.Read(b)
+}
+
 type seekErrorUploadSlicerFactory struct {
 	s3iot.DefaultUploadSlicerFactory
 	errs [][]error
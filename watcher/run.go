@@ -0,0 +1,364 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watcher
+
+import (
+	"context"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/at-wat/s3iot"
+)
+
+const eventBufferSize = 256
+
+type state int
+
+const (
+	statePending state = iota
+	stateQueued
+	stateUploading
+	stateUploaded
+	stateFailed
+)
+
+type entry struct {
+	File
+	// since is the time when the current size and modification time
+	// are observed first.
+	since   time.Time
+	state   state
+	retryAt time.Time
+	// key is the object key of the current version of the file.
+	// It's determined by the first upload attempt and reused on retries.
+	key string
+	// changed is set if the file is changed during the upload.
+	changed bool
+}
+
+type result struct {
+	file    File
+	key     string
+	removed bool
+	// paused is set if the upload is not started due to pause.
+	paused bool
+	err    error
+}
+
+// Run watches the directory and uploads the files until ctx is canceled.
+// Upload failures don't stop Run, and the ongoing uploads are canceled
+// when ctx is canceled.
+// Files uploaded without deletion or move are remembered only during Run
+// and uploaded again by the next Run.
+func (w *Watcher) Run(ctx context.Context) error {
+	if _, err := os.Stat(w.dir); err != nil {
+		return err
+	}
+	tick := w.pollInterval
+	if d := w.stableDuration / 2; d > 0 && d < tick {
+		tick = d
+	}
+	concurrency := w.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	events := make(chan string, eventBufferSize)
+	if w.notifier != nil {
+		go func() {
+			err := w.notifier.Watch(ctx, w.dir, func(p string) {
+				select {
+				case events <- p:
+				default:
+					// Overflowed events are caught up by the periodic scan.
+				}
+			})
+			if err != nil && ctx.Err() == nil {
+				w.error(err)
+			}
+		}()
+	}
+
+	entries := make(map[string]*entry)
+	results := make(chan result)
+	var queue []string
+	var active int
+
+	w.scan(entries)
+	lastScan := w.clock.Now()
+	var timer <-chan time.Time
+	for {
+		queue = append(queue, w.ready(entries)...)
+		for active < concurrency && len(queue) > 0 && !w.isPaused() {
+			rel := queue[0]
+			queue = queue[1:]
+			e, ok := entries[rel]
+			if !ok || e.state != stateQueued {
+				continue
+			}
+			e.state = stateUploading
+			active++
+			go func(f File, key string) {
+				results <- w.upload(ctx, f, key)
+			}(e.File, e.key)
+		}
+		if timer == nil {
+			timer = w.clock.After(tick)
+		}
+
+		select {
+		case <-ctx.Done():
+			for ; active > 0; active-- {
+				<-results
+			}
+			return ctx.Err()
+		case p := <-events:
+			rel, err := filepath.Rel(w.dir, p)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			if st, err := os.Stat(p); err == nil && st.IsDir() {
+				w.scan(entries)
+				continue
+			}
+			w.refresh(entries, filepath.ToSlash(rel))
+		case r := <-results:
+			active--
+			w.finish(entries, r)
+		case <-w.resumed:
+		case <-timer:
+			timer = nil
+			if now := w.clock.Now(); now.Sub(lastScan) >= w.pollInterval {
+				w.scan(entries)
+				lastScan = now
+			}
+		}
+	}
+}
+
+// scan walks the directory and updates the entries.
+// Entries of the removed files are deleted.
+func (w *Watcher) scan(entries map[string]*entry) {
+	now := w.clock.Now()
+	found := make(map[string]bool)
+	err := filepath.WalkDir(w.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p != w.dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(w.dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !w.filter(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		found[rel] = true
+		w.observe(entries, rel, info, now)
+		return nil
+	})
+	if err != nil {
+		w.error(err)
+		return
+	}
+	for rel, e := range entries {
+		if !found[rel] && (e.state == statePending || e.state == stateUploaded || e.state == stateFailed) {
+			delete(entries, rel)
+		}
+	}
+}
+
+// refresh updates the entry of the file.
+func (w *Watcher) refresh(entries map[string]*entry, rel string) {
+	if !w.filter(rel) {
+		return
+	}
+	info, err := os.Stat(filepath.Join(w.dir, filepath.FromSlash(rel)))
+	if err != nil || !info.Mode().IsRegular() {
+		if e, ok := entries[rel]; ok && e.state != stateUploading {
+			delete(entries, rel)
+		}
+		return
+	}
+	w.observe(entries, rel, info, w.clock.Now())
+}
+
+func (w *Watcher) observe(entries map[string]*entry, rel string, info fs.FileInfo, now time.Time) {
+	f := File{
+		Path:    filepath.Join(w.dir, filepath.FromSlash(rel)),
+		RelPath: rel,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	e, ok := entries[rel]
+	if !ok {
+		entries[rel] = &entry{File: f, since: now}
+		return
+	}
+	if e.Size == f.Size && e.ModTime.Equal(f.ModTime) {
+		return
+	}
+	if e.state == stateUploading {
+		e.changed = true
+		return
+	}
+	e.File = f
+	e.key = ""
+	e.since = now
+	e.state = statePending
+}
+
+// ready returns the paths of the files to be uploaded in the order of
+// the detection.
+func (w *Watcher) ready(entries map[string]*entry) []string {
+	now := w.clock.Now()
+	var rs []*entry
+	for _, e := range entries {
+		switch {
+		case e.state == statePending && now.Sub(e.since) >= w.stableDuration:
+		case e.state == stateFailed && !now.Before(e.retryAt):
+		default:
+			continue
+		}
+		rs = append(rs, e)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		if !rs[i].since.Equal(rs[j].since) {
+			return rs[i].since.Before(rs[j].since)
+		}
+		return rs[i].RelPath < rs[j].RelPath
+	})
+	var rels []string
+	for _, e := range rs {
+		// Check the latest state not to upload the file being written
+		// when the Notifier missed the change.
+		w.refresh(entries, e.RelPath)
+		if e2, ok := entries[e.RelPath]; ok && e2.state == e.state && e2.since.Equal(e.since) {
+			e2.state = stateQueued
+			rels = append(rels, e.RelPath)
+		}
+	}
+	return rels
+}
+
+func (w *Watcher) finish(entries map[string]*entry, r result) {
+	if w.onUpload != nil && !r.paused {
+		w.onUpload(r.file, r.key, r.err)
+	}
+	e, ok := entries[r.file.RelPath]
+	if !ok {
+		return
+	}
+	if !e.changed {
+		e.key = r.key
+	}
+	switch {
+	case r.removed:
+		delete(entries, r.file.RelPath)
+	case e.changed:
+		// Changed file is uploaded again after it becomes stable.
+		e.changed = false
+		e.state = statePending
+		e.Size = -1
+		w.refresh(entries, r.file.RelPath)
+	case r.paused:
+		// Queued again after resume.
+		e.state = statePending
+	case r.err != nil:
+		e.state = stateFailed
+		e.retryAt = w.clock.Now().Add(w.retryInterval)
+	default:
+		e.state = stateUploaded
+	}
+}
+
+// upload uploads the file and deletes or moves it if not changed.
+// Key is determined by KeyFunc if empty.
+func (w *Watcher) upload(ctx context.Context, f File, key string) result {
+	r := result{file: f, key: key}
+	if r.key == "" {
+		if r.key, r.err = w.key(f); r.err != nil {
+			return r
+		}
+	}
+	fh, err := os.Open(f.Path)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	defer fh.Close()
+
+	input := &s3iot.UploadInput{
+		Bucket: &w.bucket,
+		Key:    &r.key,
+		Body:   fh,
+	}
+	if typ := mime.TypeByExtension(filepath.Ext(f.Path)); typ != "" {
+		input.ContentType = &typ
+	}
+	uc, started, err := w.start(ctx, input)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	if !started {
+		r.paused = true
+		return r
+	}
+	<-uc.Done()
+	w.unregister(uc)
+	if _, r.err = uc.Result(); r.err != nil {
+		return r
+	}
+
+	if !w.remove && w.moveTo == "" {
+		return r
+	}
+	if st, err := os.Stat(f.Path); err != nil || st.Size() != f.Size || !st.ModTime().Equal(f.ModTime) {
+		return r
+	}
+	if w.remove {
+		err = os.Remove(f.Path)
+	} else {
+		dst := filepath.Join(w.moveTo, filepath.FromSlash(f.RelPath))
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+			err = os.Rename(f.Path, dst)
+		}
+	}
+	if err != nil {
+		w.error(err)
+		return r
+	}
+	r.removed = true
+	return r
+}
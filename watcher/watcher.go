@@ -0,0 +1,339 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package watcher uploads the files written to a local directory.
+//
+// Watcher detects the new and changed files by the periodic scan of
+// the directory and the optional Notifier like inotify, waits until each
+// file stops changing, and uploads it using s3iot.Uploader.
+// The file can be deleted or moved after the successful upload.
+//
+// Uploads failed after the retries of the Uploader are retried later,
+// and Watcher implements s3iot.SharedPauser to be paused during the outage,
+// for example by connectivity.Controller.
+//
+//	w := watcher.New(uploader, "/var/outbox", "bucket",
+//		watcher.WithNotifier(s3iotfsnotify.New()),
+//		watcher.WithKeyTemplate(keytemplate.MustParse("raw/dt={time:2006-01-02}/{uuid}{ext}")),
+//		watcher.WithDelete(true),
+//	)
+//	c.Add(w)
+//	err := w.Run(ctx)
+package watcher
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/keytemplate"
+)
+
+// Default Watcher parameters.
+const (
+	DefaultPollInterval   = 10 * time.Second
+	DefaultStableDuration = 5 * time.Second
+	DefaultRetryInterval  = time.Minute
+	DefaultConcurrency    = 1
+)
+
+// File represents the file to be uploaded.
+type File struct {
+	// Path is the path of the file.
+	Path string
+	// RelPath is the slash separated path relative to the watched directory.
+	RelPath string
+	Size    int64
+	ModTime time.Time
+}
+
+// KeyFunc returns the object key of the file.
+type KeyFunc func(File) (string, error)
+
+// Notifier notifies the changes of the files in the directory.
+type Notifier interface {
+	// Watch calls fn with the path of the created, written, renamed or
+	// removed file or directory under the directory until ctx is canceled.
+	// Subdirectories must be watched recursively.
+	// Watcher falls back to the periodic scan if Watch returned an error.
+	Watch(ctx context.Context, dir string, fn func(path string)) error
+}
+
+// Watcher uploads the files written to the directory.
+type Watcher struct {
+	uploader *s3iot.Uploader
+	dir      string
+	bucket   string
+
+	key            KeyFunc
+	notifier       Notifier
+	filter         func(relPath string) bool
+	pollInterval   time.Duration
+	stableDuration time.Duration
+	retryInterval  time.Duration
+	concurrency    int
+	remove         bool
+	moveTo         string
+	clock          s3iot.Clock
+	onUpload       func(f File, key string, err error)
+	onError        func(error)
+
+	mu       sync.Mutex
+	pausedBy map[interface{}]struct{}
+	active   map[s3iot.UploadContext]struct{}
+	resumed  chan struct{}
+}
+
+// Option configures Watcher.
+type Option func(*Watcher)
+
+// WithKeyFunc sets the function to determine the object key.
+// RelPath of the File is used as the key by default.
+func WithKeyFunc(fn KeyFunc) Option {
+	return func(w *Watcher) {
+		w.key = fn
+	}
+}
+
+// WithKeyTemplate sets the template of the object key.
+// Modification time and RelPath of the File are used as the time and
+// the path of the template.
+func WithKeyTemplate(t *keytemplate.Template) Option {
+	return func(w *Watcher) {
+		w.key = func(f File) (string, error) {
+			v := keytemplate.Values{
+				Time: f.ModTime,
+				Path: f.RelPath,
+			}
+			if t.NeedsBody() {
+				fh, err := os.Open(f.Path)
+				if err != nil {
+					return "", err
+				}
+				defer fh.Close()
+				v.Body = fh
+			}
+			return t.Execute(v)
+		}
+	}
+}
+
+// WithNotifier sets Notifier to detect the changes without waiting
+// the poll interval.
+// The directory is still scanned every poll interval to catch up with
+// the changes missed by the Notifier.
+func WithNotifier(n Notifier) Option {
+	return func(w *Watcher) {
+		w.notifier = n
+	}
+}
+
+// WithFilter sets the function to select the files to be uploaded by
+// the slash separated path relative to the directory.
+// Files and directories whose name start with dot are ignored by default
+// to avoid uploading temporary files.
+func WithFilter(fn func(relPath string) bool) Option {
+	return func(w *Watcher) {
+		w.filter = fn
+	}
+}
+
+// WithPollInterval sets the interval of the directory scan.
+func WithPollInterval(d time.Duration) Option {
+	return func(w *Watcher) {
+		w.pollInterval = d
+	}
+}
+
+// WithStableDuration sets the duration which the size and the
+// modification time of the file must be unchanged before the upload.
+func WithStableDuration(d time.Duration) Option {
+	return func(w *Watcher) {
+		w.stableDuration = d
+	}
+}
+
+// WithRetryInterval sets the interval to retry the failed upload.
+func WithRetryInterval(d time.Duration) Option {
+	return func(w *Watcher) {
+		w.retryInterval = d
+	}
+}
+
+// WithConcurrency sets the maximum number of the concurrent uploads.
+func WithConcurrency(n int) Option {
+	return func(w *Watcher) {
+		w.concurrency = n
+	}
+}
+
+// WithDelete enables to delete the file after the successful upload.
+// File changed during the upload is not deleted and uploaded again.
+func WithDelete(d bool) Option {
+	return func(w *Watcher) {
+		w.remove = d
+	}
+}
+
+// WithMoveTo enables to move the file to the directory after
+// the successful upload keeping the relative path.
+// The directory must be outside of the watched directory.
+func WithMoveTo(dir string) Option {
+	return func(w *Watcher) {
+		w.moveTo = dir
+	}
+}
+
+// WithClock sets Clock used to wait the intervals.
+func WithClock(clock s3iot.Clock) Option {
+	return func(w *Watcher) {
+		w.clock = clock
+	}
+}
+
+// WithOnUpload sets the callback called when the upload is finished.
+func WithOnUpload(fn func(f File, key string, err error)) Option {
+	return func(w *Watcher) {
+		w.onUpload = fn
+	}
+}
+
+// WithOnError sets the callback called on the errors of the directory
+// scan, the Notifier, and the deletion or the move of the uploaded file.
+// Callback may be called concurrently.
+func WithOnError(fn func(error)) Option {
+	return func(w *Watcher) {
+		w.onError = fn
+	}
+}
+
+// New creates Watcher uploading the files under the directory to
+// the bucket.
+// Files already in the directory are also uploaded.
+func New(u *s3iot.Uploader, dir, bucket string, opts ...Option) *Watcher {
+	w := &Watcher{
+		uploader:       u,
+		dir:            dir,
+		bucket:         bucket,
+		key:            func(f File) (string, error) { return f.RelPath, nil },
+		filter:         notHidden,
+		pollInterval:   DefaultPollInterval,
+		stableDuration: DefaultStableDuration,
+		retryInterval:  DefaultRetryInterval,
+		concurrency:    DefaultConcurrency,
+		clock:          s3iot.DefaultClock,
+		pausedBy:       make(map[interface{}]struct{}),
+		active:         make(map[s3iot.UploadContext]struct{}),
+		resumed:        make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+func notHidden(relPath string) bool {
+	for _, elem := range strings.Split(relPath, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// userPauseOwner is the owner of the pause requested by Pause, ForcePause
+// and Resume.
+type userPauseOwner struct{}
+
+// Pause pauses the ongoing uploads and stops starting new uploads.
+func (w *Watcher) Pause() {
+	w.PauseBy(userPauseOwner{}, false)
+}
+
+// ForcePause pauses the ongoing uploads canceling the API calls and
+// stops starting new uploads.
+func (w *Watcher) ForcePause() {
+	w.PauseBy(userPauseOwner{}, true)
+}
+
+// Resume resumes the uploads.
+func (w *Watcher) Resume() {
+	w.ResumeBy(userPauseOwner{})
+}
+
+// PauseBy implements s3iot.SharedPauser.
+// Uploads are paused while any of the owners pauses the Watcher.
+func (w *Watcher) PauseBy(owner interface{}, force bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pausedBy[owner] = struct{}{}
+	for uc := range w.active {
+		s3iot.PauseBy(uc, owner, force)
+	}
+}
+
+// ResumeBy implements s3iot.SharedPauser.
+func (w *Watcher) ResumeBy(owner interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.pausedBy, owner)
+	for uc := range w.active {
+		s3iot.ResumeBy(uc, owner)
+	}
+	if len(w.pausedBy) > 0 {
+		return
+	}
+	select {
+	case w.resumed <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Watcher) isPaused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pausedBy) > 0
+}
+
+// start starts the upload and adds it to be paused and resumed.
+// Upload is not started during pause.
+// Lock is held until the upload is added not to miss the pause.
+func (w *Watcher) start(ctx context.Context, input *s3iot.UploadInput) (s3iot.UploadContext, bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pausedBy) > 0 {
+		return nil, false, nil
+	}
+	uc, err := w.uploader.Upload(ctx, input)
+	if err != nil {
+		return nil, false, err
+	}
+	w.active[uc] = struct{}{}
+	return uc, true, nil
+}
+
+func (w *Watcher) unregister(uc s3iot.UploadContext) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.active, uc)
+}
+
+func (w *Watcher) error(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
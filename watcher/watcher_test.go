@@ -0,0 +1,393 @@
+// Copyright 2021 The s3iot authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/at-wat/s3iot"
+	"github.com/at-wat/s3iot/clocktest"
+	"github.com/at-wat/s3iot/keytemplate"
+	"github.com/at-wat/s3iot/s3fake"
+)
+
+const bucket = "bucket"
+
+var _ s3iot.SharedPauser = &Watcher{}
+
+type uploaded struct {
+	key string
+	err error
+}
+
+type testEnv struct {
+	api      *s3fake.API
+	clock    *clocktest.Clock
+	dir      string
+	uploaded chan uploaded
+	errs     chan error
+	w        *Watcher
+}
+
+func newTestEnv(t *testing.T, opts ...Option) *testEnv {
+	t.Helper()
+	te := &testEnv{
+		api:      s3fake.New(),
+		clock:    clocktest.New(time.Unix(1000, 0)),
+		dir:      t.TempDir(),
+		uploaded: make(chan uploaded, 16),
+		errs:     make(chan error, 16),
+	}
+	u := &s3iot.Uploader{}
+	s3iot.WithAPI(te.api).ApplyToUploader(u)
+	s3iot.WithRetryer(&s3iot.NoRetryerFactory{}).ApplyToUploader(u)
+	te.w = New(u, te.dir, bucket, append([]Option{
+		WithClock(te.clock),
+		WithPollInterval(time.Second),
+		WithStableDuration(2 * time.Second),
+		WithOnUpload(func(f File, key string, err error) {
+			te.uploaded <- uploaded{key: key, err: err}
+		}),
+		WithOnError(func(err error) {
+			te.errs <- err
+		}),
+	}, opts...)...)
+	return te
+}
+
+// run runs the Watcher and waits until the initial scan is done.
+func (te *testEnv) run(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- te.w.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Expected %v, got %v", context.Canceled, err)
+		}
+	})
+	te.clock.BlockUntil(1)
+}
+
+// advance advances the clock and waits until the Watcher processes it.
+func (te *testEnv) advance(d time.Duration) {
+	te.clock.Advance(d)
+	te.clock.BlockUntil(1)
+}
+
+func (te *testEnv) writeFile(t *testing.T, name, data string) {
+	t.Helper()
+	p := filepath.Join(te.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (te *testEnv) expectUploaded(t *testing.T, key string, expectErr bool) {
+	t.Helper()
+	select {
+	case u := <-te.uploaded:
+		if u.key != key || (u.err != nil) != expectErr {
+			t.Fatalf("Expected upload of %s (error: %v), got %s (%v)", key, expectErr, u.key, u.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout waiting upload of %s", key)
+	}
+}
+
+func (te *testEnv) expectNoUpload(t *testing.T) {
+	t.Helper()
+	select {
+	case u := <-te.uploaded:
+		t.Fatalf("Unexpected upload of %s (%v)", u.key, u.err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (te *testEnv) expectObject(t *testing.T, key, data string) {
+	t.Helper()
+	if b, ok := te.api.Object(bucket, key); !ok || string(b) != data {
+		t.Errorf("%s: expected %q, got %q", key, data, b)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	t.Run("Delete", func(t *testing.T) {
+		te := newTestEnv(t,
+			WithDelete(true),
+			WithKeyFunc(func(f File) (string, error) {
+				return "prefix/" + f.RelPath, nil
+			}),
+		)
+		te.writeFile(t, "a.txt", "a")
+		te.writeFile(t, "sub/b.txt", "b")
+		te.writeFile(t, ".a.txt.tmp", "tmp")
+		te.run(t)
+
+		te.advance(time.Second)
+		te.expectNoUpload(t)
+		te.advance(time.Second)
+		te.expectUploaded(t, "prefix/a.txt", false)
+		te.expectUploaded(t, "prefix/sub/b.txt", false)
+		te.expectObject(t, "prefix/a.txt", "a")
+		te.expectObject(t, "prefix/sub/b.txt", "b")
+
+		for _, name := range []string{"a.txt", "sub/b.txt"} {
+			if _, err := os.Stat(filepath.Join(te.dir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+				t.Errorf("%s must be deleted: %v", name, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(te.dir, ".a.txt.tmp")); err != nil {
+			t.Errorf("Hidden file must not be touched: %v", err)
+		}
+		te.advance(3 * time.Second)
+		te.expectNoUpload(t)
+	})
+	t.Run("KeyTemplate", func(t *testing.T) {
+		te := newTestEnv(t,
+			WithKeyTemplate(keytemplate.MustParse("raw/dt={time:2006-01-02}/{stem}-{sha256:8}{ext}")),
+		)
+		te.writeFile(t, "sub/a.txt", "data")
+		modTime := time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(filepath.Join(te.dir, "sub", "a.txt"), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		te.run(t)
+
+		te.advance(2 * time.Second)
+		te.expectUploaded(t, "raw/dt=2026-10-17/a-3a6eb079.txt", false)
+		te.expectObject(t, "raw/dt=2026-10-17/a-3a6eb079.txt", "data")
+	})
+	t.Run("WaitStable", func(t *testing.T) {
+		te := newTestEnv(t, WithDelete(true))
+		te.writeFile(t, "a.txt", "a")
+		te.run(t)
+
+		te.advance(time.Second)
+		te.writeFile(t, "a.txt", "aaa")
+		te.advance(time.Second)
+		te.expectNoUpload(t)
+		te.advance(time.Second)
+		te.expectNoUpload(t)
+		te.advance(time.Second)
+		te.expectUploaded(t, "a.txt", false)
+		te.expectObject(t, "a.txt", "aaa")
+	})
+	t.Run("Keep", func(t *testing.T) {
+		te := newTestEnv(t)
+		te.writeFile(t, "a.txt", "a")
+		te.run(t)
+
+		te.advance(2 * time.Second)
+		te.expectUploaded(t, "a.txt", false)
+		te.advance(3 * time.Second)
+		te.expectNoUpload(t)
+
+		// Rotated file is uploaded again.
+		te.writeFile(t, "a.txt", "a2")
+		te.advance(time.Second)
+		te.expectNoUpload(t)
+		te.advance(2 * time.Second)
+		te.expectUploaded(t, "a.txt", false)
+		te.expectObject(t, "a.txt", "a2")
+		if _, err := os.Stat(filepath.Join(te.dir, "a.txt")); err != nil {
+			t.Errorf("File must be kept: %v", err)
+		}
+	})
+	t.Run("MoveTo", func(t *testing.T) {
+		done := t.TempDir()
+		te := newTestEnv(t, WithMoveTo(done))
+		te.writeFile(t, "sub/a.txt", "a")
+		te.run(t)
+
+		te.advance(2 * time.Second)
+		te.expectUploaded(t, "sub/a.txt", false)
+		b, err := os.ReadFile(filepath.Join(done, "sub", "a.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "a" {
+			t.Errorf("Expected moved file content %q, got %q", "a", b)
+		}
+		if _, err := os.Stat(filepath.Join(te.dir, "sub", "a.txt")); !os.IsNotExist(err) {
+			t.Errorf("File must be moved: %v", err)
+		}
+	})
+	t.Run("Retry", func(t *testing.T) {
+		te := newTestEnv(t, WithDelete(true), WithRetryInterval(5*time.Second))
+		te.api.Inject(s3fake.Fault{
+			Op:    s3fake.OpPutObject,
+			Err:   errors.New("unreachable"),
+			Times: 1,
+		})
+		te.writeFile(t, "a.txt", "a")
+		te.run(t)
+
+		te.advance(2 * time.Second)
+		te.expectUploaded(t, "a.txt", true)
+		if _, err := os.Stat(filepath.Join(te.dir, "a.txt")); err != nil {
+			t.Fatalf("Failed file must be kept: %v", err)
+		}
+		te.advance(4 * time.Second)
+		te.expectNoUpload(t)
+		te.advance(time.Second)
+		te.expectUploaded(t, "a.txt", false)
+		te.expectObject(t, "a.txt", "a")
+	})
+	t.Run("RetryKey", func(t *testing.T) {
+		var n int
+		te := newTestEnv(t,
+			WithRetryInterval(5*time.Second),
+			WithKeyFunc(func(f File) (string, error) {
+				n++
+				return fmt.Sprintf("%s.%d", f.RelPath, n), nil
+			}),
+		)
+		te.api.Inject(s3fake.Fault{
+			Op:    s3fake.OpPutObject,
+			Err:   errors.New("unreachable"),
+			Times: 1,
+		})
+		te.writeFile(t, "a.txt", "a")
+		te.run(t)
+
+		te.advance(2 * time.Second)
+		te.expectUploaded(t, "a.txt.1", true)
+		te.advance(5 * time.Second)
+		te.expectUploaded(t, "a.txt.1", false)
+		te.expectObject(t, "a.txt.1", "a")
+
+		// Key is determined again for the new version.
+		te.writeFile(t, "a.txt", "ab")
+		te.advance(time.Second)
+		te.advance(2 * time.Second)
+		te.expectUploaded(t, "a.txt.2", false)
+		te.expectObject(t, "a.txt.2", "ab")
+	})
+	t.Run("Pause", func(t *testing.T) {
+		te := newTestEnv(t)
+		te.w.Pause()
+		te.writeFile(t, "a.txt", "a")
+		te.run(t)
+
+		te.advance(3 * time.Second)
+		te.expectNoUpload(t)
+		te.w.Resume()
+		te.expectUploaded(t, "a.txt", false)
+	})
+	t.Run("SharedPause", func(t *testing.T) {
+		te := newTestEnv(t)
+		type owner struct{}
+		te.w.PauseBy(owner{}, false)
+		te.w.Pause()
+		te.writeFile(t, "a.txt", "a")
+		te.run(t)
+
+		te.w.Resume()
+		te.advance(3 * time.Second)
+		te.expectNoUpload(t)
+		te.w.ResumeBy(owner{})
+		te.expectUploaded(t, "a.txt", false)
+	})
+	t.Run("PauseBeforeStart", func(t *testing.T) {
+		te := newTestEnv(t)
+		te.writeFile(t, "a.txt", "a")
+		te.w.Pause()
+
+		f := File{Path: filepath.Join(te.dir, "a.txt"), RelPath: "a.txt", Size: 1}
+		r := te.w.upload(context.Background(), f, "")
+		if !r.paused || r.err != nil {
+			t.Fatalf("Upload must not be started during pause: %+v", r)
+		}
+		if _, ok := te.api.Object(bucket, "a.txt"); ok {
+			t.Error("Object must not be uploaded during pause")
+		}
+		if r.key != "a.txt" {
+			t.Errorf("Expected key: a.txt, got: %s", r.key)
+		}
+	})
+	t.Run("Notifier", func(t *testing.T) {
+		n := &notifier{fn: make(chan func(string), 1)}
+		te := newTestEnv(t,
+			WithNotifier(n),
+			WithPollInterval(time.Hour),
+			WithStableDuration(0),
+		)
+		te.run(t)
+		notify := <-n.fn
+
+		te.writeFile(t, "a.txt", "a")
+		notify(filepath.Join(te.dir, "a.txt"))
+		te.expectUploaded(t, "a.txt", false)
+
+		te.writeFile(t, "sub/b.txt", "b")
+		notify(filepath.Join(te.dir, "sub"))
+		te.expectUploaded(t, "sub/b.txt", false)
+
+		notify(filepath.Dir(te.dir))
+		te.expectNoUpload(t)
+	})
+	t.Run("NotifierFallback", func(t *testing.T) {
+		errWatch := errors.New("inotify unavailable")
+		te := newTestEnv(t, WithNotifier(&notifier{err: errWatch}))
+		te.run(t)
+		select {
+		case err := <-te.errs:
+			if err != errWatch {
+				t.Fatalf("Expected %v, got %v", errWatch, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout")
+		}
+
+		te.writeFile(t, "a.txt", "a")
+		te.advance(time.Second)
+		te.advance(2 * time.Second)
+		te.expectUploaded(t, "a.txt", false)
+	})
+	t.Run("NoDirectory", func(t *testing.T) {
+		te := newTestEnv(t)
+		te.w.dir = filepath.Join(te.dir, "nonexistent")
+		if err := te.w.Run(context.TODO()); !os.IsNotExist(err) {
+			t.Errorf("Expected not exist error, got %v", err)
+		}
+	})
+}
+
+type notifier struct {
+	fn  chan func(string)
+	err error
+}
+
+func (n *notifier) Watch(ctx context.Context, dir string, fn func(string)) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.fn <- fn
+	<-ctx.Done()
+	return nil
+}
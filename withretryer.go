@@ -17,28 +17,43 @@ package s3iot
 import (
 	"context"
 	"errors"
-	"time"
 )
 
-func withRetry(ctx context.Context, id int64, retryer Retryer, errClassifier ErrorClassifier, fn func() error) error {
-	for {
-		err := fn()
+func withRetry(ctx context.Context, clock Clock, id int64, retryer Retryer, errClassifier ErrorClassifier, fn func() error) error {
+	return withRetryContext(ctx, clock, "", id, retryer, errClassifier, func(context.Context) error {
+		return fn()
+	})
+}
+
+// withRetryContext calls fn with the context carrying CallInfo of the attempt.
+func withRetryContext(ctx context.Context, clock Clock, api string, id int64, retryer Retryer, errClassifier ErrorClassifier, fn func(context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		callCtx := context.WithValue(ctx, callInfoKey{}, CallInfo{API: api, ID: id, Attempt: attempt})
+		err := fn(callCtx)
 		if err != nil {
 			if fe, fatal := err.(*fatalError); fatal {
 				return fe.error
 			}
+			if err == ErrForcePaused && ctx.Err() == nil {
+				// Canceled by ForcePause.
+				// Retried after resume without consuming the retry count.
+				continue
+			}
 			var re *retryableError
 			if !errClassifier.IsRetryable(err) && !errors.As(err, &re) {
 				return err
 			}
-			if wait, ok := errClassifier.IsThrottle(err); ok {
+			if wait, ok := IsThrottleAt(errClassifier, err, clock.Now()); ok {
+				if to, ok := retryer.(ThrottleObserver); ok {
+					to.OnThrottle(id, wait)
+				}
 				select {
-				case <-time.After(wait):
+				case <-clock.After(wait):
 				case <-ctx.Done():
 					return ctx.Err()
 				}
 			}
-			if ctx.Err() == nil && retryer.OnFail(ctx, id, err) {
+			if ctx.Err() == nil && retryer.OnFail(callCtx, id, err) {
 				continue
 			}
 			if ctx.Err() == err {
@@ -19,6 +19,8 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/at-wat/s3iot/clocktest"
 )
 
 func TestWithRetry(t *testing.T) {
@@ -30,7 +32,7 @@ func TestWithRetry(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		r := f.New(nil)
 		var i int
-		err := withRetry(context.TODO(), 0, r, &NaiveErrorClassifier{}, func() error {
+		err := withRetry(context.TODO(), DefaultClock, 0, r, &NaiveErrorClassifier{}, func() error {
 			defer func() {
 				i++
 			}()
@@ -52,7 +54,7 @@ func TestWithRetry(t *testing.T) {
 	t.Run("SuccessAfterRetry", func(t *testing.T) {
 		r := f.New(nil)
 		var i int
-		err := withRetry(context.TODO(), 0, r, &NaiveErrorClassifier{}, func() error {
+		err := withRetry(context.TODO(), DefaultClock, 0, r, &NaiveErrorClassifier{}, func() error {
 			defer func() {
 				i++
 			}()
@@ -76,7 +78,7 @@ func TestWithRetry(t *testing.T) {
 	t.Run("Failure", func(t *testing.T) {
 		r := f.New(nil)
 		var i int
-		err := withRetry(context.TODO(), 0, r, &NaiveErrorClassifier{}, func() error {
+		err := withRetry(context.TODO(), DefaultClock, 0, r, &NaiveErrorClassifier{}, func() error {
 			defer func() {
 				i++
 			}()
@@ -95,6 +97,24 @@ func TestWithRetry(t *testing.T) {
 			t.Errorf("Expected retry count: 2, actual: %d", i)
 		}
 	})
+	t.Run("ForcePaused", func(t *testing.T) {
+		var i int
+		err := withRetry(context.TODO(), DefaultClock, 0, &noRetryer{}, &NaiveErrorClassifier{}, func() error {
+			defer func() {
+				i++
+			}()
+			if i < 3 {
+				return ErrForcePaused
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Force paused call must be retried without Retryer, got: %v", err)
+		}
+		if i != 4 {
+			t.Errorf("Expected call count: 4, actual: %d", i)
+		}
+	})
 	t.Run("WithErrorClassifier", func(t *testing.T) {
 		errRetryable := errors.New("retryable")
 		errNotRetryable := errors.New("non retryable")
@@ -105,7 +125,7 @@ func TestWithRetry(t *testing.T) {
 		t.Run("Retryable", func(t *testing.T) {
 			r := f.New(nil)
 			var i int
-			err := withRetry(context.TODO(), 0, r, ec, func() error {
+			err := withRetry(context.TODO(), DefaultClock, 0, r, ec, func() error {
 				defer func() {
 					i++
 				}()
@@ -127,7 +147,7 @@ func TestWithRetry(t *testing.T) {
 		t.Run("NotRetryable", func(t *testing.T) {
 			r := f.New(nil)
 			var i int
-			err := withRetry(context.TODO(), 0, r, ec, func() error {
+			err := withRetry(context.TODO(), DefaultClock, 0, r, ec, func() error {
 				defer func() {
 					i++
 				}()
@@ -146,6 +166,77 @@ func TestWithRetry(t *testing.T) {
 				t.Errorf("Expected retry count: 2, actual: %d", i)
 			}
 		})
+		t.Run("ThrottleClock", func(t *testing.T) {
+			ec := &dummyErrorClassifier{
+				retryable:    errRetryable,
+				throttleWait: time.Minute,
+			}
+			r := (&NoRetryerFactory{}).New(nil)
+			clock := clocktest.New(time.Now())
+
+			done := make(chan error)
+			go func() {
+				done <- withRetry(context.TODO(), clock, 0, r, ec, func() error {
+					return errRetryable
+				})
+			}()
+			clock.BlockUntil(1)
+			if wait, _ := clock.Next(); wait != time.Minute {
+				t.Errorf("Expected throttle wait: %v, actual: %v", time.Minute, wait)
+			}
+			select {
+			case <-done:
+				t.Fatal("withRetry must wait until the clock advances")
+			case <-time.After(10 * time.Millisecond):
+			}
+			clock.Advance(time.Minute)
+			if err := <-done; !errors.Is(err, errRetryable) {
+				t.Errorf("Expected error: %v, got: %v", errRetryable, err)
+			}
+		})
+		t.Run("ThrottleAtClock", func(t *testing.T) {
+			now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+			ec := &throttleAtErrorClassifier{
+				dummyErrorClassifier: dummyErrorClassifier{retryable: errRetryable},
+				until:                now.Add(time.Minute),
+			}
+			r := (&NoRetryerFactory{}).New(nil)
+			clock := clocktest.New(now)
+
+			done := make(chan error)
+			go func() {
+				done <- withRetry(context.TODO(), clock, 0, r, ec, func() error {
+					return errRetryable
+				})
+			}()
+			clock.BlockUntil(1)
+			if wait, _ := clock.Next(); wait != time.Minute {
+				t.Errorf("Expected throttle wait: %v, actual: %v", time.Minute, wait)
+			}
+			clock.Advance(time.Minute)
+			<-done
+		})
+		t.Run("ThrottleObserver", func(t *testing.T) {
+			ec := &dummyErrorClassifier{
+				retryable:    errRetryable,
+				throttleWait: time.Minute,
+			}
+			r := &throttleObserverRetryer{}
+			clock := clocktest.New(time.Now())
+
+			done := make(chan error)
+			go func() {
+				done <- withRetry(context.TODO(), clock, 3, r, ec, func() error {
+					return errRetryable
+				})
+			}()
+			clock.BlockUntil(1)
+			clock.Advance(time.Minute)
+			<-done
+			if len(r.throttles) != 1 || r.throttles[0] != (throttle{3, time.Minute}) {
+				t.Errorf("Expected OnThrottle(3, %v), got: %v", time.Minute, r.throttles)
+			}
+		})
 		t.Run("CancelDuringThrottle", func(t *testing.T) {
 			ec := &dummyErrorClassifier{
 				retryable:    errRetryable,
@@ -163,7 +254,7 @@ func TestWithRetry(t *testing.T) {
 				}
 			}()
 
-			err := withRetry(ctx, 0, r, ec, func() error {
+			err := withRetry(ctx, DefaultClock, 0, r, ec, func() error {
 				return errRetryable
 			})
 			if err != context.DeadlineExceeded {
@@ -191,3 +282,29 @@ func (ec dummyErrorClassifier) IsThrottle(err error) (time.Duration, bool) {
 	}
 	return 0, false
 }
+
+type throttleAtErrorClassifier struct {
+	dummyErrorClassifier
+	until time.Time
+}
+
+func (ec *throttleAtErrorClassifier) IsThrottleAt(err error, now time.Time) (time.Duration, bool) {
+	if err == ec.retryable {
+		return ec.until.Sub(now), true
+	}
+	return 0, false
+}
+
+type throttle struct {
+	id   int64
+	wait time.Duration
+}
+
+type throttleObserverRetryer struct {
+	noRetryer
+	throttles []throttle
+}
+
+func (r *throttleObserverRetryer) OnThrottle(id int64, wait time.Duration) {
+	r.throttles = append(r.throttles, throttle{id, wait})
+}